@@ -1,50 +1,172 @@
 package main
 
 import (
+	"On-Premise/pkg/awsconfig"
 	"On-Premise/pkg/config"
+	filecache "On-Premise/pkg/file_cache"
 	objstorage "On-Premise/pkg/obj_storage"
 	"On-Premise/pkg/queue"
+	retrypolicy "On-Premise/pkg/retry_policy"
+	retrystore "On-Premise/pkg/retry_store"
 	"On-Premise/pkg/types"
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"On-Premise/pkg/service"
 )
 
-func setUpService(config types.Config) {
+// options groups the command line values that select the implementations to be used
+type options struct {
+	mode          string
+	localAddress  string
+	objStorageDir string
+	retryStore    string
+	cacheDir      string
+	cacheSize     int64
+	awsConfig     awsconfig.Config
+}
+
+// newObjStorage returns the ObjStorage implementation to be used.
+// Files are downloaded from the presigned URL of the messages when they have one, so S3 credentials are only needed
+// for messages without it. Otherwise a directory is used if objStorageDir is set, and files are read from S3
+// or the local backend depending on the mode
+func newObjStorage(opts options) objstorage.ObjStorage {
+	if opts.objStorageDir != "" {
+		return objstorage.NewObjStorageHTTP(objstorage.NewObjStorageFileSystem(opts.objStorageDir))
+	}
+	if opts.mode == "local" {
+		return objstorage.NewObjStorageHTTP(objstorage.NewObjStorageLocal(opts.localAddress))
+	}
+	return objstorage.NewObjStorageHTTP(objstorage.NewObjStorageS3(opts.awsConfig))
+}
+
+func newDeadLetterQueue(opts options) queue.DeadLetterQueue {
+	if opts.mode == "local" {
+		return queue.NewDeadLetterQueueLocal(opts.localAddress)
+	}
+	return queue.NewDeadLetterQueueSQS(opts.awsConfig)
+}
+
+func setUpService(ctx context.Context, config types.Config, opts options) {
 	fmt.Println("Setting up...")
-	messageQueue := queue.NewQueueSQS()
-	objStorage := objstorage.NewObjStorageS3()
-	DLQ := queue.NewDeadLetterQueueSQS()
-	service := service.NewService(messageQueue, objStorage, DLQ, config)
+
+	var messageQueue queue.Queue
+	if opts.mode == "local" {
+		messageQueue = queue.NewQueueLocal(opts.localAddress)
+	} else {
+		messageQueue = queue.NewQueueSQS(opts.awsConfig)
+	}
+	files := filecache.NewFileCache(opts.cacheDir, opts.cacheSize, newObjStorage(opts))
+	DLQ := newDeadLetterQueue(opts)
+	retries := retrystore.NewRetryStoreSQLite(opts.retryStore)
+
+	service := service.NewService(messageQueue, files, DLQ, retries, config)
 	fmt.Println("Running correctly")
-	service.Run()
+	service.Run(ctx)
+
+	err := retries.Close()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
 }
 
-func setUpDeadLetterQueueService() {
+func setUpDeadLetterQueueService(ctx context.Context, opts options) {
 	fmt.Println("Setting up...")
-	DLQ := queue.NewDeadLetterQueueSQS()
+	DLQ := newDeadLetterQueue(opts)
 	service := service.NewDLQService(DLQ)
 	fmt.Println("Running correctly")
+	service.Run(ctx)
+}
+
+func setUpRetryStoreService(opts options) {
+	retries := retrystore.NewRetryStoreSQLite(opts.retryStore)
+	service := service.NewRetryStoreService(retries)
 	service.Run()
 }
 
 func main() {
 
 	numberRetries := flag.Int("r", config.NumberOfRetries, "The maximum number of retries when processing a message")
-	secsBetweenRetries := flag.Int("s", config.InitialTimeBetweenRetries, "Time in seconds before the first retry (will double for successive retries)")
+	secsBetweenRetries := flag.Int("s", config.InitialTimeBetweenRetries, "Initial delay in seconds of the default retry policy, doubled on every retry up to -max-delay and randomized with full jitter unless -jitter=false. Message types can override it in the -retry-policies file")
+	maxSecsBetweenRetries := flag.Int("max-delay", config.MaxTimeBetweenRetries, "Maximum time in seconds between two retries, 0 for no limit")
+	retryDeadline := flag.Duration("deadline", 0, "Time since a message is received after which it is no longer retried (e.g. 2h), 0 for no limit")
+	jitter := flag.Bool("jitter", true, "If set, the time before every retry is chosen randomly up to its exponential backoff value")
+	retryPoliciesFile := flag.String("retry-policies", "", "JSON file with the default retry policy and overrides by message type, applied over the retry flags")
+	numberWorkers := flag.Int("w", config.NumberOfWorkers, "The maximum number of messages processed at the same time (messages for the same device are always processed in order)")
+	breakerThreshold := flag.Int("breaker-threshold", config.CircuitBreakerThreshold, "Consecutive failures connecting to a device after which its messages are parked, 0 to disable")
+	breakerProbeInterval := flag.Int("breaker-probe", config.CircuitBreakerProbeInterval, "Time in seconds between attempts to reach a device whose messages are parked")
+	shutdownTimeout := flag.Int("shutdown-timeout", config.ShutdownTimeout, "Time in seconds to wait for the messages being processed when stopping, before cancelling them")
+	visibilityTimeout := flag.Int("v", config.VisibilityTimeout, "Time in seconds a received message stays hidden from other consumers, extended while it is being processed")
 	dlq := flag.Bool("dlq", false, "If set, reads, shows and deletes messages from the Dead Letter Queue")
+	mode := flag.String("mode", "aws", "Where to read messages and files from: 'aws' for SQS and S3 or 'local' for a backend running with -mode=local")
+	localAddress := flag.String("local-addr", "127.0.0.1:12346", "Address of the backend running with -mode=local, use unix:<path> for a unix socket")
+	objStorageDir := flag.String("objstorage-dir", "", "If set, job files are read from this directory (e.g. a shared volume) instead of S3")
+	retryStore := flag.String("retry-store", config.RetryStorePath, "SQLite database file where messages waiting to be retried are saved")
+	cacheDir := flag.String("cache-dir", config.FileCacheDir, "Directory where downloaded job files are cached")
+	cacheSize := flag.Int64("cache-size", config.FileCacheSize, "Maximum size in megabytes of the cached job files")
+	showRetries := flag.Bool("retries", false, "If set, shows the messages waiting to be retried in the retry store and exits")
 
 	flag.Parse()
 
+	if *mode != "aws" && *mode != "local" {
+		fmt.Printf("Invalid mode %v\n", *mode)
+		os.Exit(1)
+	}
+
+	opts := options{
+		mode:          *mode,
+		localAddress:  *localAddress,
+		objStorageDir: *objStorageDir,
+		retryStore:    *retryStore,
+		cacheDir:      *cacheDir,
+		cacheSize:     *cacheSize * 1024 * 1024,
+		awsConfig:     awsconfig.FromEnv(),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *showRetries {
+		setUpRetryStoreService(opts)
+	}
+
 	if *dlq {
-		setUpDeadLetterQueueService()
+		setUpDeadLetterQueueService(ctx, opts)
+	}
+
+	retryPolicies := retrypolicy.Policies{
+		Default: retrypolicy.Policy{
+			MaxAttempts:  *numberRetries,
+			InitialDelay: time.Duration(*secsBetweenRetries) * time.Second,
+			MaxDelay:     time.Duration(*maxSecsBetweenRetries) * time.Second,
+			Deadline:     *retryDeadline,
+			Jitter:       *jitter,
+		},
+	}
+
+	if *retryPoliciesFile != "" {
+		var err error
+		retryPolicies, err = retrypolicy.LoadFile(*retryPoliciesFile, retryPolicies)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	config := types.Config{
-		NumberOfRetries:           *numberRetries,
-		InitialTimeBetweenRetries: *secsBetweenRetries,
+		RetryPolicies:               retryPolicies,
+		NumberOfWorkers:             *numberWorkers,
+		VisibilityTimeout:           *visibilityTimeout,
+		CircuitBreakerThreshold:     *breakerThreshold,
+		CircuitBreakerProbeInterval: *breakerProbeInterval,
+		ShutdownTimeout:             *shutdownTimeout,
+		BackendAPIKey:               os.Getenv("BACKEND_API_KEY"),
 	}
 
-	setUpService(config)
+	setUpService(ctx, config, opts)
 }
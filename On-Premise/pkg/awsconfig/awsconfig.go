@@ -0,0 +1,139 @@
+package awsconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+const (
+	// DefaultRegion is the region used when AWS_REGION is not present
+	DefaultRegion = "eu-west-3"
+	// DefaultQueueName is the name of the messages queue used when SQS_QUEUE_NAME is not present
+	DefaultQueueName = "messages.fifo"
+	// DefaultDeadLetterQueueName is the name of the dead letter queue used when SQS_DLQ_NAME is not present
+	DefaultDeadLetterQueueName = "dlq.fifo"
+	// DefaultBucketName is the name of the bucket used when S3_BUCKET_NAME is not present
+	DefaultBucketName = "sergiotfgbucket"
+)
+
+// Config struct represents the configurable values shared by every AWS client used by the On-Premise agent.
+// It allows pointing the clients to other regions or to S3 and SQS compatible services
+// such as MinIO, ElasticMQ or LocalStack
+type Config struct {
+	Region string
+
+	// EndpointURL is used for every service unless a service specific one is set
+	EndpointURL    string
+	S3EndpointURL  string
+	SQSEndpointURL string
+
+	// UsePathStyle makes S3 clients use path style addressing (endpoint/bucket/key), needed by most S3 compatible services
+	UsePathStyle bool
+
+	// CredentialsSource is one of "default" (SDK default chain), "static" (AccessKeyID, SecretAccessKey and SessionToken),
+	// "profile" (Profile from the shared configuration files) or "anonymous"
+	CredentialsSource string
+	AccessKeyID       string
+	SecretAccessKey   string
+	SessionToken      string
+	Profile           string
+
+	QueueName           string
+	DeadLetterQueueName string
+	BucketName          string
+}
+
+// FromEnv returns a Config whose values are read from the following environment variables:
+// AWS_REGION, AWS_ENDPOINT_URL, AWS_ENDPOINT_URL_S3, AWS_ENDPOINT_URL_SQS, AWS_S3_USE_PATH_STYLE,
+// AWS_CREDENTIALS_SOURCE, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_PROFILE,
+// SQS_QUEUE_NAME, SQS_DLQ_NAME and S3_BUCKET_NAME
+func FromEnv() Config {
+	usePathStyle, _ := strconv.ParseBool(os.Getenv("AWS_S3_USE_PATH_STYLE"))
+
+	return Config{
+		Region:              getEnv("AWS_REGION", DefaultRegion),
+		EndpointURL:         os.Getenv("AWS_ENDPOINT_URL"),
+		S3EndpointURL:       os.Getenv("AWS_ENDPOINT_URL_S3"),
+		SQSEndpointURL:      os.Getenv("AWS_ENDPOINT_URL_SQS"),
+		UsePathStyle:        usePathStyle,
+		CredentialsSource:   getEnv("AWS_CREDENTIALS_SOURCE", "default"),
+		AccessKeyID:         os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey:     os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:        os.Getenv("AWS_SESSION_TOKEN"),
+		Profile:             os.Getenv("AWS_PROFILE"),
+		QueueName:           getEnv("SQS_QUEUE_NAME", DefaultQueueName),
+		DeadLetterQueueName: getEnv("SQS_DLQ_NAME", DefaultDeadLetterQueueName),
+		BucketName:          getEnv("S3_BUCKET_NAME", DefaultBucketName),
+	}
+}
+
+func getEnv(key string, defaultValue string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Load returns the aws.Config to be used to create the clients of every AWS service
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (c Config) Load(ctx context.Context) (aws.Config, error) {
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(c.Region),
+	}
+
+	switch c.CredentialsSource {
+	case "", "default":
+	case "static":
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return aws.Config{}, fmt.Errorf("static credentials need both access key ID and secret access key")
+		}
+		options = append(options, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)))
+	case "profile":
+		options = append(options, config.WithSharedConfigProfile(c.Profile))
+	case "anonymous":
+		options = append(options, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	default:
+		return aws.Config{}, fmt.Errorf("invalid credentials source: %v", c.CredentialsSource)
+	}
+
+	if c.EndpointURL != "" || c.S3EndpointURL != "" || c.SQSEndpointURL != "" {
+		options = append(options, config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(c.resolveEndpoint)))
+	}
+
+	return config.LoadDefaultConfig(ctx, options...)
+}
+
+// resolveEndpoint returns the custom endpoint configured for the service, falling back to
+// the default AWS endpoint resolution if there is none
+func (c Config) resolveEndpoint(service, region string, options ...interface{}) (aws.Endpoint, error) {
+	url := c.EndpointURL
+
+	switch service {
+	case "S3":
+		if c.S3EndpointURL != "" {
+			url = c.S3EndpointURL
+		}
+	case "SQS":
+		if c.SQSEndpointURL != "" {
+			url = c.SQSEndpointURL
+		}
+	}
+
+	if url == "" {
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	}
+
+	return aws.Endpoint{
+		URL:               url,
+		SigningRegion:     region,
+		HostnameImmutable: true,
+	}, nil
+}
@@ -7,3 +7,38 @@ const NumberOfRetries = 5
 // InitialTimeBetweenRetries refers to the number of seconds of waiting time
 // before the first retry in case of failure while delivering a message
 const InitialTimeBetweenRetries = 15
+
+// MaxTimeBetweenRetries refers to the maximum number of seconds of waiting time between two retries
+const MaxTimeBetweenRetries = 600
+
+// NumberOfWorkers refers to the number of messages that will be processed at the same time.
+// Messages for the same device are always processed one after another, in the order they were received
+const NumberOfWorkers = 4
+
+// CircuitBreakerThreshold refers to the number of consecutive failures connecting to a device after which
+// its messages are parked instead of being attempted
+const CircuitBreakerThreshold = 3
+
+// CircuitBreakerProbeInterval refers to the number of seconds between the attempts made to check
+// whether an unreachable device is available again
+const CircuitBreakerProbeInterval = 30
+
+// VisibilityTimeout refers to the number of seconds a received message stays hidden from other consumers.
+// It is extended while the message is being processed, so that it is only received again if the service stops
+const VisibilityTimeout = 60
+
+// ShutdownTimeout refers to the number of seconds the service waits for the messages being processed
+// to finish when it is asked to stop, before cancelling them
+const ShutdownTimeout = 30
+
+// RetryStorePath refers to the SQLite database file where the messages waiting to be retried are saved,
+// so that they are resumed if the agent is restarted
+const RetryStorePath = "onPremiseRetries.db"
+
+// FileCacheDir refers to the directory where downloaded job files are cached, so that they are not downloaded again
+// for every retry or for every message referencing the same file
+const FileCacheDir = "onPremiseFiles/cache"
+
+// FileCacheSize refers to the maximum number of megabytes used by the cached job files.
+// Least recently used files are removed when it is exceeded
+const FileCacheSize = 2048
@@ -0,0 +1,464 @@
+package filecache
+
+import (
+	objstorage "On-Premise/pkg/obj_storage"
+	"On-Premise/pkg/types"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is just a reference to type Message in package types so that the usage is shorter
+type Message = types.Message
+
+// metadataExtension is the extension of the sidecar files saved next to every cached file
+const metadataExtension = ".json"
+
+// metadata represents the information saved in the sidecar of every cached file,
+// used to verify it and to rebuild the cache when the agent is restarted
+type metadata struct {
+	S3Name string
+	ETag   string
+	SHA256 string
+	Size   int64
+}
+
+// ErrChecksumMismatch is returned when a downloaded file does not match the checksum of the message referencing it
+var ErrChecksumMismatch = errors.New("the downloaded file does not match its checksum")
+
+// entry represents a cached file. pins is the number of File structs using it, which cannot be evicted,
+// and verified is set once the file has been checked against the SHA-256 of its metadata
+type entry struct {
+	key      string
+	metadata metadata
+	element  *list.Element
+	pins     int
+	removed  bool
+	verified bool
+}
+
+// download represents a file being downloaded, done is closed once it finishes
+type download struct {
+	done chan struct{}
+}
+
+// Cache defines the struct used to keep downloaded files in a local directory, so that they are downloaded only once
+// for all the retries of a message and for all the messages referencing the same file.
+// Files are addressed by their name and ETag, so a new version of a file is downloaded again, and they are evicted
+// in least recently used order when the size of the cache is over its maximum. It is safe for concurrent use
+type Cache struct {
+	dir        string
+	maxSize    int64
+	objStorage objstorage.ObjStorage
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lru       *list.List
+	size      int64
+	downloads map[string]*download
+}
+
+// File is a cached file opened for reading. It must be closed so that it can be evicted from the cache
+type File struct {
+	*os.File
+	sha256  string
+	release func()
+}
+
+// SHA256 returns the hex encoded checksum of the file, verified when it was downloaded or first opened
+func (f *File) SHA256() string {
+	return f.sha256
+}
+
+// Close closes the file and allows the cache to evict it
+func (f *File) Close() error {
+	err := f.File.Close()
+	f.release()
+	return err
+}
+
+// NewFileCache creates and returns the reference to a new Cache struct keeping up to maxSize bytes in the received directory,
+// which is created if it does not exist, and downloading the files from the received ObjStorage.
+// Files cached by a previous execution are kept
+func NewFileCache(dir string, maxSize int64, objStorage objstorage.ObjStorage) *Cache {
+	cache := &Cache{
+		dir:        dir,
+		maxSize:    maxSize,
+		objStorage: objStorage,
+		entries:    make(map[string]*entry),
+		lru:        list.New(),
+		downloads:  make(map[string]*download),
+	}
+	cache.initialize()
+	return cache
+}
+
+func (cache *Cache) initialize() {
+	if cache.maxSize <= 0 {
+		panic(fmt.Sprintf("Configuration error in file cache: invalid maximum size %v", cache.maxSize))
+	}
+
+	err := os.MkdirAll(cache.dir, 0755)
+	if err != nil {
+		panic(fmt.Sprintf("Configuration error in file cache: %v", err))
+	}
+
+	files, err := os.ReadDir(cache.dir)
+	if err != nil {
+		panic(fmt.Sprintf("Configuration error in file cache: %v", err))
+	}
+
+	type cachedFile struct {
+		key      string
+		metadata metadata
+		used     time.Time
+	}
+	var cached []cachedFile
+
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(cache.dir, name)
+
+		// leftovers of downloads interrupted by a previous execution
+		if strings.HasPrefix(name, ".download-") {
+			os.Remove(path)
+			continue
+		}
+
+		if !strings.HasSuffix(name, metadataExtension) {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, metadataExtension)
+		data, err := os.ReadFile(path)
+		var m metadata
+		if err == nil {
+			err = json.Unmarshal(data, &m)
+		}
+		info, statErr := os.Stat(filepath.Join(cache.dir, key))
+		if err != nil || statErr != nil || info.Size() != m.Size {
+			cache.removeFiles(key)
+			continue
+		}
+
+		cached = append(cached, cachedFile{key: key, metadata: m, used: info.ModTime()})
+	}
+
+	// the modification time of cached files is updated every time they are used
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].used.After(cached[j].used)
+	})
+
+	for _, file := range cached {
+		cache.add(file.key, file.metadata)
+	}
+	cache.evict()
+}
+
+// Open returns the cached file with name specified in received message, downloading it if it is not cached
+// or the cached version is not the current one. Downloaded files are verified against the SHA-256 of the message
+// and files cached by a previous execution are verified the first time they are opened, both are only hashed once.
+// Cached files that are corrupted or do not match the checksum of the message are discarded and downloaded again
+// Returns ErrChecksumMismatch if the downloaded file does not match the checksum of the message,
+// and a non-nil error if there's another one during the execution and nil otherwise
+func (cache *Cache) Open(ctx context.Context, msg Message) (*File, error) {
+	info, err := cache.objStorage.Stat(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(msg.S3Name, info.ETag)
+
+	for {
+		cache.mu.Lock()
+
+		if e, ok := cache.entries[key]; ok {
+			e.pins++
+			cache.lru.MoveToFront(e.element)
+			cache.mu.Unlock()
+
+			file, err := cache.openEntry(e)
+			if err == nil && msg.SHA256 != "" && !strings.EqualFold(msg.SHA256, file.sha256) {
+				file.File.Close()
+				err = fmt.Errorf("checksum %v does not match the expected %v", file.sha256, msg.SHA256)
+			}
+			if err == nil {
+				return file, nil
+			}
+
+			fmt.Printf("Discarding cached file %v: %v\n", msg.S3Name, err)
+			cache.mu.Lock()
+			e.pins--
+			cache.remove(e)
+			cache.release(e)
+			cache.mu.Unlock()
+			continue
+		}
+
+		// only one download is made at a time for every file, messages referencing it wait for that one
+		if d, ok := cache.downloads[key]; ok {
+			cache.mu.Unlock()
+			select {
+			case <-d.done:
+				continue
+			case <-ctx.Done():
+				return nil, fmt.Errorf("error while waiting for the file to be downloaded: %w", ctx.Err())
+			}
+		}
+
+		d := &download{done: make(chan struct{})}
+		cache.downloads[key] = d
+		cache.mu.Unlock()
+
+		e, err := cache.download(ctx, msg, key, info)
+
+		cache.mu.Lock()
+		delete(cache.downloads, key)
+		close(d.done)
+		cache.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := cache.openEntry(e)
+		if err != nil {
+			cache.mu.Lock()
+			e.pins--
+			cache.remove(e)
+			cache.release(e)
+			cache.mu.Unlock()
+			return nil, fmt.Errorf("error while opening the downloaded file: %w", err)
+		}
+
+		return file, nil
+	}
+}
+
+// download downloads the file with name specified in received message and adds it to the cache,
+// returning its entry pinned so that it is not evicted before being opened.
+// The file is verified against the checksum of the ObjStorage, if it knows it, and against the one of the message
+// Returns ErrChecksumMismatch if the file does not match the checksum of the message,
+// and a non-nil error if there's another one during the execution and nil otherwise
+func (cache *Cache) download(ctx context.Context, msg Message, key string, info objstorage.ObjectInfo) (*entry, error) {
+	fd, err := os.CreateTemp(cache.dir, ".download-")
+	if err != nil {
+		return nil, fmt.Errorf("error while creating the file: %w", err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+
+	err = cache.objStorage.DownloadFile(ctx, msg, fd)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading the file: %w", err)
+	}
+
+	sum, size, err := checksum(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	// the file was corrupted while it was downloaded
+	if info.SHA256 != "" && !strings.EqualFold(info.SHA256, sum) {
+		return nil, fmt.Errorf("error downloading the file: checksum mismatch for %v", msg.S3Name)
+	}
+
+	if msg.SHA256 != "" && !strings.EqualFold(msg.SHA256, sum) {
+		return nil, fmt.Errorf("error downloading the file: %v has checksum %v, expected %v: %w", msg.S3Name, sum, msg.SHA256, ErrChecksumMismatch)
+	}
+
+	m := metadata{
+		S3Name: msg.S3Name,
+		ETag:   info.ETag,
+		SHA256: sum,
+		Size:   size,
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("error while saving the file metadata: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(cache.dir, key+metadataExtension), data, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error while saving the file metadata: %w", err)
+	}
+
+	err = os.Rename(fd.Name(), filepath.Join(cache.dir, key))
+	if err != nil {
+		os.Remove(filepath.Join(cache.dir, key+metadataExtension))
+		return nil, fmt.Errorf("error while saving the file: %w", err)
+	}
+
+	cache.mu.Lock()
+	e := cache.add(key, m)
+	e.pins++
+	e.verified = true
+	cache.evict()
+	cache.mu.Unlock()
+
+	return e, nil
+}
+
+// openEntry opens the file of a pinned entry, checking its size and, if it has not been verified yet, its checksum
+// Returns a non-nil error if the file cannot be opened or it is corrupted
+func (cache *Cache) openEntry(e *entry) (*File, error) {
+	path := filepath.Join(cache.dir, e.key)
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	if info.Size() != e.metadata.Size {
+		fd.Close()
+		return nil, errors.New("size mismatch")
+	}
+
+	cache.mu.Lock()
+	verified := e.verified
+	cache.mu.Unlock()
+
+	if !verified {
+		sum, _, err := checksum(fd)
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+
+		if sum != e.metadata.SHA256 {
+			fd.Close()
+			return nil, errors.New("checksum mismatch")
+		}
+
+		cache.mu.Lock()
+		e.verified = true
+		cache.mu.Unlock()
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	var once sync.Once
+	return &File{
+		File:   fd,
+		sha256: e.metadata.SHA256,
+		release: func() {
+			once.Do(func() {
+				cache.mu.Lock()
+				e.pins--
+				cache.release(e)
+				cache.mu.Unlock()
+			})
+		},
+	}, nil
+}
+
+// Size returns the number of bytes used by the cached files
+func (cache *Cache) Size() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.size
+}
+
+// add must be called with the lock held
+func (cache *Cache) add(key string, m metadata) *entry {
+	e := &entry{key: key, metadata: m}
+	e.element = cache.lru.PushFront(e)
+	cache.entries[key] = e
+	cache.size += m.Size
+
+	return e
+}
+
+// remove must be called with the lock held. Files of pinned entries are removed by release once they are not used
+func (cache *Cache) remove(e *entry) {
+	e.removed = true
+	cache.lru.Remove(e.element)
+	delete(cache.entries, e.key)
+	cache.size -= e.metadata.Size
+
+	if e.pins == 0 {
+		cache.removeFiles(e.key)
+	}
+}
+
+// release must be called with the lock held after unpinning an entry.
+// The files of a removed entry are only removed if they have not been downloaded again meanwhile
+func (cache *Cache) release(e *entry) {
+	if !e.removed {
+		cache.evict()
+		return
+	}
+
+	_, cached := cache.entries[e.key]
+	_, downloading := cache.downloads[e.key]
+	if e.pins == 0 && !cached && !downloading {
+		cache.removeFiles(e.key)
+	}
+}
+
+// evict must be called with the lock held. It removes the least recently used files not in use
+// until the size of the cache is not over its maximum
+func (cache *Cache) evict() {
+	for element := cache.lru.Back(); element != nil && cache.size > cache.maxSize; {
+		e := element.Value.(*entry)
+		element = element.Prev()
+		if e.pins > 0 {
+			continue
+		}
+		fmt.Printf("Evicting cached file %v\n", e.metadata.S3Name)
+		cache.remove(e)
+	}
+}
+
+func (cache *Cache) removeFiles(key string) {
+	os.Remove(filepath.Join(cache.dir, key))
+	os.Remove(filepath.Join(cache.dir, key+metadataExtension))
+}
+
+// cacheKey returns the name used for the cached file with the received name and ETag
+func cacheKey(s3Name string, etag string) string {
+	sum := sha256.Sum256([]byte(s3Name + "\x00" + etag))
+	return hex.EncodeToString(sum[:])
+}
+
+// checksum returns the hex encoded SHA-256 and the size of the received file, leaving it at its beginning
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func checksum(fd *os.File) (string, int64, error) {
+	_, err := fd.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", 0, fmt.Errorf("error while reading the file: %w", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, fd)
+	if err != nil {
+		return "", 0, fmt.Errorf("error while reading the file: %w", err)
+	}
+
+	_, err = fd.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", 0, fmt.Errorf("error while reading the file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,250 @@
+package filecache
+
+import (
+	objstorage "On-Premise/pkg/obj_storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObjStorage serves files from memory and counts the downloads of every one of them
+type fakeObjStorage struct {
+	mu        sync.Mutex
+	files     map[string]string
+	etags     map[string]string
+	downloads map[string]int
+	delay     time.Duration
+}
+
+func newFakeObjStorage() *fakeObjStorage {
+	return &fakeObjStorage{files: map[string]string{}, etags: map[string]string{}, downloads: map[string]int{}}
+}
+
+func (obj *fakeObjStorage) put(name string, content string, etag string) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	obj.files[name] = content
+	obj.etags[name] = etag
+}
+
+func (obj *fakeObjStorage) count(name string) int {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return obj.downloads[name]
+}
+
+func (obj *fakeObjStorage) DownloadFile(ctx context.Context, msg Message, fd *os.File) error {
+	time.Sleep(obj.delay)
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	obj.downloads[msg.S3Name]++
+	_, err := fd.WriteString(obj.files[msg.S3Name])
+	return err
+}
+
+func (obj *fakeObjStorage) Stat(ctx context.Context, msg Message) (objstorage.ObjectInfo, error) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return objstorage.ObjectInfo{Size: int64(len(obj.files[msg.S3Name])), ETag: obj.etags[msg.S3Name]}, nil
+}
+
+func readFile(t *testing.T, cache *Cache, name string) string {
+	t.Helper()
+	fd, err := cache.Open(context.Background(), Message{S3Name: name})
+	if err != nil {
+		t.Fatalf("Did not expect error opening %v but got %v", name, err)
+	}
+	defer fd.Close()
+
+	content, err := io.ReadAll(fd)
+	if err != nil {
+		t.Fatalf("Did not expect error reading %v but got %v", name, err)
+	}
+	return string(content)
+}
+
+func TestFileCacheReusesDownloads(t *testing.T) {
+	dir := t.TempDir()
+	obj := newFakeObjStorage()
+	obj.put("a.stl", "first version", "1")
+	cache := NewFileCache(dir, 1024, obj)
+
+	for i := 0; i < 3; i++ {
+		if content := readFile(t, cache, "a.stl"); content != "first version" {
+			t.Fatalf("Unexpected content %q", content)
+		}
+	}
+	if obj.count("a.stl") != 1 {
+		t.Fatalf("Expected 1 download, got %v", obj.count("a.stl"))
+	}
+
+	// a new version of the file is downloaded again
+	obj.put("a.stl", "second version", "2")
+	if content := readFile(t, cache, "a.stl"); content != "second version" {
+		t.Fatalf("Unexpected content %q", content)
+	}
+	if obj.count("a.stl") != 2 {
+		t.Fatalf("Expected 2 downloads, got %v", obj.count("a.stl"))
+	}
+
+	// a restarted agent keeps the cached files
+	cache = NewFileCache(dir, 1024, obj)
+	if content := readFile(t, cache, "a.stl"); content != "second version" {
+		t.Fatalf("Unexpected content %q", content)
+	}
+	if obj.count("a.stl") != 2 {
+		t.Errorf("Expected no new downloads after restarting, got %v", obj.count("a.stl"))
+	}
+
+	// a file corrupted while the agent was stopped is discarded and downloaded again
+	err := os.WriteFile(filepath.Join(dir, cacheKey("a.stl", "2")), []byte("second versioN"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = NewFileCache(dir, 1024, obj)
+	if content := readFile(t, cache, "a.stl"); content != "second version" {
+		t.Fatalf("Unexpected content %q", content)
+	}
+	if obj.count("a.stl") != 3 {
+		t.Fatalf("Expected 3 downloads, got %v", obj.count("a.stl"))
+	}
+
+	// a file whose size changed is discarded and downloaded again
+	err = os.WriteFile(filepath.Join(dir, cacheKey("a.stl", "2")), []byte("second"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, cache, "a.stl"); content != "second version" {
+		t.Fatalf("Unexpected content %q", content)
+	}
+	if obj.count("a.stl") != 4 {
+		t.Errorf("Expected 4 downloads, got %v", obj.count("a.stl"))
+	}
+}
+
+func TestFileCacheVerifiesMessageChecksum(t *testing.T) {
+	obj := newFakeObjStorage()
+	obj.put("a.stl", "content", "1")
+	cache := NewFileCache(t.TempDir(), 1024, obj)
+
+	hash := sha256.Sum256([]byte("content"))
+	sum := hex.EncodeToString(hash[:])
+
+	var tc = []struct {
+		checksum  string
+		corrupt   bool
+		fails     bool
+		downloads int
+		testName  string
+	}{
+		{sum, true, true, 1, "Corrupted download is not cached"},
+		{sum, false, false, 2, "Download matching the checksum"},
+		{sum, false, false, 2, "Cached file matching the checksum"},
+		{"", false, false, 2, "Cached file without checksum"},
+		{strings.Repeat("0", 64), false, true, 3, "Cached file not matching the checksum is downloaded again"},
+		{sum, false, false, 4, "Discarded file is downloaded again"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if tt.corrupt {
+				obj.put("a.stl", "contenT", "1")
+				defer obj.put("a.stl", "content", "1")
+			}
+
+			fd, err := cache.Open(context.Background(), Message{S3Name: "a.stl", SHA256: tt.checksum})
+			if tt.fails {
+				if !errors.Is(err, ErrChecksumMismatch) {
+					t.Errorf("Expected checksum mismatch but got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Did not expect error but got %v", err)
+			} else {
+				if fd.SHA256() != sum {
+					t.Errorf("Expected checksum %v, got %v", sum, fd.SHA256())
+				}
+				fd.Close()
+			}
+
+			if obj.count("a.stl") != tt.downloads {
+				t.Errorf("Expected %v downloads, got %v", tt.downloads, obj.count("a.stl"))
+			}
+		})
+	}
+}
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	obj := newFakeObjStorage()
+	for _, name := range []string{"a", "b", "c"} {
+		obj.put(name, "0123456789", name)
+	}
+	cache := NewFileCache(t.TempDir(), 25, obj)
+
+	readFile(t, cache, "a")
+	readFile(t, cache, "b")
+	readFile(t, cache, "a")
+
+	// a file being used is not evicted even if it is the least recently used one
+	fd, err := cache.Open(context.Background(), Message{S3Name: "b"})
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	readFile(t, cache, "a")
+	readFile(t, cache, "c")
+	fd.Close()
+
+	if cache.Size() != 20 {
+		t.Errorf("Expected 20 cached bytes, got %v", cache.Size())
+	}
+
+	readFile(t, cache, "b")
+	readFile(t, cache, "c")
+	readFile(t, cache, "a")
+
+	tests := []struct {
+		name      string
+		downloads int
+	}{
+		{"a", 2},
+		{"b", 1},
+		{"c", 1},
+	}
+
+	for _, tt := range tests {
+		if obj.count(tt.name) != tt.downloads {
+			t.Errorf("Expected %v downloads of %v, got %v", tt.downloads, tt.name, obj.count(tt.name))
+		}
+	}
+}
+
+func TestFileCacheSharesConcurrentDownloads(t *testing.T) {
+	obj := newFakeObjStorage()
+	obj.put("a.stl", "content", "1")
+	obj.delay = 50 * time.Millisecond
+	cache := NewFileCache(t.TempDir(), 1024, obj)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if content := readFile(t, cache, "a.stl"); content != "content" {
+				t.Errorf("Unexpected content %q", content)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if obj.count("a.stl") != 1 {
+		t.Errorf("Expected 1 download, got %v", obj.count("a.stl"))
+	}
+}
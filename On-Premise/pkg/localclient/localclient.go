@@ -0,0 +1,25 @@
+package localclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// New returns an HTTP client and the base URL to be used to reach a backend running with -mode=local
+// in the received address, which can be either host:port or unix:<path>
+func New(address string) (*http.Client, string) {
+	if !strings.HasPrefix(address, "unix:") {
+		return &http.Client{}, "http://" + address
+	}
+
+	path := strings.TrimPrefix(address, "unix:")
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return &http.Client{Transport: transport}, "http://local"
+}
@@ -2,14 +2,24 @@ package objstorage
 
 import (
 	"On-Premise/pkg/types"
+	"context"
 	"os"
 )
 
 // Message is just a reference to type Message in package types so that the usage is shorter
 type Message = types.Message
 
+// ObjectInfo represents the information of a stored file that can be obtained without downloading it
+// ETag identifies the version of the file, and SHA256 is its hex encoded checksum if the implementation knows it
+type ObjectInfo struct {
+	Size   int64
+	ETag   string
+	SHA256 string
+}
+
 // ObjStorage interface defines the methods that ObjStorage implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
 type ObjStorage interface {
-	DownloadFile(Message, *os.File) error
+	DownloadFile(context.Context, Message, *os.File) error
+	Stat(context.Context, Message) (ObjectInfo, error)
 }
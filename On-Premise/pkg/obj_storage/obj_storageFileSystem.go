@@ -0,0 +1,156 @@
+package objstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// metadataDir is the directory, relative to the root one, where the backend stores metadata sidecars
+	metadataDir = ".meta"
+	// tmpDir is the directory, relative to the root one, where the backend writes files before moving them
+	tmpDir = ".tmp"
+)
+
+// fileMetadata represents the information stored by the backend in the sidecar of every file
+type fileMetadata struct {
+	ContentType string
+	SHA256      string
+	Size        int64
+}
+
+// FileSystem defines the struct used to implement ObjStorage interface reading files from a local directory,
+// usually a volume shared with the backend such as an NFS mount
+type FileSystem struct {
+	root string
+}
+
+// NewObjStorageFileSystem creates and returns the reference to a new FileSystem struct reading from the received directory
+func NewObjStorageFileSystem(root string) *FileSystem {
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		panic(fmt.Sprintf("Object storage configuration error: %v is not a directory", root))
+	}
+
+	return &FileSystem{root: root}
+}
+
+// path returns the path of the file with the received name inside the root directory
+// Returns a non-nil error if the name is not a valid one
+func (obj *FileSystem) path(name string) (string, error) {
+	key := path.Clean("/" + name)
+	if key == "/" || strings.HasPrefix(key, "/"+metadataDir) || strings.HasPrefix(key, "/"+tmpDir) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	return filepath.Join(obj.root, filepath.FromSlash(key)), nil
+}
+
+// metadata reads the metadata sidecar of the file with the received name and size
+// A sidecar whose size does not match belongs to a previous version of the file, left by an upload of the backend
+// interrupted between moving the file and its sidecar, and is ignored
+// Returns nil metadata if the sidecar does not exist or is ignored, and a non-nil error if there's one reading it
+func (obj *FileSystem) metadata(name string, size int64) (*fileMetadata, error) {
+	key := path.Clean("/" + name)
+	data, err := os.ReadFile(filepath.Join(obj.root, metadataDir, filepath.FromSlash(key)+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the file metadata: %w", err)
+	}
+
+	var metadata fileMetadata
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the file metadata: %w", err)
+	}
+
+	if metadata.Size != size {
+		return nil, nil
+	}
+
+	return &metadata, nil
+}
+
+// Stat returns the size of the file with name specified in received message and its checksum if the metadata sidecar exists.
+// Otherwise, its size and modification time are used as its ETag
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) Stat(ctx context.Context, message Message) (ObjectInfo, error) {
+	filePath, err := obj.path(message.S3Name)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+
+	metadata, err := obj.metadata(message.S3Name, info.Size())
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if metadata == nil {
+		return ObjectInfo{
+			Size: info.Size(),
+			ETag: fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano()),
+		}, nil
+	}
+
+	return ObjectInfo{
+		Size:   info.Size(),
+		ETag:   metadata.SHA256,
+		SHA256: metadata.SHA256,
+	}, nil
+}
+
+// DownloadFile copies the file with name specified in received message to the given file pointer,
+// verifying its checksum if the metadata sidecar exists
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) DownloadFile(ctx context.Context, message Message, fd *os.File) error {
+	fmt.Printf("Downloading file %s\n", message.FileName)
+
+	filePath, err := obj.path(message.S3Name)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+	defer file.Close()
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("error while downloading the file: %w", ctx.Err())
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(fd, hash), file)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	metadata, err := obj.metadata(message.S3Name, size)
+	if err != nil || metadata == nil {
+		return err
+	}
+
+	if metadata.SHA256 != hex.EncodeToString(hash.Sum(nil)) {
+		return fmt.Errorf("error while downloading the file: checksum mismatch for %v", message.S3Name)
+	}
+
+	return nil
+}
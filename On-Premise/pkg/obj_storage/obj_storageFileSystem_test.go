@@ -0,0 +1,59 @@
+package objstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSystemMetadata(t *testing.T) {
+	original := "solid part"
+	hash := sha256.Sum256([]byte(original))
+	checksum := hex.EncodeToString(hash[:])
+
+	var tc = []struct {
+		content  string
+		metadata *fileMetadata
+		sha256   string
+		valid    bool
+		testName string
+	}{
+		{original, &fileMetadata{ContentType: "model/stl", SHA256: checksum, Size: int64(len(original))}, checksum, true, "Matching sidecar"},
+		{original, nil, "", true, "File without sidecar"},
+		{"solid part, version 2", &fileMetadata{ContentType: "model/stl", SHA256: checksum, Size: int64(len(original))}, "", true, "Sidecar of a previous version"},
+		{"solid trap", &fileMetadata{ContentType: "model/stl", SHA256: checksum, Size: int64(len(original))}, checksum, false, "File not matching its sidecar"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			root := t.TempDir()
+			_ = os.WriteFile(filepath.Join(root, "part.stl"), []byte(tt.content), 0644)
+			if tt.metadata != nil {
+				data, _ := json.Marshal(tt.metadata)
+				_ = os.MkdirAll(filepath.Join(root, metadataDir), 0755)
+				_ = os.WriteFile(filepath.Join(root, metadataDir, "part.stl.json"), data, 0644)
+			}
+
+			obj := NewObjStorageFileSystem(root)
+			message := Message{FileName: "part.stl", S3Name: "part.stl"}
+
+			info, err := obj.Stat(context.Background(), message)
+			if err != nil || info.Size != int64(len(tt.content)) || info.SHA256 != tt.sha256 {
+				t.Errorf("Unexpected information %+v with error %v", info, err)
+			}
+
+			fd, _ := os.CreateTemp(t.TempDir(), "")
+			defer fd.Close()
+
+			err = obj.DownloadFile(context.Background(), message, fd)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid: %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package objstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HTTP defines the struct used to implement ObjStorage interface downloading job files from the presigned URL
+// included by the backend in the messages, so that no object storage credentials are needed.
+// Messages without a URL are handled by the fallback ObjStorage, if there is one
+type HTTP struct {
+	httpClient *http.Client
+	fallback   ObjStorage
+}
+
+// NewObjStorageHTTP creates and returns the reference to a new HTTP struct using the received fallback, which can be nil
+func NewObjStorageHTTP(fallback ObjStorage) *HTTP {
+	return &HTTP{
+		httpClient: http.DefaultClient,
+		fallback:   fallback,
+	}
+}
+
+// errNoDownloadURL is returned when a message has no URL and there is no fallback ObjStorage
+var errNoDownloadURL = errors.New("the message has no URL to download the file")
+
+// DownloadFile downloads the file from the URL specified in received message and
+// saves it to the given file pointer
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *HTTP) DownloadFile(ctx context.Context, message Message, fd *os.File) error {
+	if message.DownloadURL == "" {
+		if obj.fallback == nil {
+			return fmt.Errorf("error while downloading the file: %w", errNoDownloadURL)
+		}
+		return obj.fallback.DownloadFile(ctx, message, fd)
+	}
+
+	fmt.Printf("Downloading file %s\n", message.FileName)
+
+	resp, err := obj.get(ctx, message.DownloadURL, "")
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error while downloading the file: status code %v", resp.StatusCode)
+	}
+
+	_, err = io.Copy(fd, resp.Body)
+	if err != nil {
+		err = fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	return err
+}
+
+// Stat returns the size and the ETag of the file from the URL specified in received message.
+// Presigned URLs are only valid for GET requests, so only the first byte of the file is requested
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *HTTP) Stat(ctx context.Context, message Message) (ObjectInfo, error) {
+	if message.DownloadURL == "" {
+		if obj.fallback == nil {
+			return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", errNoDownloadURL)
+		}
+		return obj.fallback.Stat(ctx, message)
+	}
+
+	resp, err := obj.get(ctx, message.DownloadURL, "bytes=0-0")
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+	resp.Body.Close()
+
+	info := ObjectInfo{ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the server ignored the range and sends the whole file
+		info.Size = resp.ContentLength
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		// Content-Range is "bytes 0-0/<size>", or "bytes */0" for empty files
+		contentRange := resp.Header.Get("Content-Range")
+		info.Size, err = strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("error while getting the file information: invalid Content-Range %q", contentRange)
+		}
+	default:
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: status code %v", resp.StatusCode)
+	}
+
+	return info, nil
+}
+
+func (obj *HTTP) get(ctx context.Context, url string, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+
+	return obj.httpClient.Do(req)
+}
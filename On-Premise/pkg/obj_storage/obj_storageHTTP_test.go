@@ -0,0 +1,92 @@
+package objstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeObjStorage records the messages it receives and writes their S3Name as file content
+type fakeObjStorage struct {
+	calls int
+}
+
+func (obj *fakeObjStorage) DownloadFile(ctx context.Context, message Message, fd *os.File) error {
+	obj.calls++
+	_, err := fd.WriteString(message.S3Name)
+	return err
+}
+
+func (obj *fakeObjStorage) Stat(ctx context.Context, message Message) (ObjectInfo, error) {
+	obj.calls++
+	return ObjectInfo{Size: int64(len(message.S3Name)), ETag: "fallback"}, nil
+}
+
+func TestHTTPDownload(t *testing.T) {
+	files := map[string]string{"/job.stl": "solid part", "/empty.stl": ""}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok || r.URL.Query().Get("X-Amz-Signature") != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"etag`+r.URL.Path+`"`)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	fallback := &fakeObjStorage{}
+	obj := NewObjStorageHTTP(fallback)
+
+	var tc = []struct {
+		message  Message
+		expected string
+		info     ObjectInfo
+		fails    bool
+		testName string
+	}{
+		{Message{DownloadURL: server.URL + "/job.stl?X-Amz-Signature=valid"}, "solid part", ObjectInfo{Size: 10, ETag: "etag/job.stl"}, false, "Presigned URL"},
+		{Message{DownloadURL: server.URL + "/empty.stl?X-Amz-Signature=valid"}, "", ObjectInfo{Size: 0, ETag: "etag/empty.stl"}, false, "Empty file"},
+		{Message{DownloadURL: server.URL + "/job.stl?X-Amz-Signature=expired"}, "", ObjectInfo{}, true, "Expired URL"},
+		{Message{S3Name: "jobs/abc/job.stl"}, "jobs/abc/job.stl", ObjectInfo{Size: 16, ETag: "fallback"}, false, "No URL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			info, err := obj.Stat(context.Background(), tt.message)
+			if (err != nil) != tt.fails || info != tt.info {
+				t.Errorf("Expected info %+v, got %+v and error %v", tt.info, info, err)
+			}
+
+			fd, _ := os.CreateTemp(t.TempDir(), "")
+			defer fd.Close()
+
+			err = obj.DownloadFile(context.Background(), tt.message, fd)
+			if (err != nil) != tt.fails {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			_, _ = fd.Seek(0, 0)
+			content, _ := io.ReadAll(fd)
+			if !tt.fails && string(content) != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, content)
+			}
+		})
+	}
+
+	if fallback.calls != 2 {
+		t.Errorf("Expected only the message without URL to use the fallback, got %v calls", fallback.calls)
+	}
+
+	_, err := NewObjStorageHTTP(nil).Stat(context.Background(), Message{S3Name: "jobs/abc/job.stl"})
+	if err == nil {
+		t.Errorf("Expected error without URL nor fallback")
+	}
+}
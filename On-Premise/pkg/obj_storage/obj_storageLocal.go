@@ -0,0 +1,86 @@
+package objstorage
+
+import (
+	"On-Premise/pkg/localclient"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Local defines the struct used to implement ObjStorage interface using the in-memory
+// object storage served by a backend running with -mode=local
+// It contains the HTTP client and the base URL to be used
+type Local struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewObjStorageLocal creates and returns the reference to a new Local struct
+// address is the one used in the backend -local-addr flag, either host:port or unix:<path>
+func NewObjStorageLocal(address string) *Local {
+	client, baseURL := localclient.New(address)
+	return &Local{
+		httpClient: client,
+		baseURL:    baseURL,
+	}
+}
+
+// DownloadFile downloads the file with name specified in received message and
+// saves it to the given file pointer
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Local) DownloadFile(ctx context.Context, message Message, fd *os.File) error {
+	fmt.Printf("Downloading file %s\n", message.FileName)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", obj.baseURL+"/objects/"+url.PathEscape(message.S3Name), nil)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	resp, err := obj.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error while downloading the file: status code %v", resp.StatusCode)
+	}
+
+	_, err = io.Copy(fd, resp.Body)
+	if err != nil {
+		err = fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	return err
+}
+
+// Stat returns the size and the ETag of the file with name specified in received message.
+// The backend running with -mode=local uses the SHA-256 of the file as its ETag
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Local) Stat(ctx context.Context, message Message) (ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", obj.baseURL+"/objects/"+url.PathEscape(message.S3Name), nil)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+
+	resp, err := obj.httpClient.Do(req)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: status code %v", resp.StatusCode)
+	}
+
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	return ObjectInfo{
+		Size:   resp.ContentLength,
+		ETag:   etag,
+		SHA256: etag,
+	}, nil
+}
@@ -1,55 +1,54 @@
 package objstorage
 
 import (
+	"On-Premise/pkg/awsconfig"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go/aws"
 )
 
-const (
-	bucketName = "sergiotfgbucket"
-)
-
 // S3 defines the struct used to implement ObjStorage interface using AWS S3
-// It contains an S3 client and the file downloader to be used
+// It contains an S3 client, the file downloader and the name of the bucket to be used
 type S3 struct {
 	s3Client   *s3.Client
 	downloader *manager.Downloader
+	bucketName string
 }
 
-// NewObjStorageS3 creates and returns the reference to a new S3 struct
-func NewObjStorageS3() *S3 {
+// NewObjStorageS3 creates and returns the reference to a new S3 struct using the received AWS configuration
+func NewObjStorageS3(awsConfig awsconfig.Config) *S3 {
 	obj := &S3{}
-	obj.initialize()
+	obj.initialize(awsConfig)
 	return obj
 }
 
-func (obj *S3) initialize() {
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+func (obj *S3) initialize(awsConfig awsconfig.Config) {
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic(fmt.Sprintf("Object storage configuration error: %v", err))
 	}
 
-	obj.s3Client = s3.NewFromConfig(cfg)
+	obj.bucketName = awsConfig.BucketName
+	obj.s3Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = awsConfig.UsePathStyle
+	})
 	obj.downloader = manager.NewDownloader(obj.s3Client)
 }
 
 // DownloadFile downloads the file with name specified in received message and
 // saves it to the given file pointer
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (obj *S3) DownloadFile(message Message, fd *os.File) error {
+func (obj *S3) DownloadFile(ctx context.Context, message Message, fd *os.File) error {
 	fmt.Printf("Downloading file %s\n", message.FileName)
 
-	_, err := obj.downloader.Download(context.TODO(), fd, &s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
+	_, err := obj.downloader.Download(ctx, fd, &s3.GetObjectInput{
+		Bucket: aws.String(obj.bucketName),
 		Key:    aws.String(message.S3Name),
 	})
 
@@ -59,3 +58,20 @@ func (obj *S3) DownloadFile(message Message, fd *os.File) error {
 
 	return err
 }
+
+// Stat returns the size and the ETag of the file with name specified in received message
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) Stat(ctx context.Context, message Message) (ObjectInfo, error) {
+	resp, err := obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(obj.bucketName),
+		Key:    aws.String(message.S3Name),
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error while getting the file information: %w", err)
+	}
+
+	return ObjectInfo{
+		Size: resp.ContentLength,
+		ETag: strings.Trim(aws.StringValue(resp.ETag), `"`),
+	}, nil
+}
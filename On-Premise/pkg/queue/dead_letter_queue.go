@@ -1,11 +1,15 @@
 package queue
 
-import "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
 
 // DeadLetterQueue interface defines the methods that DeadLetterQueue implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
 type DeadLetterQueue interface {
-	SendMessage(string) error
-	ReceiveMessages() []types.Message
-	RemoveMessage(types.Message) error
+	SendMessage(context.Context, string) error
+	ReceiveMessages(context.Context) []types.Message
+	RemoveMessage(context.Context, types.Message) error
 }
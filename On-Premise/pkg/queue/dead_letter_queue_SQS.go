@@ -1,10 +1,10 @@
 package queue
 
 import (
+	"On-Premise/pkg/awsconfig"
 	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/aws/aws-sdk-go/aws"
@@ -17,18 +17,16 @@ type DLQ_SQS struct {
 	queueURL  *string
 }
 
-// NewDeadLetterQueueSQS creates and returns the reference to a new NewDeadLetterQueueSQS struct
-func NewDeadLetterQueueSQS() *DLQ_SQS {
+// NewDeadLetterQueueSQS creates and returns the reference to a new NewDeadLetterQueueSQS struct using the received AWS configuration
+func NewDeadLetterQueueSQS(awsConfig awsconfig.Config) *DLQ_SQS {
 	q := &DLQ_SQS{}
-	q.initialize()
+	q.initialize(awsConfig)
 	return q
 }
 
-func (dlq *DLQ_SQS) initialize() {
+func (dlq *DLQ_SQS) initialize(awsConfig awsconfig.Config) {
 
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic(fmt.Sprintf("configuration error: %v", err))
@@ -36,7 +34,7 @@ func (dlq *DLQ_SQS) initialize() {
 
 	dlq.sqsClient = sqs.NewFromConfig(cfg)
 
-	queueNameString := aws.String(deadLetterQueueName)
+	queueNameString := aws.String(awsConfig.DeadLetterQueueName)
 
 	qInput := &sqs.GetQueueUrlInput{
 		QueueName: queueNameString,
@@ -53,7 +51,7 @@ func (dlq *DLQ_SQS) initialize() {
 
 // ReceiveMessages uses the queue to retrieve and return Messages from it
 // Returns nil if there's an error receiving messages
-func (dlq *DLQ_SQS) ReceiveMessages() []types.Message {
+func (dlq *DLQ_SQS) ReceiveMessages(ctx context.Context) []types.Message {
 
 	mInput := &sqs.ReceiveMessageInput{
 		QueueUrl: dlq.queueURL,
@@ -67,7 +65,7 @@ func (dlq *DLQ_SQS) ReceiveMessages() []types.Message {
 		WaitTimeSeconds: int32(waitTime),
 	}
 
-	resp, err := getLPMessages(context.TODO(), dlq.sqsClient, mInput)
+	resp, err := getLPMessages(ctx, dlq.sqsClient, mInput)
 
 	if err != nil {
 		fmt.Printf("Got an error receiving messages: %v\n", err)
@@ -79,14 +77,14 @@ func (dlq *DLQ_SQS) ReceiveMessages() []types.Message {
 
 // RemoveMessage received a processed message and removes it from the queue
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (dlq *DLQ_SQS) RemoveMessage(msg types.Message) error {
+func (dlq *DLQ_SQS) RemoveMessage(ctx context.Context, msg types.Message) error {
 
 	dMInput := &sqs.DeleteMessageInput{
 		QueueUrl:      dlq.queueURL,
 		ReceiptHandle: msg.ReceiptHandle,
 	}
 
-	_, err := removeMessage(context.TODO(), dlq.sqsClient, dMInput)
+	_, err := removeMessage(ctx, dlq.sqsClient, dMInput)
 
 	if err != nil {
 		err = fmt.Errorf("got an error deleting the message fron the queue: %w", err)
@@ -98,7 +96,7 @@ func (dlq *DLQ_SQS) RemoveMessage(msg types.Message) error {
 
 // SendMessage receives an string and puts it in the correponding SQS URL
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (dlq *DLQ_SQS) SendMessage(s string) error {
+func (dlq *DLQ_SQS) SendMessage(ctx context.Context, s string) error {
 	sMInput := &sqs.SendMessageInput{
 
 		MessageBody:    aws.String(s),
@@ -106,7 +104,7 @@ func (dlq *DLQ_SQS) SendMessage(s string) error {
 		MessageGroupId: aws.String("1"),
 	}
 
-	resp, err := sendMsg(context.TODO(), dlq.sqsClient, sMInput)
+	resp, err := sendMsg(ctx, dlq.sqsClient, sMInput)
 	if err != nil {
 		err = fmt.Errorf("got an error sending the message to the Dead Letter Queue: %w", err)
 		return err
@@ -1,10 +1,18 @@
 package queue
 
-import "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
 
 // Queue interface defines the methods that Queue implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
+// Received messages are hidden from other consumers until their visibility timeout expires,
+// ChangeVisibility allows extending it while the message is still being processed
 type Queue interface {
-	ReceiveMessages() []types.Message
-	RemoveMessage(types.Message) error
+	ReceiveMessages(context.Context) []types.Message
+	RemoveMessage(context.Context, types.Message) error
+	ChangeVisibility(context.Context, types.Message, time.Duration) error
 }
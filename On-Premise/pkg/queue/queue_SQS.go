@@ -1,10 +1,11 @@
 package queue
 
 import (
+	"On-Premise/pkg/awsconfig"
 	"context"
 	"fmt"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/aws/aws-sdk-go/aws"
@@ -18,18 +19,16 @@ type SQS struct {
 	mInput    *sqs.ReceiveMessageInput
 }
 
-// NewQueueSQS creates and returns the reference to a new SQS struct
-func NewQueueSQS() *SQS {
+// NewQueueSQS creates and returns the reference to a new SQS struct using the received AWS configuration
+func NewQueueSQS(awsConfig awsconfig.Config) *SQS {
 	q := &SQS{}
-	q.initialize()
+	q.initialize(awsConfig)
 	return q
 }
 
-func (queue *SQS) initialize() {
+func (queue *SQS) initialize(awsConfig awsconfig.Config) {
 
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic(fmt.Sprintf("configuration error: %v", err))
@@ -37,7 +36,7 @@ func (queue *SQS) initialize() {
 
 	queue.sqsClient = sqs.NewFromConfig(cfg)
 
-	queueNameString := aws.String(queueName)
+	queueNameString := aws.String(awsConfig.QueueName)
 
 	qInput := &sqs.GetQueueUrlInput{
 		QueueName: queueNameString,
@@ -66,9 +65,9 @@ func (queue *SQS) initialize() {
 
 // ReceiveMessages uses the queue to retrieve and return Messages from it
 // Returns nil if there's an error receiving messages
-func (queue *SQS) ReceiveMessages() []types.Message {
+func (queue *SQS) ReceiveMessages(ctx context.Context) []types.Message {
 
-	resp, err := getLPMessages(context.TODO(), queue.sqsClient, queue.mInput)
+	resp, err := getLPMessages(ctx, queue.sqsClient, queue.mInput)
 
 	if err != nil {
 		fmt.Printf("Got an error receiving messages: %v\n", err)
@@ -80,14 +79,14 @@ func (queue *SQS) ReceiveMessages() []types.Message {
 
 // RemoveMessage receives a processed message and removes it from the queue
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (queue *SQS) RemoveMessage(msg types.Message) error {
+func (queue *SQS) RemoveMessage(ctx context.Context, msg types.Message) error {
 
 	dMInput := &sqs.DeleteMessageInput{
 		QueueUrl:      queue.queueURL,
 		ReceiptHandle: msg.ReceiptHandle,
 	}
 
-	_, err := removeMessage(context.TODO(), queue.sqsClient, dMInput)
+	_, err := removeMessage(ctx, queue.sqsClient, dMInput)
 
 	if err != nil {
 		err = fmt.Errorf("got an error deleting the message fron the queue: %w", err)
@@ -96,3 +95,23 @@ func (queue *SQS) RemoveMessage(msg types.Message) error {
 	return err
 
 }
+
+// ChangeVisibility receives a message being processed and makes it invisible to other consumers
+// for the received duration, counting from now
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *SQS) ChangeVisibility(ctx context.Context, msg types.Message, timeout time.Duration) error {
+
+	cMVInput := &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          queue.queueURL,
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: int32(timeout / time.Second),
+	}
+
+	_, err := changeVisibility(ctx, queue.sqsClient, cMVInput)
+
+	if err != nil {
+		err = fmt.Errorf("got an error changing the message visibility: %w", err)
+	}
+
+	return err
+}
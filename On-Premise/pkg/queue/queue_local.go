@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"On-Premise/pkg/localclient"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Local defines the struct used to implement the queue and dead letter queue interfaces
+// using the in-memory queues served by a backend running with -mode=local
+// It contains the HTTP client and the base URL of the queue to be used
+type Local struct {
+	httpClient *http.Client
+	queueURL   string
+	maxNumber  int
+}
+
+// NewQueueLocal creates and returns the reference to a new Local struct reading from the messages queue
+// address is the one used in the backend -local-addr flag, either host:port or unix:<path>
+func NewQueueLocal(address string) *Local {
+	return newLocal(address, "messages", 1)
+}
+
+// NewDeadLetterQueueLocal creates and returns the reference to a new Local struct using the dead letter queue
+// address is the one used in the backend -local-addr flag, either host:port or unix:<path>
+func NewDeadLetterQueueLocal(address string) *Local {
+	return newLocal(address, "dlq", 10)
+}
+
+func newLocal(address string, name string, maxNumber int) *Local {
+	client, baseURL := localclient.New(address)
+	client.Timeout = time.Duration(waitTime+10) * time.Second
+
+	return &Local{
+		httpClient: client,
+		queueURL:   baseURL + "/queues/" + name + "/messages",
+		maxNumber:  maxNumber,
+	}
+}
+
+// ReceiveMessages uses the queue to retrieve and return Messages from it
+// Returns nil if there's an error receiving messages
+func (queue *Local) ReceiveMessages(ctx context.Context) []types.Message {
+	url := fmt.Sprintf("%s?max=%d&wait=%d", queue.queueURL, queue.maxNumber, waitTime)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		fmt.Printf("Got an error receiving messages: %v\n", err)
+		return nil
+	}
+
+	resp, err := queue.httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("Got an error receiving messages: %v\n", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Got an error receiving messages: status code %v\n", resp.StatusCode)
+		return nil
+	}
+
+	var messages []types.Message
+	err = json.NewDecoder(resp.Body).Decode(&messages)
+	if err != nil {
+		fmt.Printf("Got an error receiving messages: %v\n", err)
+		return nil
+	}
+
+	return messages
+}
+
+// RemoveMessage receives a processed message and removes it from the queue
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Local) RemoveMessage(ctx context.Context, msg types.Message) error {
+	if msg.ReceiptHandle == nil {
+		return fmt.Errorf("got an error deleting the message fron the queue: missing receipt handle")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", queue.queueURL+"/"+url.PathEscape(*msg.ReceiptHandle), nil)
+	if err != nil {
+		return fmt.Errorf("got an error deleting the message fron the queue: %w", err)
+	}
+
+	resp, err := queue.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("got an error deleting the message fron the queue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got an error deleting the message fron the queue: status code %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ChangeVisibility receives a message being processed and makes it invisible to other consumers
+// for the received duration, counting from now
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Local) ChangeVisibility(ctx context.Context, msg types.Message, timeout time.Duration) error {
+	if msg.ReceiptHandle == nil {
+		return fmt.Errorf("got an error changing the message visibility: missing receipt handle")
+	}
+
+	url := fmt.Sprintf("%s/%s/visibility?timeout=%d", queue.queueURL, url.PathEscape(*msg.ReceiptHandle), int(timeout/time.Second))
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
+	if err != nil {
+		return fmt.Errorf("got an error changing the message visibility: %w", err)
+	}
+
+	resp, err := queue.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("got an error changing the message visibility: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got an error changing the message visibility: status code %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SendMessage receives an string and puts it in the queue
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Local) SendMessage(ctx context.Context, s string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", queue.queueURL, bytes.NewBufferString(s))
+	if err != nil {
+		return fmt.Errorf("got an error sending the message to the queue: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := queue.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("got an error sending the message to the queue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got an error sending the message to the queue: status code %v", resp.StatusCode)
+	}
+
+	return nil
+}
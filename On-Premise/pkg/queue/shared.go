@@ -7,9 +7,7 @@ import (
 )
 
 const (
-	queueName           = "messages.fifo"
-	waitTime            = 20
-	deadLetterQueueName = "dlq.fifo"
+	waitTime = 20
 )
 
 // SQSGetLPMsgAPI defines the interface for the GetQueueUrl and ReceiveMessage functions.
@@ -36,6 +34,14 @@ type SQSDeleteMessageAPI interface {
 		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
 }
 
+// SQSChangeMessageVisibilityAPI defines the interface for the ChangeMessageVisibility function.
+// We use this interface to test the functions using a mocked service.
+type SQSChangeMessageVisibilityAPI interface {
+	ChangeMessageVisibility(ctx context.Context,
+		params *sqs.ChangeMessageVisibilityInput,
+		optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
 // SQSSendMessageAPI defines the interface for the GetQueueUrl and SendMessage functions.
 // We use this interface to test the functions using a mocked service.
 type SQSSendMessageAPI interface {
@@ -60,6 +66,10 @@ func removeMessage(c context.Context, api SQSDeleteMessageAPI, input *sqs.Delete
 	return api.DeleteMessage(c, input)
 }
 
+func changeVisibility(c context.Context, api SQSChangeMessageVisibilityAPI, input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return api.ChangeMessageVisibility(c, input)
+}
+
 func sendMsg(c context.Context, api SQSSendMessageAPI, input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
 	return api.SendMessage(c, input)
 }
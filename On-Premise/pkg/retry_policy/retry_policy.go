@@ -0,0 +1,206 @@
+package retrypolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Policy defines how the processing of a message is retried after a failure
+// Delays grow exponentially from InitialDelay and are capped by MaxDelay. If Jitter is set, every delay is
+// chosen randomly between zero and that value (full jitter), so that retries for many devices are spread in time.
+// A message is not retried once it has been attempted MaxAttempts times or if its next attempt would happen
+// after Deadline has passed since it was received. MaxAttempts includes the first attempt,
+// while zero MaxDelay and Deadline mean no limit
+type Policy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Deadline     time.Duration
+	Jitter       bool
+}
+
+// Policies contains the retry policy used by default and the ones that override it for some message types
+type Policies struct {
+	Default Policy
+	Types   map[string]Policy
+}
+
+// For returns the policy used for messages of the received type
+func (p Policies) For(msgType string) Policy {
+	if policy, ok := p.Types[msgType]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// Delay returns the time to wait before the attempt following the received number of failed attempts
+func (p Policy) Delay(attempts int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempts && delay <= math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter && delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+
+	return delay
+}
+
+// ShouldRetry returns whether a message received at the given time, that failed with the received error
+// after the given number of attempts, has to be attempted again at the given time
+func (p Policy) ShouldRetry(err error, attempts int, received time.Time, nextAttempt time.Time) bool {
+	if IsPermanent(err) {
+		return false
+	}
+
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+
+	if p.Deadline > 0 && nextAttempt.After(received.Add(p.Deadline)) {
+		return false
+	}
+
+	return true
+}
+
+// permanentError is the error used to mark errors that will not be solved by retrying
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the received error as permanent, so that the message is moved to the dead letter queue without being retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns whether the received error, or any error it wraps, was marked as permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// FromStatusCode returns the received error marked as permanent if the status code is a client error,
+// which means that the request is invalid and will fail again.
+// Request timeouts and too many requests errors are not marked, as they can succeed later
+func FromStatusCode(statusCode int, err error) error {
+	if statusCode >= 400 && statusCode < 500 && statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// Duration is a time.Duration read from JSON strings such as "90s" or "2h"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration using time.ParseDuration format
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// filePolicy is the policy as it is written in the config file, where missing fields keep their default value
+type filePolicy struct {
+	MaxAttempts  *int
+	InitialDelay *Duration
+	MaxDelay     *Duration
+	Deadline     *Duration
+	Jitter       *bool
+}
+
+func (f filePolicy) apply(p Policy) Policy {
+	if f.MaxAttempts != nil {
+		p.MaxAttempts = *f.MaxAttempts
+	}
+	if f.InitialDelay != nil {
+		p.InitialDelay = time.Duration(*f.InitialDelay)
+	}
+	if f.MaxDelay != nil {
+		p.MaxDelay = time.Duration(*f.MaxDelay)
+	}
+	if f.Deadline != nil {
+		p.Deadline = time.Duration(*f.Deadline)
+	}
+	if f.Jitter != nil {
+		p.Jitter = *f.Jitter
+	}
+	return p
+}
+
+// LoadFile reads the JSON config file in the received path and applies it over the received policies.
+// The file has a "Default" policy and a "Types" object with policies by message type, for example:
+//
+//	{"Default": {"MaxDelay": "10m"}, "Types": {"HEARTBEAT": {"MaxAttempts": 2}, "JOB": {"MaxAttempts": 50, "Deadline": "6h"}}}
+//
+// Fields missing in a type policy are taken from the default one
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func LoadFile(path string, policies Policies) (Policies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, fmt.Errorf("error reading the retry policies file: %w", err)
+	}
+
+	var file struct {
+		Default filePolicy
+		Types   map[string]filePolicy
+	}
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return policies, fmt.Errorf("error reading the retry policies file: %w", err)
+	}
+
+	result := Policies{
+		Default: file.Default.apply(policies.Default),
+		Types:   make(map[string]Policy),
+	}
+
+	for msgType, policy := range policies.Types {
+		result.Types[msgType] = policy
+	}
+	for msgType, policy := range file.Types {
+		base, ok := result.Types[msgType]
+		if !ok {
+			base = result.Default
+		}
+		result.Types[msgType] = policy.apply(base)
+	}
+
+	return result, nil
+}
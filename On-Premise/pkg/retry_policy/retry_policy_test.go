@@ -0,0 +1,110 @@
+package retrypolicy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	policy := Policy{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		testName string
+		attempts int
+		expected time.Duration
+	}{
+		{testName: "First retry", attempts: 1, expected: time.Second},
+		{testName: "Doubles", attempts: 3, expected: 4 * time.Second},
+		{testName: "Capped", attempts: 5, expected: 10 * time.Second},
+		{testName: "Capped without overflowing", attempts: 200, expected: 10 * time.Second},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if delay := policy.Delay(tt.attempts); delay != tt.expected {
+				t.Errorf("Expected delay %v but got %v", tt.expected, delay)
+			}
+
+			jittered := policy
+			jittered.Jitter = true
+			for j := 0; j < 20; j++ {
+				if delay := jittered.Delay(tt.attempts); delay < 0 || delay > tt.expected {
+					t.Fatalf("Expected jittered delay between 0 and %v but got %v", tt.expected, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, Deadline: time.Minute}
+	received := time.Now()
+	retryable := errors.New("connection refused")
+
+	tests := []struct {
+		testName    string
+		err         error
+		attempts    int
+		nextAttempt time.Time
+		expected    bool
+	}{
+		{testName: "Retryable error", err: retryable, attempts: 1, nextAttempt: received.Add(time.Second), expected: true},
+		{testName: "Permanent error", err: fmt.Errorf("wrapped: %w", Permanent(retryable)), attempts: 1, nextAttempt: received, expected: false},
+		{testName: "Client error status code", err: FromStatusCode(400, retryable), attempts: 1, nextAttempt: received, expected: false},
+		{testName: "Too many requests status code", err: FromStatusCode(429, retryable), attempts: 1, nextAttempt: received, expected: true},
+		{testName: "Server error status code", err: FromStatusCode(503, retryable), attempts: 1, nextAttempt: received, expected: true},
+		{testName: "Max attempts reached", err: retryable, attempts: 3, nextAttempt: received, expected: false},
+		{testName: "After deadline", err: retryable, attempts: 1, nextAttempt: received.Add(2 * time.Minute), expected: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if result := policy.ShouldRetry(tt.err, tt.attempts, received, tt.nextAttempt); result != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	_ = os.WriteFile(path, []byte(`{
+		"Default": {"MaxDelay": "5m"},
+		"Types": {
+			"HEARTBEAT": {"MaxAttempts": 2, "Deadline": "1m"},
+			"JOB": {"MaxAttempts": 100, "Deadline": "6h", "Jitter": false}
+		}
+	}`), 0644)
+
+	defaults := Policies{Default: Policy{MaxAttempts: 5, InitialDelay: 15 * time.Second, MaxDelay: 10 * time.Minute, Jitter: true}}
+
+	policies, err := LoadFile(path, defaults)
+	if err != nil {
+		t.Fatalf("Did not expect error loading the file but got %v", err)
+	}
+
+	expectedDefault := Policy{MaxAttempts: 5, InitialDelay: 15 * time.Second, MaxDelay: 5 * time.Minute, Jitter: true}
+	if policies.For("UPLOAD") != expectedDefault {
+		t.Errorf("Unexpected default policy %+v", policies.For("UPLOAD"))
+	}
+
+	expectedHeartbeat := Policy{MaxAttempts: 2, InitialDelay: 15 * time.Second, MaxDelay: 5 * time.Minute, Deadline: time.Minute, Jitter: true}
+	if policies.For("HEARTBEAT") != expectedHeartbeat {
+		t.Errorf("Unexpected HEARTBEAT policy %+v", policies.For("HEARTBEAT"))
+	}
+
+	expectedJob := Policy{MaxAttempts: 100, InitialDelay: 15 * time.Second, MaxDelay: 5 * time.Minute, Deadline: 6 * time.Hour}
+	if policies.For("JOB") != expectedJob {
+		t.Errorf("Unexpected JOB policy %+v", policies.For("JOB"))
+	}
+
+	_ = os.WriteFile(path, []byte(`{"Default": {"MaxDelay": "ten minutes"}}`), 0644)
+	_, err = LoadFile(path, defaults)
+	if err == nil {
+		t.Errorf("Expected error loading a file with an invalid duration but got none")
+	}
+}
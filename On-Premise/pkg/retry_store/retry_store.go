@@ -0,0 +1,16 @@
+package retrystore
+
+import "On-Premise/pkg/types"
+
+// PendingRetry is just a reference to type PendingRetry in package types so that the usage is shorter
+type PendingRetry = types.PendingRetry
+
+// RetryStore interface defines the methods that retry store implementations will need to have
+// It keeps the messages whose processing failed and that are waiting to be attempted again,
+// so that they are not lost if the agent stops during the wait
+type RetryStore interface {
+	Save(PendingRetry) error
+	Delete(id string) error
+	List() ([]PendingRetry, error)
+	Close() error
+}
@@ -0,0 +1,124 @@
+package retrystore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	// Pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS pending_retries (
+	id           TEXT PRIMARY KEY,
+	message      TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	next_attempt BIGINT NOT NULL,
+	last_error   TEXT NOT NULL DEFAULT '',
+	received     BIGINT NOT NULL
+)`
+
+// SQLite defines the struct used to implement RetryStore interface using an SQLite database file
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewRetryStoreSQLite creates and returns the reference to a new SQLite struct using the database file in the received path,
+// which is created if it does not exist
+func NewRetryStoreSQLite(path string) *SQLite {
+	store := &SQLite{}
+	store.initialize(path)
+	return store
+}
+
+func (store *SQLite) initialize(path string) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		panic(fmt.Sprintf("Configuration error in retry store: %v\n", err))
+	}
+
+	// SQLite only allows one writer at a time
+	db.SetMaxOpenConns(1)
+
+	// WAL allows the inspection command to read the store while the agent is running
+	for _, statement := range []string{"PRAGMA busy_timeout = 5000", "PRAGMA journal_mode = WAL", schema} {
+		_, err = db.Exec(statement)
+		if err != nil {
+			panic(fmt.Sprintf("Configuration error in retry store: %v\n", err))
+		}
+	}
+
+	store.db = db
+}
+
+// Save inserts the received pending retry in the store, replacing the existing one with the same ID
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (store *SQLite) Save(retry PendingRetry) error {
+	messageJSON, err := json.Marshal(retry.Message)
+	if err != nil {
+		return fmt.Errorf("error saving the pending retry: %w", err)
+	}
+
+	_, err = store.db.Exec(`INSERT INTO pending_retries (id, message, attempt, next_attempt, last_error, received)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET attempt = excluded.attempt, next_attempt = excluded.next_attempt, last_error = excluded.last_error`,
+		retry.ID, string(messageJSON), retry.Attempt, retry.NextAttempt, retry.LastError, retry.Received)
+	if err != nil {
+		return fmt.Errorf("error saving the pending retry: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the pending retry with the received ID from the store, if it exists
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (store *SQLite) Delete(id string) error {
+	_, err := store.db.Exec(`DELETE FROM pending_retries WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting the pending retry: %w", err)
+	}
+
+	return nil
+}
+
+// List returns every pending retry in the store, sorted by the time their messages were received
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (store *SQLite) List() ([]PendingRetry, error) {
+	retries := []PendingRetry{}
+
+	rows, err := store.db.Query(`SELECT id, message, attempt, next_attempt, last_error, received
+		FROM pending_retries ORDER BY received, id`)
+	if err != nil {
+		return retries, fmt.Errorf("error listing the pending retries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var retry PendingRetry
+		var messageJSON string
+
+		err = rows.Scan(&retry.ID, &messageJSON, &retry.Attempt, &retry.NextAttempt, &retry.LastError, &retry.Received)
+		if err != nil {
+			return retries, fmt.Errorf("error listing the pending retries: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(messageJSON), &retry.Message)
+		if err != nil {
+			return retries, fmt.Errorf("error listing the pending retries: %w", err)
+		}
+
+		retries = append(retries, retry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return retries, fmt.Errorf("error listing the pending retries: %w", err)
+	}
+
+	return retries, nil
+}
+
+// Close closes the database file
+func (store *SQLite) Close() error {
+	return store.db.Close()
+}
@@ -0,0 +1,47 @@
+package retrystore
+
+import (
+	"On-Premise/pkg/types"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteRetryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retries.db")
+	store := NewRetryStoreSQLite(path)
+
+	second := PendingRetry{ID: "b", Message: types.Message{Type: "JOB", DeviceName: "d"}, Attempt: 1, NextAttempt: 20, Received: 2}
+	first := PendingRetry{ID: "a", Message: types.Message{Type: "HEARTBEAT", Message: "hi"}, Attempt: 1, NextAttempt: 10, Received: 1}
+
+	for _, retry := range []PendingRetry{second, first} {
+		err := store.Save(retry)
+		if err != nil {
+			t.Fatalf("Did not expect error saving the retry but got %v", err)
+		}
+	}
+
+	first.Attempt = 2
+	first.LastError = "FAILURE: unreachable"
+	_ = store.Save(first)
+	_ = store.Close()
+
+	// a restarted agent sees the same retries, sorted by the time they were received
+	store = NewRetryStoreSQLite(path)
+	defer store.Close()
+
+	retries, err := store.List()
+	if err != nil {
+		t.Fatalf("Did not expect error listing the retries but got %v", err)
+	}
+	if len(retries) != 2 || retries[0] != first || retries[1] != second {
+		t.Fatalf("Unexpected pending retries %+v", retries)
+	}
+
+	_ = store.Delete("a")
+	_ = store.Delete("missing")
+
+	retries, _ = store.List()
+	if len(retries) != 1 || retries[0].ID != "b" {
+		t.Errorf("Expected only retry b to be pending, got %+v", retries)
+	}
+}
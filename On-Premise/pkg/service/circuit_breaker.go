@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DeviceUnreachable is the outcome reported for messages that are not attempted because their device circuit is open
+const DeviceUnreachable = "DEVICE_UNREACHABLE"
+
+// unreachableError is the error used to mark transport failures while connecting to a device,
+// which are the ones counted by the circuit breaker
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// unreachable marks the received error as a transport failure while connecting to the device
+func unreachable(err error) error {
+	return &unreachableError{err: err}
+}
+
+// isUnreachable returns whether the received error, or any error it wraps, is a transport failure while connecting to the device
+func isUnreachable(err error) bool {
+	var e *unreachableError
+	return errors.As(err, &e)
+}
+
+// deviceResponseError is the error used to mark failures reported by a response of the device,
+// which show that the device is reachable although the request failed
+type deviceResponseError struct {
+	err error
+}
+
+func (e *deviceResponseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deviceResponseError) Unwrap() error {
+	return e.err
+}
+
+// deviceResponse marks the received error as a failure reported by a response of the device
+func deviceResponse(err error) error {
+	return &deviceResponseError{err: err}
+}
+
+// isDeviceResponse returns whether the received error, or any error it wraps, is a failure reported by a response of the device
+func isDeviceResponse(err error) bool {
+	var e *deviceResponseError
+	return errors.As(err, &e)
+}
+
+// deviceCircuit contains the state of the circuit of a device
+type deviceCircuit struct {
+	failures  int
+	open      bool
+	nextProbe time.Time
+}
+
+// circuitBreaker keeps a circuit for every device, which opens after a number of consecutive transport failures.
+// While a circuit is open, messages for the device are not attempted, except for one probe every probe interval.
+// The circuit closes again once an attempt reaches the device
+type circuitBreaker struct {
+	mu            sync.Mutex
+	threshold     int
+	probeInterval time.Duration
+	devices       map[string]*deviceCircuit
+	now           func() time.Time
+}
+
+// newCircuitBreaker creates a circuitBreaker that opens after threshold consecutive failures and probes every probeInterval
+// A threshold lower than 1 disables the circuit breaker
+func newCircuitBreaker(threshold int, probeInterval time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		devices:       make(map[string]*deviceCircuit),
+		now:           time.Now,
+	}
+}
+
+// Allow returns whether a message for the device can be attempted and, if it cannot, the time of the next probe.
+// Only one message is allowed every probe interval while the circuit is open
+func (b *circuitBreaker) Allow(device string) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.devices[device]
+	if !ok || !circuit.open {
+		return true, time.Time{}
+	}
+
+	now := b.now()
+	if now.Before(circuit.nextProbe) {
+		return false, circuit.nextProbe
+	}
+
+	circuit.nextProbe = now.Add(b.probeInterval)
+	return true, time.Time{}
+}
+
+// Success records that an attempt reached the device, closing its circuit
+func (b *circuitBreaker) Success(device string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.devices, device)
+}
+
+// Failure records a transport failure while connecting to the device, opening its circuit
+// once the threshold of consecutive failures is reached
+func (b *circuitBreaker) Failure(device string) {
+	if b.threshold < 1 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.devices[device]
+	if !ok {
+		circuit = &deviceCircuit{}
+		b.devices[device] = circuit
+	}
+
+	circuit.failures++
+	if circuit.failures >= b.threshold && !circuit.open {
+		circuit.open = true
+		circuit.nextProbe = b.now().Add(b.probeInterval)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// discardDLQ is a dead letter queue that counts and discards the messages sent to it
+type discardDLQ struct {
+	sent int
+}
+
+func (q *discardDLQ) SendMessage(ctx context.Context, message string) error {
+	q.sent++
+	return nil
+}
+
+func (q *discardDLQ) ReceiveMessages(ctx context.Context) []sqstypes.Message {
+	return nil
+}
+
+func (q *discardDLQ) RemoveMessage(ctx context.Context, message sqstypes.Message) error {
+	return nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure("device")
+	if allowed, _ := breaker.Allow("device"); !allowed {
+		t.Fatalf("Expected circuit to be closed after one failure")
+	}
+
+	breaker.Failure("device")
+	allowed, nextProbe := breaker.Allow("device")
+	if allowed || !nextProbe.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Expected circuit to be open until %v, got allowed %v and next probe %v", now.Add(time.Minute), allowed, nextProbe)
+	}
+
+	if allowed, _ := breaker.Allow("other"); !allowed {
+		t.Errorf("Expected circuit of other devices to be closed")
+	}
+
+	// only one probe is allowed every probe interval
+	now = now.Add(time.Minute)
+	if allowed, _ := breaker.Allow("device"); !allowed {
+		t.Fatalf("Expected a probe to be allowed once the probe interval passed")
+	}
+	if allowed, _ := breaker.Allow("device"); allowed {
+		t.Fatalf("Expected only one probe to be allowed")
+	}
+
+	breaker.Failure("device")
+	now = now.Add(30 * time.Second)
+	if allowed, _ := breaker.Allow("device"); allowed {
+		t.Fatalf("Expected circuit to stay open after a failed probe")
+	}
+
+	now = now.Add(30 * time.Second)
+	if allowed, _ := breaker.Allow("device"); !allowed {
+		t.Fatalf("Expected a new probe to be allowed")
+	}
+
+	breaker.Success("device")
+	if allowed, _ := breaker.Allow("device"); !allowed {
+		t.Errorf("Expected circuit to be closed after a successful probe")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker := newCircuitBreaker(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		breaker.Failure("device")
+	}
+
+	if allowed, _ := breaker.Allow("device"); !allowed {
+		t.Errorf("Expected disabled circuit breaker to always allow messages")
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	err := fmt.Errorf("error receiving information from the device: %w", unreachable(errors.New("connection refused")))
+	if !isUnreachable(err) {
+		t.Errorf("Expected wrapped transport failure to be unreachable")
+	}
+
+	if isUnreachable(errors.New("expected status code 200, got 500 instead")) {
+		t.Errorf("Did not expect an error response to be unreachable")
+	}
+}
+
+func TestIsDeviceResponse(t *testing.T) {
+	err := fmt.Errorf("error receiving information from the device: %w", deviceResponse(errors.New("expected status code 200, got 500 instead")))
+	if !isDeviceResponse(err) || isUnreachable(err) {
+		t.Errorf("Expected wrapped error response to be a device response")
+	}
+
+	if isDeviceResponse(errors.New("error while sending the information to the backend")) {
+		t.Errorf("Did not expect an error that does not come from the device to be a device response")
+	}
+}
+
+func TestProcessMessageKeepsCircuitOnOtherErrors(t *testing.T) {
+	dlq := &discardDLQ{}
+	s := NewService(nil, nil, dlq, nil, Config{CircuitBreakerThreshold: 2, CircuitBreakerProbeInterval: 60, NumberOfWorkers: 1})
+	s.stopping = make(chan struct{})
+	s.workCtx = context.Background()
+
+	s.breaker.Failure("device")
+
+	// the heartbeat is rejected without being sent, so it says nothing about the device
+	msg := Message{Type: "HEARTBEAT", DeviceUUID: "device", IPAddress: "invalid"}
+	if s.processMessage(&delivery{message: msg, retry: PendingRetry{ID: "id", Message: msg, Received: time.Now().UnixMilli()}}) != resultCompleted {
+		t.Fatalf("Expected the invalid message to be completed")
+	}
+	if dlq.sent != 1 {
+		t.Errorf("Expected the message to be sent to the dead letter queue, got %v messages", dlq.sent)
+	}
+
+	// the previous failure is still counted, so one more failure opens the circuit
+	s.breaker.Failure("device")
+	if allowed, _ := s.breaker.Allow("device"); allowed {
+		t.Errorf("Expected circuit to be open after an error that does not come from the device")
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"On-Premise/pkg/queue"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -23,10 +24,11 @@ func NewDLQService(queue queue.DeadLetterQueue) *DLQService {
 }
 
 // Run is the main program loop.
-// It will poll for messages from the Dead Letter Queue, read, show and delete them until there are no left messages in the queue.
-func (s *DLQService) Run() {
-	receivedMessages := s.queue.ReceiveMessages()
-	for len(receivedMessages) > 0 {
+// It will poll for messages from the Dead Letter Queue, read, show and delete them until there are no left messages in the queue
+// or ctx is cancelled.
+func (s *DLQService) Run(ctx context.Context) {
+	receivedMessages := s.queue.ReceiveMessages(ctx)
+	for len(receivedMessages) > 0 && ctx.Err() == nil {
 		for _, queueMsg := range receivedMessages {
 			var parsedMessage DLQMessage
 			err := json.Unmarshal([]byte(*queueMsg.Body), &parsedMessage)
@@ -37,7 +39,7 @@ func (s *DLQService) Run() {
 
 			go s.showMessage(parsedMessage)
 
-			err = s.queue.RemoveMessage(queueMsg)
+			err = s.queue.RemoveMessage(ctx, queueMsg)
 			if err != nil {
 				fmt.Printf("%v\n", err)
 				continue
@@ -45,7 +47,13 @@ func (s *DLQService) Run() {
 
 			fmt.Printf("Message was deleted successfully\n\n\n")
 		}
-		receivedMessages = s.queue.ReceiveMessages()
+		receivedMessages = s.queue.ReceiveMessages(ctx)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted, remaining messages were left in the Dead Letter Queue.")
+		fmt.Println("Exiting....")
+		os.Exit(0)
 	}
 
 	fmt.Println("All messages have been shown and deleted. Dead Letter Queue is now empty.")
@@ -1,7 +1,9 @@
 package service
 
 import (
+	retrypolicy "On-Premise/pkg/retry_policy"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -13,37 +15,43 @@ const ClientHBPort = "55555"
 
 // Heartbeat receives a Message and sends it to the device
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (s *Service) Heartbeat(msg Message) error {
+func (s *Service) Heartbeat(ctx context.Context, msg Message) error {
 	fmt.Println("Processing Heartbeat")
 	if msg.Message == "" || msg.IPAddress == "" {
 		err := errors.New("some message's expected fields are missing")
-		return err
+		return retrypolicy.Permanent(err)
 	}
 
-	err := sendToClient(msg)
+	err := sendToClient(ctx, msg)
 	return err
 }
 
-func sendToClient(message Message) error {
+func sendToClient(ctx context.Context, message Message) error {
 	client := net.ParseIP(message.IPAddress)
 	if client == nil {
-		return errors.New("invalid client IP")
+		return retrypolicy.Permanent(errors.New("invalid client IP"))
 	}
 	host := "http://" + client.String()
 	port := ClientHBPort
 
 	fmt.Printf("sending heartbeat to %s.\n", host)
 
-	res, err := http.Post(host+":"+port+"/heartbeat", "text/plain", bytes.NewBufferString(message.Message))
+	req, err := http.NewRequestWithContext(ctx, "POST", host+":"+port+"/heartbeat", bytes.NewBufferString(message.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	res, err := http.DefaultClient.Do(req)
 
 	if err != nil {
 		err = fmt.Errorf("error performing the petition: %w", err)
-		return err
+		return unreachable(err)
 	}
 
 	if res.StatusCode != 200 {
 		err = fmt.Errorf("error in the response: status code -> %v", res.StatusCode)
-		return err
+		return deviceResponse(retrypolicy.FromStatusCode(res.StatusCode, err))
 	}
 
 	fmt.Println("Heartbeat sent and response received correctly.")
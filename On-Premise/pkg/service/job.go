@@ -1,7 +1,9 @@
 package service
 
 import (
-	"bytes"
+	filecache "On-Premise/pkg/file_cache"
+	retrypolicy "On-Premise/pkg/retry_policy"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,50 +13,174 @@ import (
 	"net/http"
 	"net/textproto"
 	"os"
-	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 )
 
 // ClientJobPort is an arbitrary port used in which the device API is listening
 const ClientJobPort = "55555"
 
-// Job receives a message, validate it fields and send it to the device using its API
+// JobInProgress is the prefix of the intermediate outcomes reported while a job file is being sent to the device
+const JobInProgress = "IN_PROGRESS"
+
+// ChecksumMismatch is the prefix of the outcome reported when a job file does not match the checksum
+// of the file uploaded to the backend, either when it is downloaded or when it is received by the device
+const ChecksumMismatch = "CHECKSUM_MISMATCH"
+
+// checksumMismatchError is the error used to mark job files that do not match their expected checksum
+type checksumMismatchError struct {
+	err error
+}
+
+func (e *checksumMismatchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *checksumMismatchError) Unwrap() error {
+	return e.err
+}
+
+// checksumMismatch marks the received error as a checksum mismatch of the job file
+func checksumMismatch(err error) error {
+	return &checksumMismatchError{err: err}
+}
+
+// isChecksumMismatch returns whether the received error, or any error it wraps, is a checksum mismatch of the job file
+func isChecksumMismatch(err error) bool {
+	var e *checksumMismatchError
+	return errors.As(err, &e)
+}
+
+const (
+	// minimumTransferTimeout is the time allowed to send any job to the device, regardless of its size
+	minimumTransferTimeout = 10 * time.Second
+	// minimumTransferRate is the slowest rate, in bytes per second, a job file is expected to be sent to the device.
+	// Transfers not finished in the time needed at this rate, on top of the minimum timeout, are cancelled
+	minimumTransferRate = 1 << 20
+	// progressStep is the percentage of the job file sent to the device between two reported intermediate outcomes
+	progressStep = 25
+)
+
+// Job receives a message, validate it fields and send it to the device using its API.
+// The file is sent in chunks, so that a failed attempt is resumed by the next one from the last chunk committed by the device,
+// or in a single request if the device does not support chunked uploads.
+// The progress of the transfer is reported to the backend as intermediate outcomes
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (s *Service) Job(msg Message) error {
+func (s *Service) Job(ctx context.Context, msg Message) error {
 
 	if msg.FileName == "" || msg.S3Name == "" || msg.Material == "" || msg.IPAddress == "" {
 		err := errors.New("some message's expected fields are missing")
-		return err
+		return retrypolicy.Permanent(err)
 	}
 
-	fd, err := os.CreateTemp("onPremiseFiles/", "")
+	// the file is only downloaded if it is not cached by a previous attempt or message
+	// the cache verifies the file against the checksum of the message
+	fd, err := s.files.Open(ctx, msg)
 	if err != nil {
-		err = fmt.Errorf("error while creating the file: %w", err)
+		err = fmt.Errorf("error getting the file: %w", err)
+		// the file stored is not the one uploaded by the user, downloading it again would not solve it
+		if errors.Is(err, filecache.ErrChecksumMismatch) {
+			return retrypolicy.Permanent(checksumMismatch(err))
+		}
 		return err
 	}
 
-	defer os.Remove(fd.Name())
-
-	err = s.objStorage.DownloadFile(msg, fd)
-	if err != nil {
-		err = fmt.Errorf("error downloading the file: %w", err)
-		return err
-	}
+	defer fd.Close()
 
 	jobToClient := JobClient{}
 	jobToClient.FileName = msg.FileName
 	jobToClient.Material = msg.Material
+	jobToClient.SHA256 = fd.SHA256()
+
+	// intermediate outcomes are sent in the background so that the transfer is not slowed down by the backend,
+	// and the job does not finish until they are sent, so that none is received after the final outcome
+	reporter := newProgressReporter(func(step int) {
+		fmt.Printf("Sent %v%% of %v to the device\n", step, msg.FileName)
+		s.sendMessageOutcome(ctx, msg, fmt.Sprintf("%v: %v%% of the file sent to the device", JobInProgress, step))
+	})
+	defer reporter.wait()
+
+	err = sendJobInChunks(ctx, uploadKey(msg), jobToClient, fd, msg.IPAddress, reporter.report)
+	if !errors.Is(err, errChunkedUploadNotSupported) {
+		return err
+	}
 
-	err = sendJobToClient(jobToClient, fd, msg.FileName, msg.IPAddress)
+	fmt.Println("Device does not support chunked uploads, sending the whole file")
+	err = sendJobToClient(ctx, jobToClient, fd.File, msg.FileName, msg.IPAddress, reporter.report)
 
 	return err
 }
 
-func sendJobToClient(job JobClient, fd *os.File, fileName string, clientIP string) error {
+// transferTimeout returns the time allowed to send a job file of the received size to the device
+func transferTimeout(size int64) time.Duration {
+	return minimumTransferTimeout + time.Duration(size/minimumTransferRate)*time.Second
+}
+
+// progressReporter reports the progress of a transfer every progressStep percent without blocking it.
+// Only one report is sent at a time, and the steps reached while one is being sent are dropped
+type progressReporter struct {
+	send     func(step int)
+	reported int
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newProgressReporter(send func(step int)) *progressReporter {
+	return &progressReporter{send: send, inFlight: make(chan struct{}, 1)}
+}
+
+// report sends the step reached with the received number of bytes sent if it was not reported yet and no other
+// report is being sent. Completed transfers are not reported, as their outcome is sent once the job finishes
+func (r *progressReporter) report(sent int64, total int64) {
+	step := int(sent*100/total) / progressStep * progressStep
+	if step <= r.reported || step >= 100 {
+		return
+	}
+
+	select {
+	case r.inFlight <- struct{}{}:
+	default:
+		return
+	}
+
+	r.reported = step
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.send(step)
+		<-r.inFlight
+	}()
+}
+
+// wait blocks until the report being sent, if any, is finished
+func (r *progressReporter) wait() {
+	r.wg.Wait()
+}
+
+// progressReader wraps a reader of a file with the received total size, calling report with the number of bytes read so far
+type progressReader struct {
+	reader io.Reader
+	sent   int64
+	total  int64
+	report func(sent int64, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.sent += int64(n)
+	if n > 0 && r.total > 0 {
+		r.report(r.sent, r.total)
+	}
+	return n, err
+}
+
+// sendJobToClient sends the job and its file to the device. The multipart form is streamed through a pipe while it is written,
+// so the file is never loaded in memory, and progress is called as the file is sent
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func sendJobToClient(ctx context.Context, job JobClient, fd *os.File, fileName string, clientIP string, progress func(sent int64, total int64)) error {
 	client := net.ParseIP(clientIP)
 	if client == nil {
-		return errors.New("invalid client IP")
+		return retrypolicy.Permanent(errors.New("invalid client IP"))
 	}
 
 	JobJSON, err := json.Marshal(&job)
@@ -63,58 +189,85 @@ func sendJobToClient(job JobClient, fd *os.File, fileName string, clientIP strin
 		return errors.New("error creating the job to send to the client")
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	fw, err := writer.CreateFormField("job")
+	info, err := fd.Stat()
 	if err != nil {
-		return errors.New("error including the JSON in the petition")
+		return fmt.Errorf("error while reading the file: %w", err)
 	}
 
-	_, err = io.Copy(fw, strings.NewReader(string(JobJSON)))
+	ctx, cancel := context.WithTimeout(ctx, transferTimeout(info.Size()))
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+
+	file := &progressReader{reader: fd, total: info.Size(), report: progress}
+
+	written := make(chan error, 1)
+	go func() {
+		err := writeJobForm(writer, JobJSON, file, fileName)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+clientIP+":"+ClientJobPort+"/job", pr)
+
 	if err != nil {
-		return errors.New("error writing the JSON in the petition")
+		return err
 	}
 
-	switch filepath.Ext(fileName) {
-	case ".pdf":
-		fw, err = customCreateFormFile(writer, "file", fileName, "application/pdf")
-	default:
-		fw, err = writer.CreateFormFile("file", fileName)
-	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rsp, err := http.DefaultClient.Do(req)
 
-	if err != nil {
-		return errors.New("error including the file in the petition")
+	// the device may answer before reading the whole form, closing the pipe stops writing it
+	pr.Close()
+	writeErr := <-written
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
 	}
 
-	_, err = io.Copy(fw, fd)
 	if err != nil {
-		return errors.New("error writing the file in the petition")
+		return unreachable(fmt.Errorf("Error while performing the request %w", err))
 	}
 
-	writer.Close()
+	defer rsp.Body.Close()
 
-	httpClient := &http.Client{
-		Timeout: time.Second * 10,
+	if rsp.StatusCode == http.StatusUnprocessableEntity {
+		return deviceResponse(checksumMismatch(errors.New("the file received by the device does not match its checksum")))
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("resquest failed with status code %v", rsp.StatusCode)
+		return deviceResponse(retrypolicy.FromStatusCode(rsp.StatusCode, err))
 	}
-	req, err := http.NewRequest("POST", "http://"+clientIP+":"+ClientJobPort+"/job", body)
 
+	return nil
+}
+
+// writeJobForm writes the multipart form sent to the device, with the job JSON and the file, and closes it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func writeJobForm(writer *multipart.Writer, jobJSON []byte, file io.Reader, fileName string) error {
+	fw, err := writer.CreateFormField("job")
 	if err != nil {
-		return err
+		return fmt.Errorf("error including the JSON in the petition: %w", err)
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	rsp, err := httpClient.Do(req)
+	_, err = fw.Write(jobJSON)
+	if err != nil {
+		return fmt.Errorf("error writing the JSON in the petition: %w", err)
+	}
 
+	fw, err = customCreateFormFile(writer, "file", fileName, jobContentType(fileName))
 	if err != nil {
-		return fmt.Errorf("Error while performing the request %v", err)
+		return fmt.Errorf("error including the file in the petition: %w", err)
 	}
 
-	if rsp.StatusCode != http.StatusOK {
-		return fmt.Errorf("resquest failed with status code %v", rsp.StatusCode)
+	_, err = io.Copy(fw, file)
+	if err != nil {
+		return fmt.Errorf("error writing the file in the petition: %w", err)
 	}
 
-	return nil
+	return writer.Close()
 }
 
 func customCreateFormFile(w *multipart.Writer, fieldName string, fileName string, contentType string) (io.Writer, error) {
@@ -0,0 +1,158 @@
+package service
+
+import (
+	retrypolicy "On-Premise/pkg/retry_policy"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJobForm(t *testing.T) {
+	content := strings.Repeat("0123456789", 10000)
+
+	var reports []int64
+	file := &progressReader{
+		reader: strings.NewReader(content),
+		total:  int64(len(content)),
+		report: func(sent int64, total int64) { reports = append(reports, sent) },
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeJobForm(writer, []byte(`{"filename":"a.pdf"}`), file, "a.pdf"))
+	}()
+
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("Did not expect error reading the form but got %v", err)
+	}
+
+	if form.Value["job"][0] != `{"filename":"a.pdf"}` {
+		t.Errorf("Unexpected job %v", form.Value["job"])
+	}
+
+	header := form.File["file"][0]
+	if header.Filename != "a.pdf" || header.Header.Get("Content-Type") != "application/pdf" || header.Size != int64(len(content)) {
+		t.Errorf("Unexpected file %v with Content-Type %v and size %v", header.Filename, header.Header.Get("Content-Type"), header.Size)
+	}
+
+	if len(reports) == 0 || reports[len(reports)-1] != int64(len(content)) {
+		t.Errorf("Expected progress to be reported up to %v bytes, got %v", len(content), reports)
+	}
+}
+
+func TestJobContentType(t *testing.T) {
+	tests := []struct {
+		fileName string
+		expected string
+	}{
+		{"manual.pdf", "application/pdf"},
+		{"part.STL", "model/stl"},
+		{"build.3mf", "model/3mf"},
+		{"part.obj", "model/obj"},
+		{"parts.zip", "application/zip"},
+		{"part", "application/octet-stream"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.fileName), func(t *testing.T) {
+			if contentType := jobContentType(tt.fileName); contentType != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, contentType)
+			}
+		})
+	}
+}
+
+func TestTransferTimeout(t *testing.T) {
+	tests := []struct {
+		testName string
+		size     int64
+		expected time.Duration
+	}{
+		{"Empty file", 0, minimumTransferTimeout},
+		{"Small file", 1000, minimumTransferTimeout},
+		{"500 MB file", 500 << 20, minimumTransferTimeout + 500*time.Second},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if timeout := transferTimeout(tt.size); timeout != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, timeout)
+			}
+		})
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		testName string
+		err      error
+		expected bool
+	}{
+		{"Checksum mismatch", checksumMismatch(errors.New("mismatch")), true},
+		{"Permanent checksum mismatch", retrypolicy.Permanent(checksumMismatch(errors.New("mismatch"))), true},
+		{"Wrapped checksum mismatch", fmt.Errorf("error: %w", checksumMismatch(errors.New("mismatch"))), true},
+		{"Other error", errors.New("other"), false},
+		{"Unreachable device", unreachable(errors.New("refused")), false},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if isChecksumMismatch(tt.err) != tt.expected {
+				t.Errorf("Expected %v for error %v", tt.expected, tt.err)
+			}
+		})
+	}
+}
+
+func TestProgressReporter(t *testing.T) {
+	sending := make(chan int)
+	release := make(chan struct{})
+	reporter := newProgressReporter(func(step int) {
+		sending <- step
+		<-release
+	})
+
+	// the transfer is not blocked while the first step is being sent, and the steps reached meanwhile are dropped
+	reporter.report(30, 100)
+	if step := <-sending; step != 25 {
+		t.Fatalf("Expected step 25 to be sent, got %v", step)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		reporter.report(60, 100)
+		reporter.report(80, 100)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected reports not to block while another one is being sent")
+	}
+	release <- struct{}{}
+	reporter.wait()
+
+	// the steps already reported and the completed transfer are not sent
+	reporter.report(90, 100)
+	if step := <-sending; step != 75 {
+		t.Fatalf("Expected step 75 to be sent, got %v", step)
+	}
+	release <- struct{}{}
+
+	reporter.report(95, 100)
+	reporter.report(100, 100)
+	reporter.wait()
+
+	select {
+	case step := <-sending:
+		t.Errorf("Did not expect step %v to be sent", step)
+	default:
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	filecache "On-Premise/pkg/file_cache"
+	retrypolicy "On-Premise/pkg/retry_policy"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// chunkSize is the number of bytes of a job file sent to the device in every chunk of a chunked upload
+const chunkSize = 4 << 20
+
+// errChunkedUploadNotSupported is returned when the device does not have the chunked upload endpoints
+var errChunkedUploadNotSupported = errors.New("device does not support chunked uploads")
+
+// jobContentType returns the Content-Type the device expects for a job file with the received name
+func jobContentType(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".stl":
+		return "model/stl"
+	case ".3mf":
+		return "model/3mf"
+	case ".obj":
+		return "model/obj"
+	case ".zip":
+		return "application/zip"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// uploadKey returns the key identifying the upload of the job in the received message,
+// which is the same for all its attempts so that they resume the upload in progress
+func uploadKey(msg Message) string {
+	if msg.MessageUUID != "" {
+		return msg.MessageUUID
+	}
+	return msg.S3Name
+}
+
+// sendJobInChunks sends the job and its file to the device using the chunked upload protocol:
+// it starts the upload, or gets the one in progress for the same key, sends the file in chunks from the offset
+// committed by the device and completes it with the checksum of the file. progress is called after every chunk
+// Returns errChunkedUploadNotSupported if the device does not support it,
+// a non-nil error if there's another one during the execution and nil otherwise
+func sendJobInChunks(ctx context.Context, key string, job JobClient, file *filecache.File, clientIP string, progress func(sent int64, total int64)) error {
+	client := net.ParseIP(clientIP)
+	if client == nil {
+		return retrypolicy.Permanent(errors.New("invalid client IP"))
+	}
+
+	return uploadInChunks(ctx, "http://"+client.String()+":"+ClientJobPort+"/uploads", key, job, file.File, progress)
+}
+
+// uploadInChunks sends the job and its file with the chunked upload protocol to the uploads endpoint with the received URL,
+// see sendJobInChunks
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func uploadInChunks(ctx context.Context, baseURL string, key string, job JobClient, file *os.File, progress func(sent int64, total int64)) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error while reading the file: %w", err)
+	}
+	size := info.Size()
+
+	startJSON, err := json.Marshal(UploadClient{
+		Key:         key,
+		FileName:    job.FileName,
+		Material:    job.Material,
+		ContentType: jobContentType(job.FileName),
+		Size:        size,
+	})
+	if err != nil {
+		return errors.New("error creating the job to send to the client")
+	}
+
+	status, statusCode, err := uploadRequest(ctx, "POST", baseURL, bytes.NewReader(startJSON), minimumTransferTimeout)
+	if err != nil {
+		return err
+	}
+	if statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed {
+		return errChunkedUploadNotSupported
+	}
+	if statusCode != http.StatusOK {
+		err = fmt.Errorf("error starting the upload: status code %v", statusCode)
+		return deviceResponse(retrypolicy.FromStatusCode(statusCode, err))
+	}
+
+	uploadURL := baseURL + "/" + status.UploadID
+	offset := status.Offset
+	if offset > 0 {
+		fmt.Printf("Resuming upload of %v at %v of %v bytes\n", job.FileName, offset, size)
+	}
+
+	for offset < size {
+		length := size - offset
+		if length > chunkSize {
+			length = chunkSize
+		}
+
+		chunk := io.NewSectionReader(file, offset, length)
+		status, statusCode, err = uploadRequest(ctx, "PUT", fmt.Sprintf("%s?offset=%d", uploadURL, offset), chunk, transferTimeout(length))
+		if err != nil {
+			return err
+		}
+
+		// the device committed a different number of bytes than expected, the upload continues from them
+		if statusCode == http.StatusConflict && status.Offset != offset {
+			offset = status.Offset
+			continue
+		}
+		if statusCode != http.StatusOK {
+			err = fmt.Errorf("error sending the chunk at offset %v: status code %v", offset, statusCode)
+			return deviceResponse(retrypolicy.FromStatusCode(statusCode, err))
+		}
+
+		offset = status.Offset
+		progress(offset, size)
+	}
+
+	completeJSON, err := json.Marshal(map[string]string{"sha256": job.SHA256})
+	if err != nil {
+		return errors.New("error creating the checksum to send to the client")
+	}
+
+	_, statusCode, err = uploadRequest(ctx, "POST", uploadURL+"/complete", bytes.NewReader(completeJSON), minimumTransferTimeout)
+	if err != nil {
+		return err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnprocessableEntity:
+		// the device discarded the upload, so the next attempt starts it again
+		return deviceResponse(checksumMismatch(errors.New("the file received by the device does not match its checksum")))
+	case http.StatusConflict:
+		return deviceResponse(errors.New("the device has not received the whole file"))
+	default:
+		err = fmt.Errorf("error completing the upload: status code %v", statusCode)
+		return deviceResponse(retrypolicy.FromStatusCode(statusCode, err))
+	}
+}
+
+// uploadRequest sends a request of the chunked upload protocol to the device, cancelling it after the received timeout
+// Returns the status of the upload, if the device included it in the response, and the response status code.
+// Returns a non-nil error if the request could not be performed and nil otherwise
+func uploadRequest(ctx context.Context, method string, url string, body io.Reader, timeout time.Duration) (UploadStatus, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return UploadStatus{}, 0, err
+	}
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return UploadStatus{}, 0, unreachable(fmt.Errorf("Error while performing the request %w", err))
+	}
+	defer res.Body.Close()
+
+	var status UploadStatus
+	if res.Header.Get("Content-Type") == "application/json" {
+		err = json.NewDecoder(res.Body).Decode(&status)
+		if err != nil {
+			return UploadStatus{}, 0, deviceResponse(fmt.Errorf("error while reading the upload status: %w", err))
+		}
+	}
+
+	return status, res.StatusCode, nil
+}
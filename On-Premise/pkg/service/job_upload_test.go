@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDevice implements the chunked upload protocol of the device API for a single upload, keeping the bytes committed
+type fakeDevice struct {
+	mu        sync.Mutex
+	committed []byte
+	// interruptAt is the offset at which the connection of the next chunk including it is closed
+	interruptAt int64
+	// chunks contains the offset of every chunk received
+	chunks    []int64
+	completed bool
+	// statusCodes replace the response of the requests to the received paths
+	statusCodes map[string]int
+}
+
+func (d *fakeDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if statusCode, ok := d.statusCodes[r.Method+" "+r.URL.Path]; ok {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/uploads":
+		var info UploadClient
+		_ = json.NewDecoder(r.Body).Decode(&info)
+		d.writeStatus(w, http.StatusOK, info.Size)
+	case r.Method == "PUT" && r.URL.Path == "/uploads/upload":
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		d.chunks = append(d.chunks, offset)
+		if offset != int64(len(d.committed)) {
+			d.writeStatus(w, http.StatusConflict, 0)
+			return
+		}
+
+		chunk, _ := io.ReadAll(r.Body)
+		if d.interruptAt > offset && d.interruptAt < offset+int64(len(chunk)) {
+			d.committed = append(d.committed, chunk[:d.interruptAt-offset]...)
+			d.interruptAt = 0
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+
+		d.committed = append(d.committed, chunk...)
+		d.writeStatus(w, http.StatusOK, 0)
+	case r.Method == "POST" && r.URL.Path == "/uploads/upload/complete":
+		var complete map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&complete)
+		hash := sha256.Sum256(d.committed)
+		if complete["sha256"] != hex.EncodeToString(hash[:]) {
+			d.committed = nil
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		d.completed = true
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (d *fakeDevice) writeStatus(w http.ResponseWriter, statusCode int, size int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(UploadStatus{UploadID: "upload", Offset: int64(len(d.committed)), Size: size})
+}
+
+// jobFile returns a file with the received content and the job that sends it
+func jobFile(t *testing.T, content []byte) (*os.File, JobClient) {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "part.stl")
+	err := os.WriteFile(name, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	hash := sha256.Sum256(content)
+	return file, JobClient{FileName: "part.stl", Material: "HR PA 12", SHA256: hex.EncodeToString(hash[:])}
+}
+
+func TestUploadInChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), (chunkSize*2+chunkSize/2)/16)
+
+	var tc = []struct {
+		committed   []byte
+		interruptAt int64
+		checksum    string
+		statusCodes map[string]int
+		chunks      []int64
+		fails       func(error) bool
+		testName    string
+	}{
+		{nil, 0, "", nil, []int64{0, chunkSize, 2 * chunkSize}, nil, "New upload"},
+		{content[:chunkSize+10], 0, "", nil, []int64{chunkSize + 10, 2*chunkSize + 10}, nil, "Resumed upload"},
+		{content[:10], 0, "", nil, []int64{10, 10 + chunkSize, 10 + 2*chunkSize}, nil, "Upload with bytes committed by a previous attempt"},
+		{nil, 0, strings.Repeat("0", 64), nil, []int64{0, chunkSize, 2 * chunkSize},
+			func(err error) bool { return isChecksumMismatch(err) && isDeviceResponse(err) }, "Checksum mismatch"},
+		{nil, 0, "", map[string]int{"POST /uploads": http.StatusNotFound}, nil,
+			func(err error) bool { return errors.Is(err, errChunkedUploadNotSupported) }, "Chunked uploads not supported"},
+		{nil, 0, "", map[string]int{"POST /uploads/upload/complete": http.StatusConflict}, []int64{0, chunkSize, 2 * chunkSize},
+			func(err error) bool { return isDeviceResponse(err) && !isChecksumMismatch(err) }, "Upload not completed by the device"},
+		{nil, chunkSize + 10, "", nil, []int64{0, chunkSize}, isUnreachable, "Interrupted upload"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			device := &fakeDevice{committed: tt.committed, interruptAt: tt.interruptAt, statusCodes: tt.statusCodes}
+			server := httptest.NewServer(device)
+			defer server.Close()
+
+			file, job := jobFile(t, content)
+			if tt.checksum != "" {
+				job.SHA256 = tt.checksum
+			}
+
+			var reports []int64
+			err := uploadInChunks(context.Background(), server.URL+"/uploads", "key", job, file, func(sent int64, total int64) {
+				reports = append(reports, sent)
+			})
+			// the handlers of the device finish before its state is checked
+			server.Close()
+
+			if tt.fails != nil {
+				if !tt.fails(err) {
+					t.Errorf("Unexpected error %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Did not expect error but got %v", err)
+			}
+
+			if fmt.Sprint(device.chunks) != fmt.Sprint(tt.chunks) {
+				t.Errorf("Expected chunks at offsets %v, got %v", tt.chunks, device.chunks)
+			}
+
+			if tt.fails == nil && (!device.completed || !bytes.Equal(device.committed, content) || reports[len(reports)-1] != int64(len(content))) {
+				t.Errorf("Expected the whole file to be uploaded, got %v bytes, completed %v and progress %v", len(device.committed), device.completed, reports)
+			}
+		})
+	}
+}
+
+func TestUploadInChunksResumesAfterInterruption(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), chunkSize*2/16)
+
+	device := &fakeDevice{interruptAt: chunkSize + 10}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	file, job := jobFile(t, content)
+
+	err := uploadInChunks(context.Background(), server.URL+"/uploads", "key", job, file, func(int64, int64) {})
+	if !isUnreachable(err) {
+		t.Fatalf("Expected the interrupted attempt to fail as unreachable, got %v", err)
+	}
+
+	// the next attempt continues from the bytes the device committed before the connection was closed
+	err = uploadInChunks(context.Background(), server.URL+"/uploads", "key", job, file, func(int64, int64) {})
+	if err != nil {
+		t.Fatalf("Did not expect error resuming the upload but got %v", err)
+	}
+	server.Close()
+
+	if fmt.Sprint(device.chunks) != fmt.Sprint([]int64{0, chunkSize, chunkSize + 10}) || !device.completed || !bytes.Equal(device.committed, content) {
+		t.Errorf("Unexpected chunks %v with %v bytes committed and completed %v", device.chunks, len(device.committed), device.completed)
+	}
+}
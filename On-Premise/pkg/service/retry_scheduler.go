@@ -0,0 +1,141 @@
+package service
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// scheduledDelivery is a delivery waiting in the retryScheduler, seq keeps the order of the ones due at the same time
+type scheduledDelivery struct {
+	d   *delivery
+	seq uint64
+}
+
+// deliveryHeap is a min-heap of scheduled deliveries ordered by the time of their next attempt
+type deliveryHeap []scheduledDelivery
+
+func (h deliveryHeap) Len() int { return len(h) }
+
+func (h deliveryHeap) Less(i, j int) bool {
+	if h[i].d.retry.NextAttempt != h[j].d.retry.NextAttempt {
+		return h[i].d.retry.NextAttempt < h[j].d.retry.NextAttempt
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h deliveryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *deliveryHeap) Push(x interface{}) { *h = append(*h, x.(scheduledDelivery)) }
+
+func (h *deliveryHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// retryScheduler keeps the deliveries waiting for their next attempt and submits them once they are due,
+// so that no worker is held while a message waits for its retry delay or for the circuit of its device.
+// Deliveries submitted again are processed after the messages submitted to their device lane in the meantime
+type retryScheduler struct {
+	mu      sync.Mutex
+	pending deliveryHeap
+	seq     uint64
+	stopped bool
+	wake    chan struct{}
+	done    chan struct{}
+	submit  func(*delivery)
+}
+
+// newRetryScheduler creates a retryScheduler that calls submit with every delivery once its next attempt is due
+func newRetryScheduler(submit func(*delivery)) *retryScheduler {
+	return &retryScheduler{
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		submit: submit,
+	}
+}
+
+// Schedule adds the delivery to the scheduler, which submits it at the NextAttempt of its retry. It never blocks
+// Returns false if the scheduler has stopped and the delivery was not added, and true otherwise
+func (r *retryScheduler) Schedule(d *delivery) bool {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return false
+	}
+	r.seq++
+	heap.Push(&r.pending, scheduledDelivery{d: d, seq: r.seq})
+	r.mu.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Run submits the scheduled deliveries as they become due until stop is closed
+func (r *retryScheduler) Run(stop <-chan struct{}) {
+	defer close(r.done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			r.mu.Lock()
+			r.stopped = true
+			r.mu.Unlock()
+			return
+		default:
+		}
+
+		r.mu.Lock()
+		var due *delivery
+		wait := time.Hour
+		if len(r.pending) > 0 {
+			wait = time.Until(time.UnixMilli(r.pending[0].d.retry.NextAttempt))
+			if wait <= 0 {
+				due = heap.Pop(&r.pending).(scheduledDelivery).d
+			}
+		}
+		r.mu.Unlock()
+
+		// submitting blocks while the worker pool is full, which only delays the deliveries already due
+		if due != nil {
+			r.submit(due)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-stop:
+		case <-r.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Wait blocks until Run returns and returns the deliveries that were not submitted
+func (r *retryScheduler) Wait() []*delivery {
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	remaining := make([]*delivery, 0, len(r.pending))
+	for len(r.pending) > 0 {
+		remaining = append(remaining, heap.Pop(&r.pending).(scheduledDelivery).d)
+	}
+	return remaining
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	retrypolicy "On-Premise/pkg/retry_policy"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// memoryRetryStore is a retry store that keeps the retries in memory
+type memoryRetryStore struct {
+	mu      sync.Mutex
+	retries map[string]PendingRetry
+}
+
+func newMemoryRetryStore(retries ...PendingRetry) *memoryRetryStore {
+	store := &memoryRetryStore{retries: make(map[string]PendingRetry)}
+	for _, retry := range retries {
+		store.retries[retry.ID] = retry
+	}
+	return store
+}
+
+func (r *memoryRetryStore) Save(retry PendingRetry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries[retry.ID] = retry
+	return nil
+}
+
+func (r *memoryRetryStore) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.retries, id)
+	return nil
+}
+
+func (r *memoryRetryStore) List() ([]PendingRetry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	retries := []PendingRetry{}
+	for _, retry := range r.retries {
+		retries = append(retries, retry)
+	}
+	return retries, nil
+}
+
+func (r *memoryRetryStore) Close() error {
+	return nil
+}
+
+func TestRetrySchedulerSubmitsWhenDue(t *testing.T) {
+	type submitted struct {
+		id string
+		at time.Time
+	}
+	received := make(chan submitted, 4)
+	scheduler := newRetryScheduler(func(d *delivery) {
+		received <- submitted{d.retry.ID, time.Now()}
+	})
+
+	stop := make(chan struct{})
+	go scheduler.Run(stop)
+
+	now := time.Now()
+	nextAttempts := map[string]time.Time{
+		"later":  now.Add(60 * time.Millisecond),
+		"soon":   now.Add(20 * time.Millisecond),
+		"due":    now.Add(-time.Second),
+		"due-2":  now.Add(-time.Second),
+		"future": now.Add(time.Hour),
+	}
+	for _, id := range []string{"later", "soon", "due", "due-2", "future"} {
+		scheduler.Schedule(&delivery{retry: PendingRetry{ID: id, NextAttempt: nextAttempts[id].UnixMilli()}})
+	}
+
+	order := []string{}
+	for i := 0; i < 4; i++ {
+		select {
+		case s := <-received:
+			if s.at.Before(time.UnixMilli(nextAttempts[s.id].UnixMilli())) {
+				t.Errorf("Delivery %v submitted at %v, before its next attempt %v", s.id, s.at, nextAttempts[s.id])
+			}
+			order = append(order, s.id)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected due deliveries to be submitted, got %v", order)
+		}
+	}
+
+	if fmt.Sprint(order) != fmt.Sprint([]string{"due", "due-2", "soon", "later"}) {
+		t.Errorf("Unexpected order %v", order)
+	}
+
+	close(stop)
+	remaining := scheduler.Wait()
+	if len(remaining) != 1 || remaining[0].retry.ID != "future" {
+		t.Errorf("Expected the future delivery not to be submitted, got %v", remaining)
+	}
+
+	if scheduler.Schedule(&delivery{retry: PendingRetry{ID: "stopped"}}) {
+		t.Errorf("Expected a stopped scheduler not to accept deliveries")
+	}
+}
+
+func TestParkedMessageDoesNotHoldWorker(t *testing.T) {
+	retries := newMemoryRetryStore()
+	policies := retrypolicy.Policies{Default: retrypolicy.Policy{MaxAttempts: 5}}
+	s := NewService(nil, nil, &discardDLQ{}, retries, Config{CircuitBreakerThreshold: 1, CircuitBreakerProbeInterval: 60, NumberOfWorkers: 1, RetryPolicies: policies})
+	stop := make(chan struct{})
+	s.stopping = stop
+	s.workCtx = context.Background()
+	go s.scheduler.Run(stop)
+
+	s.breaker.Failure("device")
+
+	// the only worker parks the message for the device and is free to process the messages of other devices
+	msg := Message{Type: "HEARTBEAT", DeviceUUID: "device", MessageUUID: "parked"}
+	s.workers.Submit(&delivery{message: msg, retry: PendingRetry{ID: "parked", Message: msg, Received: time.Now().UnixMilli()}, stop: func() {}})
+
+	closed := make(chan struct{})
+	go func() {
+		s.workers.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the worker not to wait for the probe of the device")
+	}
+
+	stored, _ := retries.List()
+	if len(stored) != 1 || stored[0].NextAttempt < time.Now().Add(59*time.Second).UnixMilli() {
+		t.Errorf("Expected the retry to be saved until the next probe, got %+v", stored)
+	}
+
+	close(stop)
+	if remaining := s.scheduler.Wait(); len(remaining) != 1 {
+		t.Errorf("Expected the parked message to wait in the scheduler, got %v", remaining)
+	}
+}
+
+// pollingQueue is an empty queue that signals every time it is polled
+type pollingQueue struct {
+	polled chan struct{}
+}
+
+func (q *pollingQueue) ReceiveMessages(ctx context.Context) []sqstypes.Message {
+	select {
+	case q.polled <- struct{}{}:
+	default:
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Millisecond):
+	}
+	return nil
+}
+
+func (q *pollingQueue) RemoveMessage(context.Context, sqstypes.Message) error {
+	return nil
+}
+
+func (q *pollingQueue) ChangeVisibility(context.Context, sqstypes.Message, time.Duration) error {
+	return nil
+}
+
+func TestRunPollsWithManyPendingRetries(t *testing.T) {
+	// more retries than the worker pool can hold, none of them due yet
+	pending := []PendingRetry{}
+	for i := 0; i < 4*pendingMessagesPerWorker+1; i++ {
+		msg := Message{Type: "HEARTBEAT", DeviceUUID: fmt.Sprintf("device-%v", i), MessageUUID: fmt.Sprintf("retry-%v", i)}
+		pending = append(pending, PendingRetry{ID: msg.MessageUUID, Message: msg, Attempt: 1, NextAttempt: time.Now().Add(time.Hour).UnixMilli()})
+	}
+	retries := newMemoryRetryStore(pending...)
+
+	q := &pollingQueue{polled: make(chan struct{}, 1)}
+	s := NewService(q, nil, &discardDLQ{}, retries, Config{NumberOfWorkers: 1, ShutdownTimeout: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-q.polled:
+	case <-time.After(time.Second):
+		t.Error("Expected the queue to be polled while the retries are waiting")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the service to stop")
+	}
+
+	if stored, _ := retries.List(); len(stored) != len(pending) {
+		t.Errorf("Expected the %v retries to be kept in the retry store, got %v", len(pending), len(stored))
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	retrystore "On-Premise/pkg/retry_store"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RetryStoreService is the struct used to set up the On-Premise Server while inspecting the retry store
+// It contains a retry store implementation
+type RetryStoreService struct {
+	retries retrystore.RetryStore
+}
+
+// NewRetryStoreService creates and returns the reference to a new RetryStoreService struct
+func NewRetryStoreService(retries retrystore.RetryStore) *RetryStoreService {
+	s := &RetryStoreService{
+		retries: retries,
+	}
+	return s
+}
+
+// Run shows every retry pending in the retry store, without modifying them, and exits.
+// It can be used while another agent is running with the same retry store
+func (s *RetryStoreService) Run() {
+	retries, err := s.retries.List()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	for _, retry := range retries {
+		s.showRetry(retry)
+	}
+
+	fmt.Printf("There are %v pending retries.\n", len(retries))
+	fmt.Println("Exiting....")
+	os.Exit(0)
+}
+
+func (s *RetryStoreService) showRetry(retry PendingRetry) {
+	received := time.UnixMilli(retry.Received).In(time.Local).Format("02/01/2006 15:04:05")
+	nextAttempt := time.UnixMilli(retry.NextAttempt).In(time.Local).Format("02/01/2006 15:04:05")
+
+	fmt.Printf("Message %v received on %v\n", retry.ID, received)
+	fmt.Printf("\tDevice Name: %v\n", retry.Message.DeviceName)
+	fmt.Printf("\tType: %v\n", retry.Message.Type)
+	fmt.Printf("\tAttempts: %v\n", retry.Attempt)
+	fmt.Printf("\tNext attempt: %v\n", nextAttempt)
+	fmt.Printf("\tLast Recorded Result: %v\n\n", retry.LastError)
+}
@@ -1,14 +1,19 @@
 package service
 
 import (
-	objstorage "On-Premise/pkg/obj_storage"
+	filecache "On-Premise/pkg/file_cache"
 	"On-Premise/pkg/queue"
+	retrystore "On-Premise/pkg/retry_store"
 	"On-Premise/pkg/types"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
+
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
 // Message is just a reference to type Message in package types so that the usage is shorter
@@ -17,104 +22,443 @@ type Message = types.Message
 // JobClient is just a reference to type JobClient in package types so that the usage is shorter
 type JobClient = types.JobClient
 
+// UploadClient is just a reference to type UploadClient in package types so that the usage is shorter
+type UploadClient = types.UploadClient
+
+// UploadStatus is just a reference to type UploadStatus in package types so that the usage is shorter
+type UploadStatus = types.UploadStatus
+
 // Config is just a reference to type Config in package types so that the usage is shorter
 type Config = types.Config
 
 // DLQMessage is just a reference to type DLQMessage in package types so that the usage is shorter
 type DLQMessage = types.DLQMessage
 
+// PendingRetry is just a reference to type PendingRetry in package types so that the usage is shorter
+type PendingRetry = types.PendingRetry
+
+// minimumVisibilityTimeout is the lowest visibility timeout used for received messages, as it is extended every half of it
+const minimumVisibilityTimeout = 2 * time.Second
+
 // Service is the struct used to set up the On-Premise Server
-// It contains a queue, a dead letter queue and object storage implementation and config values
+// It contains a queue, a dead letter queue and retry store implementation, the cache of job files, config values,
+// the pool of workers processing the messages, the scheduler of the messages waiting to be retried
+// and the circuit breaker of the devices.
+// While running, stopping is closed once the service is asked to stop and workCtx is the context used
+// to process messages, which is only cancelled if they cannot be finished within the shutdown timeout
 type Service struct {
-	queue      queue.Queue
-	objStorage objstorage.ObjStorage
-	dlq        queue.DeadLetterQueue
-	config     Config
+	queue     queue.Queue
+	files     *filecache.Cache
+	dlq       queue.DeadLetterQueue
+	retries   retrystore.RetryStore
+	config    Config
+	workers   *workerPool
+	scheduler *retryScheduler
+	breaker   *circuitBreaker
+	stopping  <-chan struct{}
+	workCtx   context.Context
 }
 
 // NewService creates and returns the reference to a new Service struct
-func NewService(queue queue.Queue, objStorage objstorage.ObjStorage, dlq queue.DeadLetterQueue, config Config) *Service {
+func NewService(queue queue.Queue, files *filecache.Cache, dlq queue.DeadLetterQueue, retries retrystore.RetryStore, config Config) *Service {
 	s := &Service{
-		queue:      queue,
-		objStorage: objStorage,
-		dlq:        dlq,
-		config:     config,
+		queue:   queue,
+		files:   files,
+		dlq:     dlq,
+		retries: retries,
+		config:  config,
 	}
+	s.breaker = newCircuitBreaker(config.CircuitBreakerThreshold, time.Duration(config.CircuitBreakerProbeInterval)*time.Second)
+	s.workers = newWorkerPool(config.NumberOfWorkers, config.NumberOfWorkers*pendingMessagesPerWorker, s.processDelivery)
+	s.scheduler = newRetryScheduler(s.workers.Submit)
 	return s
 }
 
 // Run is the main program loop.
-// It will poll for messages from the queue and process them one by one
-func (s *Service) Run() {
-	for {
-		receivedMessages := s.queue.ReceiveMessages()
+// It will first hand the retries left pending in the retry store to the retry scheduler and then poll for messages from the queue,
+// handing them to the worker pool, which processes messages for the same device in order and messages for
+// different devices in parallel. Polling is paused while the worker pool is full.
+// Messages waiting to be retried are kept by the retry scheduler, which submits them again once they are due.
+// Messages are kept invisible in the queue while they are waiting or being processed and are only deleted
+// once they have been processed successfully, moved to the dead letter queue or saved in the retry store,
+// so that they are received again or resumed if the service stops before that.
+// Once ctx is cancelled, polling stops and Run waits up to the shutdown timeout for the messages being processed
+// before cancelling them. Messages waiting to be processed or retried are left in the queue or the retry store
+func (s *Service) Run(ctx context.Context) {
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	s.stopping = ctx.Done()
+	s.workCtx = workCtx
+
+	go s.scheduler.Run(s.stopping)
+
+	s.resumePendingRetries()
+
+	for ctx.Err() == nil {
+		receivedMessages := s.queue.ReceiveMessages(ctx)
 
 		for _, queueMsg := range receivedMessages {
+			queueMsg := queueMsg
+
 			var parsedMessage Message
 			err := json.Unmarshal([]byte(*queueMsg.Body), &parsedMessage)
 			if err != nil {
+				// the message will never be valid, so we do not keep receiving it
 				fmt.Println("Error while unmarshalling the message")
+				s.removeMessage(queueMsg)
 				continue
 			}
 
-			go s.processMessage(parsedMessage)
-
-			err = s.queue.RemoveMessage(queueMsg)
-			if err != nil {
-				fmt.Printf("%v\n", err)
-				continue
+			id := parsedMessage.MessageUUID
+			if id == "" && queueMsg.MessageId != nil {
+				id = *queueMsg.MessageId
 			}
 
-			fmt.Printf("Message was read and deleted successfully\n\n")
+			s.workers.Submit(&delivery{
+				message:      parsedMessage,
+				queueMessage: &queueMsg,
+				retry: PendingRetry{
+					ID:       id,
+					Message:  parsedMessage,
+					Received: time.Now().UnixMilli(),
+				},
+				stop: s.keepInvisible(queueMsg),
+			})
 		}
 
 	}
+
+	s.drain(cancelWork)
 }
 
-func (s *Service) processMessage(msg Message) {
+// drain waits for the worker pool to finish the messages being processed, cancelling them
+// through the work context if the shutdown timeout is reached
+func (s *Service) drain(cancelWork context.CancelFunc) {
+	fmt.Println("Shutting down, waiting for messages being processed...")
 
-	waitTime := s.config.InitialTimeBetweenRetries
+	drained := make(chan struct{})
+	go func() {
+		// the retries waiting in the scheduler are already saved in the retry store, or left in the queue
+		for _, d := range s.scheduler.Wait() {
+			s.abandonDelivery(d)
+		}
+		s.workers.Close()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Duration(s.config.ShutdownTimeout) * time.Second):
+		fmt.Println("Shutdown timeout reached, cancelling messages being processed")
+		cancelWork()
+		<-drained
+	}
 
-	var err error
+	fmt.Println("Service stopped")
+}
 
-	for i := 0; i < s.config.NumberOfRetries; i++ {
-		switch msg.Type {
-		case "HEARTBEAT":
-			err = s.Heartbeat(msg)
-		case "JOB":
-			err = s.Job(msg)
-		case "UPLOAD":
-			err = s.Upload(msg)
-		default:
-			fmt.Println("The received message is invalid")
-			return
+// isStopping returns whether the service has been asked to stop
+func (s *Service) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// resumePendingRetries hands every retry left in the retry store to the retry scheduler, which submits them
+// at their next attempt in the order their messages were received, without blocking the polling of the queue
+func (s *Service) resumePendingRetries() {
+	retries, err := s.retries.List()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	if len(retries) > 0 {
+		fmt.Printf("Resuming %v pending retries\n", len(retries))
+	}
+
+	for _, retry := range retries {
+		s.scheduler.Schedule(&delivery{
+			message: retry.Message,
+			retry:   retry,
+			stop:    func() {},
+		})
+	}
+}
+
+// keepInvisible extends the visibility timeout of the received message periodically until the returned function is called
+func (s *Service) keepInvisible(queueMsg sqstypes.Message) func() {
+	timeout := time.Duration(s.config.VisibilityTimeout) * time.Second
+	if timeout < minimumVisibilityTimeout {
+		timeout = minimumVisibilityTimeout
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	extend := func() {
+		err := s.queue.ChangeVisibility(s.workCtx, queueMsg, timeout)
+		if err != nil {
+			fmt.Printf("%v\n", err)
 		}
+	}
+
+	// the message may wait in the worker pool for longer than the visibility timeout used when it was received
+	extend()
+
+	go func() {
+		defer close(stopped)
 
-		// if there was no error, we finished the processing, check for a url to send response and do it if present
-		if err == nil {
-			if msg.ResultURL != "" {
-				s.sendMessageOutcome(msg, "SUCCESS")
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				extend()
+			case <-done:
+				return
 			}
-			break
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// processDelivery processes the message of the received delivery and deletes it from the queue if it was completed,
+// otherwise it is left in the queue to be received again once its visibility timeout expires,
+// or straight away if the service is stopping
+func (s *Service) processDelivery(d *delivery) {
+	result := s.processMessage(d)
+
+	// the scheduler is in charge of the delivery until its next attempt
+	if result == resultScheduled {
+		return
+	}
+
+	d.stop()
+
+	if d.queueMessage == nil {
+		return
+	}
+
+	if result != resultCompleted {
+		if s.isStopping() {
+			s.releaseMessage(*d.queueMessage)
+			return
+		}
+		fmt.Printf("Message was not completed, it will be received again\n\n")
+		return
+	}
+
+	s.removeMessage(*d.queueMessage)
+}
+
+// abandonDelivery stops extending the visibility of the message of a delivery that will not be processed
+// and releases it, so that it can be received again
+func (s *Service) abandonDelivery(d *delivery) {
+	d.stop()
+
+	if d.queueMessage != nil {
+		s.releaseMessage(*d.queueMessage)
+	}
+}
+
+// releaseMessage makes the received message visible again in the queue, so that it can be received by other agents
+func (s *Service) releaseMessage(queueMsg sqstypes.Message) {
+	err := s.queue.ChangeVisibility(s.workCtx, queueMsg, 0)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	fmt.Printf("Message was released, it will be received again\n\n")
+}
+
+func (s *Service) removeMessage(queueMsg sqstypes.Message) {
+	err := s.queue.RemoveMessage(s.workCtx, queueMsg)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	fmt.Printf("Message was read and deleted successfully\n\n")
+}
+
+// processResult is the result of processing a delivery
+type processResult int
+
+const (
+	// resultPending means the message was not completed and is left in the queue or the retry store
+	resultPending processResult = iota
+	// resultCompleted means the message was processed successfully, it is invalid
+	// or it was moved to the dead letter queue after its last attempt
+	resultCompleted
+	// resultScheduled means the message failed and was handed to the retry scheduler for its next attempt
+	resultScheduled
+)
+
+// processMessage makes an attempt of the message of the received delivery, scheduling its next attempt
+// in case of failure according to the retry policy of its type.
+// Every failed attempt is saved in the retry store before scheduling the next one, and the message is
+// deleted from the queue once its retry has been saved.
+// While the circuit of the device is open, the message is not attempted but parked until the next probe
+// and DEVICE_UNREACHABLE is reported as its outcome.
+// If the service is stopping, no new attempts are made and the message is left in the queue or the retry store
+func (s *Service) processMessage(d *delivery) processResult {
+	msg := d.message
+	retry := d.retry
+	policy := s.config.RetryPolicies.For(msg.Type)
+	device := laneKey(msg)
+
+	if s.isStopping() {
+		return resultPending
+	}
+
+	allowed, nextProbe := s.breaker.Allow(device)
+	if !allowed {
+		fmt.Printf("Device %v is unreachable, message parked until %v\n", device, nextProbe.Format("15:04:05"))
+
+		// the outcome is only reported once while the message is parked
+		if retry.LastError != DeviceUnreachable {
+			retry.LastError = DeviceUnreachable
+			s.sendMessageOutcome(s.workCtx, msg, DeviceUnreachable)
+		}
+
+		if !policy.ShouldRetry(nil, retry.Attempt, time.UnixMilli(retry.Received), nextProbe) {
+			return s.deadLetter(msg, retry)
 		}
 
-		// Otherwise, we log the error, send the result, wait the correspoding time and double it for next iteration
-		fmt.Printf("There was an error processing the message: %v\n", err)
+		// rounded up so that the message is not submitted before the probe time
+		retry.NextAttempt = nextProbe.Add(time.Millisecond - 1).UnixMilli()
+		return s.scheduleRetry(d, retry)
+	}
 
-		s.sendMessageOutcome(msg, fmt.Sprintf("FAILURE: %v", err))
+	var err error
 
-		if i < s.config.NumberOfRetries-1 {
-			time.Sleep(time.Duration(waitTime) * time.Second)
-			waitTime *= 2
-		} else {
-			s.sendToDeadLetterQueue(msg, fmt.Sprintf("FAILURE: %v", err))
+	switch msg.Type {
+	case "HEARTBEAT":
+		err = s.Heartbeat(s.workCtx, msg)
+	case "JOB":
+		err = s.Job(s.workCtx, msg)
+	case "UPLOAD":
+		err = s.Upload(s.workCtx, msg)
+	default:
+		fmt.Println("The received message is invalid")
+		s.forgetRetry(retry)
+		return resultCompleted
+	}
+
+	// attempts cancelled because the shutdown timeout was reached are not counted
+	if s.workCtx.Err() != nil {
+		return resultPending
+	}
+
+	retry.Attempt++
+
+	// if there was no error, we finished the processing, check for a url to send response and do it if present
+	if err == nil {
+		s.breaker.Success(device)
+		if msg.ResultURL != "" {
+			s.sendMessageOutcome(s.workCtx, msg, "SUCCESS")
 		}
+		s.forgetRetry(retry)
+		return resultCompleted
+	}
+
+	// only a response of the device shows that it is reachable again, other errors such as the ones reading
+	// the job file or sending the information to the backend say nothing about the device
+	if isUnreachable(err) {
+		s.breaker.Failure(device)
+	} else if isDeviceResponse(err) {
+		s.breaker.Success(device)
+	}
+
+	// Otherwise, we log the error, send the result and schedule the retry if the policy allows another attempt
+	fmt.Printf("There was an error processing the message: %v\n", err)
+
+	outcome := "FAILURE"
+	if isChecksumMismatch(err) {
+		outcome = ChecksumMismatch
+	}
+
+	retry.LastError = fmt.Sprintf("%v: %v", outcome, err)
+	s.sendMessageOutcome(s.workCtx, msg, retry.LastError)
+
+	nextAttempt := time.Now().Add(policy.Delay(retry.Attempt))
+	if !policy.ShouldRetry(err, retry.Attempt, time.UnixMilli(retry.Received), nextAttempt) {
+		return s.deadLetter(msg, retry)
+	}
 
+	retry.NextAttempt = nextAttempt.UnixMilli()
+	return s.scheduleRetry(d, retry)
+}
+
+// scheduleRetry saves the received retry and hands the delivery to the retry scheduler for its next attempt.
+// If the service is stopping, the delivery is not scheduled and it is left in the queue or the retry store
+func (s *Service) scheduleRetry(d *delivery, retry PendingRetry) processResult {
+	s.saveRetry(d, retry)
+	d.retry = retry
+
+	if s.isStopping() || !s.scheduler.Schedule(d) {
+		return resultPending
 	}
+	return resultScheduled
+}
 
+// deadLetter sends the message, which will not be attempted again, to the dead letter queue and forgets its retry
+func (s *Service) deadLetter(msg Message, retry PendingRetry) processResult {
+	err := s.sendToDeadLetterQueue(s.workCtx, msg, retry.LastError)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return resultPending
+	}
+
+	s.forgetRetry(retry)
+	return resultCompleted
 }
 
-func (s *Service) sendMessageOutcome(msg Message, result string) {
+// saveRetry saves the received retry in the retry store. Once it is saved, the store is in charge of the message,
+// so it is deleted from the queue. If it cannot be saved, the message is kept in the queue
+func (s *Service) saveRetry(d *delivery, retry PendingRetry) {
+	err := s.retries.Save(retry)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	if d.queueMessage != nil {
+		d.stop()
+		s.removeMessage(*d.queueMessage)
+		d.queueMessage = nil
+	}
+}
+
+// forgetRetry removes the received retry from the retry store if it was saved in it
+func (s *Service) forgetRetry(retry PendingRetry) {
+	// retries are only saved once their next attempt has been scheduled
+	if retry.NextAttempt == 0 {
+		return
+	}
+
+	err := s.retries.Delete(retry.ID)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+// sendMessageOutcome sends the result of processing the message to the backend, signed with the secret of the message
+// so that the backend can check that it was sent by the agent that received it, see signOutcome
+func (s *Service) sendMessageOutcome(ctx context.Context, msg Message, result string) {
 
 	url := msg.ResultURL + "/" + msg.DeviceUUID + "/" + msg.MessageUUID
 
@@ -130,14 +474,35 @@ func (s *Service) sendMessageOutcome(msg Message, result string) {
 		return
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Println("Error creating the result request to send")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.BackendAPIKey != "" {
+		req.Header.Set("X-API-Key", s.config.BackendAPIKey)
+	}
+	// messages sent by older backends do not have a secret, and their outcomes are sent unsigned
+	if msg.ResultSecret != "" {
+		req.Header.Set(signatureHeader, signOutcome(msg.ResultSecret, time.Now(), jsonData))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println("There was an error sending the result or the server responded with status code different to 200")
+		return
+	}
+	defer resp.Body.Close()
 
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK {
 		fmt.Println("There was an error sending the result or the server responded with status code different to 200")
 	}
 }
 
-func (s *Service) sendToDeadLetterQueue(msg Message, lastResult string) {
+// sendToDeadLetterQueue sends the information of the received message, that could not be processed, to the dead letter queue
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Service) sendToDeadLetterQueue(ctx context.Context, msg Message, lastResult string) error {
 	additionalInfo := ""
 
 	switch msg.Type {
@@ -159,14 +524,13 @@ func (s *Service) sendToDeadLetterQueue(msg Message, lastResult string) {
 
 	messageJSON, err := json.Marshal(DLQMessage)
 	if err != nil {
-		fmt.Printf("Got an error creating the message to the dead letter queue: %v\n", err)
-		return
+		return fmt.Errorf("got an error creating the message to the dead letter queue: %w", err)
 	}
 
-	err = s.dlq.SendMessage(string(messageJSON))
+	err = s.dlq.SendMessage(ctx, string(messageJSON))
 	if err != nil {
-		fmt.Printf("Got an error sending the message to the dead letter queue: %v\n", err)
-		return
+		return fmt.Errorf("got an error sending the message to the dead letter queue: %w", err)
 	}
 
+	return nil
 }
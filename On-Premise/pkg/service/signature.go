@@ -0,0 +1,23 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// signatureHeader is the header of the outcomes sent to the backend with their signature
+const signatureHeader = "X-Signature"
+
+// signOutcome returns the value of signatureHeader for the body of an outcome signed with the secret of its message
+// at the received time: "t=<unix timestamp in seconds>,v1=<hex HMAC-SHA256 of the timestamp, a dot and the body>".
+// The backend rejects the outcomes signed too long ago, so that captured ones cannot be replayed
+func signOutcome(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
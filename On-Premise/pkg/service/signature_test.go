@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignOutcome(t *testing.T) {
+	body := []byte(`{"Result":"SUCCESS","Timestamp":1650795291931}`)
+	expected := "t=1650795300,v1=e98247dc24e4fefd3aa33a5f2221d00fc4dfe993cbb8ff540ed855fcccb969f4"
+
+	if signature := signOutcome("secret", time.Unix(1650795300, 0), body); signature != expected {
+		t.Errorf("Expected signature %v, got %v", expected, signature)
+	}
+}
+
+func TestSendMessageOutcomeSigned(t *testing.T) {
+	type received struct {
+		path      string
+		signature string
+		body      []byte
+	}
+	requests := make(chan received, 2)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.URL.Path, r.Header.Get(signatureHeader), body}
+	}))
+	defer backend.Close()
+
+	s := &Service{}
+	msg := Message{ResultURL: backend.URL + "/responses", DeviceUUID: "d1", MessageUUID: "m1", ResultSecret: "secret"}
+
+	s.sendMessageOutcome(context.Background(), msg, "SUCCESS")
+	request := <-requests
+	if request.path != "/responses/d1/m1" {
+		t.Errorf("Expected the outcome to be sent to /responses/d1/m1, got %v", request.path)
+	}
+
+	// the outcome may have been signed in the previous second
+	now := time.Now()
+	signed := false
+	for _, timestamp := range []time.Time{now, now.Add(-time.Second)} {
+		signed = signed || request.signature == signOutcome("secret", timestamp, request.body)
+	}
+	if !signed {
+		t.Errorf("Expected the outcome %s to be signed with the secret of the message, got %q", request.body, request.signature)
+	}
+
+	// messages without a secret are sent unsigned
+	msg.ResultSecret = ""
+	s.sendMessageOutcome(context.Background(), msg, "SUCCESS")
+	if request = <-requests; request.signature != "" {
+		t.Errorf("Expected the outcome of a message without secret to be unsigned, got %q", request.signature)
+	}
+}
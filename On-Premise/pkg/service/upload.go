@@ -1,7 +1,9 @@
 package service
 
 import (
+	retrypolicy "On-Premise/pkg/retry_policy"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -16,21 +18,21 @@ const ClientPort = "55555"
 
 // Upload receives a message, validate it fields and sends it to the device using its API
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (s *Service) Upload(msg Message) error {
+func (s *Service) Upload(ctx context.Context, msg Message) error {
 	fmt.Println("Processing Upload")
 
 	if msg.IPAddress == "" || msg.UploadInfo == "" || msg.UploadURL == "" || msg.DeviceName == "" {
 		err := errors.New("some message's expected fields are missing")
-		return err
+		return retrypolicy.Permanent(err)
 	}
 
-	buffer, err := receiveInfoFromDevice(msg)
+	buffer, err := receiveInfoFromDevice(ctx, msg)
 
 	if err != nil {
 		return fmt.Errorf("error receiving information from the device: %w", err)
 	}
 
-	err = sendInfoToBackend(buffer, msg.UploadURL, msg.DeviceName)
+	err = sendInfoToBackend(ctx, buffer, msg.UploadURL, msg.DeviceName, s.config.BackendAPIKey)
 	if err != nil {
 		return fmt.Errorf("error while sending the information to the backend: %w", err)
 	}
@@ -40,26 +42,32 @@ func (s *Service) Upload(msg Message) error {
 	return nil
 }
 
-func receiveInfoFromDevice(msg Message) ([]byte, error) {
+func receiveInfoFromDevice(ctx context.Context, msg Message) ([]byte, error) {
 	client := net.ParseIP(msg.IPAddress)
 	if client == nil {
-		return nil, errors.New("invalid client IP")
+		return nil, retrypolicy.Permanent(errors.New("invalid client IP"))
 	}
 
-	res, err := http.Get("http://" + client.String() + ":" + ClientPort + "/" + strings.ToLower(msg.UploadInfo))
-
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+client.String()+":"+ClientPort+"/"+strings.ToLower(msg.UploadInfo), nil)
 	if err != nil {
 		return nil, err
 	}
 
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return nil, unreachable(err)
+	}
+
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("expected status code 200, got %v instead", res.StatusCode)
+		err = fmt.Errorf("expected status code 200, got %v instead", res.StatusCode)
+		return nil, deviceResponse(retrypolicy.FromStatusCode(res.StatusCode, err))
 	}
 
 	if res.Header.Get("Content-Type") != "application/json" {
-		return nil, fmt.Errorf("expected JSON body, got %v instead", res.Header.Get("Content-Type"))
+		return nil, deviceResponse(fmt.Errorf("expected JSON body, got %v instead", res.Header.Get("Content-Type")))
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -70,12 +78,12 @@ func receiveInfoFromDevice(msg Message) ([]byte, error) {
 	return body, nil
 }
 
-func sendInfoToBackend(info []byte, url string, deviceName string) error {
+func sendInfoToBackend(ctx context.Context, info []byte, url string, deviceName string, apiKey string) error {
 	httpClient := &http.Client{
 		Timeout: time.Second * 10,
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(info))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(info))
 
 	if err != nil {
 		return err
@@ -83,6 +91,9 @@ func sendInfoToBackend(info []byte, url string, deviceName string) error {
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Device", deviceName)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
 	res, err := httpClient.Do(req)
 
 	if err != nil {
@@ -92,7 +103,8 @@ func sendInfoToBackend(info []byte, url string, deviceName string) error {
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("expected status code 200, got %v instead", res.StatusCode)
+		err = fmt.Errorf("expected status code 200, got %v instead", res.StatusCode)
+		return retrypolicy.FromStatusCode(res.StatusCode, err)
 	}
 
 	return nil
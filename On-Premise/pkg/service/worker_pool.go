@@ -0,0 +1,118 @@
+package service
+
+import (
+	"sync"
+
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// pendingMessagesPerWorker is the number of received messages, per worker, that can be waiting
+// to be processed before Submit blocks and the service stops polling the queue
+const pendingMessagesPerWorker = 4
+
+// delivery represents a message that is waiting or being processed
+// It contains the parsed message, the one received from the queue, needed to extend its visibility or delete it,
+// which is nil if the message was resumed from the retry store or it has already been saved in it,
+// its retry state and the function that stops extending its visibility
+type delivery struct {
+	message      Message
+	queueMessage *sqstypes.Message
+	retry        PendingRetry
+	stop         func()
+}
+
+// workerPool processes messages using a fixed number of goroutines.
+// Messages are grouped in lanes by device, so that messages for the same device are processed
+// strictly in the order they were submitted while messages for different devices are processed in parallel
+type workerPool struct {
+	mu      sync.Mutex
+	lanes   map[string][]*delivery
+	ready   chan string
+	slots   chan struct{}
+	process func(*delivery)
+	wg      sync.WaitGroup
+}
+
+// newWorkerPool creates a workerPool with the given number of workers that calls process for every submitted delivery.
+// capacity is the maximum number of submitted messages waiting or being processed, Submit blocks when it is reached
+func newWorkerPool(workers int, capacity int, process func(*delivery)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < workers {
+		capacity = workers
+	}
+
+	p := &workerPool{
+		lanes:   make(map[string][]*delivery),
+		ready:   make(chan string, capacity),
+		slots:   make(chan struct{}, capacity),
+		process: process,
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// laneKey returns the key of the lane the message belongs to
+func laneKey(msg Message) string {
+	if msg.DeviceUUID != "" {
+		return msg.DeviceUUID
+	}
+	return msg.IPAddress
+}
+
+// Submit adds the delivery at the end of its device lane, blocking while the pool is at full capacity
+func (p *workerPool) Submit(d *delivery) {
+	p.slots <- struct{}{}
+
+	key := laneKey(d.message)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, active := p.lanes[key]
+	p.lanes[key] = append(p.lanes[key], d)
+
+	// a lane is only scheduled once, the worker processing it schedules it again if more messages arrive
+	// ready never blocks as there cannot be more scheduled lanes than slots
+	if !active {
+		p.ready <- key
+	}
+}
+
+// Close stops accepting messages and waits until every submitted message has been processed
+func (p *workerPool) Close() {
+	for i := 0; i < cap(p.slots); i++ {
+		p.slots <- struct{}{}
+	}
+	close(p.ready)
+	p.wg.Wait()
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+
+	for key := range p.ready {
+		p.mu.Lock()
+		d := p.lanes[key][0]
+		p.mu.Unlock()
+
+		p.process(d)
+
+		p.mu.Lock()
+		p.lanes[key] = p.lanes[key][1:]
+		if len(p.lanes[key]) == 0 {
+			delete(p.lanes, key)
+		} else {
+			p.ready <- key
+		}
+		p.mu.Unlock()
+
+		<-p.slots
+	}
+}
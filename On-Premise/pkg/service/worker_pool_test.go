@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrdersMessagesPerDevice(t *testing.T) {
+	var mu sync.Mutex
+	processed := make(map[string][]string)
+	var running, maxRunning int32
+
+	pool := newWorkerPool(3, 6, func(d *delivery) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		processed[d.message.DeviceUUID] = append(processed[d.message.DeviceUUID], d.message.MessageUUID)
+		mu.Unlock()
+
+		atomic.AddInt32(&running, -1)
+	})
+
+	devices := []string{"device-a", "device-b", "device-c", "device-d"}
+	for i := 0; i < 20; i++ {
+		for _, device := range devices {
+			pool.Submit(&delivery{message: Message{DeviceUUID: device, MessageUUID: fmt.Sprint(i)}})
+		}
+	}
+	pool.Close()
+
+	for _, device := range devices {
+		if len(processed[device]) != 20 {
+			t.Fatalf("Expected 20 messages processed for %v, got %v", device, len(processed[device]))
+		}
+		for i, msgUUID := range processed[device] {
+			if msgUUID != fmt.Sprint(i) {
+				t.Errorf("Messages for %v processed out of order: %v", device, processed[device])
+				break
+			}
+		}
+	}
+
+	if maxRunning > 3 {
+		t.Errorf("Expected at most 3 messages processed at the same time, got %v", maxRunning)
+	}
+}
+
+func TestWorkerPoolSameDeviceIsSerialized(t *testing.T) {
+	var running, maxRunning int32
+
+	pool := newWorkerPool(4, 8, func(d *delivery) {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, n)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i := 0; i < 10; i++ {
+		pool.Submit(&delivery{message: Message{DeviceUUID: "device"}})
+	}
+	pool.Close()
+
+	if maxRunning != 1 {
+		t.Errorf("Expected messages for the same device to be processed one at a time, got %v at the same time", maxRunning)
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import retrypolicy "On-Premise/pkg/retry_policy"
+
 // Message struct represent the message with all its possible fields that any of the backend endpoints
 // will probably receive
 type Message struct {
@@ -11,22 +13,61 @@ type Message struct {
 	IPAddress   string `json:"IPAddress,omitempty"`
 	UploadInfo  string `json:"UploadInfo,omitempty"`
 	UploadURL   string `json:"UploadURL,omitempty"`
+	DownloadURL string `json:"DownloadURL,omitempty"`
 	DeviceName  string `json:"DeviceName"`
 	DeviceUUID  string `json:"DeviceUUID,omitempty"`
 	MessageUUID string `json:"MessageUUID,omitempty"`
 	ResultURL   string `json:"ResultURL,omitempty"`
+	SHA256      string `json:"SHA256,omitempty"`
+	// ResultSecret is the secret used to sign the outcomes of the message sent to ResultURL
+	ResultSecret string `json:"ResultSecret,omitempty"`
 }
 
 // JobClient struct represent the struct that will be sent to devices when sending them a job
 type JobClient struct {
 	FileName string `json:"filename"`
 	Material string `json:"material"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// UploadClient struct represent the struct that will be sent to devices when starting a chunked upload of a job
+// Key identifies the job, so that starting it again resumes the upload in progress
+type UploadClient struct {
+	Key         string `json:"key"`
+	FileName    string `json:"filename"`
+	Material    string `json:"material"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// UploadStatus struct represent the status of a chunked upload returned by devices, with the number of bytes committed so far
+type UploadStatus struct {
+	UploadID string `json:"uploadID"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
 }
 
 // Config struct represents the configurable values for the Service
 type Config struct {
-	NumberOfRetries           int
-	InitialTimeBetweenRetries int
+	RetryPolicies               retrypolicy.Policies
+	NumberOfWorkers             int
+	VisibilityTimeout           int
+	CircuitBreakerThreshold     int
+	CircuitBreakerProbeInterval int
+	ShutdownTimeout             int
+	// BackendAPIKey is the API key sent to the backend with the uploaded information and the outcomes of the messages
+	BackendAPIKey string
+}
+
+// PendingRetry struct represents a message whose processing failed and that is waiting to be attempted again
+// Times are Unix timestamps in milliseconds
+type PendingRetry struct {
+	ID          string
+	Message     Message
+	Attempt     int
+	NextAttempt int64
+	LastError   string
+	Received    int64
 }
 
 // DLQMessage struct represents the messages that will be inserted and read from the
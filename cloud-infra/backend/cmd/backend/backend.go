@@ -1,26 +1,236 @@
 package main
 
 import (
+	"backend/pkg/auth"
+	"backend/pkg/awsconfig"
 	"backend/pkg/database"
+	"backend/pkg/materials"
 	objstorage "backend/pkg/obj_storage"
 	"backend/pkg/queue"
 	"backend/pkg/server"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func setUpServer() {
+// newDatabase returns the Database implementation selected with the DATABASE_TYPE environment variable.
+// DynamoDB is used when the variable is not present
+func newDatabase(awsConfig awsconfig.Config) database.Database {
+	databaseType, ok := os.LookupEnv("DATABASE_TYPE")
+	if !ok {
+		databaseType = "dynamodb"
+	}
+
+	switch databaseType {
+	case "dynamodb":
+		return database.NewDatabaseDynamoDB(awsConfig)
+	case "sql":
+		return database.NewDatabaseSQL()
+	default:
+		panic(fmt.Sprintf("Invalid DATABASE_TYPE value: %v", databaseType))
+	}
+}
+
+// newObjStorage returns the ObjStorage implementation selected with the OBJ_STORAGE_TYPE environment variable.
+// S3 is used when the variable is not present
+func newObjStorage(awsConfig awsconfig.Config) objstorage.ObjStorage {
+	objStorageType, ok := os.LookupEnv("OBJ_STORAGE_TYPE")
+	if !ok {
+		objStorageType = "s3"
+	}
+
+	switch objStorageType {
+	case "s3":
+		return objstorage.NewObjStorageS3(awsConfig)
+	case "filesystem":
+		return objstorage.NewObjStorageFileSystem()
+	default:
+		panic(fmt.Sprintf("Invalid OBJ_STORAGE_TYPE value: %v", objStorageType))
+	}
+}
+
+func setUpServer(ctx context.Context, shutdownTimeout time.Duration) {
+	awsConfig := awsconfig.FromEnv()
+
 	router := mux.NewRouter()
-	queue := queue.NewQueueSQS()
-	objstorage := objstorage.NewObjStorageS3()
-	database := database.NewDatabaseDynamoDB()
+	queue := queue.NewQueueSQS(awsConfig)
+	objstorage := newObjStorage(awsConfig)
+	database := newDatabase(awsConfig)
 	server := server.NewServer(queue, objstorage, database, router)
 
+	// the catalog is seeded by the first backend started with the database, so that jobs can be sent once it is deployed
+	hostname, _ := os.Hostname()
+	added, err := materials.SeedOnce(ctx, database, hostname+"/"+uuid.NewString(), time.Now())
+	if err != nil {
+		closeDatabase(database)
+		log.Fatal(err)
+	}
+	if added > 0 {
+		fmt.Printf("Added %v default materials to the catalog\n", added)
+	}
+
 	server.Routes()
-	server.ListenAndServe()
+	err = server.ListenAndServe(ctx, shutdownTimeout)
+	closeDatabase(database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+}
 
+// closeDatabase closes the database if its implementation holds connections that need to be closed
+func closeDatabase(database database.Database) {
+	if closer, ok := database.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			fmt.Printf("Error closing the database: %v\n", err)
+		}
+	}
+}
+
+// createAPIKey creates an API key with the received name in the database selected with DATABASE_TYPE, grants it
+// the admin role on every device and prints it, so that the first key can be created before any request
+// to the backend can be authenticated and authorized
+func createAPIKey(ctx context.Context, name string) {
+	database := newDatabase(awsconfig.FromEnv())
+	apiKey, key, err := auth.CreateAPIKey(ctx, database, name, "cli")
+	if err == nil {
+		subject := auth.Identity{Method: auth.MethodAPIKey, Subject: apiKey.KeyID}.String()
+		_, err = auth.CreateGrant(ctx, database, subject, auth.RoleAdmin, auth.ScopeAll, "cli")
+	}
+	closeDatabase(database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Created API key %v (%v) with the admin role, it will not be shown again:\n%v\n", apiKey.KeyID, apiKey.Name, key)
+}
+
+// seedMaterials adds the default materials missing from the catalog of the database selected with DATABASE_TYPE.
+// The catalog is seeded when the first backend is started with the database, so it is only needed to add again
+// the default materials removed by the users
+func seedMaterials(ctx context.Context) {
+	database := newDatabase(awsconfig.FromEnv())
+	added, err := materials.Seed(ctx, database)
+	closeDatabase(database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Added %v default materials to the catalog\n", added)
+}
+
+// setUpLocalServer sets up the backend using in-memory implementations, so no AWS service is needed.
+// The message queue, a dead letter queue and the stored files are served in localAddress so that
+// an On-Premise agent started with -mode=local can consume them. Authentication is disabled unless
+// AUTH_DISABLED is set, as no API key can be created before the backend starts
+func setUpLocalServer(ctx context.Context, shutdownTimeout time.Duration, localAddress string) {
+	if _, ok := os.LookupEnv("SERVER_URL"); !ok {
+		os.Setenv("SERVER_URL", "http://localhost:12345")
+	}
+
+	if _, ok := os.LookupEnv("AUTH_DISABLED"); !ok {
+		os.Setenv("AUTH_DISABLED", "true")
+	}
+
+	router := mux.NewRouter()
+	messageQueue := queue.NewQueueMemory()
+	deadLetterQueue := queue.NewQueueMemory()
+	objStorage := objstorage.NewObjStorageMemory()
+	database := database.NewDatabaseMemory()
+	server := server.NewServer(messageQueue, objStorage, database, router)
+
+	// the in-memory catalog is empty every time the backend is started
+	_, err := materials.Seed(ctx, database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	localRouter := mux.NewRouter()
+	messageQueue.RegisterRoutes(localRouter, "messages")
+	deadLetterQueue.RegisterRoutes(localRouter, "dlq")
+	objStorage.RegisterRoutes(localRouter)
+
+	listener, err := localListener(localAddress)
+	if err != nil {
+		panic(fmt.Sprintf("Error listening in %v: %v", localAddress, err))
+	}
+
+	// requests are cancelled on shutdown, so that agents waiting for messages do not delay it
+	localServer := &http.Server{
+		Handler:     localRouter,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		err := localServer.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	fmt.Printf("Running in local mode, On-Premise agent can connect to %v\n", localAddress)
+
+	server.Routes()
+	err = server.ListenAndServe(ctx, shutdownTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_ = localServer.Close()
+}
+
+// localListener listens in a unix socket if address starts with "unix:" and in a TCP address otherwise
+func localListener(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, "unix:") {
+		path := strings.TrimPrefix(address, "unix:")
+		_ = os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
 }
 
 func main() {
-	setUpServer()
+	mode := flag.String("mode", "aws", "Implementations to use: 'aws' for AWS services or 'local' for in-memory ones")
+	localAddress := flag.String("local-addr", "127.0.0.1:12346", "Address where queues and files are served in local mode, use unix:<path> for a unix socket")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for requests being handled when SIGINT or SIGTERM is received")
+	createKey := flag.String("create-api-key", "", "Create an API key with this name and the admin role in the configured database, print it and exit")
+	seed := flag.Bool("seed-materials", false, "Add the default materials missing from the catalog of the configured database and exit, which is done on the first start")
+
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *createKey != "" {
+		createAPIKey(ctx, *createKey)
+		return
+	}
+
+	if *seed {
+		seedMaterials(ctx)
+		return
+	}
+
+	switch *mode {
+	case "aws":
+		setUpServer(ctx, *shutdownTimeout)
+	case "local":
+		setUpLocalServer(ctx, *shutdownTimeout, *localAddress)
+	default:
+		fmt.Printf("Invalid mode %v\n", *mode)
+		os.Exit(1)
+	}
 }
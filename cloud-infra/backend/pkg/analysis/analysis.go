@@ -0,0 +1,183 @@
+package analysis
+
+import (
+	"backend/pkg/types"
+	"fmt"
+	"io"
+	"math"
+	"mesh"
+)
+
+// Analyze reads the meshes of the received file, whose format is given by the extension of its name,
+// and returns their analysis, with the mass estimated with the density of the received material. The reader is set back to the
+// start of the file, so it fails in the same cases as mesh.Read and can be used instead of it to validate the file
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func Analyze(file io.ReadSeeker, name string, material types.Material) (types.MeshAnalysis, error) {
+	if !(material.Density > 0) {
+		return types.MeshAnalysis{}, fmt.Errorf("error while analyzing %v: material %q has no density", name, material.Name)
+	}
+
+	parts := []*part{}
+	byName := make(map[string]*part)
+
+	err := mesh.Read(file, name, func(name string, t mesh.Triangle) {
+		p, ok := byName[name]
+		if !ok {
+			p = newPart(name)
+			byName[name] = p
+			parts = append(parts, p)
+		}
+		p.add(t)
+	})
+	if err != nil {
+		return types.MeshAnalysis{}, err
+	}
+
+	analysis := types.MeshAnalysis{
+		Material: material.Name,
+		Parts:    make([]types.MeshReport, 0, len(parts)),
+		Total:    types.MeshReport{Watertight: true, Manifold: true},
+	}
+
+	for i, p := range parts {
+		report := p.report(material.Density)
+		analysis.Parts = append(analysis.Parts, report)
+
+		total := &analysis.Total
+		total.Triangles += report.Triangles
+		total.Volume += report.Volume
+		total.SurfaceArea += report.SurfaceArea
+		total.BoundaryEdges += report.BoundaryEdges
+		total.NonManifoldEdges += report.NonManifoldEdges
+		total.Watertight = total.Watertight && report.Watertight
+		total.Manifold = total.Manifold && report.Manifold
+		total.Mass += report.Mass
+
+		for axis := 0; axis < 3; axis++ {
+			if i == 0 || report.Min[axis] < total.Min[axis] {
+				total.Min[axis] = report.Min[axis]
+			}
+			if i == 0 || report.Max[axis] > total.Max[axis] {
+				total.Max[axis] = report.Max[axis]
+			}
+		}
+	}
+
+	return analysis, nil
+}
+
+// part accumulates the measures of a mesh as its triangles are read.
+// Vertices are welded when they have exactly the same coordinates, so that the edges shared by triangles can be counted
+type part struct {
+	name      string
+	triangles int
+	min       [3]float64
+	max       [3]float64
+	// signedVolume is six times the volume enclosed by the mesh, positive if its triangles are oriented outwards
+	signedVolume float64
+	area         float64
+	vertices     map[mesh.Vec3]uint32
+	// edges contains how many times every directed edge, identified by its two vertices, is used by a triangle
+	edges map[uint64]int
+}
+
+func newPart(name string) *part {
+	return &part{
+		name:     name,
+		min:      [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)},
+		max:      [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+		vertices: make(map[mesh.Vec3]uint32),
+		edges:    make(map[uint64]int),
+	}
+}
+
+func (p *part) add(t mesh.Triangle) {
+	p.triangles++
+
+	var v [3][3]float64
+	var ids [3]uint32
+	for i, vertex := range t.Vertices {
+		for axis := 0; axis < 3; axis++ {
+			v[i][axis] = float64(vertex[axis])
+			p.min[axis] = math.Min(p.min[axis], v[i][axis])
+			p.max[axis] = math.Max(p.max[axis], v[i][axis])
+		}
+
+		id, ok := p.vertices[vertex]
+		if !ok {
+			id = uint32(len(p.vertices))
+			p.vertices[vertex] = id
+		}
+		ids[i] = id
+	}
+
+	// the signed volume of the tetrahedron formed by the triangle and the origin
+	p.signedVolume += dot(v[0], cross(v[1], v[2]))
+	p.area += length(cross(sub(v[1], v[0]), sub(v[2], v[0]))) / 2
+
+	// degenerate triangles do not have edges
+	if ids[0] == ids[1] || ids[1] == ids[2] || ids[0] == ids[2] {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		p.edges[edge(ids[i], ids[(i+1)%3])]++
+	}
+}
+
+func edge(from uint32, to uint32) uint64 {
+	return uint64(from)<<32 | uint64(to)
+}
+
+// report returns the report of the part, with its mass estimated with the received density in grams per cubic centimeter
+func (p *part) report(density float64) types.MeshReport {
+	report := types.MeshReport{
+		Name:        p.name,
+		Triangles:   p.triangles,
+		Min:         p.min,
+		Max:         p.max,
+		Volume:      math.Abs(p.signedVolume) / 6,
+		SurfaceArea: p.area,
+	}
+
+	for key, count := range p.edges {
+		from, to := uint32(key>>32), uint32(key)
+		reverse := p.edges[edge(to, from)]
+
+		// every edge used in both directions is only checked once
+		if reverse > 0 && from > to {
+			continue
+		}
+
+		switch {
+		case count+reverse == 1:
+			report.BoundaryEdges++
+		case count > 1 || reverse > 1:
+			report.NonManifoldEdges++
+		}
+	}
+
+	report.Watertight = report.BoundaryEdges == 0 && report.NonManifoldEdges == 0
+	report.Manifold = report.NonManifoldEdges == 0
+	report.Mass = report.Volume / 1000 * density
+	return report
+}
+
+func sub(a [3]float64, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross(a [3]float64, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func dot(a [3]float64, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length(a [3]float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
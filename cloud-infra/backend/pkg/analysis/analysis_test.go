@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"archive/zip"
+	"backend/pkg/types"
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// cubeFacets returns the facets of an ASCII STL cube of 10 mm with its triangles oriented outwards,
+// skipping the received ones and flipping the orientation of the triangle flipped, if it is not negative
+func cubeFacets(skip map[int]bool, flipped int) string {
+	corners := [8][3]int{{0, 0, 0}, {10, 0, 0}, {10, 10, 0}, {0, 10, 0}, {0, 0, 10}, {10, 0, 10}, {10, 10, 10}, {0, 10, 10}}
+	triangles := [12][3]int{
+		{0, 2, 1}, {0, 3, 2}, {4, 5, 6}, {4, 6, 7},
+		{0, 1, 5}, {0, 5, 4}, {2, 3, 7}, {2, 7, 6},
+		{1, 2, 6}, {1, 6, 5}, {0, 4, 7}, {0, 7, 3},
+	}
+
+	var b strings.Builder
+	for i, t := range triangles {
+		if skip[i] {
+			continue
+		}
+		if i == flipped {
+			t[1], t[2] = t[2], t[1]
+		}
+		b.WriteString("facet normal 0 0 0\nouter loop\n")
+		for _, v := range t {
+			fmt.Fprintf(&b, "vertex %v %v %v\n", corners[v][0], corners[v][1], corners[v][2])
+		}
+		b.WriteString("endloop\nendfacet\n")
+	}
+	return b.String()
+}
+
+func cube(skip map[int]bool, flipped int) string {
+	return "solid cube\n" + cubeFacets(skip, flipped) + "endsolid cube\n"
+}
+
+func TestAnalyze(t *testing.T) {
+	var tc = []struct {
+		content          string
+		triangles        int
+		volume           float64
+		area             float64
+		boundaryEdges    int
+		nonManifoldEdges int
+		watertight       bool
+		manifold         bool
+		testName         string
+	}{
+		{cube(nil, -1), 12, 1000, 600, 0, 0, true, true, "Closed cube"},
+		{cube(map[int]bool{2: true, 3: true}, -1), 10, 1000, 500, 4, 0, false, true, "Cube without top face"},
+		{cube(nil, 0), 12, 1000, 600, 0, 3, false, false, "Cube with a flipped triangle"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			analysis, err := Analyze(strings.NewReader(tt.content), "cube.stl", types.Material{Name: "HR PA 12", Density: 1.01})
+			if err != nil {
+				t.Fatalf("Did not expect error but got %v", err)
+			}
+
+			report := analysis.Total
+			if len(analysis.Parts) != 1 || analysis.Parts[0].Name != "cube.stl" || analysis.Material != "HR PA 12" {
+				t.Errorf("Unexpected analysis %+v", analysis)
+			}
+			if report.Triangles != tt.triangles || report.BoundaryEdges != tt.boundaryEdges || report.NonManifoldEdges != tt.nonManifoldEdges ||
+				report.Watertight != tt.watertight || report.Manifold != tt.manifold {
+				t.Errorf("Unexpected report %+v", report)
+			}
+			if report.Min != [3]float64{0, 0, 0} || report.Max != [3]float64{10, 10, 10} {
+				t.Errorf("Unexpected bounding box %v - %v", report.Min, report.Max)
+			}
+			if !almostEqual(report.SurfaceArea, tt.area) || !almostEqual(report.Mass, report.Volume/1000*1.01) {
+				t.Errorf("Unexpected measures %+v", report)
+			}
+			// the volume of open meshes or with flipped triangles is not reliable
+			if tt.watertight && !almostEqual(report.Volume, tt.volume) {
+				t.Errorf("Expected volume %v, got %v", tt.volume, report.Volume)
+			}
+		})
+	}
+}
+
+func TestAnalyzeParts(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range []string{"a.stl", "b.obj"} {
+		fw, _ := writer.Create(name)
+		if name == "a.stl" {
+			_, _ = fw.Write([]byte(cube(nil, -1)))
+		} else {
+			_, _ = fw.Write([]byte("v 20 0 0\nv 30 0 0\nv 20 10 0\nf 1 2 3\n"))
+		}
+	}
+	writer.Close()
+
+	analysis, err := Analyze(bytes.NewReader(buf.Bytes()), "parts.zip", types.Material{Name: "HR PP", Density: 0.89})
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	if len(analysis.Parts) != 2 || analysis.Parts[0].Name != "a.stl" || analysis.Parts[1].Name != "b.obj" {
+		t.Fatalf("Unexpected parts %+v", analysis.Parts)
+	}
+
+	total := analysis.Total
+	if total.Triangles != 13 || total.Watertight || !total.Manifold || total.BoundaryEdges != 3 {
+		t.Errorf("Unexpected total %+v", total)
+	}
+	if total.Min != [3]float64{0, 0, 0} || total.Max != [3]float64{30, 10, 10} || !almostEqual(total.Mass, 0.89) {
+		t.Errorf("Unexpected total %+v", total)
+	}
+
+	_, err = Analyze(strings.NewReader(cube(nil, -1)), "cube.stl", types.Material{Name: "plastic"})
+	if err == nil {
+		t.Errorf("Expected error with material without density")
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"backend/pkg/database"
+	"backend/pkg/types"
+	"backend/pkg/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MethodAPIKey is the method of the identities authenticated with an API key
+	MethodAPIKey = "api-key"
+	// MethodJWT is the method of the identities authenticated with a JWT bearer token
+	MethodJWT = "jwt"
+
+	// APIKeyHeader is the header used to send API keys, which can also be sent as bearer tokens
+	APIKeyHeader = "X-API-Key"
+
+	// apiKeyPrefix is the prefix of every API key, used to tell them apart from JWTs
+	apiKeyPrefix = "bk"
+)
+
+// ErrUnauthenticated is returned when the credentials of a request are missing or not valid
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// Identity represents the caller of an authenticated request
+type Identity struct {
+	// Method is how the caller was authenticated, MethodAPIKey or MethodJWT
+	Method string
+	// Subject is the ID of the API key or the subject of the token
+	Subject string
+	// Name is the name of the API key or the subject of the token
+	Name string
+}
+
+// String returns the identity as "method:subject", the form in which it is stored
+func (i Identity) String() string {
+	if i.Method == "" {
+		return ""
+	}
+	return i.Method + ":" + i.Subject
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of the received context carrying the identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity carried by the received context, and whether there is one.
+// There's none when authentication is disabled or the request did not need it
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Authenticator authenticates the requests to the backend with the API keys stored in the database
+// or with JWT bearer tokens verified against a JWKS file
+type Authenticator struct {
+	database database.Database
+	// jwt is nil if no JWKS file is configured, so only API keys are accepted
+	jwt      *JWTVerifier
+	disabled bool
+}
+
+// NewAuthenticator creates and returns the reference to a new Authenticator using the received database for the API keys.
+// JWTs are accepted if the environment variable AUTH_JWKS_FILE contains the path of the JWKS file with the keys
+// used to verify them, and their issuer and audience are checked if AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE are set.
+// Authentication is disabled if AUTH_DISABLED is true, which is only meant for local development.
+// It panics if the configuration is not valid
+func NewAuthenticator(db database.Database) *Authenticator {
+	a := &Authenticator{database: db}
+
+	disabled := os.Getenv("AUTH_DISABLED")
+	if disabled != "" {
+		var err error
+		a.disabled, err = strconv.ParseBool(disabled)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid AUTH_DISABLED %q: %v", disabled, err))
+		}
+	}
+
+	if a.disabled {
+		fmt.Println("Authentication disabled, every request is accepted")
+		return a
+	}
+
+	jwksFile := os.Getenv("AUTH_JWKS_FILE")
+	if jwksFile != "" {
+		verifier, err := NewJWTVerifier(jwksFile, os.Getenv("AUTH_JWT_ISSUER"), os.Getenv("AUTH_JWT_AUDIENCE"))
+		if err != nil {
+			panic(fmt.Sprintf("Invalid AUTH_JWKS_FILE %q: %v", jwksFile, err))
+		}
+		a.jwt = verifier
+	}
+
+	return a
+}
+
+// Run reloads the JWKS file when it is modified until ctx is cancelled. It returns immediately if no JWKS file is configured
+func (a *Authenticator) Run(ctx context.Context) {
+	if a.jwt == nil {
+		return
+	}
+	a.jwt.Run(ctx)
+}
+
+// Disabled returns whether authentication is disabled
+func (a *Authenticator) Disabled() bool {
+	return a.disabled
+}
+
+// Authenticate returns the identity of the caller of the received request, using the API key of the X-API-Key header
+// or the bearer token of the Authorization header, which can be either an API key or a JWT
+// Returns ErrUnauthenticated if the credentials are missing or not valid, other non-nil error if there's one
+// during the execution and nil otherwise
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key != "" {
+		return a.authenticateAPIKey(r.Context(), key)
+	}
+
+	authorization := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(authorization) != 2 || !strings.EqualFold(authorization[0], "Bearer") {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	token := strings.TrimSpace(authorization[1])
+	if token == "" {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	if strings.HasPrefix(token, apiKeyPrefix+"_") {
+		return a.authenticateAPIKey(r.Context(), token)
+	}
+
+	if a.jwt == nil {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	subject, err := a.jwt.Verify(token)
+	if err != nil {
+		fmt.Printf("Rejected JWT: %v\n", err)
+		return Identity{}, ErrUnauthenticated
+	}
+
+	return Identity{Method: MethodJWT, Subject: subject, Name: subject}, nil
+}
+
+// authenticateAPIKey returns the identity of the received API key if it exists and is not revoked
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) (Identity, error) {
+	id, secret, err := ParseAPIKey(key)
+	if err != nil {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	stored, err := a.database.GetAPIKey(ctx, id)
+	if err != nil {
+		return Identity{}, fmt.Errorf("error while authenticating API key: %w", err)
+	}
+
+	if stored.KeyID == "" || stored.RevokedAt != 0 || !VerifySecret(secret, stored.Hash) {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	return Identity{Method: MethodAPIKey, Subject: stored.KeyID, Name: stored.Name}, nil
+}
+
+// Middleware returns a gorilla/mux middleware rejecting with 401 the requests that cannot be authenticated,
+// except the ones for which public returns true. The identity of the caller is added to the context of the request.
+// Preflight requests are never authenticated, as browsers send them without credentials
+func (a *Authenticator) Middleware(public func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.disabled || r.Method == http.MethodOptions || public(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			identity, err := a.Authenticate(r)
+			if errors.Is(err, ErrUnauthenticated) {
+				fmt.Printf("Unauthenticated request to %v %v\n", r.Method, r.URL.Path)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="backend"`)
+				utils.Unauthorized(w)
+				return
+			}
+
+			if err != nil {
+				fmt.Println(err)
+				utils.ServerError(w)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// CreateAPIKey creates a new API key with the received name, stores it in the database with the hash of its secret
+// and returns it along with the key itself, which cannot be recovered later
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func CreateAPIKey(ctx context.Context, db database.Database, name string, createdBy string) (types.APIKey, string, error) {
+	id := make([]byte, 16)
+	secret := make([]byte, 32)
+
+	_, err := rand.Read(id)
+	if err == nil {
+		_, err = rand.Read(secret)
+	}
+	if err != nil {
+		return types.APIKey{}, "", fmt.Errorf("error while creating API key: %w", err)
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	apiKey := types.APIKey{
+		KeyID:     hex.EncodeToString(id),
+		Name:      name,
+		Hash:      HashSecret(encodedSecret),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	err = db.InsertAPIKey(ctx, apiKey)
+	if err != nil {
+		return types.APIKey{}, "", fmt.Errorf("error while creating API key: %w", err)
+	}
+
+	return apiKey, apiKeyPrefix + "_" + apiKey.KeyID + "_" + encodedSecret, nil
+}
+
+// ParseAPIKey splits an API key, "bk_<id>_<secret>", into its ID and secret
+// Returns a non-nil error if the key is not well formed and nil otherwise
+func ParseAPIKey(key string) (string, string, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", errors.New("malformed API key")
+	}
+	return parts[1], parts[2], nil
+}
+
+// HashSecret returns the hex-encoded SHA-256 hash of the secret of an API key, the value stored in the database
+func HashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// VerifySecret returns whether the secret of an API key matches the stored hash, comparing them in constant time
+func VerifySecret(secret string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// clockSkew is the leeway allowed when checking the expiration and not before times of the tokens
+	clockSkew = time.Minute
+	// jwksReloadInterval is the time between the checks of the JWKS file for modifications
+	jwksReloadInterval = 30 * time.Second
+)
+
+// algorithms contains the supported signing algorithms: RSASSA-PKCS1-v1_5 and ECDSA with SHA-2
+var algorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.RS384): true,
+	string(jose.RS512): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+}
+
+// JWTVerifier verifies JWT bearer tokens with the keys of a JWKS file, which is read again by Run when it is modified,
+// so that keys can be rotated without restarting the backend
+type JWTVerifier struct {
+	path     string
+	issuer   string
+	audience string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	modTime time.Time
+	keys    map[string]jose.JSONWebKey
+}
+
+// NewJWTVerifier creates and returns the reference to a new JWTVerifier using the keys of the JWKS file of the
+// received path. The issuer and audience of the tokens are only checked if they are not empty
+// Returns a non-nil error if the JWKS file cannot be read and nil otherwise
+func NewJWTVerifier(path string, issuer string, audience string) (*JWTVerifier, error) {
+	v := &JWTVerifier{path: path, issuer: issuer, audience: audience, interval: jwksReloadInterval}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading the JWKS file: %w", err)
+	}
+
+	err = v.load(info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// load reads the keys of the JWKS file, replacing the current ones.
+// Only the RSA and EC public keys used for signatures are kept
+func (v *JWTVerifier) load(modTime time.Time) error {
+	content, err := os.ReadFile(v.path)
+	if err != nil {
+		return fmt.Errorf("error while reading the JWKS file: %w", err)
+	}
+
+	var jwks jose.JSONWebKeySet
+	err = json.Unmarshal(content, &jwks)
+	if err != nil {
+		return fmt.Errorf("error while reading the JWKS file: %w", err)
+	}
+
+	keys := make(map[string]jose.JSONWebKey)
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys[key.KeyID] = key
+		default:
+			return fmt.Errorf("error while reading the key %q of the JWKS file: unsupported key type", key.KeyID)
+		}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("error while reading the JWKS file: no signing keys")
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.modTime = modTime
+	v.mu.Unlock()
+
+	fmt.Printf("Loaded %v keys from the JWKS file %v\n", len(keys), v.path)
+	return nil
+}
+
+// Run checks the JWKS file every reload interval until ctx is cancelled, reading it again if it was modified
+func (v *JWTVerifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		v.reload()
+	}
+}
+
+// reload reads the JWKS file again if it was modified since it was last read.
+// If the new file is not valid the current keys are kept until it is modified again
+func (v *JWTVerifier) reload() {
+	info, err := os.Stat(v.path)
+	if err != nil {
+		fmt.Printf("Error while checking the JWKS file, keeping the current keys: %v\n", err)
+		return
+	}
+
+	v.mu.RLock()
+	modified := !info.ModTime().Equal(v.modTime)
+	v.mu.RUnlock()
+
+	if !modified {
+		return
+	}
+
+	err = v.load(info.ModTime())
+	if err != nil {
+		fmt.Printf("%v, keeping the current keys\n", err)
+
+		v.mu.Lock()
+		v.modTime = info.ModTime()
+		v.mu.Unlock()
+	}
+}
+
+// Verify checks the signature of the received JWT with the keys of the JWKS file, its expiration and not before
+// times and, if configured, its issuer and audience. Tokens must have an expiration time and a subject
+// Returns the subject of the token and a non-nil error if it is not valid and nil otherwise
+func (v *JWTVerifier) Verify(token string) (string, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return "", fmt.Errorf("malformed token: %w", err)
+	}
+
+	if len(parsed.Headers) != 1 {
+		return "", errors.New("malformed token")
+	}
+	header := parsed.Headers[0]
+
+	if !algorithms[header.Algorithm] {
+		return "", fmt.Errorf("unsupported algorithm %q", header.Algorithm)
+	}
+
+	v.mu.RLock()
+	key, ok := v.keys[header.KeyID]
+	v.mu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", header.KeyID)
+	}
+
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return "", fmt.Errorf("key %q cannot be used with %v", header.KeyID, header.Algorithm)
+	}
+
+	var claims jwt.Claims
+	err = parsed.Claims(key.Key, &claims)
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	if claims.Expiry == nil {
+		return "", errors.New("token without expiration time")
+	}
+
+	expected := jwt.Expected{Issuer: v.issuer, Time: time.Now()}
+	if v.audience != "" {
+		expected.Audience = jwt.Audience{v.audience}
+	}
+
+	err = claims.ValidateWithLeeway(expected, clockSkew)
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return "", errors.New("token without subject")
+	}
+
+	return claims.Subject, nil
+}
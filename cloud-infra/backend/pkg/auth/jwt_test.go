@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signToken returns a JWT with the received header and claims signed with the key
+func signToken(t *testing.T, header map[string]interface{}, claims map[string]interface{}, key crypto.Signer) string {
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	hash := crypto.SHA256
+	switch fmt.Sprint(header["alg"]) {
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writeJWKS writes a JWKS file with the public keys of the received keys, by their IDs
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.Signer) {
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+	jwks := map[string][]map[string]string{"keys": {}}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			jwks["keys"] = append(jwks["keys"], map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "n": encode(key.N), "e": encode(big.NewInt(int64(key.E))),
+			})
+		case *ecdsa.PrivateKey:
+			// coordinates are as long as the size of the curve
+			size := (key.Curve.Params().BitSize + 7) / 8
+			x, y := make([]byte, size), make([]byte, size)
+			key.X.FillBytes(x)
+			key.Y.FillBytes(y)
+			jwks["keys"] = append(jwks["keys"], map[string]string{
+				"kty": "EC", "kid": kid, "crv": key.Curve.Params().Name,
+				"x": base64.RawURLEncoding.EncodeToString(x), "y": base64.RawURLEncoding.EncodeToString(y),
+			})
+		}
+	}
+
+	content, _ := json.Marshal(jwks)
+	err := os.WriteFile(path, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey})
+
+	verifier, err := NewJWTVerifier(path, "https://issuer", "backend")
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	now := time.Now().Unix()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"sub": "alice", "iss": "https://issuer", "aud": "backend", "exp": now + 300}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	var tc = []struct {
+		header   map[string]interface{}
+		claims   map[string]interface{}
+		key      crypto.Signer
+		valid    bool
+		testName string
+	}{
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, valid(), rsaKey, true, "Valid RS256 token"},
+		{map[string]interface{}{"alg": "ES256", "kid": "ec"}, valid(), ecKey, true, "Valid ES256 token"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("aud", []string{"other", "backend"}), rsaKey, true, "Audience in array"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("exp", now-30), rsaKey, true, "Expired within the clock skew"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("exp", now-300), rsaKey, false, "Expired token"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("exp", nil), rsaKey, false, "Token without expiration"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("nbf", now+300), rsaKey, false, "Token not valid yet"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("aud", "other"), rsaKey, false, "Other audience"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("iss", "https://other"), rsaKey, false, "Other issuer"},
+		{map[string]interface{}{"alg": "RS256", "kid": "rsa"}, with("sub", nil), rsaKey, false, "Token without subject"},
+		{map[string]interface{}{"alg": "ES256", "kid": "unknown"}, valid(), ecKey, false, "Unknown key"},
+		{map[string]interface{}{"alg": "ES256", "kid": "ec"}, valid(), otherKey, false, "Signed with other key"},
+		{map[string]interface{}{"alg": "RS256", "kid": "ec"}, valid(), rsaKey, false, "Algorithm not matching the key"},
+		{map[string]interface{}{"alg": "none", "kid": "rsa"}, valid(), rsaKey, false, "Unsupported algorithm"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			subject, err := verifier.Verify(signToken(t, tt.header, tt.claims, tt.key))
+			if (err == nil) != tt.valid {
+				t.Fatalf("Expected valid: %v, got %v", tt.valid, err)
+			}
+			if tt.valid && subject != "alice" {
+				t.Errorf("Expected subject alice, got %q", subject)
+			}
+		})
+	}
+}
+
+func TestVerifyReloadsKeys(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"old": oldKey})
+
+	verifier, err := NewJWTVerifier(path, "", "")
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 300}
+	newToken := signToken(t, map[string]interface{}{"alg": "ES384", "kid": "new"}, claims, newKey)
+
+	if _, err = verifier.Verify(newToken); err == nil {
+		t.Fatalf("Expected error verifying token signed with a key not in the JWKS yet")
+	}
+
+	// the keys are rotated, the modification time is changed explicitly as the file may be written within the same tick
+	writeJWKS(t, path, map[string]crypto.Signer{"new": newKey})
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is not read again while verifying tokens, only when it is checked periodically
+	if _, err = verifier.Verify(newToken); err == nil {
+		t.Fatalf("Expected error verifying token before the JWKS is reloaded")
+	}
+
+	verifier.reload()
+	if _, err = verifier.Verify(newToken); err != nil {
+		t.Errorf("Did not expect error verifying token signed with the new key but got %v", err)
+	}
+
+	// invalid files are ignored, keeping the current keys
+	if err = os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Hour)
+	if err = os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier.reload()
+	if _, err = verifier.Verify(newToken); err != nil {
+		t.Errorf("Did not expect error verifying token after writing an invalid JWKS but got %v", err)
+	}
+}
+
+func TestRunReloadsKeys(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"old": oldKey})
+
+	verifier, err := NewJWTVerifier(path, "", "")
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	verifier.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go verifier.Run(ctx)
+
+	writeJWKS(t, path, map[string]crypto.Signer{"new": newKey})
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := signToken(t, map[string]interface{}{"alg": "ES256", "kid": "new"}, map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 300}, newKey)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err = verifier.Verify(newToken); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the new key to be loaded, got %v", err)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"backend/pkg/database"
+	"backend/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// RoleViewer can read the devices, their messages and the information they uploaded
+	RoleViewer = "viewer"
+	// RoleOperator can also send messages, such as jobs, to the devices
+	RoleOperator = "operator"
+	// RoleAdmin can also manage the devices and, on every device, the materials, API keys and grants
+	RoleAdmin = "admin"
+
+	// ScopeAll is the scope of the grants on every device
+	ScopeAll = "*"
+
+	deviceScopePrefix = "device:"
+	groupScopePrefix  = "group:"
+)
+
+// roleLevels contains the level of every role, which has the permissions of the roles with lower levels
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// DeviceScope returns the scope of the grants on the device with the received UUID
+func DeviceScope(deviceUUID string) string {
+	return deviceScopePrefix + deviceUUID
+}
+
+// GroupScope returns the scope of the grants on the devices of the group with the received name
+func GroupScope(group string) string {
+	return groupScopePrefix + group
+}
+
+// covers returns whether the granted role has the permissions of the required one
+func covers(granted string, required string) bool {
+	level, ok := roleLevels[required]
+	return ok && roleLevels[granted] >= level
+}
+
+// inScope returns whether the device is in the scope. Only ScopeAll contains the empty device,
+// used for the actions that are not about a particular device
+func inScope(scope string, device types.Device) bool {
+	switch {
+	case scope == ScopeAll:
+		return true
+	case device.DeviceUUID != "" && scope == DeviceScope(device.DeviceUUID):
+		return true
+	case device.Group != "" && scope == GroupScope(device.Group):
+		return true
+	}
+	return false
+}
+
+// Allowed returns whether any of the grants gives at least the required role on the device.
+// If the device is empty, only the grants on every device are taken into account
+func Allowed(grants []types.Grant, role string, device types.Device) bool {
+	for _, grant := range grants {
+		if covers(grant.Role, role) && inScope(grant.Scope, device) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedAnywhere returns whether any of the grants gives at least the required role on any device,
+// used for the actions whose result is filtered by device, such as listing them
+func AllowedAnywhere(grants []types.Grant, role string) bool {
+	for _, grant := range grants {
+		if covers(grant.Role, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGrant checks that the received grant can be stored: its subject is an identity, "api-key:<id>" or "jwt:<sub>",
+// its role is one of the roles and its scope is ScopeAll, "device:<uuid>" or "group:<name>"
+// Returns nil if valid and a non-nil error otherwise
+func ValidateGrant(grant types.Grant) error {
+	method := strings.SplitN(grant.Subject, ":", 2)
+	if len(method) != 2 || (method[0] != MethodAPIKey && method[0] != MethodJWT) || method[1] == "" {
+		return fmt.Errorf("invalid grant: unknown subject %q", grant.Subject)
+	}
+
+	if _, ok := roleLevels[grant.Role]; !ok {
+		return fmt.Errorf("invalid grant: unknown role %q", grant.Role)
+	}
+
+	if grant.Scope == ScopeAll {
+		return nil
+	}
+
+	for _, prefix := range []string{deviceScopePrefix, groupScopePrefix} {
+		if strings.HasPrefix(grant.Scope, prefix) && len(grant.Scope) > len(prefix) {
+			return nil
+		}
+	}
+
+	return errors.New("invalid grant: the scope must be *, device:<uuid> or group:<name>")
+}
+
+// CreateGrant validates the grant of the role on the scope to the subject and stores it, recording who created it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func CreateGrant(ctx context.Context, db database.Database, subject string, role string, scope string, createdBy string) (types.Grant, error) {
+	grant := types.Grant{
+		GrantID:   uuid.NewString(),
+		Subject:   subject,
+		Role:      role,
+		Scope:     scope,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	err := ValidateGrant(grant)
+	if err != nil {
+		return types.Grant{}, err
+	}
+
+	err = db.InsertGrant(ctx, grant)
+	if err != nil {
+		return types.Grant{}, fmt.Errorf("error while creating grant: %w", err)
+	}
+	return grant, nil
+}
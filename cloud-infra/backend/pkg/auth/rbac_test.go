@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"backend/pkg/types"
+	"fmt"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	grants := []types.Grant{
+		{Subject: "api-key:a", Role: RoleViewer, Scope: ScopeAll},
+		{Subject: "api-key:a", Role: RoleOperator, Scope: GroupScope("lab")},
+		{Subject: "api-key:a", Role: RoleAdmin, Scope: DeviceScope("d1")},
+	}
+
+	production := types.Device{DeviceUUID: "d2", Group: "production"}
+	lab := types.Device{DeviceUUID: "d3", Group: "lab"}
+	own := types.Device{DeviceUUID: "d1", Group: "production"}
+
+	var tc = []struct {
+		role     string
+		device   types.Device
+		allowed  bool
+		testName string
+	}{
+		{RoleViewer, production, true, "Viewer on every device"},
+		{RoleViewer, types.Device{}, true, "Viewer on no particular device"},
+		{RoleOperator, production, false, "Operator out of the group"},
+		{RoleOperator, lab, true, "Operator in the group"},
+		{RoleAdmin, lab, false, "Admin in the group"},
+		{RoleAdmin, own, true, "Admin of the device"},
+		{RoleOperator, own, true, "Lower role of the device"},
+		{RoleOperator, types.Device{}, false, "Operator on no particular device"},
+		{RoleOperator, types.Device{Group: "lab"}, true, "Operator on new device of the group"},
+		{"owner", own, false, "Unknown role"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if allowed := Allowed(grants, tt.role, tt.device); allowed != tt.allowed {
+				t.Errorf("Expected allowed %v, got %v", tt.allowed, allowed)
+			}
+		})
+	}
+
+	if !AllowedAnywhere(grants, RoleAdmin) || AllowedAnywhere(grants[:2], RoleAdmin) || AllowedAnywhere(nil, RoleViewer) {
+		t.Errorf("Unexpected result of AllowedAnywhere")
+	}
+}
+
+func TestValidateGrant(t *testing.T) {
+	var tc = []struct {
+		grant    types.Grant
+		valid    bool
+		testName string
+	}{
+		{types.Grant{Subject: "api-key:a", Role: RoleAdmin, Scope: ScopeAll}, true, "Admin on every device"},
+		{types.Grant{Subject: "jwt:alice", Role: RoleViewer, Scope: "group:lab"}, true, "Viewer of a group"},
+		{types.Grant{Subject: "jwt:alice", Role: RoleOperator, Scope: "device:d1"}, true, "Operator of a device"},
+		{types.Grant{Subject: "alice", Role: RoleViewer, Scope: ScopeAll}, false, "Subject without method"},
+		{types.Grant{Subject: "password:alice", Role: RoleViewer, Scope: ScopeAll}, false, "Unknown method"},
+		{types.Grant{Subject: "jwt:", Role: RoleViewer, Scope: ScopeAll}, false, "Empty subject"},
+		{types.Grant{Subject: "jwt:alice", Role: "owner", Scope: ScopeAll}, false, "Unknown role"},
+		{types.Grant{Subject: "jwt:alice", Role: RoleViewer, Scope: "group:"}, false, "Empty group"},
+		{types.Grant{Subject: "jwt:alice", Role: RoleViewer, Scope: "site:a"}, false, "Unknown scope"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			err := ValidateGrant(tt.grant)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid: %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
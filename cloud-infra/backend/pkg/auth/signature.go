@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header of the results sent by the On-Premise agent with their signature, in the format
+// "t=<unix timestamp in seconds>,v1=<hex HMAC-SHA256 of the timestamp, a dot and the body>" signed with the secret
+// of the message
+const SignatureHeader = "X-Signature"
+
+// ErrInvalidSignature is returned when the signature of a result is missing, malformed, does not match its body
+// or was made outside the tolerance window
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// NewResultSecret returns a random secret to embed in a message, used by the agent to sign the results of that message
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func NewResultSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", fmt.Errorf("error while creating result secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign returns the value of SignatureHeader for the body signed with the secret at the received time
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(signature(secret, timestamp.Unix(), body)))
+}
+
+// signature returns the HMAC-SHA256 of the timestamp, a dot and the body with the secret
+func signature(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifySignature checks that the value of SignatureHeader is a signature of the body made with the secret
+// at most tolerance before or after now, so that captured results cannot be replayed later
+// Returns nil if valid and a non-nil error wrapping ErrInvalidSignature otherwise
+func VerifySignature(header string, secret string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		switch pair[0] {
+		case "t":
+			value, err := strconv.ParseInt(pair[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+			}
+			timestamp = value
+		case "v1":
+			// unknown schemes are ignored, so that they can be added while the agents are updated
+			value, err := hex.DecodeString(pair[1])
+			if err == nil {
+				signatures = append(signatures, value)
+			}
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("%w: missing timestamp or signature", ErrInvalidSignature)
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: signed %v ago, outside the tolerance of %v", ErrInvalidSignature, age.Round(time.Second), tolerance)
+	}
+
+	expected := signature(secret, timestamp, body)
+	for _, candidate := range signatures {
+		if hmac.Equal(candidate, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature does not match the body", ErrInvalidSignature)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"Result":"SUCCESS","Timestamp":1650795291931}`)
+	now := time.Unix(1650795300, 0)
+	valid := Sign("secret", now, body)
+	v1 := valid[strings.Index(valid, ",")+1:]
+
+	var tc = []struct {
+		header   string
+		valid    bool
+		testName string
+	}{
+		{valid, true, "Valid signature"},
+		{Sign("secret", now.Add(-4*time.Minute), body), true, "Signed within the tolerance"},
+		{Sign("secret", now.Add(4*time.Minute), body), true, "Signed in the future within the tolerance"},
+		{Sign("secret", now.Add(-6*time.Minute), body), false, "Replayed outside the tolerance"},
+		{Sign("secret", now.Add(6*time.Minute), body), false, "Signed in the future outside the tolerance"},
+		{Sign("other", now, body), false, "Signed with other secret"},
+		{Sign("secret", now, []byte(`{"Result":"FAILURE"}`)), false, "Signature of other body"},
+		{valid + ",v2=abc", true, "Unknown scheme ignored"},
+		{valid + ",v1=00", true, "Several signatures"},
+		{fmt.Sprintf("t=%d", now.Unix()), false, "Missing signature"},
+		{v1, false, "Missing timestamp"},
+		{"t=now," + v1, false, "Malformed timestamp"},
+		{"", false, "Missing header"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			err := VerifySignature(tt.header, "secret", body, now, 5*time.Minute)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Expected valid: %v, got %v", tt.valid, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Expected ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
+
+// TestSign checks the signature against the same vector as the On-Premise agent, so that both keep being compatible
+func TestSign(t *testing.T) {
+	body := []byte(`{"Result":"SUCCESS","Timestamp":1650795291931}`)
+	now := time.Unix(1650795300, 0)
+	expected := "t=1650795300,v1=e98247dc24e4fefd3aa33a5f2221d00fc4dfe993cbb8ff540ed855fcccb969f4"
+
+	if signature := Sign("secret", now, body); signature != expected {
+		t.Errorf("Expected signature %v, got %v", expected, signature)
+	}
+
+	err := VerifySignature(expected, "secret", body, now, 5*time.Minute)
+	if err != nil {
+		t.Errorf("Expected the signature of the agent to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package awsconfig
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	c := Config{
+		EndpointURL:   "http://localstack:4566",
+		S3EndpointURL: "http://minio:9000",
+	}
+
+	var tc = []struct {
+		service     string
+		expectedURL string
+	}{
+		{"S3", "http://minio:9000"},
+		{"SQS", "http://localstack:4566"},
+		{"DynamoDB", "http://localstack:4566"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.service), func(t *testing.T) {
+			endpoint, err := c.resolveEndpoint(tt.service, "us-east-1")
+			if err != nil {
+				t.Fatalf("Did not expect error but got %v", err)
+			}
+			if endpoint.URL != tt.expectedURL || endpoint.SigningRegion != "us-east-1" {
+				t.Errorf("Expected URL %v, got %v", tt.expectedURL, endpoint.URL)
+			}
+		})
+	}
+
+	_, err := Config{SQSEndpointURL: "http://elasticmq:9324"}.resolveEndpoint("S3", "us-east-1")
+	if err == nil {
+		t.Errorf("Expected fallback to default resolution for services without custom endpoint")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_S3_USE_PATH_STYLE", "true")
+	t.Setenv("S3_BUCKET_NAME", "bucket")
+
+	c := FromEnv()
+	if c.Region != DefaultRegion || !c.UsePathStyle || c.BucketName != "bucket" || c.CredentialsSource != "default" {
+		t.Errorf("Unexpected configuration %+v", c)
+	}
+}
+
+func TestLoadStaticCredentials(t *testing.T) {
+	_, err := Config{Region: DefaultRegion, CredentialsSource: "static"}.Load(context.Background())
+	if err == nil {
+		t.Errorf("Expected error with static credentials source and no keys")
+	}
+
+	cfg, err := Config{Region: DefaultRegion, CredentialsSource: "static", AccessKeyID: "id", SecretAccessKey: "secret"}.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "id" {
+		t.Errorf("Expected static credentials, got %+v and error %v", creds, err)
+	}
+}
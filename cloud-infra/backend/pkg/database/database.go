@@ -1,31 +1,116 @@
 package database
 
-import "backend/pkg/types"
+import (
+	"backend/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrFileDeleting is returned when a message references a file whose deletion has begun,
+// which has to be stored again once it is deleted
+var ErrFileDeleting = errors.New("the file is being deleted")
 
 // Database interface defines the methods that Database implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
+// Every method receives the context of the request, so that the call is cancelled if the request is
 type Database interface {
 
 	/*
 		Devices management
 	*/
 
-	GetDevices() ([]types.Device, error)
-	GetDeviceByUUID(string) (types.Device, error)
-	InsertDevice(types.Device) error
-	DeviceExistWithNameAndIP(string, string) (bool, error)
-	DeviceIPFromName(string) (string, error)
-	DeviceIPAndUUIDFromName(string) (string, string, error)
-	DeleteDeviceFromUUID(string) error
-	UpdateDevice(types.Device) error
+	GetDevices(context.Context) ([]types.Device, error)
+	GetDeviceByUUID(context.Context, string) (types.Device, error)
+	InsertDevice(context.Context, types.Device) error
+	DeviceExistWithNameAndIP(context.Context, string, string) (bool, error)
+	DeviceIPFromName(context.Context, string) (string, error)
+	DeviceIPAndUUIDFromName(context.Context, string) (string, string, error)
+	DeleteDeviceFromUUID(context.Context, string) error
+	UpdateDevice(context.Context, types.Device) error
 
 	/*
 		Messages and results management
 	*/
 
-	InsertMessage(types.MessageDB) error
-	InsertResult(types.ResultDB) error
+	InsertMessage(context.Context, types.MessageDB) error
+	InsertResult(context.Context, types.ResultDB) error
+
+	GetMessage(context.Context, string, string) (types.MessageDB, error)
+	GetMessagesFromDevice(context.Context, string) ([]types.MessageDB, error)
+	GetResponsesFromMessage(context.Context, string, string) ([]types.Response, error)
+
+	GetMessagesBefore(context.Context, int64, string, int) ([]types.MessageDB, string, error)
+	DeleteMessage(context.Context, string, string) error
+
+	/*
+		Files management
+	*/
+
+	AddFileReference(context.Context, types.FileReferenceDB) (bool, error)
+	RemoveFileReference(context.Context, types.FileReferenceDB) error
+	GetUnreferencedFiles(context.Context, int64) ([]types.FileDB, error)
+	BeginFileDeletion(context.Context, string) (bool, error)
+	DeleteFile(context.Context, string) (bool, error)
+
+	/*
+		Materials management
+	*/
+
+	GetMaterials(context.Context) ([]types.Material, error)
+	GetMaterial(context.Context, string) (types.Material, error)
+	PutMaterial(context.Context, types.Material) error
+	DeleteMaterial(context.Context, string) error
+
+	/*
+		API keys management
+	*/
+
+	GetAPIKeys(context.Context) ([]types.APIKey, error)
+	GetAPIKey(context.Context, string) (types.APIKey, error)
+	InsertAPIKey(context.Context, types.APIKey) error
+	RevokeAPIKey(context.Context, string, int64) error
+
+	/*
+		Access control management
+	*/
+
+	GetGrants(context.Context) ([]types.Grant, error)
+	GetGrantsOfSubject(context.Context, string) ([]types.Grant, error)
+	InsertGrant(context.Context, types.Grant) error
+	DeleteGrant(context.Context, string) error
+
+	InsertAuditEntry(context.Context, types.AuditEntry) error
+	GetAuditEntries(context.Context, int64) ([]types.AuditEntry, error)
+
+	/*
+		Leases management
+	*/
+
+	AcquireLease(context.Context, string, string, int64, int64) (bool, error)
+}
+
+// messagesCursor returns the cursor of the page of messages following the received message,
+// used by the implementations that return the messages sorted by timestamp and UUID
+func messagesCursor(msg types.MessageDB) string {
+	return fmt.Sprintf("%v/%v", msg.Timestamp, msg.MessageUUID)
+}
+
+// parseMessagesCursor returns the timestamp and UUID of the last message of the page before the received cursor.
+// An empty cursor returns a position before every message
+// Returns a non-nil error if the cursor is not valid and nil otherwise
+func parseMessagesCursor(cursor string) (int64, string, error) {
+	if cursor == "" {
+		return math.MinInt64, "", nil
+	}
 
-	GetMessagesFromDevice(string) ([]types.MessageDB, error)
-	GetResponsesFromMessage(string, string) ([]types.Response, error)
+	parts := strings.SplitN(cursor, "/", 2)
+	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return timestamp, parts[1], nil
 }
@@ -1,15 +1,17 @@
 package database
 
 import (
+	"backend/pkg/awsconfig"
 	"backend/pkg/types"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -19,47 +21,82 @@ import (
 // DynamoDB defines the struct used to implement Database interface using AWS DynamoDB
 // It contains a DynamoDB client and the name of the tables to be used
 type DynamoDB struct {
-	dynamoDBClient    *dynamodb.Client
-	DevicesTableName  string
-	MessagesTableName string
+	dynamoDBClient     *dynamodb.Client
+	DevicesTableName   string
+	MessagesTableName  string
+	FilesTableName     string
+	MaterialsTableName string
+	APIKeysTableName   string
+	GrantsTableName    string
+	AuditTableName     string
+	LeasesTableName    string
 }
 
-// NewDatabaseDynamoDB creates and returns the reference to a new DynamoDB struct
-func NewDatabaseDynamoDB() *DynamoDB {
+// NewDatabaseDynamoDB creates and returns the reference to a new DynamoDB struct using the received AWS configuration
+func NewDatabaseDynamoDB(awsConfig awsconfig.Config) *DynamoDB {
 	db := &DynamoDB{}
-	db.initialize()
+	db.initialize(awsConfig)
 	return db
 }
 
-func (db *DynamoDB) initialize() {
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+func (db *DynamoDB) initialize(awsConfig awsconfig.Config) {
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic(fmt.Sprintf("Configuration error in AWS DynamoDB: %v\n", err))
 	}
 
-	_, ok := os.LookupEnv("DYNAMO_DB_DEVICES_TABLE_NAME")
-	if !ok {
-		panic("Environment variable DYNAMO_DB_DEVICES_TABLE_NAME does not exist")
+	if awsConfig.DevicesTableName == "" {
+		panic("DynamoDB devices table name not configured, set environment variable DYNAMO_DB_DEVICES_TABLE_NAME")
 	}
 
-	_, ok = os.LookupEnv("DYNAMO_DB_MESSAGES_TABLE_NAME")
-	if !ok {
-		panic("Environment variable DYNAMO_DB_MESSAGES_TABLE_NAME does not exist")
+	if awsConfig.MessagesTableName == "" {
+		panic("DynamoDB messages table name not configured, set environment variable DYNAMO_DB_MESSAGES_TABLE_NAME")
 	}
 
-	db.DevicesTableName = os.Getenv("DYNAMO_DB_DEVICES_TABLE_NAME")
-	db.MessagesTableName = os.Getenv("DYNAMO_DB_MESSAGES_TABLE_NAME")
+	if awsConfig.FilesTableName == "" {
+		panic("DynamoDB files table name not configured, set environment variable DYNAMO_DB_FILES_TABLE_NAME")
+	}
+
+	db.DevicesTableName = awsConfig.DevicesTableName
+	db.MessagesTableName = awsConfig.MessagesTableName
+	if awsConfig.MaterialsTableName == "" {
+		panic("DynamoDB materials table name not configured, set environment variable DYNAMO_DB_MATERIALS_TABLE_NAME")
+	}
+
+	db.FilesTableName = awsConfig.FilesTableName
+	db.MaterialsTableName = awsConfig.MaterialsTableName
+
+	if awsConfig.APIKeysTableName == "" {
+		panic("DynamoDB API keys table name not configured, set environment variable DYNAMO_DB_API_KEYS_TABLE_NAME")
+	}
+
+	db.APIKeysTableName = awsConfig.APIKeysTableName
+
+	if awsConfig.GrantsTableName == "" {
+		panic("DynamoDB grants table name not configured, set environment variable DYNAMO_DB_GRANTS_TABLE_NAME")
+	}
+
+	if awsConfig.AuditTableName == "" {
+		panic("DynamoDB audit table name not configured, set environment variable DYNAMO_DB_AUDIT_TABLE_NAME")
+	}
+
+	db.GrantsTableName = awsConfig.GrantsTableName
+	db.AuditTableName = awsConfig.AuditTableName
+
+	if awsConfig.LeasesTableName == "" {
+		panic("DynamoDB leases table name not configured, set environment variable DYNAMO_DB_LEASES_TABLE_NAME")
+	}
+
+	db.LeasesTableName = awsConfig.LeasesTableName
 
 	db.dynamoDBClient = dynamodb.NewFromConfig(cfg)
 }
 
 // GetDevices returns an slice of all available Devices in the Device table from DynamoDB
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) GetDevices() ([]types.Device, error) {
-	out, err := db.dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
+func (db *DynamoDB) GetDevices(ctx context.Context) ([]types.Device, error) {
+	out, err := db.dynamoDBClient.Scan(ctx, &dynamodb.ScanInput{
 		TableName: aws.String(db.DevicesTableName),
 	})
 
@@ -80,8 +117,8 @@ func (db *DynamoDB) GetDevices() ([]types.Device, error) {
 
 // GetDeviceByUUID receives a UUID and returns the correspoding device if exists, and an empty one otherwise.
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) GetDeviceByUUID(uuid string) (types.Device, error) {
-	out, err := db.dynamoDBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+func (db *DynamoDB) GetDeviceByUUID(ctx context.Context, uuid string) (types.Device, error) {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(db.DevicesTableName),
 		Key: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: uuid},
@@ -106,28 +143,26 @@ func (db *DynamoDB) GetDeviceByUUID(uuid string) (types.Device, error) {
 
 // InsertDevice receives a Device and inserts it in the Device table from DynamoDB
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) InsertDevice(device types.Device) error {
-	var err error
-	if device.Model == "" {
-		_, err = db.dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-			TableName: aws.String(db.DevicesTableName),
-			Item: map[string]DynamoDBTypes.AttributeValue{
-				"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: device.DeviceUUID},
-				"Name":       &DynamoDBTypes.AttributeValueMemberS{Value: device.Name},
-				"IP":         &DynamoDBTypes.AttributeValueMemberS{Value: device.IP},
-			},
-		})
-	} else {
-		_, err = db.dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-			TableName: aws.String(db.DevicesTableName),
-			Item: map[string]DynamoDBTypes.AttributeValue{
-				"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: device.DeviceUUID},
-				"Name":       &DynamoDBTypes.AttributeValueMemberS{Value: device.Name},
-				"IP":         &DynamoDBTypes.AttributeValueMemberS{Value: device.IP},
-				"Model":      &DynamoDBTypes.AttributeValueMemberS{Value: device.Model},
-			},
-		})
+func (db *DynamoDB) InsertDevice(ctx context.Context, device types.Device) error {
+	item := map[string]DynamoDBTypes.AttributeValue{
+		"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: device.DeviceUUID},
+		"Name":       &DynamoDBTypes.AttributeValueMemberS{Value: device.Name},
+		"IP":         &DynamoDBTypes.AttributeValueMemberS{Value: device.IP},
+	}
+
+	// Model and Group are only stored when present
+	if device.Model != "" {
+		item["Model"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.Model}
 	}
+
+	if device.Group != "" {
+		item["Group"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.Group}
+	}
+
+	_, err := db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.DevicesTableName),
+		Item:      item,
+	})
 	if err != nil {
 		err = fmt.Errorf("error while inserting: %w", err)
 	}
@@ -138,7 +173,7 @@ func (db *DynamoDB) InsertDevice(device types.Device) error {
 // DeviceExistWithNameAndIP receives a device name and device ip and checks if there is any
 // device that already have one of those 2 attributes matching exactly. Returns true is so and false otherwise
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) DeviceExistWithNameAndIP(name string, ip string) (bool, error) {
+func (db *DynamoDB) DeviceExistWithNameAndIP(ctx context.Context, name string, ip string) (bool, error) {
 	expr, err := expression.NewBuilder().WithFilter(
 		expression.Or(
 			expression.Equal(expression.Name("IP"), expression.Value(ip)),
@@ -150,7 +185,7 @@ func (db *DynamoDB) DeviceExistWithNameAndIP(name string, ip string) (bool, erro
 		return true, err
 	}
 
-	out, err := db.dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
+	out, err := db.dynamoDBClient.Scan(ctx, &dynamodb.ScanInput{
 		TableName:                 aws.String(db.DevicesTableName),
 		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
@@ -170,7 +205,7 @@ func (db *DynamoDB) DeviceExistWithNameAndIP(name string, ip string) (bool, erro
 
 // DeviceIPFromName receives a name and returns its IP address if exists, and an empty string otherwise.
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) DeviceIPFromName(name string) (string, error) {
+func (db *DynamoDB) DeviceIPFromName(ctx context.Context, name string) (string, error) {
 	expr, err := expression.NewBuilder().WithFilter(
 		expression.Equal(expression.Name("Name"), expression.Value(name)),
 	).Build()
@@ -179,7 +214,7 @@ func (db *DynamoDB) DeviceIPFromName(name string) (string, error) {
 		return "", err
 	}
 
-	out, err := db.dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
+	out, err := db.dynamoDBClient.Scan(ctx, &dynamodb.ScanInput{
 		TableName:                 aws.String(db.DevicesTableName),
 		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
@@ -208,7 +243,7 @@ func (db *DynamoDB) DeviceIPFromName(name string) (string, error) {
 
 // DeviceIPAndUUIDFromName receives a name and returns its IP address if exists, and an empty string otherwise.
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) DeviceIPAndUUIDFromName(name string) (string, string, error) {
+func (db *DynamoDB) DeviceIPAndUUIDFromName(ctx context.Context, name string) (string, string, error) {
 	expr, err := expression.NewBuilder().WithFilter(
 		expression.Equal(expression.Name("Name"), expression.Value(name)),
 	).Build()
@@ -217,7 +252,7 @@ func (db *DynamoDB) DeviceIPAndUUIDFromName(name string) (string, string, error)
 		return "", "", err
 	}
 
-	out, err := db.dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
+	out, err := db.dynamoDBClient.Scan(ctx, &dynamodb.ScanInput{
 		TableName:                 aws.String(db.DevicesTableName),
 		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
@@ -246,8 +281,8 @@ func (db *DynamoDB) DeviceIPAndUUIDFromName(name string) (string, string, error)
 
 // DeleteDeviceFromUUID receives a UUID and deletes the correspoding device from the database
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) DeleteDeviceFromUUID(UUID string) error {
-	_, err := db.dynamoDBClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+func (db *DynamoDB) DeleteDeviceFromUUID(ctx context.Context, UUID string) error {
+	_, err := db.dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(db.DevicesTableName),
 		Key: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: UUID},
@@ -259,7 +294,7 @@ func (db *DynamoDB) DeleteDeviceFromUUID(UUID string) error {
 
 // UpdateDevice receives a Device and update the device with matching UUID with the values of the received one
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) UpdateDevice(device types.Device) error {
+func (db *DynamoDB) UpdateDevice(ctx context.Context, device types.Device) error {
 
 	var updateExpression string
 	expressionAttributes := make(map[string]DynamoDBTypes.AttributeValue)
@@ -267,10 +302,12 @@ func (db *DynamoDB) UpdateDevice(device types.Device) error {
 	expressionAttributes[":IP"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.IP}
 	expressionAttributes[":Name"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.Name}
 	expressionAttributes[":Model"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.Model}
+	expressionAttributes[":Group"] = &DynamoDBTypes.AttributeValueMemberS{Value: device.Group}
 
-	updateExpression = "set IP = :IP, #device_name = :Name, Model= :Model"
+	// Name and Group are reserved words in DynamoDB, so they are referenced through attribute names
+	updateExpression = "set IP = :IP, #device_name = :Name, Model= :Model, #device_group = :Group"
 
-	_, err := db.dynamoDBClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err := db.dynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(db.DevicesTableName),
 		Key: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: device.DeviceUUID},
@@ -278,7 +315,8 @@ func (db *DynamoDB) UpdateDevice(device types.Device) error {
 		UpdateExpression:          aws.String(updateExpression),
 		ExpressionAttributeValues: expressionAttributes,
 		ExpressionAttributeNames: map[string]string{
-			"#device_name": "Name",
+			"#device_name":  "Name",
+			"#device_group": "Group",
 		},
 	})
 
@@ -287,16 +325,35 @@ func (db *DynamoDB) UpdateDevice(device types.Device) error {
 
 // InsertMessage receives a types.MessageDB and inserts the message information into the DB
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) InsertMessage(msg types.MessageDB) error {
-	_, err := db.dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+func (db *DynamoDB) InsertMessage(ctx context.Context, msg types.MessageDB) error {
+	item := map[string]DynamoDBTypes.AttributeValue{
+		"DeviceUUID":     &DynamoDBTypes.AttributeValueMemberS{Value: msg.DeviceUUID},
+		"Information":    &DynamoDBTypes.AttributeValueMemberS{Value: "Message_" + msg.MessageUUID},
+		"Type":           &DynamoDBTypes.AttributeValueMemberS{Value: msg.Type},
+		"AdditionalInfo": &DynamoDBTypes.AttributeValueMemberS{Value: msg.AdditionalInfo},
+		"Timestamp":      &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(msg.Timestamp, 10)},
+	}
+
+	// the analysis is stored as a map, so it is read with the rest of the message
+	if msg.Analysis != nil {
+		analysis, err := attributevalue.Marshal(msg.Analysis)
+		if err != nil {
+			return fmt.Errorf("error while inserting message: %w", err)
+		}
+		item["Analysis"] = analysis
+	}
+
+	if msg.Caller != "" {
+		item["Caller"] = &DynamoDBTypes.AttributeValueMemberS{Value: msg.Caller}
+	}
+
+	if msg.ResultSecret != "" {
+		item["ResultSecret"] = &DynamoDBTypes.AttributeValueMemberS{Value: msg.ResultSecret}
+	}
+
+	_, err := db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(db.MessagesTableName),
-		Item: map[string]DynamoDBTypes.AttributeValue{
-			"DeviceUUID":     &DynamoDBTypes.AttributeValueMemberS{Value: msg.DeviceUUID},
-			"Information":    &DynamoDBTypes.AttributeValueMemberS{Value: "Message_" + msg.MessageUUID},
-			"Type":           &DynamoDBTypes.AttributeValueMemberS{Value: msg.Type},
-			"AdditionalInfo": &DynamoDBTypes.AttributeValueMemberS{Value: msg.AdditionalInfo},
-			"Timestamp":      &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(msg.Timestamp, 10)},
-		},
+		Item:      item,
 	})
 	if err != nil {
 		err = fmt.Errorf("error while inserting message: %w", err)
@@ -306,8 +363,8 @@ func (db *DynamoDB) InsertMessage(msg types.MessageDB) error {
 
 // InsertResult receives a types.ResultDB and inserts the message outcome information into the DB
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) InsertResult(result types.ResultDB) error {
-	_, err := db.dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+func (db *DynamoDB) InsertResult(ctx context.Context, result types.ResultDB) error {
+	_, err := db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(db.MessagesTableName),
 		Item: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID":  &DynamoDBTypes.AttributeValueMemberS{Value: result.DeviceUUID},
@@ -321,7 +378,7 @@ func (db *DynamoDB) InsertResult(result types.ResultDB) error {
 		return err
 	}
 
-	_, err = db.dynamoDBClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err = db.dynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(db.DevicesTableName),
 		Key: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: result.DeviceUUID},
@@ -337,7 +394,7 @@ func (db *DynamoDB) InsertResult(result types.ResultDB) error {
 		return err
 	}
 
-	_, err = db.dynamoDBClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err = db.dynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(db.MessagesTableName),
 		Key: map[string]DynamoDBTypes.AttributeValue{
 			"DeviceUUID":  &DynamoDBTypes.AttributeValueMemberS{Value: result.DeviceUUID},
@@ -357,10 +414,10 @@ func (db *DynamoDB) InsertResult(result types.ResultDB) error {
 	return nil
 }
 
-// GetMessagesFromDevice receives a deviceUUID and returns an slice with the information from its messages
+// GetMessagesFromDevice receives a deviceUUID and returns an slice with the information from its messages, oldest first
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) GetMessagesFromDevice(deviceUUID string) ([]types.MessageDB, error) {
-	out, err := db.dynamoDBClient.Query(context.TODO(), &dynamodb.QueryInput{
+func (db *DynamoDB) GetMessagesFromDevice(ctx context.Context, deviceUUID string) ([]types.MessageDB, error) {
+	out, err := db.dynamoDBClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(db.MessagesTableName),
 		KeyConditionExpression: aws.String("DeviceUUID = :deviceUUID and begins_with(Information, :prefix)"),
 		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
@@ -385,13 +442,54 @@ func (db *DynamoDB) GetMessagesFromDevice(deviceUUID string) ([]types.MessageDB,
 		messages[i].MessageUUID = strings.Split(messages[i].Information, "_")[1]
 	}
 
+	// the sort key of the table is the message UUID, so they are not returned by their timestamp
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Timestamp != messages[j].Timestamp {
+			return messages[i].Timestamp < messages[j].Timestamp
+		}
+		return messages[i].MessageUUID < messages[j].MessageUUID
+	})
+
 	return messages, nil
 }
 
+// GetMessage receives a deviceUUID and messageUUID and returns the information of the message,
+// which is empty if it does not exist
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetMessage(ctx context.Context, deviceUUID string, messageUUID string) (types.MessageDB, error) {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.MessagesTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"DeviceUUID":  &DynamoDBTypes.AttributeValueMemberS{Value: deviceUUID},
+			"Information": &DynamoDBTypes.AttributeValueMemberS{Value: "Message_" + messageUUID},
+		},
+	})
+
+	msg := types.MessageDB{}
+
+	if err != nil {
+		err = fmt.Errorf("error getting the message: %w", err)
+		return msg, err
+	}
+
+	if out.Item == nil {
+		return msg, nil
+	}
+
+	err = attributevalue.UnmarshalMap(out.Item, &msg)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling message info: %w", err)
+		return msg, err
+	}
+
+	msg.MessageUUID = messageUUID
+	return msg, nil
+}
+
 // GetResponsesFromMessage receives a deviceUUID and messageUUID and returns an slice with the information from its responses
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (db *DynamoDB) GetResponsesFromMessage(deviceUUID string, messageUUID string) ([]types.Response, error) {
-	out, err := db.dynamoDBClient.Query(context.TODO(), &dynamodb.QueryInput{
+func (db *DynamoDB) GetResponsesFromMessage(ctx context.Context, deviceUUID string, messageUUID string) ([]types.Response, error) {
+	out, err := db.dynamoDBClient.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(db.MessagesTableName),
 		KeyConditionExpression: aws.String("DeviceUUID = :deviceUUID and begins_with(Information, :prefix)"),
 		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
@@ -416,3 +514,780 @@ func (db *DynamoDB) GetResponsesFromMessage(deviceUUID string, messageUUID strin
 	return responses, nil
 
 }
+
+// messagesKey is the key of an item of the Messages table, used as the cursor of a scan
+type messagesKey struct {
+	DeviceUUID  string
+	Information string
+}
+
+// GetMessagesBefore receives a timestamp, a cursor and a limit and returns an slice with the information from up to limit
+// of the messages sent before the timestamp, in no particular order, starting after the cursor, which is empty for the first page.
+// It also returns the cursor of the next page, which is empty if there are no more messages. Pages may have
+// less than limit messages, or none, before the last one, as the limit is applied to the items scanned
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetMessagesBefore(ctx context.Context, before int64, cursor string, limit int) ([]types.MessageDB, string, error) {
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.And(
+			expression.BeginsWith(expression.Name("Information"), "Message_"),
+			expression.LessThan(expression.Name("Timestamp"), expression.Value(before)),
+		),
+	).Build()
+	if err != nil {
+		err = fmt.Errorf("error while building the expression: %w", err)
+		return nil, "", err
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(db.MessagesTableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int32(int32(limit)),
+	}
+
+	if cursor != "" {
+		var key messagesKey
+		err = json.Unmarshal([]byte(cursor), &key)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+		input.ExclusiveStartKey, err = attributevalue.MarshalMap(key)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	out, err := db.dynamoDBClient.Scan(ctx, input)
+	if err != nil {
+		err = fmt.Errorf("error while scanning the DB: %w", err)
+		return nil, "", err
+	}
+
+	messages := []types.MessageDB{}
+	err = attributevalue.UnmarshalListOfMaps(out.Items, &messages)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling messages info: %w", err)
+		return nil, "", err
+	}
+
+	for i := range messages {
+		messages[i].MessageUUID = strings.Split(messages[i].Information, "_")[1]
+	}
+
+	if len(out.LastEvaluatedKey) == 0 {
+		return messages, "", nil
+	}
+
+	var key messagesKey
+	err = attributevalue.UnmarshalMap(out.LastEvaluatedKey, &key)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling the key of the next page: %w", err)
+		return nil, "", err
+	}
+	next, err := json.Marshal(key)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling the key of the next page: %w", err)
+		return nil, "", err
+	}
+
+	return messages, string(next), nil
+}
+
+// DeleteMessage receives a deviceUUID and messageUUID and deletes the message and all its results from the DB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) DeleteMessage(ctx context.Context, deviceUUID string, messageUUID string) error {
+	paginator := dynamodb.NewQueryPaginator(db.dynamoDBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(db.MessagesTableName),
+		KeyConditionExpression: aws.String("DeviceUUID = :deviceUUID and begins_with(Information, :prefix)"),
+		ProjectionExpression:   aws.String("Information"),
+		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+			":deviceUUID": &DynamoDBTypes.AttributeValueMemberS{Value: deviceUUID},
+			":prefix":     &DynamoDBTypes.AttributeValueMemberS{Value: "Result_Message_" + messageUUID + "_"},
+		},
+	})
+
+	// results are deleted before the message, so that a failed deletion can be retried
+	information := []string{}
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error while retrieving responses: %w", err)
+			return err
+		}
+
+		for _, item := range out.Items {
+			if info, ok := item["Information"].(*DynamoDBTypes.AttributeValueMemberS); ok {
+				information = append(information, info.Value)
+			}
+		}
+	}
+	information = append(information, "Message_"+messageUUID)
+
+	for _, info := range information {
+		_, err := db.dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(db.MessagesTableName),
+			Key: map[string]DynamoDBTypes.AttributeValue{
+				"DeviceUUID":  &DynamoDBTypes.AttributeValueMemberS{Value: deviceUUID},
+				"Information": &DynamoDBTypes.AttributeValueMemberS{Value: info},
+			},
+		})
+		if err != nil {
+			err = fmt.Errorf("error while deleting message: %w", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isConditionFailed returns whether the received error is caused by a condition of the request that was not met,
+// either in a single write or in any of the writes of a transaction
+func isConditionFailed(err error) bool {
+	var conditionErr *DynamoDBTypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return true
+	}
+
+	var transactionErr *DynamoDBTypes.TransactionCanceledException
+	if errors.As(err, &transactionErr) {
+		for _, reason := range transactionErr.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddFileReference receives a types.FileReferenceDB and adds the reference of the message to the file,
+// creating the file if it does not exist. Adding the reference of a message more than once has no effect.
+// Returns whether the file already existed and ErrFileDeleting if its deletion has begun.
+// Files are stored as 'File_<key>' items and references as 'Reference_<messageUUID>' items of the files table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) AddFileReference(ctx context.Context, ref types.FileReferenceDB) (bool, error) {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.FilesTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "File_" + ref.FileKey},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("error getting the file: %w", err)
+		return false, err
+	}
+	existed := len(out.Item) != 0
+
+	// the deletion of the file can begin after it was read, so it is checked again while it is updated
+	_, err = db.dynamoDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []DynamoDBTypes.TransactWriteItem{
+			{
+				Put: &DynamoDBTypes.Put{
+					TableName: aws.String(db.FilesTableName),
+					Item: map[string]DynamoDBTypes.AttributeValue{
+						"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "Reference_" + ref.MessageUUID},
+						"File":    &DynamoDBTypes.AttributeValueMemberS{Value: ref.FileKey},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(FileKey)"),
+				},
+			},
+			{
+				Update: &DynamoDBTypes.Update{
+					TableName: aws.String(db.FilesTableName),
+					Key: map[string]DynamoDBTypes.AttributeValue{
+						"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "File_" + ref.FileKey},
+					},
+					UpdateExpression:    aws.String("add #references :one set #timestamp = :timestamp"),
+					ConditionExpression: aws.String("attribute_not_exists(#deleting) OR #deleting = :false"),
+					ExpressionAttributeNames: map[string]string{
+						"#references": "References",
+						"#timestamp":  "Timestamp",
+						"#deleting":   "Deleting",
+					},
+					ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+						":one":       &DynamoDBTypes.AttributeValueMemberN{Value: "1"},
+						":timestamp": &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(ref.Timestamp, 10)},
+						":false":     &DynamoDBTypes.AttributeValueMemberBOOL{Value: false},
+					},
+				},
+			},
+		},
+	})
+
+	// the reasons are in the order of the items, the second one is the file
+	var transactionErr *DynamoDBTypes.TransactionCanceledException
+	if errors.As(err, &transactionErr) && len(transactionErr.CancellationReasons) == 2 &&
+		aws.ToString(transactionErr.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+		return false, ErrFileDeleting
+	}
+
+	// the message already references the file
+	if isConditionFailed(err) {
+		return existed, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while inserting file reference: %w", err)
+		return false, err
+	}
+	return existed, nil
+}
+
+// RemoveFileReference receives a types.FileReferenceDB and removes the reference of its message to the file it sends,
+// if there is one. The file is kept with no references until it is deleted with DeleteFile
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) RemoveFileReference(ctx context.Context, ref types.FileReferenceDB) error {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.FilesTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "Reference_" + ref.MessageUUID},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("error getting the file reference: %w", err)
+		return err
+	}
+
+	reference := struct{ File string }{}
+	err = attributevalue.UnmarshalMap(out.Item, &reference)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling file reference info: %w", err)
+		return err
+	}
+
+	if reference.File == "" {
+		return nil
+	}
+
+	_, err = db.dynamoDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []DynamoDBTypes.TransactWriteItem{
+			{
+				Delete: &DynamoDBTypes.Delete{
+					TableName: aws.String(db.FilesTableName),
+					Key: map[string]DynamoDBTypes.AttributeValue{
+						"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "Reference_" + ref.MessageUUID},
+					},
+					ConditionExpression: aws.String("attribute_exists(FileKey)"),
+				},
+			},
+			{
+				Update: &DynamoDBTypes.Update{
+					TableName: aws.String(db.FilesTableName),
+					Key: map[string]DynamoDBTypes.AttributeValue{
+						"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "File_" + reference.File},
+					},
+					UpdateExpression:    aws.String("add #references :minusOne set #timestamp = :timestamp"),
+					ConditionExpression: aws.String("#references > :zero"),
+					ExpressionAttributeNames: map[string]string{
+						"#references": "References",
+						"#timestamp":  "Timestamp",
+					},
+					ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+						":minusOne":  &DynamoDBTypes.AttributeValueMemberN{Value: "-1"},
+						":zero":      &DynamoDBTypes.AttributeValueMemberN{Value: "0"},
+						":timestamp": &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(ref.Timestamp, 10)},
+					},
+				},
+			},
+		},
+	})
+
+	// the reference was removed concurrently
+	if isConditionFailed(err) {
+		return nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while deleting file reference: %w", err)
+	}
+	return err
+}
+
+// GetUnreferencedFiles receives a timestamp and returns an slice with the files that have no references since before it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetUnreferencedFiles(ctx context.Context, before int64) ([]types.FileDB, error) {
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.And(
+			expression.BeginsWith(expression.Name("FileKey"), "File_"),
+			expression.Equal(expression.Name("References"), expression.Value(0)),
+			expression.LessThan(expression.Name("Timestamp"), expression.Value(before)),
+		),
+	).Build()
+	if err != nil {
+		err = fmt.Errorf("error while building the expression: %w", err)
+		return nil, err
+	}
+
+	files := []types.FileDB{}
+	paginator := dynamodb.NewScanPaginator(db.dynamoDBClient, &dynamodb.ScanInput{
+		TableName:                 aws.String(db.FilesTableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error while scanning the DB: %w", err)
+			return nil, err
+		}
+
+		page := []types.FileDB{}
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			err = fmt.Errorf("error unmarshalling files info: %w", err)
+			return nil, err
+		}
+
+		for _, file := range page {
+			file.FileKey = strings.TrimPrefix(file.FileKey, "File_")
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// BeginFileDeletion receives a file key and begins the deletion of the file if it has no references,
+// so that it cannot be referenced again until it is deleted with DeleteFile.
+// Returns true if its deletion has begun, now or before, and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) BeginFileDeletion(ctx context.Context, fileKey string) (bool, error) {
+	_, err := db.dynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.FilesTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "File_" + fileKey},
+		},
+		UpdateExpression:    aws.String("set #deleting = :true"),
+		ConditionExpression: aws.String("#references = :zero"),
+		ExpressionAttributeNames: map[string]string{
+			"#references": "References",
+			"#deleting":   "Deleting",
+		},
+		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+			":zero": &DynamoDBTypes.AttributeValueMemberN{Value: "0"},
+			":true": &DynamoDBTypes.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+
+	// the file was referenced again or already deleted
+	if isConditionFailed(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while beginning the file deletion: %w", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteFile receives a file key and deletes the file from the DB if its deletion has begun with BeginFileDeletion.
+// Returns true if it was deleted and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) DeleteFile(ctx context.Context, fileKey string) (bool, error) {
+	_, err := db.dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.FilesTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"FileKey": &DynamoDBTypes.AttributeValueMemberS{Value: "File_" + fileKey},
+		},
+		ConditionExpression: aws.String("#deleting = :true"),
+		ExpressionAttributeNames: map[string]string{
+			"#deleting": "Deleting",
+		},
+		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+			":true": &DynamoDBTypes.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+
+	// the file was already deleted
+	if isConditionFailed(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while deleting file: %w", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMaterials returns an slice of all the materials of the catalog in the Materials table from DynamoDB, sorted by name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetMaterials(ctx context.Context) ([]types.Material, error) {
+	materials := []types.Material{}
+	paginator := dynamodb.NewScanPaginator(db.dynamoDBClient, &dynamodb.ScanInput{
+		TableName: aws.String(db.MaterialsTableName),
+	})
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error getting the materials: %w", err)
+			return nil, err
+		}
+
+		page := []types.Material{}
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			err = fmt.Errorf("error unmarshalling materials info: %w", err)
+			return nil, err
+		}
+		materials = append(materials, page...)
+	}
+
+	sort.Slice(materials, func(i, j int) bool { return materials[i].Name < materials[j].Name })
+	return materials, nil
+}
+
+// GetMaterial receives a name and returns the corresponding material if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetMaterial(ctx context.Context, name string) (types.Material, error) {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.MaterialsTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"Name": &DynamoDBTypes.AttributeValueMemberS{Value: name},
+		},
+	})
+
+	material := types.Material{}
+
+	if err != nil {
+		err = fmt.Errorf("error getting the material: %w", err)
+		return material, err
+	}
+
+	err = attributevalue.UnmarshalMap(out.Item, &material)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling material info: %w", err)
+		return material, err
+	}
+
+	return material, nil
+}
+
+// PutMaterial receives a Material and inserts it in the Materials table from DynamoDB,
+// replacing the material with the same name if exists
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) PutMaterial(ctx context.Context, material types.Material) error {
+	if material.Models == nil {
+		material.Models = []string{}
+	}
+
+	item, err := attributevalue.MarshalMap(material)
+	if err != nil {
+		return fmt.Errorf("error while inserting material: %w", err)
+	}
+
+	_, err = db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.MaterialsTableName),
+		Item:      item,
+	})
+	if err != nil {
+		err = fmt.Errorf("error while inserting material: %w", err)
+	}
+	return err
+}
+
+// DeleteMaterial receives a name and deletes the corresponding material from the Materials table from DynamoDB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) DeleteMaterial(ctx context.Context, name string) error {
+	_, err := db.dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.MaterialsTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"Name": &DynamoDBTypes.AttributeValueMemberS{Value: name},
+		},
+	})
+	return err
+}
+
+// GetAPIKeys returns an slice of all the API keys of the APIKeys table from DynamoDB, revoked ones included,
+// sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetAPIKeys(ctx context.Context) ([]types.APIKey, error) {
+	keys := []types.APIKey{}
+	paginator := dynamodb.NewScanPaginator(db.dynamoDBClient, &dynamodb.ScanInput{
+		TableName: aws.String(db.APIKeysTableName),
+	})
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error getting the API keys: %w", err)
+			return nil, err
+		}
+
+		page := []types.APIKey{}
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			err = fmt.Errorf("error unmarshalling API keys info: %w", err)
+			return nil, err
+		}
+		keys = append(keys, page...)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt != keys[j].CreatedAt {
+			return keys[i].CreatedAt < keys[j].CreatedAt
+		}
+		return keys[i].KeyID < keys[j].KeyID
+	})
+	return keys, nil
+}
+
+// GetAPIKey receives an ID and returns the corresponding API key if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetAPIKey(ctx context.Context, id string) (types.APIKey, error) {
+	out, err := db.dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.APIKeysTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"KeyID": &DynamoDBTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+
+	key := types.APIKey{}
+
+	if err != nil {
+		err = fmt.Errorf("error getting the API key: %w", err)
+		return key, err
+	}
+
+	err = attributevalue.UnmarshalMap(out.Item, &key)
+	if err != nil {
+		err = fmt.Errorf("error unmarshalling API key info: %w", err)
+		return key, err
+	}
+
+	return key, nil
+}
+
+// InsertAPIKey receives an APIKey and inserts it in the APIKeys table from DynamoDB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) InsertAPIKey(ctx context.Context, key types.APIKey) error {
+	item, err := attributevalue.MarshalMap(key)
+	if err != nil {
+		return fmt.Errorf("error while inserting API key: %w", err)
+	}
+
+	_, err = db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(db.APIKeysTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(KeyID)"),
+	})
+	if err != nil {
+		err = fmt.Errorf("error while inserting API key: %w", err)
+	}
+	return err
+}
+
+// RevokeAPIKey receives an ID and a timestamp and marks the corresponding API key of the APIKeys table
+// from DynamoDB as revoked at that time. Keys already revoked keep their first revocation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) RevokeAPIKey(ctx context.Context, id string, timestamp int64) error {
+	_, err := db.dynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.APIKeysTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"KeyID": &DynamoDBTypes.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("set RevokedAt = :timestamp"),
+		ConditionExpression: aws.String("attribute_exists(KeyID) and RevokedAt = :notRevoked"),
+		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+			":timestamp":  &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(timestamp, 10)},
+			":notRevoked": &DynamoDBTypes.AttributeValueMemberN{Value: "0"},
+		},
+	})
+
+	// the key does not exist or was already revoked
+	if isConditionFailed(err) {
+		return nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while revoking API key: %w", err)
+	}
+	return err
+}
+
+// GetGrants returns an slice of all the grants of the Grants table from DynamoDB, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetGrants(ctx context.Context) ([]types.Grant, error) {
+	return db.scanGrants(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(db.GrantsTableName),
+	})
+}
+
+// GetGrantsOfSubject receives a subject and returns an slice of its grants of the Grants table from DynamoDB,
+// sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetGrantsOfSubject(ctx context.Context, subject string) ([]types.Grant, error) {
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.Equal(expression.Name("Subject"), expression.Value(subject)),
+	).Build()
+	if err != nil {
+		err = fmt.Errorf("error while building the expression: %w", err)
+		return nil, err
+	}
+
+	return db.scanGrants(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(db.GrantsTableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+}
+
+// scanGrants returns the grants of all the pages of the received scan, sorted by creation time
+func (db *DynamoDB) scanGrants(ctx context.Context, input *dynamodb.ScanInput) ([]types.Grant, error) {
+	grants := []types.Grant{}
+	paginator := dynamodb.NewScanPaginator(db.dynamoDBClient, input)
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error getting the grants: %w", err)
+			return nil, err
+		}
+
+		page := []types.Grant{}
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			err = fmt.Errorf("error unmarshalling grants info: %w", err)
+			return nil, err
+		}
+		grants = append(grants, page...)
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].CreatedAt != grants[j].CreatedAt {
+			return grants[i].CreatedAt < grants[j].CreatedAt
+		}
+		return grants[i].GrantID < grants[j].GrantID
+	})
+	return grants, nil
+}
+
+// InsertGrant receives a Grant and inserts it in the Grants table from DynamoDB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) InsertGrant(ctx context.Context, grant types.Grant) error {
+	item, err := attributevalue.MarshalMap(grant)
+	if err != nil {
+		return fmt.Errorf("error while inserting grant: %w", err)
+	}
+
+	_, err = db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.GrantsTableName),
+		Item:      item,
+	})
+	if err != nil {
+		err = fmt.Errorf("error while inserting grant: %w", err)
+	}
+	return err
+}
+
+// DeleteGrant receives an ID and deletes the corresponding grant from the Grants table from DynamoDB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) DeleteGrant(ctx context.Context, id string) error {
+	_, err := db.dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.GrantsTableName),
+		Key: map[string]DynamoDBTypes.AttributeValue{
+			"GrantID": &DynamoDBTypes.AttributeValueMemberS{Value: id},
+		},
+	})
+	return err
+}
+
+// InsertAuditEntry receives an AuditEntry and inserts it in the Audit table from DynamoDB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) InsertAuditEntry(ctx context.Context, entry types.AuditEntry) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("error while inserting audit entry: %w", err)
+	}
+
+	_, err = db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.AuditTableName),
+		Item:      item,
+	})
+	if err != nil {
+		err = fmt.Errorf("error while inserting audit entry: %w", err)
+	}
+	return err
+}
+
+// GetAuditEntries receives a timestamp and returns an slice of the entries of the Audit table from DynamoDB
+// since then, sorted by time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) GetAuditEntries(ctx context.Context, since int64) ([]types.AuditEntry, error) {
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.GreaterThanEqual(expression.Name("Timestamp"), expression.Value(since)),
+	).Build()
+	if err != nil {
+		err = fmt.Errorf("error while building the expression: %w", err)
+		return nil, err
+	}
+
+	entries := []types.AuditEntry{}
+	paginator := dynamodb.NewScanPaginator(db.dynamoDBClient, &dynamodb.ScanInput{
+		TableName:                 aws.String(db.AuditTableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error getting the audit entries: %w", err)
+			return nil, err
+		}
+
+		page := []types.AuditEntry{}
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			err = fmt.Errorf("error unmarshalling audit entries info: %w", err)
+			return nil, err
+		}
+		entries = append(entries, page...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Timestamp != entries[j].Timestamp {
+			return entries[i].Timestamp < entries[j].Timestamp
+		}
+		return entries[i].EntryID < entries[j].EntryID
+	})
+	return entries, nil
+}
+
+// AcquireLease receives the name of a lease, its holder, the current time and the time it expires, and takes the lease
+// until then if it is not held, it has expired or it is already held by the same holder.
+// Leases are stored in the Leases table, whose partition key is Name
+// Returns whether the lease was acquired and a non-nil error if there's one during the execution and nil otherwise
+func (db *DynamoDB) AcquireLease(ctx context.Context, name string, holder string, now int64, expires int64) (bool, error) {
+	_, err := db.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.LeasesTableName),
+		Item: map[string]DynamoDBTypes.AttributeValue{
+			"Name":    &DynamoDBTypes.AttributeValueMemberS{Value: name},
+			"Holder":  &DynamoDBTypes.AttributeValueMemberS{Value: holder},
+			"Expires": &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(expires, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#name) OR #holder = :holder OR #expires < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#name":    "Name",
+			"#holder":  "Holder",
+			"#expires": "Expires",
+		},
+		ExpressionAttributeValues: map[string]DynamoDBTypes.AttributeValue{
+			":holder": &DynamoDBTypes.AttributeValueMemberS{Value: holder},
+			":now":    &DynamoDBTypes.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
+		},
+	})
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error while acquiring the lease: %w", err)
+	}
+	return true, nil
+}
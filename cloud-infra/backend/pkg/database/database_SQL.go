@@ -0,0 +1,1036 @@
+package database
+
+import (
+	"backend/pkg/types"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	// PostgreSQL driver, registered as "postgres"
+	_ "github.com/lib/pq"
+	// Pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// schema contains the statements used to create the tables needed by the SQL implementation.
+// Messages and results are stored in their own tables instead of sharing one with a prefixed sort key
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS devices (
+		device_uuid TEXT PRIMARY KEY,
+		name        TEXT NOT NULL UNIQUE,
+		ip          TEXT NOT NULL UNIQUE,
+		model        TEXT NOT NULL DEFAULT '',
+		last_result  TEXT NOT NULL DEFAULT '',
+		device_group TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS messages (
+		message_uuid    TEXT PRIMARY KEY,
+		device_uuid     TEXT NOT NULL,
+		type            TEXT NOT NULL,
+		additional_info TEXT NOT NULL DEFAULT '',
+		timestamp       BIGINT NOT NULL,
+		last_result     TEXT NOT NULL DEFAULT '',
+		analysis        TEXT NOT NULL DEFAULT '',
+		caller          TEXT NOT NULL DEFAULT '',
+		result_secret   TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS messages_device_uuid ON messages (device_uuid)`,
+	`CREATE INDEX IF NOT EXISTS messages_timestamp ON messages (timestamp)`,
+	`CREATE TABLE IF NOT EXISTS results (
+		device_uuid  TEXT NOT NULL,
+		message_uuid TEXT NOT NULL,
+		result       TEXT NOT NULL,
+		timestamp    BIGINT NOT NULL,
+		PRIMARY KEY (device_uuid, message_uuid, timestamp)
+	)`,
+	`CREATE TABLE IF NOT EXISTS files (
+		file_key  TEXT PRIMARY KEY,
+		refs      BIGINT NOT NULL DEFAULT 0,
+		timestamp BIGINT NOT NULL,
+		deleting  INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS file_references (
+		message_uuid TEXT PRIMARY KEY,
+		file_key     TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS materials (
+		name    TEXT PRIMARY KEY,
+		density DOUBLE PRECISION NOT NULL,
+		models  TEXT NOT NULL DEFAULT '[]'
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		key_id     TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		hash       TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		revoked_at BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS grants (
+		grant_id   TEXT PRIMARY KEY,
+		subject    TEXT NOT NULL,
+		role       TEXT NOT NULL,
+		scope      TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS grants_subject ON grants (subject)`,
+	`CREATE TABLE IF NOT EXISTS audit (
+		entry_id    TEXT PRIMARY KEY,
+		timestamp   BIGINT NOT NULL,
+		caller      TEXT NOT NULL,
+		action      TEXT NOT NULL,
+		role        TEXT NOT NULL,
+		device_uuid TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_timestamp ON audit (timestamp)`,
+	`CREATE TABLE IF NOT EXISTS leases (
+		name    TEXT PRIMARY KEY,
+		holder  TEXT NOT NULL,
+		expires BIGINT NOT NULL
+	)`,
+}
+
+// addedColumns contains the columns added to the tables after they were first created,
+// which are added to the tables of existing databases that do not have them yet
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"messages", "analysis", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "caller", "TEXT NOT NULL DEFAULT ''"},
+	{"devices", "device_group", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "result_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "deleting", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// SQL defines the struct used to implement Database interface using a SQL database.
+// Both PostgreSQL ("postgres") and SQLite ("sqlite") drivers are supported
+type SQL struct {
+	db     *sql.DB
+	Driver string
+}
+
+// NewDatabaseSQL creates and returns the reference to a new SQL struct
+// Driver and data source are read from the SQL_DRIVER and SQL_DATA_SOURCE environment variables
+func NewDatabaseSQL() *SQL {
+	db := &SQL{}
+	db.initialize()
+	return db
+}
+
+func (db *SQL) initialize() {
+	driver, ok := os.LookupEnv("SQL_DRIVER")
+	if !ok {
+		panic("Environment variable SQL_DRIVER does not exist")
+	}
+
+	dataSource, ok := os.LookupEnv("SQL_DATA_SOURCE")
+	if !ok {
+		panic("Environment variable SQL_DATA_SOURCE does not exist")
+	}
+
+	if driver != "postgres" && driver != "sqlite" {
+		panic(fmt.Sprintf("Unsupported SQL driver: %v", driver))
+	}
+
+	conn, err := sql.Open(driver, dataSource)
+	if err != nil {
+		panic(fmt.Sprintf("Configuration error in SQL database: %v\n", err))
+	}
+
+	// SQLite only allows one writer at a time, and every connection to an in-memory
+	// database would otherwise see its own empty database
+	if driver == "sqlite" {
+		conn.SetMaxOpenConns(1)
+	}
+
+	db.db = conn
+	db.Driver = driver
+
+	err = db.createSchema()
+	if err != nil {
+		panic(fmt.Sprintf("Error creating the SQL schema: %v\n", err))
+	}
+}
+
+func (db *SQL) createSchema() error {
+	for _, statement := range schema {
+		_, err := db.db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, added := range addedColumns {
+		// selecting the column fails if it does not exist, in both PostgreSQL and SQLite
+		rows, err := db.db.Query(`SELECT ` + added.column + ` FROM ` + added.table + ` LIMIT 0`)
+		if err == nil {
+			rows.Close()
+			continue
+		}
+
+		_, err = db.db.Exec(`ALTER TABLE ` + added.table + ` ADD COLUMN ` + added.column + ` ` + added.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database connections
+func (db *SQL) Close() error {
+	return db.db.Close()
+}
+
+// GetDevices returns an slice of all available Devices in the devices table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetDevices(ctx context.Context) ([]types.Device, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT device_uuid, name, ip, model, last_result, device_group FROM devices`)
+	if err != nil {
+		err = fmt.Errorf("error getting information Devices table: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []types.Device{}
+	for rows.Next() {
+		var device types.Device
+		err = rows.Scan(&device.DeviceUUID, &device.Name, &device.IP, &device.Model, &device.LastResult, &device.Group)
+		if err != nil {
+			err = fmt.Errorf("error reading devices info: %w", err)
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading devices info: %w", err)
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// GetDeviceByUUID receives a UUID and returns the correspoding device if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetDeviceByUUID(ctx context.Context, uuid string) (types.Device, error) {
+	device := types.Device{}
+
+	err := db.db.QueryRowContext(ctx,
+		`SELECT device_uuid, name, ip, model, last_result, device_group FROM devices WHERE device_uuid = $1`, uuid,
+	).Scan(&device.DeviceUUID, &device.Name, &device.IP, &device.Model, &device.LastResult, &device.Group)
+
+	if err == sql.ErrNoRows {
+		return types.Device{}, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error getting the device: %w", err)
+		return types.Device{}, err
+	}
+
+	return device, nil
+}
+
+// InsertDevice receives a Device and inserts it in the devices table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertDevice(ctx context.Context, device types.Device) error {
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO devices (device_uuid, name, ip, model, device_group) VALUES ($1, $2, $3, $4, $5)`,
+		device.DeviceUUID, device.Name, device.IP, device.Model, device.Group,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting: %w", err)
+	}
+	return err
+}
+
+// DeviceExistWithNameAndIP receives a device name and device ip and checks if there is any
+// device that already have one of those 2 attributes matching exactly. Returns true is so and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeviceExistWithNameAndIP(ctx context.Context, name string, ip string) (bool, error) {
+	var count int
+	err := db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE name = $1 OR ip = $2`, name, ip).Scan(&count)
+	if err != nil {
+		err = fmt.Errorf("error while querying the DB: %w", err)
+		return true, err
+	}
+
+	return count != 0, nil
+}
+
+// DeviceIPFromName receives a name and returns its IP address if exists, and an empty string otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeviceIPFromName(ctx context.Context, name string) (string, error) {
+	ip, _, err := db.DeviceIPAndUUIDFromName(ctx, name)
+	return ip, err
+}
+
+// DeviceIPAndUUIDFromName receives a name and returns its IP address and UUID if exists, and empty strings otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeviceIPAndUUIDFromName(ctx context.Context, name string) (string, string, error) {
+	var ip, deviceUUID string
+
+	err := db.db.QueryRowContext(ctx, `SELECT ip, device_uuid FROM devices WHERE name = $1`, name).Scan(&ip, &deviceUUID)
+
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error while querying the DB: %w", err)
+		return "", "", err
+	}
+
+	return ip, deviceUUID, nil
+}
+
+// DeleteDeviceFromUUID receives a UUID and deletes the correspoding device from the database
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeleteDeviceFromUUID(ctx context.Context, UUID string) error {
+	_, err := db.db.ExecContext(ctx, `DELETE FROM devices WHERE device_uuid = $1`, UUID)
+	return err
+}
+
+// UpdateDevice receives a Device and update the device with matching UUID with the values of the received one
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) UpdateDevice(ctx context.Context, device types.Device) error {
+	_, err := db.db.ExecContext(ctx,
+		`UPDATE devices SET ip = $1, name = $2, model = $3, device_group = $4 WHERE device_uuid = $5`,
+		device.IP, device.Name, device.Model, device.Group, device.DeviceUUID,
+	)
+	return err
+}
+
+// InsertMessage receives a types.MessageDB and inserts the message information into the DB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertMessage(ctx context.Context, msg types.MessageDB) error {
+	analysis := ""
+	if msg.Analysis != nil {
+		analysisJSON, err := json.Marshal(msg.Analysis)
+		if err != nil {
+			return fmt.Errorf("error while inserting message: %w", err)
+		}
+		analysis = string(analysisJSON)
+	}
+
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO messages (message_uuid, device_uuid, type, additional_info, timestamp, analysis, caller, result_secret)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		msg.MessageUUID, msg.DeviceUUID, msg.Type, msg.AdditionalInfo, msg.Timestamp, analysis, msg.Caller, msg.ResultSecret,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting message: %w", err)
+	}
+	return err
+}
+
+// InsertResult receives a types.ResultDB and inserts the message outcome information into the DB,
+// updating the last result of both the device and the message
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertResult(ctx context.Context, result types.ResultDB) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		err = fmt.Errorf("error while starting the transaction: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO results (device_uuid, message_uuid, result, timestamp) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (device_uuid, message_uuid, timestamp) DO UPDATE SET result = excluded.result`,
+		result.DeviceUUID, result.MessageUUID, result.Result, result.Timestamp,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while inserting message: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE devices SET last_result = $1 WHERE device_uuid = $2`, result.Result, result.DeviceUUID)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while updating device last result: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE messages SET last_result = $1 WHERE device_uuid = $2 AND message_uuid = $3`,
+		result.Result, result.DeviceUUID, result.MessageUUID,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while updating message last result: %w", err)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error while committing the result: %w", err)
+	}
+	return err
+}
+
+// GetMessagesFromDevice receives a deviceUUID and returns an slice with the information from its messages, oldest first
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetMessagesFromDevice(ctx context.Context, deviceUUID string) ([]types.MessageDB, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT device_uuid, message_uuid, type, additional_info, timestamp, last_result, analysis, caller, result_secret
+		FROM messages WHERE device_uuid = $1 ORDER BY timestamp, message_uuid`, deviceUUID,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while retrieving messages: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessage receives a deviceUUID and messageUUID and returns the information of the message,
+// which is empty if it does not exist
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetMessage(ctx context.Context, deviceUUID string, messageUUID string) (types.MessageDB, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT device_uuid, message_uuid, type, additional_info, timestamp, last_result, analysis, caller, result_secret
+		FROM messages WHERE device_uuid = $1 AND message_uuid = $2`, deviceUUID, messageUUID,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while retrieving message: %w", err)
+		return types.MessageDB{}, err
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return types.MessageDB{}, err
+	}
+	return messages[0], nil
+}
+
+// scanMessages reads the messages returned by a query that selects all the columns of the messages table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func scanMessages(rows *sql.Rows) ([]types.MessageDB, error) {
+	messages := []types.MessageDB{}
+	for rows.Next() {
+		var msg types.MessageDB
+		var analysis string
+		err := rows.Scan(&msg.DeviceUUID, &msg.MessageUUID, &msg.Type, &msg.AdditionalInfo, &msg.Timestamp, &msg.LastResult, &analysis, &msg.Caller, &msg.ResultSecret)
+		if err != nil {
+			err = fmt.Errorf("error reading messages info: %w", err)
+			return nil, err
+		}
+
+		if analysis != "" {
+			msg.Analysis = &types.MeshAnalysis{}
+			err = json.Unmarshal([]byte(analysis), msg.Analysis)
+			if err != nil {
+				err = fmt.Errorf("error reading messages info: %w", err)
+				return nil, err
+			}
+		}
+
+		messages = append(messages, msg)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading messages info: %w", err)
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// GetResponsesFromMessage receives a deviceUUID and messageUUID and returns an slice with the information from its responses
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetResponsesFromMessage(ctx context.Context, deviceUUID string, messageUUID string) ([]types.Response, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT result, timestamp FROM results WHERE device_uuid = $1 AND message_uuid = $2 ORDER BY timestamp`,
+		deviceUUID, messageUUID,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while retrieving responses: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := []types.Response{}
+	for rows.Next() {
+		var response types.Response
+		err = rows.Scan(&response.Result, &response.Timestamp)
+		if err != nil {
+			err = fmt.Errorf("error reading responses info: %w", err)
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading responses info: %w", err)
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+// GetMessagesBefore receives a timestamp, a cursor and a limit and returns an slice with the information from up to limit
+// of the messages sent before the timestamp, sorted by time, starting after the cursor, which is empty for the first page.
+// It also returns the cursor of the next page, which is empty if there are no more messages
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetMessagesBefore(ctx context.Context, before int64, cursor string, limit int) ([]types.MessageDB, string, error) {
+	after, afterUUID, err := parseMessagesCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT device_uuid, message_uuid, type, additional_info, timestamp, last_result, analysis, caller, result_secret
+		FROM messages WHERE timestamp < $1 AND (timestamp > $2 OR (timestamp = $2 AND message_uuid > $3))
+		ORDER BY timestamp, message_uuid LIMIT $4`, before, after, afterUUID, limit,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while retrieving messages: %w", err)
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) < limit {
+		return messages, "", err
+	}
+	return messages, messagesCursor(messages[len(messages)-1]), nil
+}
+
+// DeleteMessage receives a deviceUUID and messageUUID and deletes the message and all its results from the DB
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeleteMessage(ctx context.Context, deviceUUID string, messageUUID string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		err = fmt.Errorf("error while starting the transaction: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM results WHERE device_uuid = $1 AND message_uuid = $2`, deviceUUID, messageUUID)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while deleting message results: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM messages WHERE device_uuid = $1 AND message_uuid = $2`, deviceUUID, messageUUID)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while deleting message: %w", err)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error while committing the deletion: %w", err)
+	}
+	return err
+}
+
+// AddFileReference receives a types.FileReferenceDB and adds the reference of the message to the file,
+// creating the file if it does not exist. Adding the reference of a message more than once has no effect.
+// Returns whether the file already existed and ErrFileDeleting if its deletion has begun
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) AddFileReference(ctx context.Context, ref types.FileReferenceDB) (bool, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		err = fmt.Errorf("error while starting the transaction: %w", err)
+		return false, err
+	}
+
+	var deleting int
+	err = tx.QueryRowContext(ctx, `SELECT deleting FROM files WHERE file_key = $1`, ref.FileKey).Scan(&deleting)
+	if err != nil && err != sql.ErrNoRows {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while querying the DB: %w", err)
+		return false, err
+	}
+	existed := err == nil
+
+	if deleting != 0 {
+		_ = tx.Rollback()
+		return false, ErrFileDeleting
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO file_references (message_uuid, file_key) VALUES ($1, $2) ON CONFLICT (message_uuid) DO NOTHING`,
+		ref.MessageUUID, ref.FileKey,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while inserting file reference: %w", err)
+		return false, err
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while inserting file reference: %w", err)
+		return false, err
+	}
+
+	if inserted != 0 {
+		// the deletion of the file can begin after it was read, in which case it is not updated
+		res, err = tx.ExecContext(ctx,
+			`INSERT INTO files (file_key, refs, timestamp) VALUES ($1, 1, $2)
+			ON CONFLICT (file_key) DO UPDATE SET refs = files.refs + 1, timestamp = excluded.timestamp
+			WHERE files.deleting = 0`,
+			ref.FileKey, ref.Timestamp,
+		)
+		if err == nil {
+			inserted, err = res.RowsAffected()
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			err = fmt.Errorf("error while updating file references: %w", err)
+			return false, err
+		}
+		if inserted == 0 {
+			_ = tx.Rollback()
+			return false, ErrFileDeleting
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error while committing the file reference: %w", err)
+		return false, err
+	}
+	return existed, nil
+}
+
+// RemoveFileReference receives a types.FileReferenceDB and removes the reference of its message to the file it sends,
+// if there is one. The file is kept with no references until it is deleted with DeleteFile
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) RemoveFileReference(ctx context.Context, ref types.FileReferenceDB) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		err = fmt.Errorf("error while starting the transaction: %w", err)
+		return err
+	}
+
+	var fileKey string
+	err = tx.QueryRowContext(ctx, `SELECT file_key FROM file_references WHERE message_uuid = $1`, ref.MessageUUID).Scan(&fileKey)
+	if err == sql.ErrNoRows {
+		return tx.Rollback()
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while querying the DB: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM file_references WHERE message_uuid = $1`, ref.MessageUUID)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while deleting file reference: %w", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE files SET refs = refs - 1, timestamp = $1 WHERE file_key = $2 AND refs > 0`,
+		ref.Timestamp, fileKey,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		err = fmt.Errorf("error while updating file references: %w", err)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error while committing the file reference: %w", err)
+	}
+	return err
+}
+
+// GetUnreferencedFiles receives a timestamp and returns an slice with the files that have no references since before it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetUnreferencedFiles(ctx context.Context, before int64) ([]types.FileDB, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT file_key, refs, timestamp, deleting FROM files WHERE refs = 0 AND timestamp < $1 ORDER BY file_key`, before,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while retrieving files: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []types.FileDB{}
+	for rows.Next() {
+		var file types.FileDB
+		var deleting int
+		err = rows.Scan(&file.FileKey, &file.References, &file.Timestamp, &deleting)
+		file.Deleting = deleting != 0
+		if err != nil {
+			err = fmt.Errorf("error reading files info: %w", err)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading files info: %w", err)
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// BeginFileDeletion receives a file key and begins the deletion of the file if it has no references,
+// so that it cannot be referenced again until it is deleted with DeleteFile.
+// Returns true if its deletion has begun, now or before, and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) BeginFileDeletion(ctx context.Context, fileKey string) (bool, error) {
+	res, err := db.db.ExecContext(ctx, `UPDATE files SET deleting = 1 WHERE file_key = $1 AND refs = 0`, fileKey)
+	if err != nil {
+		err = fmt.Errorf("error while beginning the file deletion: %w", err)
+		return false, err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		err = fmt.Errorf("error while beginning the file deletion: %w", err)
+		return false, err
+	}
+
+	return updated != 0, nil
+}
+
+// DeleteFile receives a file key and deletes the file from the DB if its deletion has begun with BeginFileDeletion.
+// Returns true if it was deleted and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeleteFile(ctx context.Context, fileKey string) (bool, error) {
+	res, err := db.db.ExecContext(ctx, `DELETE FROM files WHERE file_key = $1 AND deleting = 1`, fileKey)
+	if err != nil {
+		err = fmt.Errorf("error while deleting file: %w", err)
+		return false, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		err = fmt.Errorf("error while deleting file: %w", err)
+		return false, err
+	}
+
+	return deleted != 0, nil
+}
+
+// GetMaterials returns an slice of all the materials of the catalog, sorted by name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetMaterials(ctx context.Context) ([]types.Material, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT name, density, models FROM materials ORDER BY name`)
+	if err != nil {
+		err = fmt.Errorf("error getting the materials: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	materials := []types.Material{}
+	for rows.Next() {
+		var material types.Material
+		var models string
+		err = rows.Scan(&material.Name, &material.Density, &models)
+		if err == nil {
+			err = json.Unmarshal([]byte(models), &material.Models)
+		}
+		if err != nil {
+			err = fmt.Errorf("error reading materials info: %w", err)
+			return nil, err
+		}
+		materials = append(materials, material)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading materials info: %w", err)
+		return nil, err
+	}
+
+	return materials, nil
+}
+
+// GetMaterial receives a name and returns the corresponding material if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetMaterial(ctx context.Context, name string) (types.Material, error) {
+	material := types.Material{}
+	var models string
+
+	err := db.db.QueryRowContext(ctx,
+		`SELECT name, density, models FROM materials WHERE name = $1`, name,
+	).Scan(&material.Name, &material.Density, &models)
+
+	if err == sql.ErrNoRows {
+		return types.Material{}, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal([]byte(models), &material.Models)
+	}
+	if err != nil {
+		err = fmt.Errorf("error getting the material: %w", err)
+		return types.Material{}, err
+	}
+
+	return material, nil
+}
+
+// PutMaterial receives a Material and inserts it in the materials table, replacing the material with the same name if exists
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) PutMaterial(ctx context.Context, material types.Material) error {
+	models := material.Models
+	if models == nil {
+		models = []string{}
+	}
+
+	modelsJSON, err := json.Marshal(models)
+	if err != nil {
+		return fmt.Errorf("error while inserting material: %w", err)
+	}
+
+	_, err = db.db.ExecContext(ctx,
+		`INSERT INTO materials (name, density, models) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET density = excluded.density, models = excluded.models`,
+		material.Name, material.Density, string(modelsJSON),
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting material: %w", err)
+	}
+	return err
+}
+
+// DeleteMaterial receives a name and deletes the corresponding material from the database
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeleteMaterial(ctx context.Context, name string) error {
+	_, err := db.db.ExecContext(ctx, `DELETE FROM materials WHERE name = $1`, name)
+	return err
+}
+
+// GetAPIKeys returns an slice of all the API keys of the api_keys table, revoked ones included, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetAPIKeys(ctx context.Context) ([]types.APIKey, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT key_id, name, hash, created_by, created_at, revoked_at FROM api_keys ORDER BY created_at, key_id`,
+	)
+	if err != nil {
+		err = fmt.Errorf("error getting the API keys: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []types.APIKey{}
+	for rows.Next() {
+		var key types.APIKey
+		err = rows.Scan(&key.KeyID, &key.Name, &key.Hash, &key.CreatedBy, &key.CreatedAt, &key.RevokedAt)
+		if err != nil {
+			err = fmt.Errorf("error reading API keys info: %w", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading API keys info: %w", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKey receives an ID and returns the corresponding API key if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetAPIKey(ctx context.Context, id string) (types.APIKey, error) {
+	key := types.APIKey{}
+
+	err := db.db.QueryRowContext(ctx,
+		`SELECT key_id, name, hash, created_by, created_at, revoked_at FROM api_keys WHERE key_id = $1`, id,
+	).Scan(&key.KeyID, &key.Name, &key.Hash, &key.CreatedBy, &key.CreatedAt, &key.RevokedAt)
+
+	if err == sql.ErrNoRows {
+		return types.APIKey{}, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("error getting the API key: %w", err)
+		return types.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// InsertAPIKey receives an APIKey and inserts it in the api_keys table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertAPIKey(ctx context.Context, key types.APIKey) error {
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO api_keys (key_id, name, hash, created_by, created_at, revoked_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.KeyID, key.Name, key.Hash, key.CreatedBy, key.CreatedAt, key.RevokedAt,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting API key: %w", err)
+	}
+	return err
+}
+
+// RevokeAPIKey receives an ID and a timestamp and marks the corresponding API key as revoked at that time.
+// Keys already revoked keep their first revocation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) RevokeAPIKey(ctx context.Context, id string, timestamp int64) error {
+	_, err := db.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = $1 WHERE key_id = $2 AND revoked_at = 0`, timestamp, id,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while revoking API key: %w", err)
+	}
+	return err
+}
+
+// GetGrants returns an slice of all the grants of the grants table, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetGrants(ctx context.Context) ([]types.Grant, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT grant_id, subject, role, scope, created_by, created_at FROM grants ORDER BY created_at, grant_id`,
+	)
+	if err != nil {
+		err = fmt.Errorf("error getting the grants: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanGrants(rows)
+}
+
+// GetGrantsOfSubject receives a subject and returns an slice of its grants of the grants table, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetGrantsOfSubject(ctx context.Context, subject string) ([]types.Grant, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT grant_id, subject, role, scope, created_by, created_at FROM grants WHERE subject = $1 ORDER BY created_at, grant_id`,
+		subject,
+	)
+	if err != nil {
+		err = fmt.Errorf("error getting the grants: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanGrants(rows)
+}
+
+// scanGrants reads the grants returned by a query selecting all the columns of the grants table
+func scanGrants(rows *sql.Rows) ([]types.Grant, error) {
+	grants := []types.Grant{}
+	for rows.Next() {
+		var grant types.Grant
+		err := rows.Scan(&grant.GrantID, &grant.Subject, &grant.Role, &grant.Scope, &grant.CreatedBy, &grant.CreatedAt)
+		if err != nil {
+			err = fmt.Errorf("error reading grants info: %w", err)
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading grants info: %w", err)
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// InsertGrant receives a Grant and inserts it in the grants table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertGrant(ctx context.Context, grant types.Grant) error {
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO grants (grant_id, subject, role, scope, created_by, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		grant.GrantID, grant.Subject, grant.Role, grant.Scope, grant.CreatedBy, grant.CreatedAt,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting grant: %w", err)
+	}
+	return err
+}
+
+// DeleteGrant receives an ID and deletes the corresponding grant from the database
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) DeleteGrant(ctx context.Context, id string) error {
+	_, err := db.db.ExecContext(ctx, `DELETE FROM grants WHERE grant_id = $1`, id)
+	return err
+}
+
+// InsertAuditEntry receives an AuditEntry and inserts it in the audit table
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) InsertAuditEntry(ctx context.Context, entry types.AuditEntry) error {
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO audit (entry_id, timestamp, caller, action, role, device_uuid) VALUES ($1, $2, $3, $4, $5, $6)`,
+		entry.EntryID, entry.Timestamp, entry.Caller, entry.Action, entry.Role, entry.DeviceUUID,
+	)
+	if err != nil {
+		err = fmt.Errorf("error while inserting audit entry: %w", err)
+	}
+	return err
+}
+
+// GetAuditEntries receives a timestamp and returns an slice of the entries of the audit table since then, sorted by time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) GetAuditEntries(ctx context.Context, since int64) ([]types.AuditEntry, error) {
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT entry_id, timestamp, caller, action, role, device_uuid FROM audit WHERE timestamp >= $1 ORDER BY timestamp, entry_id`,
+		since,
+	)
+	if err != nil {
+		err = fmt.Errorf("error getting the audit entries: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []types.AuditEntry{}
+	for rows.Next() {
+		var entry types.AuditEntry
+		err = rows.Scan(&entry.EntryID, &entry.Timestamp, &entry.Caller, &entry.Action, &entry.Role, &entry.DeviceUUID)
+		if err != nil {
+			err = fmt.Errorf("error reading audit entries info: %w", err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("error reading audit entries info: %w", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// AcquireLease receives the name of a lease, its holder, the current time and the time it expires, and takes the lease
+// until then if it is not held, it has expired or it is already held by the same holder
+// Returns whether the lease was acquired and a non-nil error if there's one during the execution and nil otherwise
+func (db *SQL) AcquireLease(ctx context.Context, name string, holder string, now int64, expires int64) (bool, error) {
+	res, err := db.db.ExecContext(ctx,
+		`INSERT INTO leases (name, holder, expires) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires < $4`, name, holder, expires, now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error while acquiring the lease: %w", err)
+	}
+
+	acquired, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error while acquiring the lease: %w", err)
+	}
+	return acquired == 1, nil
+}
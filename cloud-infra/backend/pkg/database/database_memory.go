@@ -0,0 +1,595 @@
+package database
+
+import (
+	"backend/pkg/types"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Memory defines the struct used to implement Database interface keeping everything in memory.
+// It is safe for concurrent use and is meant for local development and CI, as nothing is persisted
+type Memory struct {
+	mu       sync.RWMutex
+	devices  map[string]types.Device
+	messages map[string]map[string]types.MessageDB
+	results  map[string][]types.ResultDB
+	files    map[string]types.FileDB
+	// references maps the UUID of every message sending a file to its key
+	references map[string]string
+	materials  map[string]types.Material
+	apiKeys    map[string]types.APIKey
+	grants     map[string]types.Grant
+	audit      []types.AuditEntry
+	leases     map[string]lease
+}
+
+// lease is the holder of a lease and the time it expires
+type lease struct {
+	holder  string
+	expires int64
+}
+
+// NewDatabaseMemory creates and returns the reference to a new, empty, Memory struct
+func NewDatabaseMemory() *Memory {
+	return &Memory{
+		devices:    make(map[string]types.Device),
+		messages:   make(map[string]map[string]types.MessageDB),
+		results:    make(map[string][]types.ResultDB),
+		files:      make(map[string]types.FileDB),
+		references: make(map[string]string),
+		materials:  make(map[string]types.Material),
+		apiKeys:    make(map[string]types.APIKey),
+		grants:     make(map[string]types.Grant),
+		leases:     make(map[string]lease),
+	}
+}
+
+// GetDevices returns an slice of all stored Devices
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetDevices(ctx context.Context) ([]types.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	devices := make([]types.Device, 0, len(db.devices))
+	for _, device := range db.devices {
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices, nil
+}
+
+// GetDeviceByUUID receives a UUID and returns the correspoding device if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetDeviceByUUID(ctx context.Context, uuid string) (types.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.devices[uuid], nil
+}
+
+// InsertDevice receives a Device and stores it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertDevice(ctx context.Context, device types.Device) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if device.DeviceUUID == "" {
+		return errors.New("error while inserting: missing device UUID")
+	}
+
+	db.devices[device.DeviceUUID] = device
+	return nil
+}
+
+// DeviceExistWithNameAndIP receives a device name and device ip and checks if there is any
+// device that already have one of those 2 attributes matching exactly. Returns true is so and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeviceExistWithNameAndIP(ctx context.Context, name string, ip string) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, device := range db.devices {
+		if device.Name == name || device.IP == ip {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeviceIPFromName receives a name and returns its IP address if exists, and an empty string otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeviceIPFromName(ctx context.Context, name string) (string, error) {
+	ip, _, err := db.DeviceIPAndUUIDFromName(ctx, name)
+	return ip, err
+}
+
+// DeviceIPAndUUIDFromName receives a name and returns its IP address and UUID if exists, and empty strings otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeviceIPAndUUIDFromName(ctx context.Context, name string) (string, string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, device := range db.devices {
+		if device.Name == name {
+			return device.IP, device.DeviceUUID, nil
+		}
+	}
+	return "", "", nil
+}
+
+// DeleteDeviceFromUUID receives a UUID and deletes the correspoding device
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeleteDeviceFromUUID(ctx context.Context, UUID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.devices, UUID)
+	return nil
+}
+
+// UpdateDevice receives a Device and update the device with matching UUID with the values of the received one
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) UpdateDevice(ctx context.Context, device types.Device) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.devices[device.DeviceUUID]
+	if !ok {
+		return nil
+	}
+
+	stored.IP = device.IP
+	stored.Name = device.Name
+	stored.Model = device.Model
+	stored.Group = device.Group
+	db.devices[device.DeviceUUID] = stored
+	return nil
+}
+
+// InsertMessage receives a types.MessageDB and stores the message information
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertMessage(ctx context.Context, msg types.MessageDB) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.messages[msg.DeviceUUID] == nil {
+		db.messages[msg.DeviceUUID] = make(map[string]types.MessageDB)
+	}
+	db.messages[msg.DeviceUUID][msg.MessageUUID] = msg
+	return nil
+}
+
+// InsertResult receives a types.ResultDB and stores the message outcome information,
+// updating the last result of both the device and the message
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertResult(ctx context.Context, result types.ResultDB) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := result.DeviceUUID + "/" + result.MessageUUID
+	db.results[key] = append(db.results[key], result)
+
+	if device, ok := db.devices[result.DeviceUUID]; ok {
+		device.LastResult = result.Result
+		db.devices[result.DeviceUUID] = device
+	}
+
+	if msg, ok := db.messages[result.DeviceUUID][result.MessageUUID]; ok {
+		msg.LastResult = result.Result
+		db.messages[result.DeviceUUID][result.MessageUUID] = msg
+	}
+	return nil
+}
+
+// GetMessagesFromDevice receives a deviceUUID and returns an slice with the information from its messages, oldest first
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetMessagesFromDevice(ctx context.Context, deviceUUID string) ([]types.MessageDB, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	messages := make([]types.MessageDB, 0, len(db.messages[deviceUUID]))
+	for _, msg := range db.messages[deviceUUID] {
+		messages = append(messages, msg)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Timestamp != messages[j].Timestamp {
+			return messages[i].Timestamp < messages[j].Timestamp
+		}
+		return messages[i].MessageUUID < messages[j].MessageUUID
+	})
+	return messages, nil
+}
+
+// GetMessage receives a deviceUUID and messageUUID and returns the information of the message,
+// which is empty if it does not exist
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetMessage(ctx context.Context, deviceUUID string, messageUUID string) (types.MessageDB, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.messages[deviceUUID][messageUUID], nil
+}
+
+// GetResponsesFromMessage receives a deviceUUID and messageUUID and returns an slice with the information from its responses
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetResponsesFromMessage(ctx context.Context, deviceUUID string, messageUUID string) ([]types.Response, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	results := db.results[deviceUUID+"/"+messageUUID]
+	responses := make([]types.Response, 0, len(results))
+	for _, result := range results {
+		responses = append(responses, types.Response{Result: result.Result, Timestamp: result.Timestamp})
+	}
+
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Timestamp < responses[j].Timestamp })
+	return responses, nil
+}
+
+// GetMessagesBefore receives a timestamp, a cursor and a limit and returns an slice with the information from up to limit
+// of the messages sent before the timestamp, sorted by time, starting after the cursor, which is empty for the first page.
+// It also returns the cursor of the next page, which is empty if there are no more messages
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetMessagesBefore(ctx context.Context, before int64, cursor string, limit int) ([]types.MessageDB, string, error) {
+	after, afterUUID, err := parseMessagesCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	messages := []types.MessageDB{}
+	for _, deviceMessages := range db.messages {
+		for _, msg := range deviceMessages {
+			if msg.Timestamp < before && (msg.Timestamp > after || msg.Timestamp == after && msg.MessageUUID > afterUUID) {
+				messages = append(messages, msg)
+			}
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Timestamp != messages[j].Timestamp {
+			return messages[i].Timestamp < messages[j].Timestamp
+		}
+		return messages[i].MessageUUID < messages[j].MessageUUID
+	})
+
+	if len(messages) <= limit {
+		return messages, "", nil
+	}
+	messages = messages[:limit]
+	return messages, messagesCursor(messages[limit-1]), nil
+}
+
+// DeleteMessage receives a deviceUUID and messageUUID and deletes the message and all its results
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeleteMessage(ctx context.Context, deviceUUID string, messageUUID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.messages[deviceUUID], messageUUID)
+	delete(db.results, deviceUUID+"/"+messageUUID)
+	return nil
+}
+
+// AddFileReference receives a types.FileReferenceDB and adds the reference of the message to the file,
+// creating the file if it does not exist. Adding the reference of a message more than once has no effect.
+// Returns whether the file already existed and ErrFileDeleting if its deletion has begun
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) AddFileReference(ctx context.Context, ref types.FileReferenceDB) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	file, existed := db.files[ref.FileKey]
+	if file.Deleting {
+		return false, ErrFileDeleting
+	}
+
+	if _, ok := db.references[ref.MessageUUID]; ok {
+		return existed, nil
+	}
+	db.references[ref.MessageUUID] = ref.FileKey
+
+	file.FileKey = ref.FileKey
+	file.References++
+	file.Timestamp = ref.Timestamp
+	db.files[ref.FileKey] = file
+	return existed, nil
+}
+
+// RemoveFileReference receives a types.FileReferenceDB and removes the reference of its message to the file it sends,
+// if there is one. The file is kept with no references until it is deleted with DeleteFile
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) RemoveFileReference(ctx context.Context, ref types.FileReferenceDB) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	fileKey, ok := db.references[ref.MessageUUID]
+	if !ok {
+		return nil
+	}
+	delete(db.references, ref.MessageUUID)
+
+	if file, ok := db.files[fileKey]; ok && file.References > 0 {
+		file.References--
+		file.Timestamp = ref.Timestamp
+		db.files[fileKey] = file
+	}
+	return nil
+}
+
+// GetUnreferencedFiles receives a timestamp and returns an slice with the files that have no references since before it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetUnreferencedFiles(ctx context.Context, before int64) ([]types.FileDB, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	files := []types.FileDB{}
+	for _, file := range db.files {
+		if file.References == 0 && file.Timestamp < before {
+			files = append(files, file)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].FileKey < files[j].FileKey })
+	return files, nil
+}
+
+// BeginFileDeletion receives a file key and begins the deletion of the file if it has no references,
+// so that it cannot be referenced again until it is deleted with DeleteFile.
+// Returns true if its deletion has begun, now or before, and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) BeginFileDeletion(ctx context.Context, fileKey string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	file, ok := db.files[fileKey]
+	if !ok || file.References != 0 {
+		return false, nil
+	}
+
+	file.Deleting = true
+	db.files[fileKey] = file
+	return true, nil
+}
+
+// DeleteFile receives a file key and deletes the file if its deletion has begun with BeginFileDeletion.
+// Returns true if it was deleted and false otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeleteFile(ctx context.Context, fileKey string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	file, ok := db.files[fileKey]
+	if !ok || !file.Deleting {
+		return false, nil
+	}
+
+	delete(db.files, fileKey)
+	return true, nil
+}
+
+// GetMaterials returns an slice of all the materials of the catalog, sorted by name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetMaterials(ctx context.Context) ([]types.Material, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	materials := make([]types.Material, 0, len(db.materials))
+	for _, material := range db.materials {
+		materials = append(materials, copyMaterial(material))
+	}
+
+	sort.Slice(materials, func(i, j int) bool { return materials[i].Name < materials[j].Name })
+	return materials, nil
+}
+
+// GetMaterial receives a name and returns the corresponding material if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetMaterial(ctx context.Context, name string) (types.Material, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	material, ok := db.materials[name]
+	if !ok {
+		return types.Material{}, nil
+	}
+	return copyMaterial(material), nil
+}
+
+// PutMaterial receives a Material and stores it, replacing the material with the same name if exists
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) PutMaterial(ctx context.Context, material types.Material) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if material.Name == "" {
+		return errors.New("error while inserting: missing material name")
+	}
+
+	db.materials[material.Name] = copyMaterial(material)
+	return nil
+}
+
+// DeleteMaterial receives a name and deletes the corresponding material
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeleteMaterial(ctx context.Context, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.materials, name)
+	return nil
+}
+
+// copyMaterial returns a copy of the received material, so that the stored models are not shared with the callers
+func copyMaterial(material types.Material) types.Material {
+	material.Models = append([]string{}, material.Models...)
+	return material
+}
+
+// GetAPIKeys returns an slice of all the API keys, revoked ones included, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetAPIKeys(ctx context.Context) ([]types.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]types.APIKey, 0, len(db.apiKeys))
+	for _, key := range db.apiKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt != keys[j].CreatedAt {
+			return keys[i].CreatedAt < keys[j].CreatedAt
+		}
+		return keys[i].KeyID < keys[j].KeyID
+	})
+	return keys, nil
+}
+
+// GetAPIKey receives an ID and returns the corresponding API key if exists, and an empty one otherwise.
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetAPIKey(ctx context.Context, id string) (types.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.apiKeys[id], nil
+}
+
+// InsertAPIKey receives an APIKey and stores it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertAPIKey(ctx context.Context, key types.APIKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if key.KeyID == "" {
+		return errors.New("error while inserting: missing API key ID")
+	}
+
+	if _, ok := db.apiKeys[key.KeyID]; ok {
+		return errors.New("error while inserting: API key ID already exists")
+	}
+
+	db.apiKeys[key.KeyID] = key
+	return nil
+}
+
+// RevokeAPIKey receives an ID and a timestamp and marks the corresponding API key as revoked at that time.
+// Keys already revoked keep their first revocation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) RevokeAPIKey(ctx context.Context, id string, timestamp int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key, ok := db.apiKeys[id]
+	if ok && key.RevokedAt == 0 {
+		key.RevokedAt = timestamp
+		db.apiKeys[id] = key
+	}
+	return nil
+}
+
+// GetGrants returns an slice of all the grants, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetGrants(ctx context.Context) ([]types.Grant, error) {
+	return db.grantsWhere(func(grant types.Grant) bool { return true }), nil
+}
+
+// GetGrantsOfSubject receives a subject and returns an slice of its grants, sorted by creation time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetGrantsOfSubject(ctx context.Context, subject string) ([]types.Grant, error) {
+	return db.grantsWhere(func(grant types.Grant) bool { return grant.Subject == subject }), nil
+}
+
+// grantsWhere returns the grants matching the received function, sorted by creation time
+func (db *Memory) grantsWhere(match func(types.Grant) bool) []types.Grant {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	grants := []types.Grant{}
+	for _, grant := range db.grants {
+		if match(grant) {
+			grants = append(grants, grant)
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].CreatedAt != grants[j].CreatedAt {
+			return grants[i].CreatedAt < grants[j].CreatedAt
+		}
+		return grants[i].GrantID < grants[j].GrantID
+	})
+	return grants
+}
+
+// InsertGrant receives a Grant and stores it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertGrant(ctx context.Context, grant types.Grant) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if grant.GrantID == "" {
+		return errors.New("error while inserting: missing grant ID")
+	}
+
+	db.grants[grant.GrantID] = grant
+	return nil
+}
+
+// DeleteGrant receives an ID and deletes the corresponding grant
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) DeleteGrant(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.grants, id)
+	return nil
+}
+
+// InsertAuditEntry receives an AuditEntry and stores it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) InsertAuditEntry(ctx context.Context, entry types.AuditEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.audit = append(db.audit, entry)
+	return nil
+}
+
+// GetAuditEntries receives a timestamp and returns an slice of the audit entries since then, sorted by time
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) GetAuditEntries(ctx context.Context, since int64) ([]types.AuditEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entries := []types.AuditEntry{}
+	for _, entry := range db.audit {
+		if entry.Timestamp >= since {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+	return entries, nil
+}
+
+// AcquireLease receives the name of a lease, its holder, the current time and the time it expires, and takes the lease
+// until then if it is not held, it has expired or it is already held by the same holder
+// Returns whether the lease was acquired and a non-nil error if there's one during the execution and nil otherwise
+func (db *Memory) AcquireLease(ctx context.Context, name string, holder string, now int64, expires int64) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current, ok := db.leases[name]
+	if ok && current.holder != holder && current.expires >= now {
+		return false, nil
+	}
+
+	db.leases[name] = lease{holder: holder, expires: expires}
+	return true, nil
+}
@@ -0,0 +1,560 @@
+package database
+
+import (
+	"backend/pkg/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileReferences(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+			db := tt.db
+
+			// adding the reference of the same message twice only counts once
+			for _, ref := range []struct {
+				types.FileReferenceDB
+				existed bool
+			}{
+				{types.FileReferenceDB{FileKey: "jobs/a/a.stl", MessageUUID: "m1", Timestamp: 10}, false},
+				{types.FileReferenceDB{FileKey: "jobs/a/a.stl", MessageUUID: "m1", Timestamp: 11}, true},
+				{types.FileReferenceDB{FileKey: "jobs/a/a.stl", MessageUUID: "m2", Timestamp: 12}, true},
+				{types.FileReferenceDB{FileKey: "jobs/b/b.stl", MessageUUID: "m3", Timestamp: 13}, false},
+			} {
+				existed, err := db.AddFileReference(ctx, ref.FileReferenceDB)
+				if err != nil || existed != ref.existed {
+					t.Fatalf("Expected file existed %v adding reference %+v, got %v and error %v", ref.existed, ref, existed, err)
+				}
+			}
+
+			for _, ref := range []types.FileReferenceDB{
+				{MessageUUID: "m1", Timestamp: 20},
+				{MessageUUID: "m1", Timestamp: 21},
+				{MessageUUID: "m3", Timestamp: 22},
+				{MessageUUID: "unknown", Timestamp: 23},
+			} {
+				err := db.RemoveFileReference(ctx, ref)
+				if err != nil {
+					t.Fatalf("Did not expect error removing reference but got %v", err)
+				}
+			}
+
+			files, err := db.GetUnreferencedFiles(ctx, 100)
+			if err != nil || len(files) != 1 || files[0] != (types.FileDB{FileKey: "jobs/b/b.stl", References: 0, Timestamp: 22}) {
+				t.Fatalf("Expected only jobs/b/b.stl to be unreferenced, got %+v and error %v", files, err)
+			}
+
+			files, err = db.GetUnreferencedFiles(ctx, 22)
+			if err != nil || len(files) != 0 {
+				t.Errorf("Expected no files unreferenced before their grace period, got %+v and error %v", files, err)
+			}
+
+			began, err := db.BeginFileDeletion(ctx, "jobs/a/a.stl")
+			if err != nil || began {
+				t.Errorf("Expected the deletion of the referenced file not to begin, got %v and error %v", began, err)
+			}
+
+			deleted, err := db.DeleteFile(ctx, "jobs/b/b.stl")
+			if err != nil || deleted {
+				t.Errorf("Expected file not to be deleted before its deletion begins, got %v and error %v", deleted, err)
+			}
+
+			began, err = db.BeginFileDeletion(ctx, "jobs/b/b.stl")
+			if err != nil || !began {
+				t.Errorf("Expected the deletion of the unreferenced file to begin, got %v and error %v", began, err)
+			}
+
+			// the file cannot be referenced again until it is deleted, and then it is created again
+			_, err = db.AddFileReference(ctx, types.FileReferenceDB{FileKey: "jobs/b/b.stl", MessageUUID: "m4", Timestamp: 30})
+			if !errors.Is(err, ErrFileDeleting) {
+				t.Errorf("Expected ErrFileDeleting referencing a file being deleted, got %v", err)
+			}
+
+			files, err = db.GetUnreferencedFiles(ctx, 100)
+			if err != nil || len(files) != 1 || !files[0].Deleting {
+				t.Errorf("Expected the file being deleted to be unreferenced, got %+v and error %v", files, err)
+			}
+
+			deleted, err = db.DeleteFile(ctx, "jobs/b/b.stl")
+			if err != nil || !deleted {
+				t.Errorf("Expected unreferenced file to be deleted, got %v and error %v", deleted, err)
+			}
+
+			files, err = db.GetUnreferencedFiles(ctx, 100)
+			if err != nil || len(files) != 0 {
+				t.Errorf("Expected no unreferenced files after deleting them, got %+v and error %v", files, err)
+			}
+
+			existed, err := db.AddFileReference(ctx, types.FileReferenceDB{FileKey: "jobs/b/b.stl", MessageUUID: "m4", Timestamp: 31})
+			if err != nil || existed {
+				t.Errorf("Expected the deleted file to be created again, got %v and error %v", existed, err)
+			}
+		})
+	}
+}
+
+func TestMessageAnalysis(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	analysis := &types.MeshAnalysis{
+		Material: "HR PA 12",
+		Parts:    []types.MeshReport{{Name: "part.stl", Triangles: 12, Max: [3]float64{10, 10, 10}, Volume: 1000, Watertight: true, Manifold: true, Mass: 1.01}},
+		Total:    types.MeshReport{Triangles: 12, Max: [3]float64{10, 10, 10}, Volume: 1000, Watertight: true, Manifold: true, Mass: 1.01},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, msg := range []types.MessageDB{
+				{DeviceUUID: "d1", MessageUUID: "m1", Type: "Job", AdditionalInfo: "part.stl", Timestamp: 1, Analysis: analysis, Caller: "api-key:k1"},
+				{DeviceUUID: "d1", MessageUUID: "m2", Type: "Heartbeat", Timestamp: 2, ResultSecret: "secret"},
+			} {
+				err := tt.db.InsertMessage(ctx, msg)
+				if err != nil {
+					t.Fatalf("Did not expect error inserting message but got %v", err)
+				}
+			}
+
+			messages, err := tt.db.GetMessagesFromDevice(ctx, "d1")
+			if err != nil || len(messages) != 2 {
+				t.Fatalf("Expected 2 messages, got %+v and error %v", messages, err)
+			}
+			if !reflect.DeepEqual(messages[0].Analysis, analysis) || messages[1].Analysis != nil {
+				t.Errorf("Expected only the job to have the analysis, got %+v and %+v", messages[0].Analysis, messages[1].Analysis)
+			}
+			if messages[0].Caller != "api-key:k1" || messages[1].Caller != "" {
+				t.Errorf("Expected only the job to have a caller, got %q and %q", messages[0].Caller, messages[1].Caller)
+			}
+
+			message, err := tt.db.GetMessage(ctx, "d1", "m2")
+			if err != nil || message.MessageUUID != "m2" || message.ResultSecret != "secret" {
+				t.Errorf("Expected the heartbeat with its result secret, got %+v and error %v", message, err)
+			}
+
+			message, err = tt.db.GetMessage(ctx, "d1", "unknown")
+			if err != nil || message.MessageUUID != "" {
+				t.Errorf("Expected unknown message not to be found, got %+v and error %v", message, err)
+			}
+
+			messages, _, err = tt.db.GetMessagesBefore(ctx, 2, "", 10)
+			if err != nil || len(messages) != 1 || !reflect.DeepEqual(messages[0].Analysis, analysis) {
+				t.Errorf("Expected the expired job with its analysis, got %+v and error %v", messages, err)
+			}
+		})
+	}
+}
+
+func TestGetMessagesFromDeviceByTimestamp(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			// the UUIDs are not in the order the messages were sent
+			for _, msg := range []types.MessageDB{
+				{DeviceUUID: "d1", MessageUUID: "c", Type: "Heartbeat", Timestamp: 1},
+				{DeviceUUID: "d1", MessageUUID: "a", Type: "Heartbeat", Timestamp: 3},
+				{DeviceUUID: "d1", MessageUUID: "b", Type: "Heartbeat", Timestamp: 2},
+				{DeviceUUID: "d1", MessageUUID: "d", Type: "Heartbeat", Timestamp: 2},
+			} {
+				err := tt.db.InsertMessage(ctx, msg)
+				if err != nil {
+					t.Fatalf("Did not expect error inserting message but got %v", err)
+				}
+			}
+
+			messages, err := tt.db.GetMessagesFromDevice(ctx, "d1")
+			uuids := []string{}
+			for _, msg := range messages {
+				uuids = append(uuids, msg.MessageUUID)
+			}
+			if err != nil || fmt.Sprint(uuids) != "[c b d a]" {
+				t.Errorf("Expected the messages oldest first, got %v and error %v", uuids, err)
+			}
+		})
+	}
+}
+
+func TestGetMessagesBeforeInPages(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, msg := range []types.MessageDB{
+				{DeviceUUID: "d1", MessageUUID: "m1", Type: "Heartbeat", Timestamp: 3},
+				{DeviceUUID: "d2", MessageUUID: "m2", Type: "Heartbeat", Timestamp: 1},
+				{DeviceUUID: "d1", MessageUUID: "m3", Type: "Heartbeat", Timestamp: 1},
+				{DeviceUUID: "d2", MessageUUID: "m4", Type: "Heartbeat", Timestamp: 2},
+				{DeviceUUID: "d1", MessageUUID: "m5", Type: "Heartbeat", Timestamp: 5},
+			} {
+				err := tt.db.InsertMessage(ctx, msg)
+				if err != nil {
+					t.Fatalf("Did not expect error inserting message but got %v", err)
+				}
+			}
+
+			// the messages of every page are deleted before reading the next one, as the sweeper does
+			pages := [][]string{}
+			cursor := ""
+			for len(pages) < 5 {
+				messages, next, err := tt.db.GetMessagesBefore(ctx, 4, cursor, 2)
+				if err != nil {
+					t.Fatalf("Did not expect error but got %v", err)
+				}
+
+				page := []string{}
+				for _, msg := range messages {
+					page = append(page, msg.MessageUUID)
+					_ = tt.db.DeleteMessage(ctx, msg.DeviceUUID, msg.MessageUUID)
+				}
+				pages = append(pages, page)
+
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			if fmt.Sprint(pages) != "[[m2 m3] [m4 m1]]" && fmt.Sprint(pages) != "[[m2 m3] [m4 m1] []]" {
+				t.Errorf("Unexpected pages %v", pages)
+			}
+
+			_, _, err := tt.db.GetMessagesBefore(ctx, 4, "invalid", 2)
+			if err == nil {
+				t.Errorf("Expected error with an invalid cursor")
+			}
+		})
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	attempts := []struct {
+		holder   string
+		now      int64
+		acquired bool
+	}{
+		{"a", 0, true},
+		{"b", 5, false},
+		{"a", 5, true},
+		{"b", 16, true},
+		{"a", 20, false},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			for _, attempt := range attempts {
+				acquired, err := tt.db.AcquireLease(context.Background(), "sweeper", attempt.holder, attempt.now, attempt.now+10)
+				if err != nil || acquired != attempt.acquired {
+					t.Errorf("Expected %v acquiring the lease at %v to be %v, got %v and error %v", attempt.holder, attempt.now, attempt.acquired, acquired, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLMigration(t *testing.T) {
+	dataSource := filepath.Join(t.TempDir(), "db.sqlite")
+
+	// a database created before messages had an analysis and a caller
+	old, err := sql.Open("sqlite", dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`CREATE TABLE messages (
+		message_uuid    TEXT PRIMARY KEY,
+		device_uuid     TEXT NOT NULL,
+		type            TEXT NOT NULL,
+		additional_info TEXT NOT NULL DEFAULT '',
+		timestamp       BIGINT NOT NULL,
+		last_result     TEXT NOT NULL DEFAULT ''
+	)`)
+	if err == nil {
+		_, err = old.Exec(`INSERT INTO messages (message_uuid, device_uuid, type, timestamp) VALUES ('m1', 'd1', 'Job', 1)`)
+	}
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", dataSource)
+
+	// opening it twice checks that the columns are only added once
+	for i := 0; i < 2; i++ {
+		db := NewDatabaseSQL()
+		messages, err := db.GetMessagesFromDevice(context.Background(), "d1")
+		db.Close()
+
+		if err != nil || len(messages) != 1 || messages[0].Analysis != nil || messages[0].Caller != "" {
+			t.Fatalf("Expected the old message without analysis and caller, got %+v and error %v", messages, err)
+		}
+	}
+}
+
+func TestMaterials(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, material := range []types.Material{
+				{Name: "HR PP", Density: 0.89, Models: []string{"HP Jet Fusion 5210"}},
+				{Name: "HR PA 12", Density: 1, Models: []string{"*"}},
+				{Name: "HR PA 12", Density: 1.01, Models: []string{"HP Jet Fusion 4200", "HP Jet Fusion 5210"}},
+				{Name: "HR TPA", Density: 1.01},
+			} {
+				err := tt.db.PutMaterial(ctx, material)
+				if err != nil {
+					t.Fatalf("Did not expect error storing material but got %v", err)
+				}
+			}
+
+			// materials are sorted by name and replaced by the last material stored with their name
+			expected := []types.Material{
+				{Name: "HR PA 12", Density: 1.01, Models: []string{"HP Jet Fusion 4200", "HP Jet Fusion 5210"}},
+				{Name: "HR PP", Density: 0.89, Models: []string{"HP Jet Fusion 5210"}},
+				{Name: "HR TPA", Density: 1.01, Models: []string{}},
+			}
+
+			materials, err := tt.db.GetMaterials(ctx)
+			if err != nil || !reflect.DeepEqual(materials, expected) {
+				t.Fatalf("Expected materials %+v, got %+v and error %v", expected, materials, err)
+			}
+
+			material, err := tt.db.GetMaterial(ctx, "HR PP")
+			if err != nil || !reflect.DeepEqual(material, expected[1]) {
+				t.Errorf("Expected material %+v, got %+v and error %v", expected[1], material, err)
+			}
+
+			err = tt.db.DeleteMaterial(ctx, "HR PP")
+			if err != nil {
+				t.Fatalf("Did not expect error deleting material but got %v", err)
+			}
+
+			material, err = tt.db.GetMaterial(ctx, "HR PP")
+			if err != nil || material.Name != "" {
+				t.Errorf("Expected deleted material not to be found, got %+v and error %v", material, err)
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			keys := []types.APIKey{
+				{KeyID: "b", Name: "agent", Hash: "hashB", CreatedBy: "cli", CreatedAt: 2},
+				{KeyID: "a", Name: "frontend", Hash: "hashA", CreatedBy: "api-key:b", CreatedAt: 3},
+			}
+			for _, key := range keys {
+				err := tt.db.InsertAPIKey(ctx, key)
+				if err != nil {
+					t.Fatalf("Did not expect error storing API key but got %v", err)
+				}
+			}
+
+			err := tt.db.InsertAPIKey(ctx, types.APIKey{KeyID: "a", Name: "duplicated", Hash: "hash", CreatedAt: 4})
+			if err == nil {
+				t.Errorf("Expected error storing API key with duplicated ID")
+			}
+
+			stored, err := tt.db.GetAPIKeys(ctx)
+			if err != nil || !reflect.DeepEqual(stored, keys) {
+				t.Fatalf("Expected API keys %+v, got %+v and error %v", keys, stored, err)
+			}
+
+			// revoked keys keep their first revocation time
+			for _, timestamp := range []int64{10, 20} {
+				err = tt.db.RevokeAPIKey(ctx, "a", timestamp)
+				if err != nil {
+					t.Fatalf("Did not expect error revoking API key but got %v", err)
+				}
+			}
+
+			key, err := tt.db.GetAPIKey(ctx, "a")
+			expected := keys[1]
+			expected.RevokedAt = 10
+			if err != nil || key != expected {
+				t.Errorf("Expected API key %+v, got %+v and error %v", expected, key, err)
+			}
+
+			key, err = tt.db.GetAPIKey(ctx, "unknown")
+			if err != nil || key.KeyID != "" {
+				t.Errorf("Expected unknown API key not to be found, got %+v and error %v", key, err)
+			}
+		})
+	}
+}
+
+func TestGrantsAndAudit(t *testing.T) {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	sqlDB := NewDatabaseSQL()
+	defer sqlDB.Close()
+
+	var tc = []struct {
+		db       Database
+		testName string
+	}{
+		{NewDatabaseMemory(), "Memory"},
+		{sqlDB, "SQL"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			ctx := context.Background()
+
+			grants := []types.Grant{
+				{GrantID: "g1", Subject: "api-key:a", Role: "admin", Scope: "*", CreatedBy: "cli", CreatedAt: 1},
+				{GrantID: "g2", Subject: "jwt:alice", Role: "viewer", Scope: "group:lab", CreatedAt: 2},
+				{GrantID: "g3", Subject: "jwt:alice", Role: "operator", Scope: "device:d1", CreatedBy: "api-key:a", CreatedAt: 3},
+			}
+			for _, grant := range grants {
+				err := tt.db.InsertGrant(ctx, grant)
+				if err != nil {
+					t.Fatalf("Did not expect error storing grant but got %v", err)
+				}
+			}
+
+			stored, err := tt.db.GetGrants(ctx)
+			if err != nil || !reflect.DeepEqual(stored, grants) {
+				t.Fatalf("Expected grants %+v, got %+v and error %v", grants, stored, err)
+			}
+
+			err = tt.db.DeleteGrant(ctx, "g2")
+			if err != nil {
+				t.Fatalf("Did not expect error deleting grant but got %v", err)
+			}
+
+			stored, err = tt.db.GetGrantsOfSubject(ctx, "jwt:alice")
+			if err != nil || !reflect.DeepEqual(stored, grants[2:]) {
+				t.Errorf("Expected grants %+v, got %+v and error %v", grants[2:], stored, err)
+			}
+
+			entries := []types.AuditEntry{
+				{EntryID: "e1", Timestamp: 10, Caller: "jwt:alice", Action: "POST /heartbeat", Role: "operator", DeviceUUID: "d2"},
+				{EntryID: "e2", Timestamp: 20, Caller: "api-key:b", Action: "GET /auth/grants", Role: "admin"},
+			}
+			for _, entry := range entries {
+				err = tt.db.InsertAuditEntry(ctx, entry)
+				if err != nil {
+					t.Fatalf("Did not expect error storing audit entry but got %v", err)
+				}
+			}
+
+			audit, err := tt.db.GetAuditEntries(ctx, 0)
+			if err != nil || !reflect.DeepEqual(audit, entries) {
+				t.Errorf("Expected audit entries %+v, got %+v and error %v", entries, audit, err)
+			}
+
+			audit, err = tt.db.GetAuditEntries(ctx, 11)
+			if err != nil || !reflect.DeepEqual(audit, entries[1:]) {
+				t.Errorf("Expected audit entries %+v, got %+v and error %v", entries[1:], audit, err)
+			}
+		})
+	}
+}
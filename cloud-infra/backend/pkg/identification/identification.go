@@ -0,0 +1,124 @@
+package identification
+
+import (
+	"backend/pkg/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// unitScales contains the millimeters of every unit used by the devices to describe their build platforms
+var unitScales = map[string]float64{
+	"micron":     0.001,
+	"millimeter": 1,
+	"centimeter": 10,
+	"inch":       25.4,
+	"meter":      1000,
+}
+
+// ErrNoPlatform is returned when the identification information does not describe the usable build platform
+var ErrNoPlatform = errors.New("the identification does not describe the usable platform")
+
+// Platform is a build platform of a device, the box between two corners in millimeters
+type Platform struct {
+	Min [3]float64
+	Max [3]float64
+}
+
+// Size returns the size of the platform in every axis
+func (p Platform) Size() [3]float64 {
+	return [3]float64{p.Max[0] - p.Min[0], p.Max[1] - p.Min[1], p.Max[2] - p.Min[2]}
+}
+
+// Fits returns whether the bounding box of the received mesh fits in the platform.
+// Meshes are not rotated, so their axes are the ones of the platform
+func (p Platform) Fits(report types.MeshReport) bool {
+	size := p.Size()
+	for axis := 0; axis < 3; axis++ {
+		if report.Max[axis]-report.Min[axis] > size[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+type point struct {
+	X *float64
+	Y *float64
+	Z *float64
+}
+
+type box struct {
+	P1    point
+	P2    point
+	Units string
+}
+
+// identification is the part of the identification information uploaded by the devices used by the backend
+type identification struct {
+	Identification struct {
+		PrinterProperties struct {
+			BuildPlatforms struct {
+				// BuildPlatform is an object, or an array of them if the device has several platforms
+				BuildPlatform json.RawMessage
+			}
+		}
+	}
+}
+
+// UsablePlatform reads the identification information uploaded by a device and returns the usable platform
+// of its build platform, PrinterProperties.BuildPlatforms.BuildPlatform.UsablePlatform. If the device has several
+// build platforms the first one is used
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func UsablePlatform(reader io.Reader) (Platform, error) {
+	var info identification
+	err := json.NewDecoder(reader).Decode(&info)
+	if err != nil {
+		return Platform{}, fmt.Errorf("error while reading the identification: %w", err)
+	}
+
+	var platform struct {
+		UsablePlatform *box
+	}
+
+	raw := bytes.TrimSpace(info.Identification.PrinterProperties.BuildPlatforms.BuildPlatform)
+	if len(raw) == 0 {
+		return Platform{}, ErrNoPlatform
+	}
+
+	if raw[0] == '[' {
+		var platforms []json.RawMessage
+		err = json.Unmarshal(raw, &platforms)
+		if err != nil || len(platforms) == 0 {
+			return Platform{}, ErrNoPlatform
+		}
+		raw = platforms[0]
+	}
+
+	err = json.Unmarshal(raw, &platform)
+	if err != nil || platform.UsablePlatform == nil {
+		return Platform{}, ErrNoPlatform
+	}
+
+	usable := platform.UsablePlatform
+	scale, ok := unitScales[usable.Units]
+	if !ok {
+		return Platform{}, fmt.Errorf("error while reading the usable platform: unknown unit %q", usable.Units)
+	}
+
+	var p Platform
+	for axis, values := range [][2]*float64{{usable.P1.X, usable.P2.X}, {usable.P1.Y, usable.P2.Y}, {usable.P1.Z, usable.P2.Z}} {
+		if values[0] == nil || values[1] == nil {
+			return Platform{}, ErrNoPlatform
+		}
+
+		p.Min[axis], p.Max[axis] = *values[0]*scale, *values[1]*scale
+		if p.Min[axis] > p.Max[axis] {
+			p.Min[axis], p.Max[axis] = p.Max[axis], p.Min[axis]
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,82 @@
+package identification
+
+import (
+	"backend/pkg/types"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// identificationJSON returns the identification of a device with the received build platform
+func identificationJSON(buildPlatform string) string {
+	return `{"Identification": {"Version": "1.7.0.0", "PrinterProperties": {"BuildPlatforms": {"BuildPlatform": ` + buildPlatform + `}}}}`
+}
+
+const usablePlatform = `{
+	"MaxPlatform": {"P1": {"X": 0, "Y": 0, "Z": 0}, "P2": {"X": 450000, "Y": 350000, "Z": 425000}, "Units": "micron"},
+	"UsablePlatform": {"P1": {"X": 35000, "Y": 33000, "Z": 16920}, "P2": {"X": 415000, "Y": 317000, "Z": 396920}, "Units": "micron"}
+}`
+
+func TestUsablePlatform(t *testing.T) {
+	var tc = []struct {
+		content  string
+		platform Platform
+		fails    bool
+		testName string
+	}{
+		{identificationJSON(usablePlatform), Platform{Min: [3]float64{35, 33, 16.92}, Max: [3]float64{415, 317, 396.92}}, false, "Usable platform in microns"},
+		{identificationJSON(`[` + usablePlatform + `, {}]`), Platform{Min: [3]float64{35, 33, 16.92}, Max: [3]float64{415, 317, 396.92}}, false, "Several build platforms"},
+		{identificationJSON(`{"UsablePlatform": {"P1": {"X": 10, "Y": 0, "Z": 0}, "P2": {"X": 0, "Y": 20, "Z": 30}, "Units": "centimeter"}}`),
+			Platform{Min: [3]float64{0, 0, 0}, Max: [3]float64{100, 200, 300}}, false, "Usable platform in centimeters"},
+		{identificationJSON(`{"UsablePlatform": {"P1": {"X": 0, "Y": 0, "Z": 0}, "P2": {"X": 1, "Y": 1, "Z": 1}, "Units": "furlong"}}`), Platform{}, true, "Unknown unit"},
+		{identificationJSON(`{"UsablePlatform": {"P1": {"X": 0, "Y": 0}, "P2": {"X": 1, "Y": 1, "Z": 1}, "Units": "micron"}}`), Platform{}, true, "Missing coordinate"},
+		{identificationJSON(`{"MaxPlatform": {}}`), Platform{}, true, "Missing usable platform"},
+		{identificationJSON(`[]`), Platform{}, true, "No build platforms"},
+		{`{"Identification": {}}`, Platform{}, true, "Missing printer properties"},
+		{`{"Identification": `, Platform{}, true, "Invalid JSON"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			platform, err := UsablePlatform(strings.NewReader(tt.content))
+			if (err != nil) != tt.fails {
+				t.Fatalf("Expected error: %v, got %v", tt.fails, err)
+			}
+
+			for axis := 0; axis < 3; axis++ {
+				if !near(platform.Min[axis], tt.platform.Min[axis]) || !near(platform.Max[axis], tt.platform.Max[axis]) {
+					t.Fatalf("Expected platform %+v, got %+v", tt.platform, platform)
+				}
+			}
+		})
+	}
+}
+
+func TestFits(t *testing.T) {
+	platform := Platform{Min: [3]float64{35, 33, 16.92}, Max: [3]float64{415, 317, 396.92}}
+
+	var tc = []struct {
+		min      [3]float64
+		max      [3]float64
+		fits     bool
+		testName string
+	}{
+		{[3]float64{0, 0, 0}, [3]float64{100, 100, 100}, true, "Small part"},
+		{[3]float64{-500, -500, -500}, [3]float64{-200, -300, -200}, true, "Part away from the platform"},
+		{[3]float64{0, 0, 0}, [3]float64{380, 284, 380}, true, "Part as big as the platform"},
+		{[3]float64{0, 0, 0}, [3]float64{100, 300, 100}, false, "Part too wide"},
+		{[3]float64{0, 0, -1}, [3]float64{100, 100, 380}, false, "Part too tall"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if platform.Fits(types.MeshReport{Min: tt.min, Max: tt.max}) != tt.fits {
+				t.Errorf("Expected part to fit: %v", tt.fits)
+			}
+		})
+	}
+}
+
+func near(a float64, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,130 @@
+package materials
+
+import (
+	"backend/pkg/database"
+	"backend/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// AnyModel is the model used in the catalog for the materials compatible with every device
+const AnyModel = "*"
+
+// Defaults contains the materials printed by every device before the catalog existed, which are added to the catalog
+// with Seed. Their densities are the ones of the parts printed with them
+var Defaults = []types.Material{
+	{Name: "HR PA 11", Density: 1.05, Models: []string{AnyModel}},
+	{Name: "HR PA 12", Density: 1.01, Models: []string{AnyModel}},
+	{Name: "HR PA 12GB", Density: 1.30, Models: []string{AnyModel}},
+	{Name: "HR PP", Density: 0.89, Models: []string{AnyModel}},
+	{Name: "HR TPA", Density: 1.01, Models: []string{AnyModel}},
+}
+
+// Compatible returns whether a device of the received model can print with the material.
+// Models are compared ignoring case and surrounding spaces
+func Compatible(material types.Material, model string) bool {
+	model = strings.TrimSpace(model)
+	for _, compatible := range material.Models {
+		if compatible == AnyModel || strings.EqualFold(strings.TrimSpace(compatible), model) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the received material can be added to the catalog: it has a name, a positive density
+// and none of its models is empty
+// Returns nil if valid and a non-nil error otherwise
+func Validate(material types.Material) error {
+	if strings.TrimSpace(material.Name) == "" {
+		return errors.New("invalid material: missing name")
+	}
+
+	if !(material.Density > 0) {
+		return fmt.Errorf("invalid material %v: density must be positive", material.Name)
+	}
+
+	for _, model := range material.Models {
+		if strings.TrimSpace(model) == "" {
+			return fmt.Errorf("invalid material %v: empty model", material.Name)
+		}
+	}
+
+	return nil
+}
+
+// seedLease is the name of the lease marking the catalog as initialized. It is held while the catalog is seeded,
+// and never expires once it is, so that no backend seeds it again
+const seedLease = "materials-seed"
+
+// seedTimeout is the time the lease is held while the catalog is seeded, so that another backend
+// can seed it if the one seeding it stops before finishing
+const seedTimeout = time.Minute
+
+// Seed adds to the catalog of the received database the Defaults that it does not have, keeping the ones with
+// the same name. It is only called when requested, or by SeedOnce, so that materials removed by the users are not added again
+// Returns the number of materials added, and a non-nil error if there's one during the execution and nil otherwise
+func Seed(ctx context.Context, db database.Database) (int, error) {
+	materials, err := db.GetMaterials(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while seeding the materials: %w", err)
+	}
+
+	existing := make(map[string]bool, len(materials))
+	for _, material := range materials {
+		existing[material.Name] = true
+	}
+
+	added := 0
+	for _, material := range Defaults {
+		if existing[material.Name] {
+			continue
+		}
+
+		err = db.PutMaterial(ctx, material)
+		if err != nil {
+			return added, fmt.Errorf("error while seeding the materials: %w", err)
+		}
+		added++
+	}
+
+	return added, nil
+}
+
+// SeedOnce seeds the catalog of the received database the first time a backend identified by holder is started with it,
+// so that jobs can be sent without seeding it on deployment. Catalogs that already have materials, which were seeded
+// before the initialization was marked, are only marked as initialized
+// Returns the number of materials added, and a non-nil error if there's one during the execution and nil otherwise
+func SeedOnce(ctx context.Context, db database.Database, holder string, now time.Time) (int, error) {
+	acquired, err := db.AcquireLease(ctx, seedLease, holder, now.UnixMilli(), now.Add(seedTimeout).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("error while seeding the materials: %w", err)
+	}
+	if !acquired {
+		return 0, nil
+	}
+
+	catalog, err := db.GetMaterials(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while seeding the materials: %w", err)
+	}
+
+	added := 0
+	if len(catalog) == 0 {
+		added, err = Seed(ctx, db)
+		if err != nil {
+			return added, err
+		}
+	}
+
+	_, err = db.AcquireLease(ctx, seedLease, holder, now.UnixMilli(), math.MaxInt64)
+	if err != nil {
+		return added, fmt.Errorf("error while marking the materials as seeded: %w", err)
+	}
+
+	return added, nil
+}
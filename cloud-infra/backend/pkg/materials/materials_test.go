@@ -0,0 +1,128 @@
+package materials
+
+import (
+	"backend/pkg/database"
+	"backend/pkg/types"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompatible(t *testing.T) {
+	var tc = []struct {
+		models     []string
+		model      string
+		compatible bool
+		testName   string
+	}{
+		{[]string{"HP Jet Fusion 5210"}, "HP Jet Fusion 5210", true, "Same model"},
+		{[]string{" hp jet fusion 5210"}, "HP Jet Fusion 5210 ", true, "Model with different case and spaces"},
+		{[]string{"HP Jet Fusion 4200", "HP Jet Fusion 5210"}, "HP Jet Fusion 5210", true, "One of several models"},
+		{[]string{"HP Jet Fusion 4200"}, "HP Jet Fusion 5210", false, "Other model"},
+		{[]string{AnyModel}, "", true, "Any model"},
+		{[]string{}, "HP Jet Fusion 5210", false, "No models"},
+		{[]string{"HP Jet Fusion 5210"}, "", false, "Device without model"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			if Compatible(types.Material{Name: "HR PA 12", Density: 1.01, Models: tt.models}, tt.model) != tt.compatible {
+				t.Errorf("Expected compatible: %v", tt.compatible)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var tc = []struct {
+		material types.Material
+		valid    bool
+		testName string
+	}{
+		{types.Material{Name: "HR PA 12", Density: 1.01, Models: []string{AnyModel}}, true, "Valid material"},
+		{types.Material{Name: "HR PA 12", Density: 1.01}, true, "Material without models"},
+		{types.Material{Name: " ", Density: 1.01}, false, "Missing name"},
+		{types.Material{Name: "HR PA 12", Density: 0}, false, "Missing density"},
+		{types.Material{Name: "HR PA 12", Density: -1}, false, "Negative density"},
+		{types.Material{Name: "HR PA 12", Density: 1.01, Models: []string{""}}, false, "Empty model"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			err := Validate(tt.material)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid: %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabaseMemory()
+
+	// a material of the catalog with the name of a default one is kept
+	edited := types.Material{Name: "HR PP", Density: 0.9, Models: []string{"HP Jet Fusion 5210"}}
+	_ = db.PutMaterial(ctx, edited)
+
+	added, err := Seed(ctx, db)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	catalog, _ := db.GetMaterials(ctx)
+	if added != len(Defaults)-1 || len(catalog) != len(Defaults) {
+		t.Fatalf("Expected %v default materials to be added, got %v and catalog %+v", len(Defaults)-1, added, catalog)
+	}
+
+	material, _ := db.GetMaterial(ctx, "HR PP")
+	if !reflect.DeepEqual(material, edited) {
+		t.Errorf("Expected material %+v to be kept, got %+v", edited, material)
+	}
+
+	// seeding again does not add anything
+	added, err = Seed(ctx, db)
+	if err != nil || added != 0 {
+		t.Errorf("Expected no material to be added, got %v and error %v", added, err)
+	}
+}
+
+func TestSeedOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	var tc = []struct {
+		catalog  []types.Material
+		seeding  bool
+		starts   []time.Time
+		added    []int
+		testName string
+	}{
+		{nil, false, []time.Time{now, now.Add(time.Hour)}, []int{len(Defaults), 0}, "First start"},
+		{[]types.Material{Defaults[0]}, false, []time.Time{now}, []int{0}, "Catalog seeded before marking it"},
+		{nil, true, []time.Time{now, now.Add(2 * seedTimeout)}, []int{0, len(Defaults)}, "Backend stopped while seeding"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			db := database.NewDatabaseMemory()
+			for _, material := range tt.catalog {
+				_ = db.PutMaterial(ctx, material)
+			}
+			if tt.seeding {
+				_, _ = db.AcquireLease(ctx, seedLease, "stopped", now.UnixMilli(), now.Add(seedTimeout).UnixMilli())
+			}
+
+			// every start is a different backend, and the materials removed by the users are not added again
+			for j, start := range tt.starts {
+				added, err := SeedOnce(ctx, db, fmt.Sprintf("backend-%v", j), start)
+				if err != nil || added != tt.added[j] {
+					t.Errorf("Expected %v materials to be added in start %v, got %v and error %v", tt.added[j], j, added, err)
+				}
+				_ = db.DeleteMaterial(ctx, Defaults[1].Name)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package mocks
 
 import (
 	types "backend/pkg/types"
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,39 +35,141 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return m.recorder
 }
 
+// AcquireLease mocks base method.
+func (m *MockDatabase) AcquireLease(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireLease", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireLease indicates an expected call of AcquireLease.
+func (mr *MockDatabaseMockRecorder) AcquireLease(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireLease", reflect.TypeOf((*MockDatabase)(nil).AcquireLease), arg0, arg1, arg2, arg3, arg4)
+}
+
+// AddFileReference mocks base method.
+func (m *MockDatabase) AddFileReference(arg0 context.Context, arg1 types.FileReferenceDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddFileReference", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddFileReference indicates an expected call of AddFileReference.
+func (mr *MockDatabaseMockRecorder) AddFileReference(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFileReference", reflect.TypeOf((*MockDatabase)(nil).AddFileReference), arg0, arg1)
+}
+
+// BeginFileDeletion mocks base method.
+func (m *MockDatabase) BeginFileDeletion(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginFileDeletion", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginFileDeletion indicates an expected call of BeginFileDeletion.
+func (mr *MockDatabaseMockRecorder) BeginFileDeletion(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginFileDeletion", reflect.TypeOf((*MockDatabase)(nil).BeginFileDeletion), arg0, arg1)
+}
+
 // DeleteDeviceFromUUID mocks base method.
-func (m *MockDatabase) DeleteDeviceFromUUID(arg0 string) error {
+func (m *MockDatabase) DeleteDeviceFromUUID(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteDeviceFromUUID", arg0)
+	ret := m.ctrl.Call(m, "DeleteDeviceFromUUID", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteDeviceFromUUID indicates an expected call of DeleteDeviceFromUUID.
-func (mr *MockDatabaseMockRecorder) DeleteDeviceFromUUID(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) DeleteDeviceFromUUID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeviceFromUUID", reflect.TypeOf((*MockDatabase)(nil).DeleteDeviceFromUUID), arg0, arg1)
+}
+
+// DeleteFile mocks base method.
+func (m *MockDatabase) DeleteFile(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFile", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteFile indicates an expected call of DeleteFile.
+func (mr *MockDatabaseMockRecorder) DeleteFile(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeviceFromUUID", reflect.TypeOf((*MockDatabase)(nil).DeleteDeviceFromUUID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockDatabase)(nil).DeleteFile), arg0, arg1)
+}
+
+// DeleteGrant mocks base method.
+func (m *MockDatabase) DeleteGrant(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGrant", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGrant indicates an expected call of DeleteGrant.
+func (mr *MockDatabaseMockRecorder) DeleteGrant(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGrant", reflect.TypeOf((*MockDatabase)(nil).DeleteGrant), arg0, arg1)
+}
+
+// DeleteMaterial mocks base method.
+func (m *MockDatabase) DeleteMaterial(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMaterial", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMaterial indicates an expected call of DeleteMaterial.
+func (mr *MockDatabaseMockRecorder) DeleteMaterial(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMaterial", reflect.TypeOf((*MockDatabase)(nil).DeleteMaterial), arg0, arg1)
+}
+
+// DeleteMessage mocks base method.
+func (m *MockDatabase) DeleteMessage(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMessage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMessage indicates an expected call of DeleteMessage.
+func (mr *MockDatabaseMockRecorder) DeleteMessage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessage", reflect.TypeOf((*MockDatabase)(nil).DeleteMessage), arg0, arg1, arg2)
 }
 
 // DeviceExistWithNameAndIP mocks base method.
-func (m *MockDatabase) DeviceExistWithNameAndIP(arg0, arg1 string) (bool, error) {
+func (m *MockDatabase) DeviceExistWithNameAndIP(arg0 context.Context, arg1, arg2 string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeviceExistWithNameAndIP", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeviceExistWithNameAndIP", arg0, arg1, arg2)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeviceExistWithNameAndIP indicates an expected call of DeviceExistWithNameAndIP.
-func (mr *MockDatabaseMockRecorder) DeviceExistWithNameAndIP(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) DeviceExistWithNameAndIP(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceExistWithNameAndIP", reflect.TypeOf((*MockDatabase)(nil).DeviceExistWithNameAndIP), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceExistWithNameAndIP", reflect.TypeOf((*MockDatabase)(nil).DeviceExistWithNameAndIP), arg0, arg1, arg2)
 }
 
 // DeviceIPAndUUIDFromName mocks base method.
-func (m *MockDatabase) DeviceIPAndUUIDFromName(arg0 string) (string, string, error) {
+func (m *MockDatabase) DeviceIPAndUUIDFromName(arg0 context.Context, arg1 string) (string, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeviceIPAndUUIDFromName", arg0)
+	ret := m.ctrl.Call(m, "DeviceIPAndUUIDFromName", arg0, arg1)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
@@ -74,138 +177,373 @@ func (m *MockDatabase) DeviceIPAndUUIDFromName(arg0 string) (string, string, err
 }
 
 // DeviceIPAndUUIDFromName indicates an expected call of DeviceIPAndUUIDFromName.
-func (mr *MockDatabaseMockRecorder) DeviceIPAndUUIDFromName(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) DeviceIPAndUUIDFromName(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceIPAndUUIDFromName", reflect.TypeOf((*MockDatabase)(nil).DeviceIPAndUUIDFromName), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceIPAndUUIDFromName", reflect.TypeOf((*MockDatabase)(nil).DeviceIPAndUUIDFromName), arg0, arg1)
 }
 
 // DeviceIPFromName mocks base method.
-func (m *MockDatabase) DeviceIPFromName(arg0 string) (string, error) {
+func (m *MockDatabase) DeviceIPFromName(arg0 context.Context, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeviceIPFromName", arg0)
+	ret := m.ctrl.Call(m, "DeviceIPFromName", arg0, arg1)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeviceIPFromName indicates an expected call of DeviceIPFromName.
-func (mr *MockDatabaseMockRecorder) DeviceIPFromName(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) DeviceIPFromName(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceIPFromName", reflect.TypeOf((*MockDatabase)(nil).DeviceIPFromName), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceIPFromName", reflect.TypeOf((*MockDatabase)(nil).DeviceIPFromName), arg0, arg1)
+}
+
+// GetAPIKey mocks base method.
+func (m *MockDatabase) GetAPIKey(arg0 context.Context, arg1 string) (types.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(types.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockDatabaseMockRecorder) GetAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockDatabase)(nil).GetAPIKey), arg0, arg1)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockDatabase) GetAPIKeys(arg0 context.Context) ([]types.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", arg0)
+	ret0, _ := ret[0].([]types.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockDatabaseMockRecorder) GetAPIKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockDatabase)(nil).GetAPIKeys), arg0)
+}
+
+// GetAuditEntries mocks base method.
+func (m *MockDatabase) GetAuditEntries(arg0 context.Context, arg1 int64) ([]types.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEntries", arg0, arg1)
+	ret0, _ := ret[0].([]types.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEntries indicates an expected call of GetAuditEntries.
+func (mr *MockDatabaseMockRecorder) GetAuditEntries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEntries", reflect.TypeOf((*MockDatabase)(nil).GetAuditEntries), arg0, arg1)
 }
 
 // GetDeviceByUUID mocks base method.
-func (m *MockDatabase) GetDeviceByUUID(arg0 string) (types.Device, error) {
+func (m *MockDatabase) GetDeviceByUUID(arg0 context.Context, arg1 string) (types.Device, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetDeviceByUUID", arg0)
+	ret := m.ctrl.Call(m, "GetDeviceByUUID", arg0, arg1)
 	ret0, _ := ret[0].(types.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetDeviceByUUID indicates an expected call of GetDeviceByUUID.
-func (mr *MockDatabaseMockRecorder) GetDeviceByUUID(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetDeviceByUUID(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceByUUID", reflect.TypeOf((*MockDatabase)(nil).GetDeviceByUUID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceByUUID", reflect.TypeOf((*MockDatabase)(nil).GetDeviceByUUID), arg0, arg1)
 }
 
 // GetDevices mocks base method.
-func (m *MockDatabase) GetDevices() ([]types.Device, error) {
+func (m *MockDatabase) GetDevices(arg0 context.Context) ([]types.Device, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetDevices")
+	ret := m.ctrl.Call(m, "GetDevices", arg0)
 	ret0, _ := ret[0].([]types.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetDevices indicates an expected call of GetDevices.
-func (mr *MockDatabaseMockRecorder) GetDevices() *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetDevices(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDevices", reflect.TypeOf((*MockDatabase)(nil).GetDevices), arg0)
+}
+
+// GetGrants mocks base method.
+func (m *MockDatabase) GetGrants(arg0 context.Context) ([]types.Grant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGrants", arg0)
+	ret0, _ := ret[0].([]types.Grant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGrants indicates an expected call of GetGrants.
+func (mr *MockDatabaseMockRecorder) GetGrants(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGrants", reflect.TypeOf((*MockDatabase)(nil).GetGrants), arg0)
+}
+
+// GetGrantsOfSubject mocks base method.
+func (m *MockDatabase) GetGrantsOfSubject(arg0 context.Context, arg1 string) ([]types.Grant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGrantsOfSubject", arg0, arg1)
+	ret0, _ := ret[0].([]types.Grant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGrantsOfSubject indicates an expected call of GetGrantsOfSubject.
+func (mr *MockDatabaseMockRecorder) GetGrantsOfSubject(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGrantsOfSubject", reflect.TypeOf((*MockDatabase)(nil).GetGrantsOfSubject), arg0, arg1)
+}
+
+// GetMaterial mocks base method.
+func (m *MockDatabase) GetMaterial(arg0 context.Context, arg1 string) (types.Material, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaterial", arg0, arg1)
+	ret0, _ := ret[0].(types.Material)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMaterial indicates an expected call of GetMaterial.
+func (mr *MockDatabaseMockRecorder) GetMaterial(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaterial", reflect.TypeOf((*MockDatabase)(nil).GetMaterial), arg0, arg1)
+}
+
+// GetMaterials mocks base method.
+func (m *MockDatabase) GetMaterials(arg0 context.Context) ([]types.Material, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaterials", arg0)
+	ret0, _ := ret[0].([]types.Material)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMaterials indicates an expected call of GetMaterials.
+func (mr *MockDatabaseMockRecorder) GetMaterials(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaterials", reflect.TypeOf((*MockDatabase)(nil).GetMaterials), arg0)
+}
+
+// GetMessage mocks base method.
+func (m *MockDatabase) GetMessage(arg0 context.Context, arg1, arg2 string) (types.MessageDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.MessageDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMessage indicates an expected call of GetMessage.
+func (mr *MockDatabaseMockRecorder) GetMessage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessage", reflect.TypeOf((*MockDatabase)(nil).GetMessage), arg0, arg1, arg2)
+}
+
+// GetMessagesBefore mocks base method.
+func (m *MockDatabase) GetMessagesBefore(arg0 context.Context, arg1 int64, arg2 string, arg3 int) ([]types.MessageDB, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessagesBefore", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]types.MessageDB)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetMessagesBefore indicates an expected call of GetMessagesBefore.
+func (mr *MockDatabaseMockRecorder) GetMessagesBefore(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDevices", reflect.TypeOf((*MockDatabase)(nil).GetDevices))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessagesBefore", reflect.TypeOf((*MockDatabase)(nil).GetMessagesBefore), arg0, arg1, arg2, arg3)
 }
 
 // GetMessagesFromDevice mocks base method.
-func (m *MockDatabase) GetMessagesFromDevice(arg0 string) ([]types.MessageDB, error) {
+func (m *MockDatabase) GetMessagesFromDevice(arg0 context.Context, arg1 string) ([]types.MessageDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMessagesFromDevice", arg0)
+	ret := m.ctrl.Call(m, "GetMessagesFromDevice", arg0, arg1)
 	ret0, _ := ret[0].([]types.MessageDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMessagesFromDevice indicates an expected call of GetMessagesFromDevice.
-func (mr *MockDatabaseMockRecorder) GetMessagesFromDevice(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetMessagesFromDevice(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessagesFromDevice", reflect.TypeOf((*MockDatabase)(nil).GetMessagesFromDevice), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessagesFromDevice", reflect.TypeOf((*MockDatabase)(nil).GetMessagesFromDevice), arg0, arg1)
 }
 
 // GetResponsesFromMessage mocks base method.
-func (m *MockDatabase) GetResponsesFromMessage(arg0, arg1 string) ([]types.Response, error) {
+func (m *MockDatabase) GetResponsesFromMessage(arg0 context.Context, arg1, arg2 string) ([]types.Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetResponsesFromMessage", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetResponsesFromMessage", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]types.Response)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetResponsesFromMessage indicates an expected call of GetResponsesFromMessage.
-func (mr *MockDatabaseMockRecorder) GetResponsesFromMessage(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetResponsesFromMessage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetResponsesFromMessage", reflect.TypeOf((*MockDatabase)(nil).GetResponsesFromMessage), arg0, arg1, arg2)
+}
+
+// GetUnreferencedFiles mocks base method.
+func (m *MockDatabase) GetUnreferencedFiles(arg0 context.Context, arg1 int64) ([]types.FileDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnreferencedFiles", arg0, arg1)
+	ret0, _ := ret[0].([]types.FileDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnreferencedFiles indicates an expected call of GetUnreferencedFiles.
+func (mr *MockDatabaseMockRecorder) GetUnreferencedFiles(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetResponsesFromMessage", reflect.TypeOf((*MockDatabase)(nil).GetResponsesFromMessage), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnreferencedFiles", reflect.TypeOf((*MockDatabase)(nil).GetUnreferencedFiles), arg0, arg1)
+}
+
+// InsertAPIKey mocks base method.
+func (m *MockDatabase) InsertAPIKey(arg0 context.Context, arg1 types.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAPIKey indicates an expected call of InsertAPIKey.
+func (mr *MockDatabaseMockRecorder) InsertAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAPIKey", reflect.TypeOf((*MockDatabase)(nil).InsertAPIKey), arg0, arg1)
+}
+
+// InsertAuditEntry mocks base method.
+func (m *MockDatabase) InsertAuditEntry(arg0 context.Context, arg1 types.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAuditEntry", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAuditEntry indicates an expected call of InsertAuditEntry.
+func (mr *MockDatabaseMockRecorder) InsertAuditEntry(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAuditEntry", reflect.TypeOf((*MockDatabase)(nil).InsertAuditEntry), arg0, arg1)
 }
 
 // InsertDevice mocks base method.
-func (m *MockDatabase) InsertDevice(arg0 types.Device) error {
+func (m *MockDatabase) InsertDevice(arg0 context.Context, arg1 types.Device) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertDevice", arg0)
+	ret := m.ctrl.Call(m, "InsertDevice", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertDevice indicates an expected call of InsertDevice.
-func (mr *MockDatabaseMockRecorder) InsertDevice(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) InsertDevice(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertDevice", reflect.TypeOf((*MockDatabase)(nil).InsertDevice), arg0, arg1)
+}
+
+// InsertGrant mocks base method.
+func (m *MockDatabase) InsertGrant(arg0 context.Context, arg1 types.Grant) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertGrant", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertGrant indicates an expected call of InsertGrant.
+func (mr *MockDatabaseMockRecorder) InsertGrant(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertDevice", reflect.TypeOf((*MockDatabase)(nil).InsertDevice), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertGrant", reflect.TypeOf((*MockDatabase)(nil).InsertGrant), arg0, arg1)
 }
 
 // InsertMessage mocks base method.
-func (m *MockDatabase) InsertMessage(arg0 types.MessageDB) error {
+func (m *MockDatabase) InsertMessage(arg0 context.Context, arg1 types.MessageDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertMessage", arg0)
+	ret := m.ctrl.Call(m, "InsertMessage", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertMessage indicates an expected call of InsertMessage.
-func (mr *MockDatabaseMockRecorder) InsertMessage(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) InsertMessage(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertMessage", reflect.TypeOf((*MockDatabase)(nil).InsertMessage), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertMessage", reflect.TypeOf((*MockDatabase)(nil).InsertMessage), arg0, arg1)
 }
 
 // InsertResult mocks base method.
-func (m *MockDatabase) InsertResult(arg0 types.ResultDB) error {
+func (m *MockDatabase) InsertResult(arg0 context.Context, arg1 types.ResultDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertResult", arg0)
+	ret := m.ctrl.Call(m, "InsertResult", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertResult indicates an expected call of InsertResult.
-func (mr *MockDatabaseMockRecorder) InsertResult(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) InsertResult(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertResult", reflect.TypeOf((*MockDatabase)(nil).InsertResult), arg0, arg1)
+}
+
+// PutMaterial mocks base method.
+func (m *MockDatabase) PutMaterial(arg0 context.Context, arg1 types.Material) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutMaterial", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutMaterial indicates an expected call of PutMaterial.
+func (mr *MockDatabaseMockRecorder) PutMaterial(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutMaterial", reflect.TypeOf((*MockDatabase)(nil).PutMaterial), arg0, arg1)
+}
+
+// RemoveFileReference mocks base method.
+func (m *MockDatabase) RemoveFileReference(arg0 context.Context, arg1 types.FileReferenceDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveFileReference", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveFileReference indicates an expected call of RemoveFileReference.
+func (mr *MockDatabaseMockRecorder) RemoveFileReference(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFileReference", reflect.TypeOf((*MockDatabase)(nil).RemoveFileReference), arg0, arg1)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockDatabase) RevokeAPIKey(arg0 context.Context, arg1 string, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockDatabaseMockRecorder) RevokeAPIKey(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertResult", reflect.TypeOf((*MockDatabase)(nil).InsertResult), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockDatabase)(nil).RevokeAPIKey), arg0, arg1, arg2)
 }
 
 // UpdateDevice mocks base method.
-func (m *MockDatabase) UpdateDevice(arg0 types.Device) error {
+func (m *MockDatabase) UpdateDevice(arg0 context.Context, arg1 types.Device) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateDevice", arg0)
+	ret := m.ctrl.Call(m, "UpdateDevice", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateDevice indicates an expected call of UpdateDevice.
-func (mr *MockDatabaseMockRecorder) UpdateDevice(arg0 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) UpdateDevice(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDevice", reflect.TypeOf((*MockDatabase)(nil).UpdateDevice), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDevice", reflect.TypeOf((*MockDatabase)(nil).UpdateDevice), arg0, arg1)
 }
@@ -6,9 +6,11 @@ package mocks
 
 import (
 	types "backend/pkg/types"
+	context "context"
 	io "io"
 	os "os"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -37,44 +39,176 @@ func (m *MockObjStorage) EXPECT() *MockObjStorageMockRecorder {
 }
 
 // AvailableInformation mocks base method.
-func (m *MockObjStorage) AvailableInformation() (types.Information, error) {
+func (m *MockObjStorage) AvailableInformation(arg0 context.Context) (types.Information, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AvailableInformation")
+	ret := m.ctrl.Call(m, "AvailableInformation", arg0)
 	ret0, _ := ret[0].(types.Information)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AvailableInformation indicates an expected call of AvailableInformation.
-func (mr *MockObjStorageMockRecorder) AvailableInformation() *gomock.Call {
+func (mr *MockObjStorageMockRecorder) AvailableInformation(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AvailableInformation", reflect.TypeOf((*MockObjStorage)(nil).AvailableInformation))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AvailableInformation", reflect.TypeOf((*MockObjStorage)(nil).AvailableInformation), arg0)
+}
+
+// CompleteMultipartUpload mocks base method.
+func (m *MockObjStorage) CompleteMultipartUpload(arg0 context.Context, arg1 string, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteMultipartUpload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteMultipartUpload indicates an expected call of CompleteMultipartUpload.
+func (mr *MockObjStorageMockRecorder) CompleteMultipartUpload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteMultipartUpload", reflect.TypeOf((*MockObjStorage)(nil).CompleteMultipartUpload), arg0, arg1, arg2)
+}
+
+// CopyFile mocks base method.
+func (m *MockObjStorage) CopyFile(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyFile", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CopyFile indicates an expected call of CopyFile.
+func (mr *MockObjStorageMockRecorder) CopyFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyFile", reflect.TypeOf((*MockObjStorage)(nil).CopyFile), arg0, arg1, arg2)
+}
+
+// CreateMultipartUpload mocks base method.
+func (m *MockObjStorage) CreateMultipartUpload(arg0 context.Context, arg1 string, arg2 int, arg3 time.Duration) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMultipartUpload", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMultipartUpload indicates an expected call of CreateMultipartUpload.
+func (mr *MockObjStorageMockRecorder) CreateMultipartUpload(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMultipartUpload", reflect.TypeOf((*MockObjStorage)(nil).CreateMultipartUpload), arg0, arg1, arg2, arg3)
+}
+
+// DeleteFile mocks base method.
+func (m *MockObjStorage) DeleteFile(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFile", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFile indicates an expected call of DeleteFile.
+func (mr *MockObjStorageMockRecorder) DeleteFile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockObjStorage)(nil).DeleteFile), arg0, arg1)
+}
+
+// Exists mocks base method.
+func (m *MockObjStorage) Exists(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockObjStorageMockRecorder) Exists(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockObjStorage)(nil).Exists), arg0, arg1)
 }
 
 // GetFile mocks base method.
-func (m *MockObjStorage) GetFile(arg0 string, arg1 *os.File) error {
+func (m *MockObjStorage) GetFile(arg0 context.Context, arg1 string, arg2 *os.File) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFile", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetFile", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // GetFile indicates an expected call of GetFile.
-func (mr *MockObjStorageMockRecorder) GetFile(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockObjStorageMockRecorder) GetFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFile", reflect.TypeOf((*MockObjStorage)(nil).GetFile), arg0, arg1, arg2)
+}
+
+// ListFiles mocks base method.
+func (m *MockObjStorage) ListFiles(arg0 context.Context, arg1 string) ([]types.ObjectInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFiles", arg0, arg1)
+	ret0, _ := ret[0].([]types.ObjectInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFiles indicates an expected call of ListFiles.
+func (mr *MockObjStorageMockRecorder) ListFiles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFiles", reflect.TypeOf((*MockObjStorage)(nil).ListFiles), arg0, arg1)
+}
+
+// OpenFile mocks base method.
+func (m *MockObjStorage) OpenFile(arg0 context.Context, arg1 string) (io.ReadSeekCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenFile", arg0, arg1)
+	ret0, _ := ret[0].(io.ReadSeekCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenFile indicates an expected call of OpenFile.
+func (mr *MockObjStorageMockRecorder) OpenFile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenFile", reflect.TypeOf((*MockObjStorage)(nil).OpenFile), arg0, arg1)
+}
+
+// PresignGetURL mocks base method.
+func (m *MockObjStorage) PresignGetURL(arg0 context.Context, arg1 string, arg2 time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresignGetURL", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PresignGetURL indicates an expected call of PresignGetURL.
+func (mr *MockObjStorageMockRecorder) PresignGetURL(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignGetURL", reflect.TypeOf((*MockObjStorage)(nil).PresignGetURL), arg0, arg1, arg2)
+}
+
+// PresignPutURL mocks base method.
+func (m *MockObjStorage) PresignPutURL(arg0 context.Context, arg1 string, arg2 time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresignPutURL", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PresignPutURL indicates an expected call of PresignPutURL.
+func (mr *MockObjStorageMockRecorder) PresignPutURL(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFile", reflect.TypeOf((*MockObjStorage)(nil).GetFile), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignPutURL", reflect.TypeOf((*MockObjStorage)(nil).PresignPutURL), arg0, arg1, arg2)
 }
 
 // UploadFile mocks base method.
-func (m *MockObjStorage) UploadFile(arg0 io.Reader, arg1 string) error {
+func (m *MockObjStorage) UploadFile(arg0 context.Context, arg1 io.Reader, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadFile", arg0, arg1)
+	ret := m.ctrl.Call(m, "UploadFile", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UploadFile indicates an expected call of UploadFile.
-func (mr *MockObjStorageMockRecorder) UploadFile(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockObjStorageMockRecorder) UploadFile(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockObjStorage)(nil).UploadFile), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockObjStorage)(nil).UploadFile), arg0, arg1, arg2)
 }
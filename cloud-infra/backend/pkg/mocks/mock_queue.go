@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,15 +35,15 @@ func (m *MockQueue) EXPECT() *MockQueueMockRecorder {
 }
 
 // SendMessage mocks base method.
-func (m *MockQueue) SendMessage(arg0 string) error {
+func (m *MockQueue) SendMessage(ctx context.Context, body, groupID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendMessage", arg0)
+	ret := m.ctrl.Call(m, "SendMessage", ctx, body, groupID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendMessage indicates an expected call of SendMessage.
-func (mr *MockQueueMockRecorder) SendMessage(arg0 interface{}) *gomock.Call {
+func (mr *MockQueueMockRecorder) SendMessage(ctx, body, groupID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockQueue)(nil).SendMessage), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockQueue)(nil).SendMessage), ctx, body, groupID)
 }
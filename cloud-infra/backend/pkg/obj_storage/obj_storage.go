@@ -2,14 +2,33 @@ package objstorage
 
 import (
 	"backend/pkg/types"
+	"context"
+	"errors"
 	"io"
 	"os"
+	"time"
 )
 
+// ErrPresignNotSupported is returned by the implementations that cannot generate presigned URLs
+var ErrPresignNotSupported = errors.New("presigned URLs are not supported by this object storage")
+
+// ErrIncompleteUpload is returned when a multipart upload is completed before all its parts are uploaded
+var ErrIncompleteUpload = errors.New("the multipart upload does not have all its parts")
+
 // ObjStorage interface defines the methods that ObjStorage implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
+// Every method receives the context of the request, so that the call is cancelled if the request is
 type ObjStorage interface {
-	UploadFile(io.Reader, string) error
-	AvailableInformation() (types.Information, error)
-	GetFile(string, *os.File) error
+	UploadFile(context.Context, io.Reader, string) error
+	AvailableInformation(context.Context) (types.Information, error)
+	GetFile(context.Context, string, *os.File) error
+	OpenFile(context.Context, string) (io.ReadSeekCloser, error)
+	Exists(context.Context, string) (bool, error)
+	ListFiles(context.Context, string) ([]types.ObjectInfo, error)
+	DeleteFile(context.Context, string) error
+	PresignGetURL(context.Context, string, time.Duration) (string, error)
+	PresignPutURL(context.Context, string, time.Duration) (string, error)
+	CreateMultipartUpload(context.Context, string, int, time.Duration) ([]string, error)
+	CompleteMultipartUpload(context.Context, string, int) error
+	CopyFile(context.Context, string, string) error
 }
@@ -1,31 +1,45 @@
 package objstorage
 
 import (
+	"backend/pkg/awsconfig"
 	"backend/pkg/types"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxCopySize is the size of the largest object that S3 copies with a single request,
+// bigger objects are copied with a multipart upload in parts of copyPartSize bytes
+const (
+	maxCopySize  = 5 << 30
+	copyPartSize = 512 << 20
 )
 
 // S3 defines the struct used to implement ObjStorage interface using AWS S3
 // It contains an S3 client and the name of the bucket to be used
 type S3 struct {
-	s3Client   *s3.Client
-	BUCKETNAME string
-	downloader *manager.Downloader
+	s3Client      *s3.Client
+	BUCKETNAME    string
+	downloader    *manager.Downloader
+	presignClient *s3.PresignClient
 }
 
-// NewObjStorageS3 creates and returns the reference to a new S3 struct
-func NewObjStorageS3() *S3 {
+// NewObjStorageS3 creates and returns the reference to a new S3 struct using the received AWS configuration
+func NewObjStorageS3(awsConfig awsconfig.Config) *S3 {
 	obj := &S3{}
-	obj.initialize()
+	obj.initialize(awsConfig)
 	return obj
 }
 
@@ -57,23 +71,23 @@ func GetObjects(c context.Context, api S3ListObjectsAPI, input *s3.ListObjectsV2
 	return api.ListObjectsV2(c, input)
 }
 
-func (obj *S3) initialize() {
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+func (obj *S3) initialize(awsConfig awsconfig.Config) {
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic(fmt.Sprintf("Configuration error: %v\n", err))
 	}
 
-	_, ok := os.LookupEnv("S3_BUCKET_NAME")
-	if !ok {
-		panic("Environment variable S3_BUCKET_NAME does not exist")
+	if awsConfig.BucketName == "" {
+		panic("S3 bucket name not configured, set environment variable S3_BUCKET_NAME")
 	}
-	obj.BUCKETNAME = os.Getenv("S3_BUCKET_NAME")
+	obj.BUCKETNAME = awsConfig.BucketName
 
-	obj.s3Client = s3.NewFromConfig(cfg)
+	obj.s3Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = awsConfig.UsePathStyle
+	})
 	obj.downloader = manager.NewDownloader(obj.s3Client)
+	obj.presignClient = s3.NewPresignClient(obj.s3Client)
 }
 
 func putFile(c context.Context, api S3PutObjectAPI, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
@@ -83,14 +97,14 @@ func putFile(c context.Context, api S3PutObjectAPI, input *s3.PutObjectInput) (*
 // UploadFile receives an instance of a file that implements interface io.Reader and a name
 // and upload that file with that name to S3
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (obj *S3) UploadFile(file io.Reader, s3Name string) error {
+func (obj *S3) UploadFile(ctx context.Context, file io.Reader, s3Name string) error {
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(obj.BUCKETNAME),
 		Key:    aws.String(s3Name),
 		Body:   file,
 	}
 
-	_, err := putFile(context.TODO(), obj.s3Client, input)
+	_, err := putFile(ctx, obj.s3Client, input)
 	if err != nil {
 		err = fmt.Errorf("got an error uploading the file: %w", err)
 	}
@@ -101,7 +115,7 @@ func (obj *S3) UploadFile(file io.Reader, s3Name string) error {
 // AvailableInformation returns an Information type object containing all the files (Jobs and Identification)
 // whose name starts with 'Jobs-' or 'Identification-' respectively.
 // It also returns a non-nil error if there's one during the execution and nil otherwise
-func (obj *S3) AvailableInformation() (types.Information, error) {
+func (obj *S3) AvailableInformation(ctx context.Context) (types.Information, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(obj.BUCKETNAME),
 	}
@@ -110,7 +124,7 @@ func (obj *S3) AvailableInformation() (types.Information, error) {
 	listAvailable.Jobs = make([]string, 0)
 	listAvailable.Identification = make([]string, 0)
 
-	resp, err := GetObjects(context.TODO(), obj.s3Client, input)
+	resp, err := GetObjects(ctx, obj.s3Client, input)
 
 	if err != nil {
 		err = fmt.Errorf("error getting the list of available files: %w", err)
@@ -132,8 +146,8 @@ func (obj *S3) AvailableInformation() (types.Information, error) {
 // GetFile receives a file name and a file pointer
 // It will retrieve the mentioned file from S3 and store it in the pointer received
 // It also returns a non-nil error if there's one during the execution and nil otherwise
-func (obj *S3) GetFile(fileName string, fd *os.File) error {
-	_, err := obj.downloader.Download(context.TODO(), fd, &s3.GetObjectInput{
+func (obj *S3) GetFile(ctx context.Context, fileName string, fd *os.File) error {
+	_, err := obj.downloader.Download(ctx, fd, &s3.GetObjectInput{
 		Bucket: aws.String(obj.BUCKETNAME),
 		Key:    aws.String(fileName),
 	})
@@ -144,3 +158,378 @@ func (obj *S3) GetFile(fileName string, fd *os.File) error {
 
 	return err
 }
+
+// OpenFile receives a file name and returns a reader of the file with that name in S3, that downloads it
+// as it is read instead of storing it. Seeking makes the next read request the file from the new offset
+// The caller has to close the reader
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) OpenFile(ctx context.Context, fileName string) (io.ReadSeekCloser, error) {
+	head, err := obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while opening the file: %w", err)
+	}
+
+	return &s3Reader{ctx: ctx, obj: obj, key: fileName, size: head.ContentLength}, nil
+}
+
+// s3Reader reads an object of S3 with range requests, keeping the body of the last one open
+// while it is read sequentially
+type s3Reader struct {
+	ctx    context.Context
+	obj    *S3
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		resp, err := r.obj.s3Client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(r.obj.BUCKETNAME),
+			Key:    aws.String(r.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error while reading the file: %w", err)
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("error while seeking the file: negative offset")
+	}
+
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+
+	return r.offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Exists receives a file name and returns whether a file with that name is stored in S3
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) Exists(ctx context.Context, fileName string) (bool, error) {
+	_, err := obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	})
+
+	var responseError *awshttp.ResponseError
+	if errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error while checking the file: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListFiles receives a prefix and returns the information of all the files in S3 whose name starts with it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) ListFiles(ctx context.Context, prefix string) ([]types.ObjectInfo, error) {
+	files := []types.ObjectInfo{}
+
+	paginator := s3.NewListObjectsV2Paginator(obj.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("error getting the list of files: %w", err)
+			return nil, err
+		}
+
+		for _, s := range resp.Contents {
+			files = append(files, types.ObjectInfo{
+				Key:          aws.ToString(s.Key),
+				Size:         s.Size,
+				LastModified: aws.ToTime(s.LastModified).UnixMilli(),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// DeleteFile receives a file name and deletes the file with that name from S3
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) DeleteFile(ctx context.Context, fileName string) error {
+	_, err := obj.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	})
+
+	if err != nil {
+		err = fmt.Errorf("error while deleting the file: %w", err)
+	}
+
+	return err
+}
+
+// PresignGetURL receives a file name and returns a URL that can be used to download it from S3
+// without credentials until the received expiry elapses
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) PresignGetURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	req, err := obj.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	}, s3.WithPresignExpires(expiry))
+
+	if err != nil {
+		return "", fmt.Errorf("error while presigning the file URL: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+// PresignPutURL receives a file name and returns a URL that can be used to upload it to S3 with a single PUT request
+// without credentials until the received expiry elapses
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) PresignPutURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	req, err := obj.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	}, s3.WithPresignExpires(expiry))
+
+	if err != nil {
+		return "", fmt.Errorf("error while presigning the file URL: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+// CreateMultipartUpload starts a multipart upload of the file with the received name and returns the URLs
+// that can be used to upload the received number of parts, in order, until the received expiry elapses.
+// The upload has to be completed with CompleteMultipartUpload once all the parts are uploaded
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) CreateMultipartUpload(ctx context.Context, fileName string, parts int, expiry time.Duration) ([]string, error) {
+	upload, err := obj.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while creating the multipart upload: %w", err)
+	}
+
+	urls := make([]string, 0, parts)
+	for part := 1; part <= parts; part++ {
+		req, err := obj.presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(obj.BUCKETNAME),
+			Key:        aws.String(fileName),
+			UploadId:   upload.UploadId,
+			PartNumber: int32(part),
+		}, s3.WithPresignExpires(expiry))
+
+		if err != nil {
+			obj.abortMultipartUpload(ctx, fileName, upload.UploadId)
+			return nil, fmt.Errorf("error while presigning the part URL: %w", err)
+		}
+		urls = append(urls, req.URL)
+	}
+
+	return urls, nil
+}
+
+// CompleteMultipartUpload completes the multipart upload of the file with the received name, so that it is stored in S3,
+// if all the received number of parts have been uploaded. Otherwise, it returns ErrIncompleteUpload and the upload
+// is left pending. It does nothing if there is no pending upload of the file, as it can already have been completed
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) CompleteMultipartUpload(ctx context.Context, fileName string, parts int) error {
+	uploadIDs, err := obj.multipartUploads(ctx, fileName)
+	if err != nil {
+		return err
+	}
+
+	for _, uploadID := range uploadIDs {
+		uploaded := []s3types.CompletedPart{}
+
+		paginator := s3.NewListPartsPaginator(obj.s3Client, &s3.ListPartsInput{
+			Bucket:   aws.String(obj.BUCKETNAME),
+			Key:      aws.String(fileName),
+			UploadId: uploadID,
+		})
+
+		for paginator.HasMorePages() {
+			resp, err := paginator.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("error while getting the uploaded parts: %w", err)
+			}
+
+			for _, part := range resp.Parts {
+				uploaded = append(uploaded, s3types.CompletedPart{ETag: part.ETag, PartNumber: part.PartNumber})
+			}
+		}
+
+		// parts are listed in order, so every part from 1 to parts has to be in its position
+		if len(uploaded) != parts {
+			return fmt.Errorf("error while completing the multipart upload, %v of %v parts uploaded: %w", len(uploaded), parts, ErrIncompleteUpload)
+		}
+		for i, part := range uploaded {
+			if part.PartNumber != int32(i+1) {
+				return fmt.Errorf("error while completing the multipart upload, part %v is missing: %w", i+1, ErrIncompleteUpload)
+			}
+		}
+
+		_, err = obj.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(obj.BUCKETNAME),
+			Key:             aws.String(fileName),
+			UploadId:        uploadID,
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: uploaded},
+		})
+		if err != nil {
+			return fmt.Errorf("error while completing the multipart upload: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// multipartUploads returns the IDs of the pending multipart uploads of the file with the received name,
+// going through all the pages of uploads
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) multipartUploads(ctx context.Context, fileName string) ([]*string, error) {
+	uploadIDs := []*string{}
+
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Prefix: aws.String(fileName),
+	}
+
+	for {
+		resp, err := obj.s3Client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error while getting the multipart uploads: %w", err)
+		}
+
+		// the prefix also matches longer names
+		for _, upload := range resp.Uploads {
+			if aws.ToString(upload.Key) == fileName {
+				uploadIDs = append(uploadIDs, upload.UploadId)
+			}
+		}
+
+		if !resp.IsTruncated {
+			return uploadIDs, nil
+		}
+
+		input.KeyMarker = resp.NextKeyMarker
+		input.UploadIdMarker = resp.NextUploadIdMarker
+	}
+}
+
+// CopyFile receives the name of a file in S3 and stores a copy of it with the name dst without downloading it.
+// Files bigger than maxCopySize are copied in parts
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *S3) CopyFile(ctx context.Context, src string, dst string) error {
+	head, err := obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return fmt.Errorf("error while copying the file: %w", err)
+	}
+
+	copySource := obj.BUCKETNAME + "/" + url.PathEscape(src)
+
+	if head.ContentLength <= maxCopySize {
+		_, err = obj.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(obj.BUCKETNAME),
+			Key:        aws.String(dst),
+			CopySource: aws.String(copySource),
+		})
+		if err != nil {
+			err = fmt.Errorf("error while copying the file: %w", err)
+		}
+		return err
+	}
+
+	upload, err := obj.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(obj.BUCKETNAME),
+		Key:    aws.String(dst),
+	})
+	if err != nil {
+		return fmt.Errorf("error while copying the file: %w", err)
+	}
+
+	parts := []s3types.CompletedPart{}
+	for start, part := int64(0), int32(1); start < head.ContentLength; start, part = start+copyPartSize, part+1 {
+		end := start + copyPartSize - 1
+		if end >= head.ContentLength {
+			end = head.ContentLength - 1
+		}
+
+		resp, err := obj.s3Client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(obj.BUCKETNAME),
+			Key:             aws.String(dst),
+			UploadId:        upload.UploadId,
+			PartNumber:      part,
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			obj.abortMultipartUpload(ctx, dst, upload.UploadId)
+			return fmt.Errorf("error while copying the file: %w", err)
+		}
+		parts = append(parts, s3types.CompletedPart{ETag: resp.CopyPartResult.ETag, PartNumber: part})
+	}
+
+	_, err = obj.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(obj.BUCKETNAME),
+		Key:             aws.String(dst),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		obj.abortMultipartUpload(ctx, dst, upload.UploadId)
+		return fmt.Errorf("error while copying the file: %w", err)
+	}
+
+	return nil
+}
+
+// abortMultipartUpload aborts the received multipart upload, so that the parts uploaded are deleted
+func (obj *S3) abortMultipartUpload(ctx context.Context, fileName string, uploadID *string) {
+	_, err := obj.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(obj.BUCKETNAME),
+		Key:      aws.String(fileName),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		fmt.Printf("Error while aborting the multipart upload of %v: %v\n", fileName, err)
+	}
+}
@@ -0,0 +1,413 @@
+package objstorage
+
+import (
+	"backend/pkg/types"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// metadataDir is the directory, relative to the root one, where metadata sidecars are stored
+	metadataDir = ".meta"
+	// tmpDir is the directory, relative to the root one, where files are written before being moved to their final location
+	tmpDir = ".tmp"
+)
+
+// FileMetadata represents the information stored in the sidecar of every file saved by FileSystem
+type FileMetadata struct {
+	ContentType string
+	SHA256      string
+	Size        int64
+	Modified    int64
+}
+
+// FileSystem defines the struct used to implement ObjStorage interface using a local directory,
+// which can be a shared volume such as an NFS mount.
+// Files are written atomically and every file has a JSON metadata sidecar with its content type and checksum
+type FileSystem struct {
+	root string
+}
+
+// NewObjStorageFileSystem creates and returns the reference to a new FileSystem struct
+// The directory used is read from the OBJ_STORAGE_DIRECTORY environment variable and created if needed
+func NewObjStorageFileSystem() *FileSystem {
+	root, ok := os.LookupEnv("OBJ_STORAGE_DIRECTORY")
+	if !ok {
+		panic("Environment variable OBJ_STORAGE_DIRECTORY does not exist")
+	}
+
+	obj, err := NewObjStorageFileSystemFromDir(root)
+	if err != nil {
+		panic(fmt.Sprintf("Configuration error in filesystem object storage: %v", err))
+	}
+	return obj
+}
+
+// NewObjStorageFileSystemFromDir creates and returns the reference to a new FileSystem struct using the received directory
+// Returns a non-nil error if the needed directories cannot be created and nil otherwise
+func NewObjStorageFileSystemFromDir(root string) (*FileSystem, error) {
+	for _, dir := range []string{root, filepath.Join(root, metadataDir), filepath.Join(root, tmpDir)} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileSystem{root: root}, nil
+}
+
+// objectPath returns the path where the object with the received key is stored
+// keys use '/' as separator and cannot point outside of the root directory
+func (obj *FileSystem) objectPath(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.HasPrefix(clean, "/"+metadataDir) || strings.HasPrefix(clean, "/"+tmpDir) {
+		return "", fmt.Errorf("invalid object name: %q", key)
+	}
+	return filepath.Join(obj.root, filepath.FromSlash(clean)), nil
+}
+
+func (obj *FileSystem) metadataPath(key string) string {
+	return filepath.Join(obj.root, metadataDir, filepath.FromSlash(path.Clean("/"+key))+".json")
+}
+
+// UploadFile receives an instance of a file that implements interface io.Reader and a name
+// and stores that file with that name in the directory, together with its metadata sidecar.
+// Both are written to temporary files first, and the sidecar is moved right after the file, so that a sidecar
+// is never left describing a file that was not stored. Readers ignore the sidecar of a previous version of the file
+// that an interrupted upload did not replace, see GetFile
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) UploadFile(ctx context.Context, file io.Reader, name string) error {
+	dst, err := obj.objectPath(name)
+	if err != nil {
+		return fmt.Errorf("got an error uploading the file: %w", err)
+	}
+
+	hash := sha256.New()
+	tmpFile, size, err := obj.writeTemp(io.TeeReader(file, hash))
+	if err != nil {
+		return fmt.Errorf("got an error uploading the file: %w", err)
+	}
+	defer os.Remove(tmpFile)
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	metadata := FileMetadata{
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		Modified:    time.Now().UnixMilli(),
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("got an error creating the file metadata: %w", err)
+	}
+
+	tmpMetadata, _, err := obj.writeTemp(strings.NewReader(string(metadataJSON)))
+	if err != nil {
+		return fmt.Errorf("got an error writing the file metadata: %w", err)
+	}
+	defer os.Remove(tmpMetadata)
+
+	err = move(tmpFile, dst)
+	if err != nil {
+		return fmt.Errorf("got an error uploading the file: %w", err)
+	}
+
+	err = move(tmpMetadata, obj.metadataPath(name))
+	if err != nil {
+		return fmt.Errorf("got an error writing the file metadata: %w", err)
+	}
+
+	return nil
+}
+
+// writeTemp copies the content of r to a temporary file and returns its name and size, so that it can be moved
+// to its final location once it is written and readers never see a partially written file
+func (obj *FileSystem) writeTemp(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(obj.root, tmpDir), "upload-")
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+
+	return tmp.Name(), size, nil
+}
+
+// move renames the file src to dst, creating the directory of dst if needed
+func move(src string, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// Metadata returns the metadata stored in the sidecar of the file with the received name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) Metadata(name string) (FileMetadata, error) {
+	var metadata FileMetadata
+
+	data, err := os.ReadFile(obj.metadataPath(name))
+	if err != nil {
+		return metadata, fmt.Errorf("error reading the file metadata: %w", err)
+	}
+
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return metadata, fmt.Errorf("error reading the file metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// List returns the names of all stored files starting with the received prefix, sorted alphabetically
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) List(prefix string) ([]string, error) {
+	keys := []string{}
+
+	err := filepath.WalkDir(obj.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(obj.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if key == metadataDir || key == tmpDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+
+	sort.Strings(keys)
+	return keys, err
+}
+
+// AvailableInformation returns an Information type object containing all the files (Jobs and Identification)
+// whose name starts with 'Jobs-' or 'Identification-' respectively.
+// It also returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) AvailableInformation(ctx context.Context) (types.Information, error) {
+	var listAvailable types.Information
+	listAvailable.Jobs = make([]string, 0)
+	listAvailable.Identification = make([]string, 0)
+
+	jobs, err := obj.List("Jobs-")
+	if err != nil {
+		err = fmt.Errorf("error getting the list of available files: %w", err)
+		return listAvailable, err
+	}
+
+	identification, err := obj.List("Identification-")
+	if err != nil {
+		err = fmt.Errorf("error getting the list of available files: %w", err)
+		return listAvailable, err
+	}
+
+	listAvailable.Jobs = append(listAvailable.Jobs, jobs...)
+	listAvailable.Identification = append(listAvailable.Identification, identification...)
+	return listAvailable, nil
+}
+
+// GetFile receives a file name and a file pointer
+// It will copy the mentioned file to the pointer received, verifying its checksum. A sidecar whose size does not match
+// the file belongs to a previous version of it, left by an upload interrupted between moving the file and its sidecar,
+// and is ignored as if it were missing
+// It also returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) GetFile(ctx context.Context, fileName string, fd *os.File) error {
+	src, err := obj.objectPath(fileName)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(fd, hash), file)
+	if err != nil {
+		return fmt.Errorf("error while downloading the file: %w", err)
+	}
+
+	metadata, err := obj.Metadata(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		// files copied to the directory by other means have no sidecar
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if metadata.Size != size {
+		fmt.Printf("Ignoring the metadata of %v, which has %v bytes instead of %v\n", fileName, size, metadata.Size)
+		return nil
+	}
+
+	if metadata.SHA256 != hex.EncodeToString(hash.Sum(nil)) {
+		return fmt.Errorf("error while downloading the file: checksum mismatch for %v", fileName)
+	}
+	return nil
+}
+
+// OpenFile receives a file name and returns the file with that name in the directory, opened for reading.
+// Unlike GetFile, the checksum is not verified, as the file is not read entirely
+// The caller has to close the file
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) OpenFile(ctx context.Context, fileName string) (io.ReadSeekCloser, error) {
+	src, err := obj.objectPath(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening the file: %w", err)
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening the file: %w", err)
+	}
+
+	return file, nil
+}
+
+// Exists receives a file name and returns whether a file with that name is stored in the directory
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) Exists(ctx context.Context, fileName string) (bool, error) {
+	src, err := obj.objectPath(fileName)
+	if err != nil {
+		return false, fmt.Errorf("error while checking the file: %w", err)
+	}
+
+	_, err = os.Stat(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error while checking the file: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListFiles receives a prefix and returns the information of all the files in the directory whose name starts with it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) ListFiles(ctx context.Context, prefix string) ([]types.ObjectInfo, error) {
+	keys, err := obj.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the list of files: %w", err)
+	}
+
+	files := make([]types.ObjectInfo, 0, len(keys))
+	for _, key := range keys {
+		src, err := obj.objectPath(key)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of files: %w", err)
+		}
+
+		info, err := os.Stat(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			// deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of files: %w", err)
+		}
+
+		files = append(files, types.ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime().UnixMilli()})
+	}
+
+	return files, nil
+}
+
+// DeleteFile receives a file name and deletes the file with that name and its metadata sidecar from the directory.
+// Deleting a file that does not exist is not an error
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) DeleteFile(ctx context.Context, fileName string) error {
+	src, err := obj.objectPath(fileName)
+	if err != nil {
+		return fmt.Errorf("error while deleting the file: %w", err)
+	}
+
+	for _, p := range []string{src, obj.metadataPath(fileName)} {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error while deleting the file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// PresignGetURL returns ErrPresignNotSupported, as files stored in the directory can only be read with the object storage itself
+func (obj *FileSystem) PresignGetURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// PresignPutURL returns ErrPresignNotSupported, as files can only be stored in the directory with the object storage itself
+func (obj *FileSystem) PresignPutURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// CreateMultipartUpload returns ErrPresignNotSupported, as files can only be stored in the directory with the object storage itself
+func (obj *FileSystem) CreateMultipartUpload(ctx context.Context, fileName string, parts int, expiry time.Duration) ([]string, error) {
+	return nil, ErrPresignNotSupported
+}
+
+// CompleteMultipartUpload does nothing, as multipart uploads cannot be created
+func (obj *FileSystem) CompleteMultipartUpload(ctx context.Context, fileName string, parts int) error {
+	return nil
+}
+
+// CopyFile receives the name of a file in the directory and stores a copy of it with the name dst, with its own metadata sidecar
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *FileSystem) CopyFile(ctx context.Context, src string, dst string) error {
+	srcPath, err := obj.objectPath(src)
+	if err != nil {
+		return fmt.Errorf("error while copying the file: %w", err)
+	}
+
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("error while copying the file: %w", err)
+	}
+	defer file.Close()
+
+	return obj.UploadFile(ctx, file, dst)
+}
@@ -0,0 +1,178 @@
+package objstorage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileSystemUploadAndGet(t *testing.T) {
+	obj, err := NewObjStorageFileSystemFromDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("Did not expect error creating the storage but got %v", err)
+	}
+
+	err = obj.UploadFile(context.Background(), strings.NewReader(`{"Jobs":{}}`), "Jobs-127_0_0_1.json")
+	if err != nil {
+		t.Fatalf("Did not expect error uploading the file but got %v", err)
+	}
+
+	metadata, err := obj.Metadata("Jobs-127_0_0_1.json")
+	if err != nil {
+		t.Fatalf("Did not expect error reading metadata but got %v", err)
+	}
+	if metadata.ContentType != "application/json" || metadata.Size != 11 || len(metadata.SHA256) != 64 {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+
+	fd, _ := os.CreateTemp(t.TempDir(), "")
+	defer fd.Close()
+
+	err = obj.GetFile(context.Background(), "Jobs-127_0_0_1.json", fd)
+	if err != nil {
+		t.Fatalf("Did not expect error getting the file but got %v", err)
+	}
+
+	_, _ = fd.Seek(0, 0)
+	data, _ := io.ReadAll(fd)
+	if string(data) != `{"Jobs":{}}` {
+		t.Errorf("Unexpected file content %s", data)
+	}
+
+	err = obj.GetFile(context.Background(), "missing.json", fd)
+	if err == nil {
+		t.Errorf("Expected error getting a missing file but got none")
+	}
+
+	file, err := obj.OpenFile(context.Background(), "Jobs-127_0_0_1.json")
+	if err != nil {
+		t.Fatalf("Did not expect error opening the file but got %v", err)
+	}
+	defer file.Close()
+
+	_, _ = file.Seek(2, io.SeekStart)
+	data, _ = io.ReadAll(file)
+	if string(data) != `Jobs":{}}` {
+		t.Errorf("Unexpected file content %s", data)
+	}
+
+	_, err = obj.OpenFile(context.Background(), "missing.json")
+	if err == nil {
+		t.Errorf("Expected error opening a missing file but got none")
+	}
+}
+
+func TestFileSystemChecksumMismatch(t *testing.T) {
+	root := t.TempDir()
+	obj, _ := NewObjStorageFileSystemFromDir(root)
+
+	_ = obj.UploadFile(context.Background(), strings.NewReader("original"), "file.stl")
+	_ = os.WriteFile(filepath.Join(root, "file.stl"), []byte("tampered"), 0644)
+
+	fd, _ := os.CreateTemp(t.TempDir(), "")
+	defer fd.Close()
+
+	err := obj.GetFile(context.Background(), "file.stl", fd)
+	if err == nil {
+		t.Errorf("Expected checksum error but got none")
+	}
+}
+
+func TestFileSystemStaleMetadata(t *testing.T) {
+	root := t.TempDir()
+	obj, _ := NewObjStorageFileSystemFromDir(root)
+
+	// an upload of a new version of the file interrupted after moving the file, but before moving its sidecar
+	_ = obj.UploadFile(context.Background(), strings.NewReader("original"), "file.stl")
+	_ = os.WriteFile(filepath.Join(root, "file.stl"), []byte("new version"), 0644)
+
+	fd, _ := os.CreateTemp(t.TempDir(), "")
+	defer fd.Close()
+
+	err := obj.GetFile(context.Background(), "file.stl", fd)
+	if err != nil {
+		t.Fatalf("Expected the stale metadata to be ignored but got %v", err)
+	}
+
+	_, _ = fd.Seek(0, 0)
+	data, _ := io.ReadAll(fd)
+	if string(data) != "new version" {
+		t.Errorf("Unexpected file content %s", data)
+	}
+
+	// no temporary file is left once the uploads finish
+	tmp, _ := os.ReadDir(filepath.Join(root, tmpDir))
+	if len(tmp) != 0 {
+		t.Errorf("Expected no temporary files, got %v", len(tmp))
+	}
+}
+
+func TestFileSystemInvalidNames(t *testing.T) {
+	obj, _ := NewObjStorageFileSystemFromDir(t.TempDir())
+
+	for _, name := range []string{"", "/", ".meta/file.json", "../.tmp/file"} {
+		err := obj.UploadFile(context.Background(), strings.NewReader("data"), name)
+		if err == nil {
+			t.Errorf("Expected error uploading file with name %q but got none", name)
+		}
+	}
+}
+
+func TestFileSystemAvailableInformation(t *testing.T) {
+	obj, _ := NewObjStorageFileSystemFromDir(t.TempDir())
+
+	for _, name := range []string{"Jobs-b.json", "Identification-a.json", "Jobs-a.json", "123 - file.pdf", "jobs/abc/file.stl"} {
+		_ = obj.UploadFile(context.Background(), strings.NewReader("{}"), name)
+	}
+
+	info, err := obj.AvailableInformation(context.Background())
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+
+	if !reflect.DeepEqual(info.Jobs, []string{"Jobs-a.json", "Jobs-b.json"}) {
+		t.Errorf("Unexpected Jobs list %v", info.Jobs)
+	}
+	if !reflect.DeepEqual(info.Identification, []string{"Identification-a.json"}) {
+		t.Errorf("Unexpected Identification list %v", info.Identification)
+	}
+
+	keys, _ := obj.List("jobs/")
+	if !reflect.DeepEqual(keys, []string{"jobs/abc/file.stl"}) {
+		t.Errorf("Unexpected prefix listing %v", keys)
+	}
+}
+
+func TestFileSystemListAndDeleteFiles(t *testing.T) {
+	root := t.TempDir()
+	obj, _ := NewObjStorageFileSystemFromDir(root)
+
+	for _, name := range []string{"jobs/abc/file.stl", "jobs/def/other.pdf", "Jobs-a.json"} {
+		_ = obj.UploadFile(context.Background(), strings.NewReader("{}"), name)
+	}
+
+	files, err := obj.ListFiles(context.Background(), "jobs/")
+	if err != nil || len(files) != 2 || files[0].Key != "jobs/abc/file.stl" || files[0].Size != 2 || files[0].LastModified == 0 {
+		t.Fatalf("Unexpected files %+v and error %v", files, err)
+	}
+
+	err = obj.DeleteFile(context.Background(), "jobs/abc/file.stl")
+	if err != nil {
+		t.Fatalf("Did not expect error deleting the file but got %v", err)
+	}
+
+	exists, _ := obj.Exists(context.Background(), "jobs/abc/file.stl")
+	_, metadataErr := obj.Metadata("jobs/abc/file.stl")
+	if exists || metadataErr == nil {
+		t.Errorf("Expected file and metadata to be deleted")
+	}
+
+	err = obj.DeleteFile(context.Background(), "jobs/abc/file.stl")
+	if err != nil {
+		t.Errorf("Did not expect error deleting a missing file but got %v", err)
+	}
+}
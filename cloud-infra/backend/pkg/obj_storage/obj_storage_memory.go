@@ -0,0 +1,229 @@
+package objstorage
+
+import (
+	"backend/pkg/types"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Memory defines the struct used to implement ObjStorage interface keeping the files in memory.
+// It is safe for concurrent use and is meant for local development and CI, as nothing is persisted
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+	// modified contains the time when every object was last written
+	modified map[string]time.Time
+}
+
+// NewObjStorageMemory creates and returns the reference to a new, empty, Memory struct
+func NewObjStorageMemory() *Memory {
+	return &Memory{
+		objects:  make(map[string][]byte),
+		modified: make(map[string]time.Time),
+	}
+}
+
+// UploadFile receives an instance of a file that implements interface io.Reader and a name
+// and stores that file with that name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) UploadFile(ctx context.Context, file io.Reader, name string) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("got an error uploading the file: %w", err)
+	}
+
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+
+	obj.objects[name] = data
+	obj.modified[name] = time.Now()
+	return nil
+}
+
+// Exists receives a file name and returns whether a file with that name is stored
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) Exists(ctx context.Context, fileName string) (bool, error) {
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+
+	_, ok := obj.objects[fileName]
+	return ok, nil
+}
+
+// AvailableInformation returns an Information type object containing all the files (Jobs and Identification)
+// whose name starts with 'Jobs-' or 'Identification-' respectively.
+// It also returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) AvailableInformation(ctx context.Context) (types.Information, error) {
+	var listAvailable types.Information
+	listAvailable.Jobs = make([]string, 0)
+	listAvailable.Identification = make([]string, 0)
+
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+
+	for key := range obj.objects {
+		if strings.HasPrefix(key, "Jobs-") {
+			listAvailable.Jobs = append(listAvailable.Jobs, key)
+		}
+		if strings.HasPrefix(key, "Identification-") {
+			listAvailable.Identification = append(listAvailable.Identification, key)
+		}
+	}
+
+	sort.Strings(listAvailable.Jobs)
+	sort.Strings(listAvailable.Identification)
+	return listAvailable, nil
+}
+
+// GetFile receives a file name and a file pointer
+// It will retrieve the mentioned file and store it in the pointer received
+// It also returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) GetFile(ctx context.Context, fileName string, fd *os.File) error {
+	obj.mu.RLock()
+	data, ok := obj.objects[fileName]
+	obj.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("error while downloading the file: %s does not exist", fileName)
+	}
+
+	_, err := io.Copy(fd, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("error while downloading the file: %w", err)
+	}
+	return err
+}
+
+// OpenFile receives a file name and returns a reader of the file with that name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) OpenFile(ctx context.Context, fileName string) (io.ReadSeekCloser, error) {
+	obj.mu.RLock()
+	data, ok := obj.objects[fileName]
+	obj.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("error while opening the file: %s does not exist", fileName)
+	}
+
+	// objects are replaced and never modified, so the data can be read without the lock
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// nopCloser adds a Close method that does nothing to a bytes.Reader
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ListFiles receives a prefix and returns the information of all the stored files whose name starts with it
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) ListFiles(ctx context.Context, prefix string) ([]types.ObjectInfo, error) {
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+
+	files := []types.ObjectInfo{}
+	for key, data := range obj.objects {
+		if strings.HasPrefix(key, prefix) {
+			files = append(files, types.ObjectInfo{Key: key, Size: int64(len(data)), LastModified: obj.modified[key].UnixMilli()})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, nil
+}
+
+// DeleteFile receives a file name and deletes the file with that name
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) DeleteFile(ctx context.Context, fileName string) error {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+
+	delete(obj.objects, fileName)
+	delete(obj.modified, fileName)
+	return nil
+}
+
+// PresignGetURL returns ErrPresignNotSupported, as files stored in memory can only be read with the object storage itself
+func (obj *Memory) PresignGetURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// PresignPutURL returns ErrPresignNotSupported, as files can only be stored in memory with the object storage itself
+func (obj *Memory) PresignPutURL(ctx context.Context, fileName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// CreateMultipartUpload returns ErrPresignNotSupported, as files can only be stored in memory with the object storage itself
+func (obj *Memory) CreateMultipartUpload(ctx context.Context, fileName string, parts int, expiry time.Duration) ([]string, error) {
+	return nil, ErrPresignNotSupported
+}
+
+// CompleteMultipartUpload does nothing, as multipart uploads cannot be created
+func (obj *Memory) CompleteMultipartUpload(ctx context.Context, fileName string, parts int) error {
+	return nil
+}
+
+// CopyFile receives the name of a stored file and stores a copy of it with the name dst
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (obj *Memory) CopyFile(ctx context.Context, src string, dst string) error {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+
+	data, ok := obj.objects[src]
+	if !ok {
+		return fmt.Errorf("error while copying the file: %s does not exist", src)
+	}
+
+	obj.objects[dst] = data
+	obj.modified[dst] = time.Now()
+	return nil
+}
+
+// RegisterRoutes adds to the received router the endpoint used by a local On-Premise agent
+// to download stored files: GET /objects/{key}
+// HEAD /objects/{key} returns only the headers, including the ETag, the SHA-256 of the file, so that it can be cached
+func (obj *Memory) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/objects/{key:.+}", obj.serveObject).Methods("GET", "HEAD")
+}
+
+func (obj *Memory) serveObject(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	obj.mu.RLock()
+	data, ok := obj.objects[key]
+	obj.mu.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	if r.Method == "HEAD" {
+		return
+	}
+
+	_, err := w.Write(data)
+	if err != nil {
+		fmt.Printf("Error while serving object %v: %v\n", key, err)
+	}
+}
@@ -1,7 +1,10 @@
 package queue
 
+import "context"
+
 // Queue interface defines the methods that Queue implementations will need to have
 // Iterface is used although only one implementation is used so that we can mock it
+// Messages with the same group ID are delivered in order, while messages from different groups can be processed in parallel
 type Queue interface {
-	SendMessage(string) error
+	SendMessage(ctx context.Context, body string, groupID string) error
 }
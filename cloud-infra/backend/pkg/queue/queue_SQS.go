@@ -1,12 +1,11 @@
 package queue
 
 import (
+	"backend/pkg/awsconfig"
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
@@ -17,10 +16,10 @@ type SQS struct {
 	queueURL  *string
 }
 
-// NewQueueSQS creates and returns the reference to a new SQS struct
-func NewQueueSQS() *SQS {
+// NewQueueSQS creates and returns the reference to a new SQS struct using the received AWS configuration
+func NewQueueSQS(awsConfig awsconfig.Config) *SQS {
 	q := &SQS{}
-	q.initialize()
+	q.initialize(awsConfig)
 	return q
 }
 
@@ -44,10 +43,8 @@ func sendMsg(c context.Context, api SQSSendMessageAPI, input *sqs.SendMessageInp
 	return api.SendMessage(c, input)
 }
 
-func (queue *SQS) initialize() {
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion("eu-west-3"))
+func (queue *SQS) initialize(awsConfig awsconfig.Config) {
+	cfg, err := awsConfig.Load(context.TODO())
 
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -55,13 +52,12 @@ func (queue *SQS) initialize() {
 
 	queue.sqsClient = sqs.NewFromConfig(cfg)
 
-	queueName, ok := os.LookupEnv("SQS_QUEUE_NAME")
-	if !ok {
-		panic("Environment variable SQS_QUEUE_NAME does not exist.")
+	if awsConfig.QueueName == "" {
+		panic("SQS queue name not configured, set environment variable SQS_QUEUE_NAME")
 	}
 
 	gQInput := &sqs.GetQueueUrlInput{
-		QueueName: aws.String(queueName),
+		QueueName: aws.String(awsConfig.QueueName),
 	}
 
 	result, err := getQueueURL(context.TODO(), queue.sqsClient, gQInput)
@@ -72,17 +68,18 @@ func (queue *SQS) initialize() {
 	queue.queueURL = result.QueueUrl
 }
 
-// SendMessage receives an string and puts it in the correponding SQS URL
+// SendMessage receives an string and puts it in the correponding SQS URL using the received message group ID,
+// so that messages in the same group are received in order and one group does not block the others
 // Returns a non-nil error if there's one during the execution and nil otherwise
-func (queue *SQS) SendMessage(s string) error {
+func (queue *SQS) SendMessage(ctx context.Context, s string, groupID string) error {
 	sMInput := &sqs.SendMessageInput{
 
 		MessageBody:    aws.String(s),
 		QueueUrl:       queue.queueURL,
-		MessageGroupId: aws.String("1"),
+		MessageGroupId: aws.String(groupID),
 	}
 
-	resp, err := sendMsg(context.TODO(), queue.sqsClient, sMInput)
+	resp, err := sendMsg(ctx, queue.sqsClient, sMInput)
 	if err != nil {
 		err = fmt.Errorf("got an error sending the message to the queue: %w", err)
 		return err
@@ -0,0 +1,240 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// DefaultVisibilityTimeout is the time a received message stays hidden from other consumers
+// before it is delivered again if it has not been removed
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// maxWaitTime is the maximum long polling time allowed when receiving messages, same as SQS
+const maxWaitTime = 20 * time.Second
+
+// MemoryMessage represents a message stored in a Memory queue.
+// JSON field names match the ones used by SQS so that consumers can decode them the same way
+type MemoryMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+
+	visibleAt time.Time
+}
+
+// Memory defines the struct used to implement queue interface keeping the messages in memory.
+// Messages are delivered in FIFO order and, as in SQS, received messages are hidden during the
+// visibility timeout and delivered again if they are not removed before it expires.
+// It is safe for concurrent use and can be consumed in the same process or through RegisterRoutes
+type Memory struct {
+	mu                sync.Mutex
+	messages          []*MemoryMessage
+	notify            chan struct{}
+	visibilityTimeout time.Duration
+}
+
+// NewQueueMemory creates and returns the reference to a new, empty, Memory struct
+func NewQueueMemory() *Memory {
+	return &Memory{
+		notify:            make(chan struct{}),
+		visibilityTimeout: DefaultVisibilityTimeout,
+	}
+}
+
+// SendMessage receives an string and puts it at the end of the queue
+// The group ID is ignored, messages are always received in the order they were sent
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Memory) SendMessage(ctx context.Context, s string, groupID string) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	msg := &MemoryMessage{
+		MessageID: uuid.NewString(),
+		Body:      s,
+	}
+	queue.messages = append(queue.messages, msg)
+
+	// wakes up every consumer waiting for new messages
+	close(queue.notify)
+	queue.notify = make(chan struct{})
+
+	fmt.Println("Sent message with ID: " + msg.MessageID)
+	return nil
+}
+
+// ReceiveMessages returns up to max visible messages, waiting up to wait for them to arrive if the queue is empty
+// or until ctx is cancelled. Returned messages are hidden until they are removed or their visibility timeout expires
+func (queue *Memory) ReceiveMessages(ctx context.Context, max int, wait time.Duration) []MemoryMessage {
+	if wait > maxWaitTime {
+		wait = maxWaitTime
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		// messages are not received for consumers that are gone, as they would be hidden until their visibility timeout expires
+		if ctx.Err() != nil {
+			return []MemoryMessage{}
+		}
+
+		queue.mu.Lock()
+		received := queue.receive(max)
+		notify := queue.notify
+		queue.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if len(received) > 0 || remaining <= 0 {
+			return received
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-notify:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+}
+
+// receive must be called with the lock held
+func (queue *Memory) receive(max int) []MemoryMessage {
+	now := time.Now()
+	received := []MemoryMessage{}
+
+	for _, msg := range queue.messages {
+		if len(received) >= max {
+			break
+		}
+		if msg.visibleAt.After(now) {
+			continue
+		}
+		msg.visibleAt = now.Add(queue.visibilityTimeout)
+		msg.ReceiptHandle = uuid.NewString()
+		received = append(received, *msg)
+	}
+
+	return received
+}
+
+// RemoveMessage receives the receipt handle of a received message and removes it from the queue
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Memory) RemoveMessage(receiptHandle string) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for i, msg := range queue.messages {
+		if msg.ReceiptHandle == receiptHandle {
+			queue.messages = append(queue.messages[:i], queue.messages[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("got an error deleting the message fron the queue: invalid receipt handle %v", receiptHandle)
+}
+
+// ChangeVisibility receives the receipt handle of a received message and makes it invisible
+// to other consumers for the received duration, counting from now
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (queue *Memory) ChangeVisibility(receiptHandle string, timeout time.Duration) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for _, msg := range queue.messages {
+		if msg.ReceiptHandle == receiptHandle {
+			msg.visibleAt = time.Now().Add(timeout)
+			if timeout <= 0 {
+				close(queue.notify)
+				queue.notify = make(chan struct{})
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("got an error changing the message visibility: invalid receipt handle %v", receiptHandle)
+}
+
+// Len returns the number of messages in the queue, including the ones not visible
+func (queue *Memory) Len() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	return len(queue.messages)
+}
+
+// RegisterRoutes adds to the received router the endpoints used by a local On-Premise agent to consume
+// the queue identified by name:
+// POST /queues/{name}/messages sends the request body as a new message
+// GET /queues/{name}/messages?max=N&wait=S receives up to N messages, waiting up to S seconds
+// DELETE /queues/{name}/messages/{receiptHandle} removes a received message
+// PUT /queues/{name}/messages/{receiptHandle}/visibility?timeout=S hides a received message for S more seconds
+func (queue *Memory) RegisterRoutes(router *mux.Router, name string) {
+	path := "/queues/" + name + "/messages"
+	router.HandleFunc(path, queue.sendHandler).Methods("POST")
+	router.HandleFunc(path, queue.receiveHandler).Methods("GET")
+	router.HandleFunc(path+"/{receiptHandle}", queue.removeHandler).Methods("DELETE")
+	router.HandleFunc(path+"/{receiptHandle}/visibility", queue.visibilityHandler).Methods("PUT")
+}
+
+func (queue *Memory) sendHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || len(body) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = queue.SendMessage(r.Context(), string(body), "")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (queue *Memory) receiveHandler(w http.ResponseWriter, r *http.Request) {
+	max, err := strconv.Atoi(r.URL.Query().Get("max"))
+	if err != nil || max < 1 {
+		max = 1
+	}
+
+	wait, err := strconv.Atoi(r.URL.Query().Get("wait"))
+	if err != nil || wait < 0 {
+		wait = 0
+	}
+
+	messages := queue.ReceiveMessages(r.Context(), max, time.Duration(wait)*time.Second)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(messages)
+	if err != nil {
+		fmt.Printf("Error while sending the received messages: %v\n", err)
+	}
+}
+
+func (queue *Memory) removeHandler(w http.ResponseWriter, r *http.Request) {
+	err := queue.RemoveMessage(mux.Vars(r)["receiptHandle"])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (queue *Memory) visibilityHandler(w http.ResponseWriter, r *http.Request) {
+	timeout, err := strconv.Atoi(r.URL.Query().Get("timeout"))
+	if err != nil || timeout < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = queue.ChangeVisibility(mux.Vars(r)["receiptHandle"], time.Duration(timeout)*time.Second)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
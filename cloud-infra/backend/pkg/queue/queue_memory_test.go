@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	queue := NewQueueMemory()
+	queue.visibilityTimeout = 50 * time.Millisecond
+
+	_ = queue.SendMessage(context.Background(), "first", "")
+	_ = queue.SendMessage(context.Background(), "second", "")
+
+	received := queue.ReceiveMessages(context.Background(), 1, 0)
+	if len(received) != 1 || received[0].Body != "first" {
+		t.Fatalf("Expected to receive first message, got %v", received)
+	}
+
+	received = queue.ReceiveMessages(context.Background(), 10, 0)
+	if len(received) != 1 || received[0].Body != "second" {
+		t.Fatalf("Expected only second message to be visible, got %v", received)
+	}
+
+	err := queue.RemoveMessage(received[0].ReceiptHandle)
+	if err != nil {
+		t.Errorf("Did not expect error removing message but got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	received = queue.ReceiveMessages(context.Background(), 10, 0)
+	if len(received) != 1 || received[0].Body != "first" {
+		t.Fatalf("Expected first message to be delivered again, got %v", received)
+	}
+
+	_ = queue.RemoveMessage(received[0].ReceiptHandle)
+	if queue.Len() != 0 {
+		t.Errorf("Expected empty queue, got %v messages", queue.Len())
+	}
+}
+
+func TestMemoryQueueLongPolling(t *testing.T) {
+	queue := NewQueueMemory()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = queue.SendMessage(context.Background(), "late", "")
+	}()
+
+	received := queue.ReceiveMessages(context.Background(), 1, time.Second)
+	if len(received) != 1 || received[0].Body != "late" {
+		t.Fatalf("Expected to receive the message sent while waiting, got %v", received)
+	}
+}
+
+func TestMemoryQueueChangeVisibility(t *testing.T) {
+	queue := NewQueueMemory()
+	queue.visibilityTimeout = 30 * time.Millisecond
+
+	_ = queue.SendMessage(context.Background(), "in flight", "")
+	received := queue.ReceiveMessages(context.Background(), 1, 0)
+
+	err := queue.ChangeVisibility(received[0].ReceiptHandle, time.Second)
+	if err != nil {
+		t.Fatalf("Did not expect error changing visibility but got %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if again := queue.ReceiveMessages(context.Background(), 1, 0); len(again) != 0 {
+		t.Fatalf("Expected message to stay invisible after extending its visibility, got %v", again)
+	}
+
+	err = queue.ChangeVisibility(received[0].ReceiptHandle, 0)
+	if err != nil {
+		t.Fatalf("Did not expect error changing visibility but got %v", err)
+	}
+	if again := queue.ReceiveMessages(context.Background(), 1, 0); len(again) != 1 {
+		t.Fatalf("Expected message to be visible again, got %v", again)
+	}
+
+	err = queue.ChangeVisibility("unknown", time.Second)
+	if err == nil {
+		t.Errorf("Expected error changing visibility of an unknown message but got none")
+	}
+}
+
+func TestMemoryQueueReceiveCancelled(t *testing.T) {
+	queue := NewQueueMemory()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	received := queue.ReceiveMessages(ctx, 1, 10*time.Second)
+	if len(received) != 0 || time.Since(start) > time.Second {
+		t.Fatalf("Expected receive to return without messages once cancelled, got %v after %v", received, time.Since(start))
+	}
+
+	_ = queue.SendMessage(context.Background(), "pending", "")
+	if received := queue.ReceiveMessages(ctx, 1, 0); len(received) != 0 {
+		t.Errorf("Did not expect messages to be received with a cancelled context, got %v", received)
+	}
+	if received := queue.ReceiveMessages(context.Background(), 1, 0); len(received) != 1 {
+		t.Errorf("Expected the message to still be visible, got %v", received)
+	}
+}
@@ -0,0 +1,385 @@
+package retention
+
+import (
+	"backend/pkg/database"
+	objstorage "backend/pkg/obj_storage"
+	"backend/pkg/types"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// JobFilesPrefix is the prefix of the job files uploaded with content-addressed keys
+	JobFilesPrefix = "jobs/"
+	// JobsSnapshotsPrefix is the prefix of the snapshots of the jobs of every device
+	JobsSnapshotsPrefix = "Jobs-"
+	// IdentificationSnapshotsPrefix is the prefix of the snapshots of the identification of every device
+	IdentificationSnapshotsPrefix = "Identification-"
+	// ArchivePrefix is the prefix of the archives with the history of expired messages
+	ArchivePrefix = "archive/messages/"
+	// UploadsPrefix is the prefix of the files uploaded directly to the object storage that have not been sent in a job yet
+	UploadsPrefix = "uploads/"
+	// archiveBatchSize is the maximum number of expired messages read from the DB at once and saved in every archive,
+	// which is built in memory before it is uploaded, so that sweeping does not need more memory the more messages have expired
+	archiveBatchSize = 1000
+	// sweeperLease is the name of the lease held by the replica running the background sweeps
+	sweeperLease = "retention-sweeper"
+)
+
+// Policy defines for how long every class of objects and the messages are kept. A zero duration keeps them forever
+type Policy struct {
+	// JobFiles is the time job files are kept after no message references them
+	JobFiles time.Duration
+	// JobsSnapshots and IdentificationSnapshots are the time snapshots are kept after the device last uploaded them
+	JobsSnapshots           time.Duration
+	IdentificationSnapshots time.Duration
+	// Uploads is the time files uploaded directly to the object storage are kept if they are not sent in a job
+	Uploads time.Duration
+	// Messages is the time messages and their results are kept after they were sent
+	Messages time.Duration
+	// Archive makes expired messages be archived in the object storage before they are deleted
+	Archive bool
+	// Interval is the time between sweeps. A zero interval disables the background sweeper
+	Interval time.Duration
+}
+
+// PolicyFromEnv returns a Policy whose values are read from the following environment variables, which contain durations
+// such as "720h": RETENTION_JOB_FILES (24h by default), RETENTION_JOBS_SNAPSHOTS, RETENTION_IDENTIFICATION_SNAPSHOTS,
+// RETENTION_UPLOADS (24h by default), RETENTION_MESSAGES and RETENTION_INTERVAL (1h by default), and RETENTION_ARCHIVE (true by default).
+// It panics if any of them is not valid
+func PolicyFromEnv() Policy {
+	archive := true
+	if value, ok := os.LookupEnv("RETENTION_ARCHIVE"); ok && value != "" {
+		var err error
+		archive, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid RETENTION_ARCHIVE value: %v", value))
+		}
+	}
+
+	return Policy{
+		JobFiles:                durationFromEnv("RETENTION_JOB_FILES", 24*time.Hour),
+		JobsSnapshots:           durationFromEnv("RETENTION_JOBS_SNAPSHOTS", 0),
+		IdentificationSnapshots: durationFromEnv("RETENTION_IDENTIFICATION_SNAPSHOTS", 0),
+		Uploads:                 durationFromEnv("RETENTION_UPLOADS", 24*time.Hour),
+		Messages:                durationFromEnv("RETENTION_MESSAGES", 0),
+		Archive:                 archive,
+		Interval:                durationFromEnv("RETENTION_INTERVAL", time.Hour),
+	}
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		panic(fmt.Sprintf("Invalid %v value: %v", key, value))
+	}
+	return duration
+}
+
+// Report contains what a sweep deleted or, if it is a dry run, would delete
+type Report struct {
+	DryRun                  bool
+	Timestamp               int64
+	JobFiles                []string
+	JobsSnapshots           []string
+	IdentificationSnapshots []string
+	Uploads                 []string
+	Messages                []types.MessageDB
+	// Archives are the names of the objects where the expired messages were archived, if any
+	Archives []string `json:",omitempty"`
+	// Errors contains the errors that did not stop the sweep, such as failing to delete one of the objects
+	Errors []string
+}
+
+// ArchivedMessage is the information about an expired message saved in every line of an archive
+type ArchivedMessage struct {
+	Message   types.MessageDB
+	Responses []types.Response
+}
+
+// Sweeper deletes the objects and messages that have expired according to its Policy
+type Sweeper struct {
+	objStorage objstorage.ObjStorage
+	database   database.Database
+	policy     Policy
+	// holder identifies the sweeper in the lease of the background sweeps
+	holder string
+	// mu serializes the sweeps
+	mu sync.Mutex
+}
+
+// NewSweeper creates and returns the reference to a new Sweeper that applies the received policy
+func NewSweeper(objStorage objstorage.ObjStorage, database database.Database, policy Policy) *Sweeper {
+	hostname, _ := os.Hostname()
+	return &Sweeper{
+		objStorage: objStorage,
+		database:   database,
+		policy:     policy,
+		holder:     hostname + "/" + uuid.NewString(),
+	}
+}
+
+// Run sweeps every Interval of the policy until ctx is cancelled. It returns immediately if the interval is zero.
+// Every replica of the backend runs a Sweeper, but only the one holding the lease of the sweeper in the DB sweeps.
+// The holder renews the lease before every sweep for two intervals, so another replica takes it over
+// if the holder stops sweeping
+func (s *Sweeper) Run(ctx context.Context) {
+	if s.policy.Interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		acquired, err := s.database.AcquireLease(ctx, sweeperLease, s.holder, now.UnixMilli(), now.Add(2*s.policy.Interval).UnixMilli())
+		if err != nil {
+			fmt.Printf("Error while acquiring the lease of the retention sweeper: %v\n", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		report, err := s.Sweep(ctx, now, false)
+		if err != nil {
+			fmt.Printf("Error while sweeping expired data: %v\n", err)
+			continue
+		}
+
+		fmt.Printf("Retention sweep deleted %v job files, %v snapshots, %v uploads and %v messages with %v errors\n",
+			len(report.JobFiles), len(report.JobsSnapshots)+len(report.IdentificationSnapshots), len(report.Uploads), len(report.Messages), len(report.Errors))
+	}
+}
+
+// Sweep deletes the objects and messages that have expired at the received time, or only reports them if dryRun is true.
+// Messages are deleted first, so that the job files they referenced start their grace period
+// Returns a non-nil error if the sweep could not be completed and nil otherwise
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time, dryRun bool) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := Report{
+		DryRun:                  dryRun,
+		Timestamp:               now.UnixMilli(),
+		JobFiles:                []string{},
+		JobsSnapshots:           []string{},
+		IdentificationSnapshots: []string{},
+		Uploads:                 []string{},
+		Messages:                []types.MessageDB{},
+		Errors:                  []string{},
+	}
+
+	err := s.sweepMessages(ctx, now, &report)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.sweepJobFiles(ctx, now, &report)
+	if err != nil {
+		return report, err
+	}
+
+	report.JobsSnapshots, err = s.sweepObjects(ctx, now, JobsSnapshotsPrefix, s.policy.JobsSnapshots, &report)
+	if err != nil {
+		return report, err
+	}
+
+	report.IdentificationSnapshots, err = s.sweepObjects(ctx, now, IdentificationSnapshotsPrefix, s.policy.IdentificationSnapshots, &report)
+	if err != nil {
+		return report, err
+	}
+
+	report.Uploads, err = s.sweepObjects(ctx, now, UploadsPrefix, s.policy.Uploads, &report)
+	return report, err
+}
+
+// sweepMessages archives, if enabled, and deletes the messages older than the policy, removing their file references.
+// Expired messages are read in batches of up to archiveBatchSize messages
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Sweeper) sweepMessages(ctx context.Context, now time.Time, report *Report) error {
+	if s.policy.Messages == 0 {
+		return nil
+	}
+
+	before := now.Add(-s.policy.Messages).UnixMilli()
+	cursor := ""
+	for {
+		batch, next, err := s.database.GetMessagesBefore(ctx, before, cursor, archiveBatchSize)
+		if err != nil {
+			return fmt.Errorf("error while getting expired messages: %w", err)
+		}
+
+		if report.DryRun {
+			report.Messages = append(report.Messages, batch...)
+		} else if len(batch) > 0 {
+			// every batch is deleted once it is archived and before the next one, so that the batches archived are not
+			// archived again by the next sweep if a later one cannot be archived
+			if s.policy.Archive {
+				name, err := s.archive(ctx, now, len(report.Archives), batch)
+				if err != nil {
+					return err
+				}
+				report.Archives = append(report.Archives, name)
+			}
+
+			s.deleteMessages(ctx, now, batch, report)
+		}
+
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// deleteMessages deletes the received messages and removes their file references, adding the ones deleted to the report
+func (s *Sweeper) deleteMessages(ctx context.Context, now time.Time, messages []types.MessageDB, report *Report) {
+	for _, msg := range messages {
+		err := s.database.DeleteMessage(ctx, msg.DeviceUUID, msg.MessageUUID)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.Messages = append(report.Messages, msg)
+
+		err = s.database.RemoveFileReference(ctx, types.FileReferenceDB{MessageUUID: msg.MessageUUID, Timestamp: now.UnixMilli()})
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+}
+
+// archive saves the received messages and their responses in a gzip compressed NDJSON object,
+// with one ArchivedMessage per line, and returns its name, which includes the number of the batch in the sweep
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Sweeper) archive(ctx context.Context, now time.Time, batch int, messages []types.MessageDB) (string, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(writer)
+
+	for _, msg := range messages {
+		responses, err := s.database.GetResponsesFromMessage(ctx, msg.DeviceUUID, msg.MessageUUID)
+		if err != nil {
+			return "", fmt.Errorf("error while archiving messages: %w", err)
+		}
+
+		err = encoder.Encode(ArchivedMessage{Message: msg, Responses: responses})
+		if err != nil {
+			return "", fmt.Errorf("error while archiving messages: %w", err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return "", fmt.Errorf("error while archiving messages: %w", err)
+	}
+
+	name := ArchivePrefix + now.UTC().Format("2006/01/02/") + fmt.Sprintf("%v-%v.ndjson.gz", now.UnixMilli(), batch)
+	err = s.objStorage.UploadFile(ctx, &buf, name)
+	if err != nil {
+		return "", fmt.Errorf("error while archiving messages: %w", err)
+	}
+
+	return name, nil
+}
+
+// sweepJobFiles deletes the job files without references for longer than the policy.
+// Their deletion begins in the DB, if they have not been referenced again in the meantime, so that they cannot be
+// referenced until their object and then the file in the DB are deleted. Deletions that were not finished are resumed
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Sweeper) sweepJobFiles(ctx context.Context, now time.Time, report *Report) error {
+	if s.policy.JobFiles == 0 {
+		return nil
+	}
+
+	files, err := s.database.GetUnreferencedFiles(ctx, now.Add(-s.policy.JobFiles).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error while getting unreferenced files: %w", err)
+	}
+
+	for _, file := range files {
+		if report.DryRun {
+			report.JobFiles = append(report.JobFiles, file.FileKey)
+			continue
+		}
+
+		began, err := s.database.BeginFileDeletion(ctx, file.FileKey)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		if !began {
+			continue
+		}
+
+		err = s.objStorage.DeleteFile(ctx, file.FileKey)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+
+		_, err = s.database.DeleteFile(ctx, file.FileKey)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.JobFiles = append(report.JobFiles, file.FileKey)
+	}
+
+	return nil
+}
+
+// sweepObjects deletes the objects with the received prefix not modified for longer than maxAge and returns their names.
+// It is used with snapshots, which are overwritten every time they are uploaded, and with abandoned uploads
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Sweeper) sweepObjects(ctx context.Context, now time.Time, prefix string, maxAge time.Duration, report *Report) ([]string, error) {
+	expired := []string{}
+	if maxAge == 0 {
+		return expired, nil
+	}
+
+	files, err := s.objStorage.ListFiles(ctx, prefix)
+	if err != nil {
+		return expired, fmt.Errorf("error while getting the files to sweep: %w", err)
+	}
+
+	before := now.Add(-maxAge).UnixMilli()
+	for _, file := range files {
+		if file.LastModified >= before {
+			continue
+		}
+
+		if !report.DryRun {
+			err = s.objStorage.DeleteFile(ctx, file.Key)
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+		}
+		expired = append(expired, file.Key)
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,267 @@
+package retention
+
+import (
+	"backend/pkg/database"
+	objstorage "backend/pkg/obj_storage"
+	"backend/pkg/types"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	db := database.NewDatabaseMemory()
+	obj := objstorage.NewObjStorageMemory()
+
+	// an old message referencing a file, a recent one referencing another file and a device snapshot
+	messages := []types.MessageDB{
+		{DeviceUUID: "d1", MessageUUID: "old", Type: "Job", AdditionalInfo: "a.stl", Timestamp: now.Add(-48 * time.Hour).UnixMilli()},
+		{DeviceUUID: "d1", MessageUUID: "recent", Type: "Job", AdditionalInfo: "b.stl", Timestamp: now.UnixMilli()},
+	}
+	for i, msg := range messages {
+		key := "jobs/" + msg.MessageUUID + "/" + msg.AdditionalInfo
+		_ = db.InsertMessage(ctx, msg)
+		_, _ = db.AddFileReference(ctx, types.FileReferenceDB{FileKey: key, MessageUUID: msg.MessageUUID, Timestamp: msg.Timestamp})
+		_ = obj.UploadFile(ctx, strings.NewReader("solid"), key)
+		_ = db.InsertResult(ctx, types.ResultDB{DeviceUUID: "d1", MessageUUID: msg.MessageUUID, Result: "SUCCESS", Timestamp: int64(i)})
+	}
+	_ = obj.UploadFile(ctx, strings.NewReader("{}"), "Jobs-127_0_0_1.json")
+	_ = obj.UploadFile(ctx, strings.NewReader("solid"), UploadsPrefix+"abandoned/c.stl")
+
+	sweeper := NewSweeper(obj, db, Policy{
+		JobFiles:      time.Hour,
+		JobsSnapshots: 24 * time.Hour,
+		Uploads:       24 * time.Hour,
+		Messages:      24 * time.Hour,
+		Archive:       true,
+	})
+
+	// a dry run reports the expired message without deleting it
+	report, err := sweeper.Sweep(ctx, now, true)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	if len(report.Messages) != 1 || report.Messages[0].MessageUUID != "old" || len(report.JobFiles) != 0 || len(report.Archives) != 0 {
+		t.Fatalf("Unexpected dry run report %+v", report)
+	}
+	stored, _ := db.GetMessagesFromDevice(ctx, "d1")
+	if len(stored) != 2 {
+		t.Fatalf("Expected dry run not to delete messages, got %v", stored)
+	}
+
+	// the expired message is archived and deleted, but its file is kept during its grace period
+	report, err = sweeper.Sweep(ctx, now, false)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	if len(report.Messages) != 1 || len(report.JobFiles) != 0 || len(report.Errors) != 0 || len(report.Archives) != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	stored, _ = db.GetMessagesFromDevice(ctx, "d1")
+	if len(stored) != 1 || stored[0].MessageUUID != "recent" {
+		t.Errorf("Expected only the recent message to be kept, got %v", stored)
+	}
+
+	archived := readArchive(t, obj, report.Archives[0])
+	expected := []ArchivedMessage{{
+		Message:   types.MessageDB{DeviceUUID: "d1", MessageUUID: "old", Type: "Job", AdditionalInfo: "a.stl", Timestamp: messages[0].Timestamp, LastResult: "SUCCESS"},
+		Responses: []types.Response{{Result: "SUCCESS", Timestamp: 0}},
+	}}
+	if !reflect.DeepEqual(archived, expected) {
+		t.Errorf("Expected archive %+v, got %+v", expected, archived)
+	}
+
+	// once the grace period is over, only the file that is not referenced anymore is deleted
+	report, err = sweeper.Sweep(ctx, now.Add(2*time.Hour), false)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	if !reflect.DeepEqual(report.JobFiles, []string{"jobs/old/a.stl"}) || len(report.JobsSnapshots) != 0 || len(report.Uploads) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for key, exists := range map[string]bool{"jobs/old/a.stl": false, "jobs/recent/b.stl": true, "Jobs-127_0_0_1.json": true} {
+		if ok, _ := obj.Exists(ctx, key); ok != exists {
+			t.Errorf("Expected %v to exist: %v", key, exists)
+		}
+	}
+
+	// the file is deleted from the DB after its object, so a new job with it has to upload it again
+	existed, err := db.AddFileReference(ctx, types.FileReferenceDB{FileKey: "jobs/old/a.stl", MessageUUID: "new", Timestamp: now.UnixMilli()})
+	if err != nil || existed {
+		t.Errorf("Expected the deleted file not to exist, got %v and error %v", existed, err)
+	}
+
+	// snapshots not uploaded again and uploads not sent in a job are deleted after their retention
+	report, err = sweeper.Sweep(ctx, now.Add(25*time.Hour), false)
+	if err != nil {
+		t.Fatalf("Did not expect error but got %v", err)
+	}
+	if !reflect.DeepEqual(report.JobsSnapshots, []string{"Jobs-127_0_0_1.json"}) || len(report.IdentificationSnapshots) != 0 ||
+		!reflect.DeepEqual(report.Uploads, []string{UploadsPrefix + "abandoned/c.stl"}) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestSweepResumesFileDeletion(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	db := database.NewDatabaseMemory()
+	obj := objstorage.NewObjStorageMemory()
+
+	// a sweep stopped after beginning the deletion of a file, which cannot be referenced anymore
+	ref := types.FileReferenceDB{FileKey: "jobs/a/a.stl", MessageUUID: "m1", Timestamp: now.Add(-2 * time.Hour).UnixMilli()}
+	_, _ = db.AddFileReference(ctx, ref)
+	_ = db.RemoveFileReference(ctx, ref)
+	_ = obj.UploadFile(ctx, strings.NewReader("solid"), ref.FileKey)
+	_, _ = db.BeginFileDeletion(ctx, ref.FileKey)
+
+	_, err := db.AddFileReference(ctx, types.FileReferenceDB{FileKey: ref.FileKey, MessageUUID: "m2", Timestamp: now.UnixMilli()})
+	if !errors.Is(err, database.ErrFileDeleting) {
+		t.Fatalf("Expected ErrFileDeleting, got %v", err)
+	}
+
+	report, err := NewSweeper(obj, db, Policy{JobFiles: time.Hour}).Sweep(ctx, now, false)
+	if err != nil || !reflect.DeepEqual(report.JobFiles, []string{ref.FileKey}) {
+		t.Fatalf("Expected the deletion to be finished, got %+v and error %v", report, err)
+	}
+	if ok, _ := obj.Exists(ctx, ref.FileKey); ok {
+		t.Errorf("Expected %v to be deleted", ref.FileKey)
+	}
+}
+
+// failingUploads is an ObjStorage whose uploads fail once it has uploaded the received number of files
+type failingUploads struct {
+	objstorage.ObjStorage
+	uploads int
+}
+
+func (obj *failingUploads) UploadFile(ctx context.Context, file io.Reader, name string) error {
+	if obj.uploads == 0 {
+		return errors.New("error uploading the file")
+	}
+	obj.uploads--
+	return obj.ObjStorage.UploadFile(ctx, file, name)
+}
+
+func TestSweepArchivesInBatches(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	db := database.NewDatabaseMemory()
+	obj := &failingUploads{ObjStorage: objstorage.NewObjStorageMemory(), uploads: 1}
+
+	for i := 0; i < archiveBatchSize+1; i++ {
+		_ = db.InsertMessage(ctx, types.MessageDB{DeviceUUID: "d1", MessageUUID: fmt.Sprintf("m%v", i), Type: "Heartbeat", Timestamp: now.Add(-48*time.Hour).UnixMilli() + int64(i)})
+	}
+
+	sweeper := NewSweeper(obj, db, Policy{Messages: 24 * time.Hour, Archive: true})
+
+	// the first batch is deleted once it is archived, although the second one cannot be archived
+	report, err := sweeper.Sweep(ctx, now, false)
+	if err == nil || len(report.Archives) != 1 || len(report.Messages) != archiveBatchSize {
+		t.Fatalf("Expected the first batch to be archived and deleted, got %v archives, %v messages and error %v",
+			len(report.Archives), len(report.Messages), err)
+	}
+	if archived := readArchive(t, obj, report.Archives[0]); len(archived) != archiveBatchSize {
+		t.Errorf("Expected %v messages archived, got %v", archiveBatchSize, len(archived))
+	}
+
+	// the next sweep only archives the messages that were not deleted
+	obj.uploads = 1
+	report, err = sweeper.Sweep(ctx, now.Add(time.Minute), false)
+	if err != nil || len(report.Archives) != 1 || len(report.Messages) != 1 {
+		t.Fatalf("Expected the second batch to be archived and deleted, got %+v and error %v", report, err)
+	}
+	if archived := readArchive(t, obj, report.Archives[0]); len(archived) != 1 || archived[0].Message.MessageUUID != report.Messages[0].MessageUUID {
+		t.Errorf("Expected only %v to be archived, got %+v", report.Messages[0].MessageUUID, archived)
+	}
+}
+
+func TestRunOnlySweepsWithLease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+
+	db := database.NewDatabaseMemory()
+	_ = db.InsertMessage(ctx, types.MessageDB{DeviceUUID: "d1", MessageUUID: "m1", Type: "Heartbeat", Timestamp: now.Add(-48 * time.Hour).UnixMilli()})
+
+	// another replica holds the lease for a while
+	acquired, err := db.AcquireLease(ctx, sweeperLease, "other", now.UnixMilli(), now.Add(200*time.Millisecond).UnixMilli())
+	if err != nil || !acquired {
+		t.Fatalf("Expected the lease to be acquired, got %v and error %v", acquired, err)
+	}
+
+	sweeper := NewSweeper(objstorage.NewObjStorageMemory(), db, Policy{Messages: 24 * time.Hour, Interval: 10 * time.Millisecond})
+	go sweeper.Run(ctx)
+
+	time.Sleep(100 * time.Millisecond)
+	if msg, _ := db.GetMessage(ctx, "d1", "m1"); msg.MessageUUID == "" {
+		t.Fatalf("Expected the message not to be swept while another replica holds the lease")
+	}
+
+	// the lease expires as the other replica does not renew it
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if msg, _ := db.GetMessage(ctx, "d1", "m1"); msg.MessageUUID == "" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the message to be swept once the lease expired")
+}
+
+func readArchive(t *testing.T, obj objstorage.ObjStorage, name string) []ArchivedMessage {
+	t.Helper()
+
+	fd, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	err = obj.GetFile(context.Background(), name, fd)
+	if err != nil {
+		t.Fatalf("Did not expect error getting the archive but got %v", err)
+	}
+	_, _ = fd.Seek(0, 0)
+
+	reader, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatalf("Expected a gzip archive but got %v", err)
+	}
+
+	archived := []ArchivedMessage{}
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		var msg ArchivedMessage
+		err = decoder.Decode(&msg)
+		if err != nil {
+			t.Fatalf("Did not expect error reading the archive but got %v", err)
+		}
+		archived = append(archived, msg)
+	}
+	return archived
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("RETENTION_MESSAGES", "720h")
+	t.Setenv("RETENTION_ARCHIVE", "false")
+
+	policy := PolicyFromEnv()
+	expected := Policy{JobFiles: 24 * time.Hour, Uploads: 24 * time.Hour, Messages: 720 * time.Hour, Interval: time.Hour}
+	if policy != expected {
+		t.Errorf("Expected %+v, got %+v", expected, policy)
+	}
+}
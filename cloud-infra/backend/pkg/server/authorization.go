@@ -0,0 +1,199 @@
+package server
+
+import (
+	"backend/pkg/auth"
+	"backend/pkg/retention"
+	"backend/pkg/types"
+	"backend/pkg/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// callerGrants returns the grants of the caller of the request, and whether access control is enforced,
+// which is not when authentication is disabled
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) callerGrants(r *http.Request) ([]types.Grant, bool, error) {
+	if s.authenticator.Disabled() {
+		return nil, false, nil
+	}
+
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return nil, true, nil
+	}
+
+	grants, err := s.database.GetGrantsOfSubject(r.Context(), identity.String())
+	if err != nil {
+		return nil, true, fmt.Errorf("error while getting the grants of the caller: %w", err)
+	}
+	return grants, true, nil
+}
+
+// authorize checks that the caller of the request has at least the received role on the device, or on every device
+// if it is empty. Denied actions are audited and answered with status code 403, and errors with status code 500
+// It returns whether the caller is allowed, the response being already written otherwise
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, role string, device types.Device) bool {
+	return s.check(w, r, role, device.DeviceUUID, func(grants []types.Grant) (bool, error) {
+		return auth.Allowed(grants, role, device), nil
+	})
+}
+
+// authorizeUUID is like authorize for the device with the received UUID, which is read from the database
+// to know its group. Devices that do not exist are only in the scope of their UUID
+func (s *Server) authorizeUUID(w http.ResponseWriter, r *http.Request, role string, deviceUUID string) bool {
+	return s.check(w, r, role, deviceUUID, func(grants []types.Grant) (bool, error) {
+		device := types.Device{DeviceUUID: deviceUUID}
+		if deviceUUID != "" && !auth.Allowed(grants, role, device) {
+			stored, err := s.database.GetDeviceByUUID(r.Context(), deviceUUID)
+			if err != nil {
+				return false, fmt.Errorf("error while getting the group of the device: %w", err)
+			}
+			device.Group = stored.Group
+		}
+		return auth.Allowed(grants, role, device), nil
+	})
+}
+
+// authorizeName is like authorizeUUID for the device with the received name, which is only looked up
+// if access control is enforced
+func (s *Server) authorizeName(w http.ResponseWriter, r *http.Request, role string, deviceName string) bool {
+	if s.authenticator.Disabled() {
+		return true
+	}
+
+	_, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(r.Context(), deviceName)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return false
+	}
+	return s.authorizeUUID(w, r, role, deviceUUID)
+}
+
+// authorizeAnywhere is like authorize, but the caller is allowed if it has the role on any device.
+// It is used for the actions whose result is then filtered with readableDevices, or that are not about a device
+func (s *Server) authorizeAnywhere(w http.ResponseWriter, r *http.Request, role string) bool {
+	return s.check(w, r, role, "", func(grants []types.Grant) (bool, error) {
+		return auth.AllowedAnywhere(grants, role), nil
+	})
+}
+
+// check gets the grants of the caller and, if access control is enforced, returns whether they allow the action,
+// auditing it if they do not. Errors getting the grants or checking them are answered with status code 500
+func (s *Server) check(w http.ResponseWriter, r *http.Request, role string, deviceUUID string, allowed func([]types.Grant) (bool, error)) bool {
+	grants, enforced, err := s.callerGrants(r)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return false
+	}
+
+	if !enforced {
+		return true
+	}
+
+	ok, err := allowed(grants)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return false
+	}
+	if ok {
+		return true
+	}
+
+	entry := types.AuditEntry{
+		EntryID:    uuid.NewString(),
+		Timestamp:  utils.GetTimestamp(),
+		Caller:     caller(r),
+		Action:     r.Method + " " + r.URL.Path,
+		Role:       role,
+		DeviceUUID: deviceUUID,
+	}
+
+	err = s.database.InsertAuditEntry(r.Context(), entry)
+	if err != nil {
+		fmt.Printf("Error while auditing %v denied to %q: %v\n", entry.Action, entry.Caller, err)
+	}
+
+	utils.Forbidden(w)
+	return false
+}
+
+// readableDevices returns the devices of the received ones that the caller of the request can read,
+// all of them if access control is not enforced
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) readableDevices(r *http.Request, devices []types.Device) ([]types.Device, error) {
+	grants, enforced, err := s.callerGrants(r)
+	if err != nil || !enforced {
+		return devices, err
+	}
+
+	readable := []types.Device{}
+	for _, device := range devices {
+		if auth.Allowed(grants, auth.RoleViewer, device) {
+			readable = append(readable, device)
+		}
+	}
+	return readable, nil
+}
+
+// authorizeSnapshot is like authorize for the device that uploaded the Jobs or Identification snapshot with the received
+// name, which is only looked up if access control is enforced. Snapshots of devices that do not exist anymore
+// are only in the scope of every device
+func (s *Server) authorizeSnapshot(w http.ResponseWriter, r *http.Request, role string, name string) bool {
+	if s.authenticator.Disabled() {
+		return true
+	}
+
+	devices, err := s.database.GetDevices(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return false
+	}
+
+	for _, device := range devices {
+		if name == snapshotName(retention.JobsSnapshotsPrefix, device.Name) || name == snapshotName(retention.IdentificationSnapshotsPrefix, device.Name) {
+			return s.authorize(w, r, role, device)
+		}
+	}
+	return s.authorize(w, r, role, types.Device{})
+}
+
+// readableInformation returns the Jobs and Identification snapshots of the received ones that the caller of the request
+// can read. The snapshots of devices that do not exist anymore can only be read with a grant on every device
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) readableInformation(r *http.Request, information types.Information) (types.Information, error) {
+	grants, enforced, err := s.callerGrants(r)
+	if err != nil || !enforced || auth.Allowed(grants, auth.RoleViewer, types.Device{}) {
+		return information, err
+	}
+
+	devices, err := s.database.GetDevices(r.Context())
+	if err != nil {
+		return types.Information{}, err
+	}
+
+	readable := map[string]bool{}
+	for _, device := range devices {
+		if auth.Allowed(grants, auth.RoleViewer, device) {
+			readable[snapshotName(retention.JobsSnapshotsPrefix, device.Name)] = true
+			readable[snapshotName(retention.IdentificationSnapshotsPrefix, device.Name)] = true
+		}
+	}
+
+	filter := func(names []string) []string {
+		filtered := []string{}
+		for _, name := range names {
+			if readable[name] {
+				filtered = append(filtered, name)
+			}
+		}
+		return filtered
+	}
+
+	return types.Information{Jobs: filter(information.Jobs), Identification: filter(information.Identification)}, nil
+}
@@ -1,16 +1,26 @@
 package server
 
 import (
+	"backend/pkg/analysis"
+	"backend/pkg/auth"
+	"backend/pkg/identification"
+	"backend/pkg/materials"
+	objstorage "backend/pkg/obj_storage"
+	"backend/pkg/retention"
 	"backend/pkg/types"
 	"backend/pkg/utils"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
+	"mesh"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -27,7 +37,7 @@ type Device = types.Device
 
 // Heartbeat is the handler used with POST and OPTIONS /heartbeat endpoint
 // It will validate the received JSON, if valid, and send the corresponding message to the queue
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 	requestBody, err := ioutil.ReadAll(r.Body)
 
@@ -66,7 +76,7 @@ func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(message.DeviceName)
+	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(r.Context(), message.DeviceName)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -79,6 +89,10 @@ func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeUUID(w, r, auth.RoleOperator, deviceUUID) {
+		return
+	}
+
 	message.IPAddress = deviceIP
 	message.DeviceUUID = deviceUUID
 
@@ -86,6 +100,13 @@ func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 
 	message.ResultURL = s.serverURL + "/responses"
 
+	message.ResultSecret, err = auth.NewResultSecret()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		fmt.Printf("Got an error creating the message to the queue: %v\n", err)
@@ -99,16 +120,18 @@ func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 		Type:           "Heartbeat",
 		AdditionalInfo: message.Message,
 		Timestamp:      utils.GetTimestamp(),
+		Caller:         caller(r),
+		ResultSecret:   message.ResultSecret,
 	}
 
-	err = s.database.InsertMessage(messageDb)
+	err = s.database.InsertMessage(r.Context(), messageDb)
 	if err != nil {
 		fmt.Printf("Got an error inserting the message in the DB: %v\n", err)
 		utils.ServerError(w)
 		return
 	}
 
-	err = s.queue.SendMessage(string(messageJSON))
+	err = s.queue.SendMessage(r.Context(), string(messageJSON), deviceUUID)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -119,9 +142,13 @@ func (s *Server) Heartbeat(w http.ResponseWriter, r *http.Request) {
 }
 
 // Job is the handler used with POST and OPTIONS /job endpoint
-// It will validate the received MultiPart Form, if valid,
-// and send the corresponding message to the queue and file to object storage
-// It will return status code 200, 400 or 500 as appropiate
+// It will validate the received MultiPart Form, if valid, and the material, which has to be in the catalog
+// and compatible with the model of the device, and send the corresponding message to the queue and file to object storage.
+// If the message includes an UploadID, the file uploaded directly to the object storage is validated and used instead
+// of the one in the form, see JobUploads. Meshes are analyzed and the analysis is stored with the message.
+// Jobs whose meshes do not fit in the usable platform of the device are rejected with a JSON body describing why,
+// unless the force query parameter is true, see checkBuildVolume
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) Job(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(64 << 20)
 
@@ -149,52 +176,111 @@ func (s *Server) Job(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.ValidateMaterial(message.Material)
+	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(r.Context(), message.DeviceName)
 	if err != nil {
 		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	if deviceIP == "" || deviceUUID == "" {
+		fmt.Printf("No device found with provided name\n")
 		utils.BadRequest(w)
 		return
 	}
 
-	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(message.DeviceName)
-	if err != nil {
-		fmt.Printf("%v\n", err)
-		utils.ServerError(w)
+	if !s.authorizeUUID(w, r, auth.RoleOperator, deviceUUID) {
 		return
 	}
 
-	if deviceIP == "" || deviceUUID == "" {
-		fmt.Printf("No device found with provided name\n")
+	material, err := s.compatibleMaterial(r.Context(), message.Material, deviceUUID)
+	if errors.Is(err, errIncompatibleMaterial) {
+		fmt.Printf("%v\n", err)
 		utils.BadRequest(w)
 		return
 	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
 
 	message.IPAddress = deviceIP
 	message.DeviceUUID = deviceUUID
 
-	file, fileHeader, err := r.FormFile("file")
+	var file io.ReadSeeker
+	var contentType string
+	// stagedKey is the name of the file uploaded directly to the object storage, if any
+	var stagedKey string
 
-	if err != nil {
-		fmt.Println("Error while reading the file")
-		utils.BadRequest(w)
-		return
+	if message.UploadID != "" {
+		staged, key, stagedType, err := s.stagedFile(r.Context(), message.UploadID)
+		if errors.Is(err, errUploadNotFound) {
+			fmt.Printf("%v\n", err)
+			utils.BadRequest(w)
+			return
+		}
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			utils.ServerError(w)
+			return
+		}
+
+		defer staged.Close()
+
+		file, stagedKey = staged, key
+		message.FileName = path.Base(key)
+		contentType = stagedType
+	} else {
+		formFile, fileHeader, err := r.FormFile("file")
+
+		if err != nil {
+			fmt.Println("Error while reading the file")
+			utils.BadRequest(w)
+			return
+		}
+
+		defer formFile.Close()
+
+		file = formFile
+		message.FileName = fileHeader.Filename
+		contentType = fileHeader.Header.Get("Content-Type")
 	}
 
-	defer file.Close()
+	// meshes are validated while they are analyzed, so that they are only read once
+	var meshAnalysis *types.MeshAnalysis
+	if mesh.Supported(message.FileName) {
+		var result types.MeshAnalysis
+		result, err = analysis.Analyze(file, message.FileName, material)
+		meshAnalysis = &result
+	} else {
+		err = utils.ValidateFile(file, message.FileName, contentType)
+	}
 
-	err = utils.ValidateFile(file, fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.BadRequest(w)
 		return
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	message.FileName = fileHeader.Filename
-	message.S3Name = strconv.Itoa(rand.Int()) + " - " + message.FileName
+	// parts that do not fit in the device can still be sent with ?force=true
+	if meshAnalysis != nil && r.URL.Query().Get("force") != "true" {
+		rejection, err := s.checkBuildVolume(r.Context(), message.DeviceName, message.FileName, *meshAnalysis)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			utils.ServerError(w)
+			return
+		}
 
-	err = s.objStorage.UploadFile(file, message.S3Name)
+		if rejection != nil {
+			fmt.Printf("%v\n", rejection.Error)
+			utils.BadRequestJSON(w, rejection)
+			return
+		}
+	}
 
+	// the checksum travels with the message so that the agent and the device verify the file they receive
+	message.SHA256, err = utils.Checksum(file)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -203,8 +289,64 @@ func (s *Server) Job(w http.ResponseWriter, r *http.Request) {
 
 	message.MessageUUID = uuid.NewString()
 
+	// objects are addressed by their content, so identical files are stored only once
+	message.S3Name = "jobs/" + message.SHA256 + "/" + utils.SanitizeFileName(message.FileName)
+
+	// the deletion of a file cannot begin while it is referenced and its object is deleted before the file,
+	// so the object of a file that already existed is kept once the reference is added, if it was uploaded.
+	// Files whose deletion has begun cannot be referenced until they are deleted, the request has to be retried
+	fileReference := types.FileReferenceDB{
+		FileKey:     message.S3Name,
+		MessageUUID: message.MessageUUID,
+		Timestamp:   utils.GetTimestamp(),
+	}
+
+	existed, err := s.database.AddFileReference(r.Context(), fileReference)
+	if err != nil {
+		fmt.Printf("Got an error adding the file reference in the DB: %v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	// files that did not exist have no object, as it is deleted before the file, so they are uploaded without checking it
+	exists := false
+	if existed {
+		exists, err = s.objStorage.Exists(r.Context(), message.S3Name)
+	}
+	if err == nil && !exists {
+		if stagedKey != "" {
+			err = s.objStorage.CopyFile(r.Context(), stagedKey, message.S3Name)
+		} else {
+			err = s.objStorage.UploadFile(r.Context(), file, message.S3Name)
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		s.removeFileReference(r.Context(), fileReference)
+		utils.ServerError(w)
+		return
+	}
+
 	message.ResultURL = s.serverURL + "/responses"
 
+	message.ResultSecret, err = auth.NewResultSecret()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	// agents without access to the object storage download the file from this URL
+	message.DownloadURL, err = s.objStorage.PresignGetURL(r.Context(), message.S3Name, s.presignExpiry)
+	if err != nil && !errors.Is(err, objstorage.ErrPresignNotSupported) {
+		fmt.Printf("%v\n", err)
+	}
+
+	// the upload is only meaningful to the backend
+	uploadID := message.UploadID
+	message.UploadID = ""
+
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		fmt.Printf("Got an error creating the message to the queue: %v\n", err)
@@ -218,29 +360,344 @@ func (s *Server) Job(w http.ResponseWriter, r *http.Request) {
 		Type:           "Job",
 		AdditionalInfo: message.FileName,
 		Timestamp:      utils.GetTimestamp(),
+		Analysis:       meshAnalysis,
+		Caller:         caller(r),
+		ResultSecret:   message.ResultSecret,
 	}
 
-	err = s.database.InsertMessage(messageDb)
+	err = s.database.InsertMessage(r.Context(), messageDb)
 	if err != nil {
 		fmt.Printf("Got an error inserting the message in the DB: %v\n", err)
+		s.removeFileReference(r.Context(), fileReference)
 		utils.ServerError(w)
 		return
 	}
 
-	err = s.queue.SendMessage(string(messageJSON))
+	err = s.queue.SendMessage(r.Context(), string(messageJSON), deviceUUID)
 	if err != nil {
 		fmt.Printf("%v\n", err)
+		s.removeFileReference(r.Context(), fileReference)
 		utils.ServerError(w)
 		return
 	}
 
+	// the staged file is kept until the job is sent so that the request can be retried,
+	// if it cannot be deleted now the retention sweeper will
+	if stagedKey != "" {
+		for _, key := range []string{stagedKey, manifestName(uploadID)} {
+			err = s.objStorage.DeleteFile(r.Context(), key)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}
+	}
+
 	utils.OKRequest(w)
 }
 
+// errIncompatibleMaterial is returned when a job uses a material that is not in the catalog
+// or that the device cannot print with
+var errIncompatibleMaterial = errors.New("the material is not compatible with the device")
+
+// compatibleMaterial returns the material of the catalog with the received name, if the device with the received UUID
+// can print with it according to its model
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) compatibleMaterial(ctx context.Context, name string, deviceUUID string) (types.Material, error) {
+	material, err := s.database.GetMaterial(ctx, name)
+	if err != nil {
+		return types.Material{}, fmt.Errorf("error while getting the material: %w", err)
+	}
+
+	if material.Name == "" {
+		return types.Material{}, fmt.Errorf("material %q not found in the catalog: %w", name, errIncompatibleMaterial)
+	}
+
+	device, err := s.database.GetDeviceByUUID(ctx, deviceUUID)
+	if err != nil {
+		return types.Material{}, fmt.Errorf("error while getting the device: %w", err)
+	}
+
+	if !materials.Compatible(material, device.Model) {
+		return types.Material{}, fmt.Errorf("material %q cannot be used by model %q: %w", name, device.Model, errIncompatibleMaterial)
+	}
+
+	return material, nil
+}
+
+// errUploadNotFound is returned when a job references an upload that does not exist or has not been completed
+var errUploadNotFound = errors.New("the upload does not exist or has not been completed")
+
+// manifestName returns the name of the object where the StagedUpload of the upload with the received ID is stored.
+// It is not under the prefix of the uploaded file so that clients cannot overwrite it with their presigned URLs
+func manifestName(uploadID string) string {
+	return retention.UploadsPrefix + uploadID + ".json"
+}
+
+// stagedFile completes the upload with the received ID, if it is a multipart one, checking that all the parts
+// and the whole file described in its manifest have been uploaded, see JobUploads.
+// It returns a reader that streams the uploaded file from the object storage, so that it can be validated,
+// its name in the object storage and its MIME type, detected from its content. The caller has to close the reader
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) stagedFile(ctx context.Context, uploadID string) (io.ReadSeekCloser, string, string, error) {
+	_, err := uuid.Parse(uploadID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", errUploadNotFound)
+	}
+
+	exists, err := s.objStorage.Exists(ctx, manifestName(uploadID))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+	}
+	if !exists {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", errUploadNotFound)
+	}
+
+	manifestFile, err := s.objStorage.OpenFile(ctx, manifestName(uploadID))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+	}
+
+	var manifest types.StagedUpload
+	err = json.NewDecoder(io.LimitReader(manifestFile, 64<<10)).Decode(&manifest)
+	manifestFile.Close()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while reading the upload manifest: %w", err)
+	}
+
+	if manifest.Parts > 0 {
+		err = s.objStorage.CompleteMultipartUpload(ctx, manifest.Key, manifest.Parts)
+		if errors.Is(err, objstorage.ErrIncompleteUpload) {
+			return nil, "", "", fmt.Errorf("%v: %w", err, errUploadNotFound)
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+		}
+	}
+
+	files, err := s.objStorage.ListFiles(ctx, manifest.Key)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+	}
+
+	// the prefix also matches longer names
+	var size int64 = -1
+	for _, file := range files {
+		if file.Key == manifest.Key {
+			size = file.Size
+		}
+	}
+
+	if size != manifest.Size {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file, %v bytes uploaded of %v: %w", size, manifest.Size, errUploadNotFound)
+	}
+
+	file, err := s.objStorage.OpenFile(ctx, manifest.Key)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+	}
+
+	// the extension is chosen by the client, so the type is detected from the first bytes of the file
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err == nil || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, "", "", fmt.Errorf("error while getting the uploaded file: %w", err)
+	}
+
+	return file, manifest.Key, http.DetectContentType(head[:n]), nil
+}
+
+// snapshotName returns the name of the snapshot with the received prefix, such as retention.IdentificationSnapshotsPrefix,
+// uploaded by the device with the received name
+func snapshotName(prefix string, deviceName string) string {
+	return prefix + strings.Replace(deviceName, ".", "_", 4) + ".json"
+}
+
+// checkBuildVolume checks that the meshes of a job fit in the usable platform of the device with the received name,
+// described by its latest Identification snapshot. The parts of ZIP archives are checked one by one, as they are
+// independent meshes, and the parts of other files together, as they are placed in the same build.
+// The job is not checked if the device has not uploaded a snapshot describing its usable platform.
+// It returns the reason to reject the job if a part does not fit and nil otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) checkBuildVolume(ctx context.Context, deviceName string, fileName string, meshAnalysis types.MeshAnalysis) (*types.BuildVolumeError, error) {
+	key := snapshotName(retention.IdentificationSnapshotsPrefix, deviceName)
+
+	exists, err := s.objStorage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error while checking the build volume: %w", err)
+	}
+	if !exists {
+		fmt.Printf("No identification of device %v, the build volume is not checked\n", deviceName)
+		return nil, nil
+	}
+
+	fd, err := os.CreateTemp("", "identification-*")
+	if err != nil {
+		return nil, fmt.Errorf("error while checking the build volume: %w", err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+
+	err = s.objStorage.GetFile(ctx, key, fd)
+	if err == nil {
+		_, err = fd.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while checking the build volume: %w", err)
+	}
+
+	platform, err := identification.UsablePlatform(fd)
+	if err != nil {
+		fmt.Printf("%v, the build volume of device %v is not checked\n", err, deviceName)
+		return nil, nil
+	}
+
+	parts := []types.MeshReport{meshAnalysis.Total}
+	parts[0].Name = fileName
+	if strings.EqualFold(filepath.Ext(fileName), ".zip") {
+		parts = meshAnalysis.Parts
+	}
+
+	for _, part := range parts {
+		if platform.Fits(part) {
+			continue
+		}
+
+		size := [3]float64{}
+		for axis := range size {
+			size[axis] = part.Max[axis] - part.Min[axis]
+		}
+
+		return &types.BuildVolumeError{
+			Error:        fmt.Sprintf("%v does not fit in the usable platform of %v", part.Name, deviceName),
+			Part:         part.Name,
+			PartSize:     size,
+			PlatformSize: platform.Size(),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// multipartThreshold is the size of the biggest file uploaded with a single request, bigger files are uploaded in parts
+const multipartThreshold = 100 << 20
+
+// minPartSize is the size of the parts of multipart uploads, unless the file needs more than maxParts of that size.
+// maxUploadSize is the size of the biggest file that can be sent in a job, as it is read entirely from the object storage
+// to be validated and checksummed before the job is sent
+const (
+	minPartSize   = 64 << 20
+	maxParts      = 10000
+	maxUploadSize = 8 << 30
+)
+
+// JobUploads is the handler used with POST and OPTIONS /job/uploads endpoint
+// It will validate the received JSON, if valid, and return the presigned URLs where the file has to be uploaded,
+// in parts if it is bigger than multipartThreshold, and the ID of the upload to include in the message sent to /job
+// It will return status code 200, 400, 403, 500 or 501, if the object storage does not support presigned URLs, as appropiate
+func (s *Server) JobUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		utils.OKRequest(w)
+		return
+	}
+
+	if !s.authorizeAnywhere(w, r, auth.RoleOperator) {
+		return
+	}
+
+	var request types.JobUploadRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Println("Invalid JSON provided")
+		utils.BadRequest(w)
+		return
+	}
+
+	err = utils.ValidateFileName(request.FileName)
+	if err != nil || request.Size <= 0 || request.Size > maxUploadSize {
+		fmt.Printf("Invalid file to upload: %+v\n", request)
+		utils.BadRequest(w)
+		return
+	}
+
+	upload := types.JobUpload{
+		UploadID: uuid.NewString(),
+		Expires:  time.Now().Add(s.presignExpiry).UnixMilli(),
+	}
+
+	manifest := types.StagedUpload{
+		Key:  retention.UploadsPrefix + upload.UploadID + "/" + utils.SanitizeFileName(request.FileName),
+		Size: request.Size,
+	}
+
+	if request.Size <= multipartThreshold {
+		upload.URL, err = s.objStorage.PresignPutURL(r.Context(), manifest.Key, s.presignExpiry)
+	} else {
+		upload.PartSize = minPartSize
+		if request.Size > minPartSize*maxParts {
+			upload.PartSize = (request.Size + maxParts - 1) / maxParts
+		}
+
+		manifest.Parts = int((request.Size + upload.PartSize - 1) / upload.PartSize)
+		upload.PartURLs, err = s.objStorage.CreateMultipartUpload(r.Context(), manifest.Key, manifest.Parts, s.presignExpiry)
+	}
+
+	if errors.Is(err, objstorage.ErrPresignNotSupported) {
+		fmt.Printf("%v\n", err)
+		utils.NotImplemented(w)
+		return
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	// the manifest is what the uploaded file is checked against when it is sent in a job, see stagedFile
+	manifestJSON, err := json.Marshal(manifest)
+	if err == nil {
+		err = s.objStorage.UploadFile(r.Context(), bytes.NewReader(manifestJSON), manifestName(upload.UploadID))
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	uploadJSON, err := json.Marshal(upload)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(uploadJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+}
+
+// removeFileReference removes the received reference of a job that could not be sent, so that the file it added
+// can be garbage-collected if no other message references it
+func (s *Server) removeFileReference(ctx context.Context, fileReference types.FileReferenceDB) {
+	fileReference.Timestamp = utils.GetTimestamp()
+	err := s.database.RemoveFileReference(ctx, fileReference)
+	if err != nil {
+		fmt.Printf("Got an error removing the file reference from the DB: %v\n", err)
+	}
+}
+
 // Upload is the handler used with POST and OPTIONS /upload endpoint
 // It will validate the received JSON, if valid, and send the corresponding message to the queue,
 // including the URL that the On-Premise server will have to use to upload the requested information
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 	requestBody, err := ioutil.ReadAll(r.Body)
 
@@ -274,7 +731,7 @@ func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(message.DeviceName)
+	deviceIP, deviceUUID, err := s.database.DeviceIPAndUUIDFromName(r.Context(), message.DeviceName)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -287,6 +744,10 @@ func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeUUID(w, r, auth.RoleOperator, deviceUUID) {
+		return
+	}
+
 	message.IPAddress = deviceIP
 	message.DeviceUUID = deviceUUID
 
@@ -307,6 +768,13 @@ func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 
 	message.ResultURL = s.serverURL + "/responses"
 
+	message.ResultSecret, err = auth.NewResultSecret()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		fmt.Printf("Got an error creating the message to the queue: %v\n", err)
@@ -320,16 +788,18 @@ func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 		Type:           "Upload",
 		AdditionalInfo: message.UploadInfo,
 		Timestamp:      utils.GetTimestamp(),
+		Caller:         caller(r),
+		ResultSecret:   message.ResultSecret,
 	}
 
-	err = s.database.InsertMessage(messageDb)
+	err = s.database.InsertMessage(r.Context(), messageDb)
 	if err != nil {
 		fmt.Printf("Got an error inserting the message in the DB: %v\n", err)
 		utils.ServerError(w)
 		return
 	}
 
-	err = s.queue.SendMessage(string(messageJSON))
+	err = s.queue.SendMessage(r.Context(), string(messageJSON), deviceUUID)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -344,7 +814,7 @@ func (s *Server) Upload(w http.ResponseWriter, r *http.Request) {
 // It will receive a JSON body containing device's identification information
 // and device's IP in the X-Device header, create the correspoding file
 // and upload it to the object storage
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) UploadIdentification(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("Content-Type") != "application/json" {
 		fmt.Println("Invalid request content type")
@@ -374,9 +844,13 @@ func (s *Server) UploadIdentification(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeName(w, r, auth.RoleOperator, deviceName) {
+		return
+	}
+
 	fmt.Printf("\nReceived Identification JSON from device: %v\n", deviceName)
 
-	fileName := "Identification-" + strings.Replace(deviceName, ".", "_", 4) + ".json"
+	fileName := snapshotName(retention.IdentificationSnapshotsPrefix, deviceName)
 	file, err := os.Create(fileName)
 
 	if err != nil {
@@ -402,7 +876,7 @@ func (s *Server) UploadIdentification(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.objStorage.UploadFile(file, fileName)
+	err = s.objStorage.UploadFile(r.Context(), file, fileName)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
@@ -418,7 +892,7 @@ func (s *Server) UploadIdentification(w http.ResponseWriter, r *http.Request) {
 // It will receive a JSON body containing device's jobs information
 // and device's IP in the X-Device header, create the correspoding file
 // and upload it to the object storage
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) UploadJobs(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("Content-Type") != "application/json" {
 		fmt.Println("Invalid request content type")
@@ -448,9 +922,13 @@ func (s *Server) UploadJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeName(w, r, auth.RoleOperator, deviceName) {
+		return
+	}
+
 	fmt.Printf("\nReceived Jobs JSON from device: %v\n", deviceName)
 
-	fileName := "Jobs-" + strings.Replace(deviceName, ".", "_", 4) + ".json"
+	fileName := snapshotName(retention.JobsSnapshotsPrefix, deviceName)
 	file, err := os.Create(fileName)
 
 	if err != nil {
@@ -476,7 +954,7 @@ func (s *Server) UploadJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.objStorage.UploadFile(file, fileName)
+	err = s.objStorage.UploadFile(r.Context(), file, fileName)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
@@ -490,14 +968,25 @@ func (s *Server) UploadJobs(w http.ResponseWriter, r *http.Request) {
 // AvailableInformation is the handler used with GET /availableInformation endpoint
 // It will return a JSON with all the Jobs and Identification information files
 // that are available in the object storage
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) AvailableInformation(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
 		return
 	}
 
-	AvailableInformation, err := s.objStorage.AvailableInformation()
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
+
+	AvailableInformation, err := s.objStorage.AvailableInformation(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	AvailableInformation, err = s.readableInformation(r, AvailableInformation)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -512,7 +1001,6 @@ func (s *Server) AvailableInformation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(jsonResult)
 	if err != nil {
@@ -527,7 +1015,7 @@ func (s *Server) AvailableInformation(w http.ResponseWriter, r *http.Request) {
 // GetInformationFile is the handler used with GET /getInformationFile endpoint
 // It will return the requestes JSON file, if it a valid one and it exists in the object storage
 // Requested file name is received from the petition as a Get parameter
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) GetInformationFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -540,6 +1028,10 @@ func (s *Server) GetInformationFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeSnapshot(w, r, auth.RoleViewer, key) {
+		return
+	}
+
 	file, err := os.CreateTemp("/tmp", "file")
 	if err != nil {
 		fmt.Printf("%v\n", err)
@@ -548,7 +1040,7 @@ func (s *Server) GetInformationFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer os.Remove(file.Name())
 
-	err = s.objStorage.GetFile(key, file)
+	err = s.objStorage.GetFile(r.Context(), key, file)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
@@ -564,7 +1056,6 @@ func (s *Server) GetInformationFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
@@ -585,14 +1076,25 @@ func (s *Server) GetInformationFile(w http.ResponseWriter, r *http.Request) {
 
 // GetPublicDevices is the handler used with GET /getPublicDevices endpoint
 // It will return the information (only name and model) about all the devices in JSON format
-// It will return status code 200 or 500 as appropiate
+// It will return status code 200, 403 or 500 as appropiate
 func (s *Server) GetPublicDevices(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
 		return
 	}
 
-	devices, err := s.database.GetDevices()
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
+
+	devices, err := s.database.GetDevices(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	devices, err = s.readableDevices(r, devices)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -602,7 +1104,6 @@ func (s *Server) GetPublicDevices(w http.ResponseWriter, r *http.Request) {
 	publicJSON := utils.DevicesToPublicJSON(devices)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(publicJSON)
 	if err != nil {
@@ -618,21 +1119,30 @@ func (s *Server) GetPublicDevices(w http.ResponseWriter, r *http.Request) {
 // It will write the necessary headers
 // It will return status code 200
 func (s *Server) DevicesCRUDOptionsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
 }
 
 // GetDevices is the handler used with GET /devices endpoint
 // It will return the information (UUID, name, IP and model) about all the devices in JSON format
-// It will return status code 200 or 500 as appropiate
+// It will return status code 200, 403 or 500 as appropiate
 func (s *Server) GetDevices(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
 		return
 	}
 
-	devices, err := s.database.GetDevices()
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
+
+	devices, err := s.database.GetDevices(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	devices, err = s.readableDevices(r, devices)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -647,7 +1157,6 @@ func (s *Server) GetDevices(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(devicesJSON)
 	if err != nil {
@@ -660,7 +1169,7 @@ func (s *Server) GetDevices(w http.ResponseWriter, r *http.Request) {
 
 // GetDeviceByUUID is the handler used with GET /devices/{uuid} endpoint
 // It will return the information about the device with the UUID received as URL parameter
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) GetDeviceByUUID(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -675,7 +1184,11 @@ func (s *Server) GetDeviceByUUID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	device, err := s.database.GetDeviceByUUID(deviceUUID)
+	if !s.authorizeUUID(w, r, auth.RoleViewer, deviceUUID) {
+		return
+	}
+
+	device, err := s.database.GetDeviceByUUID(r.Context(), deviceUUID)
 
 	if err != nil {
 		fmt.Printf("Error while getting the device: %v\n", err)
@@ -698,7 +1211,6 @@ func (s *Server) GetDeviceByUUID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(deviceJSON)
 	if err != nil {
@@ -712,7 +1224,7 @@ func (s *Server) GetDeviceByUUID(w http.ResponseWriter, r *http.Request) {
 
 // DeleteDevice is the handler used with DELETE /devices/{uuid} endpoint
 // It will delete the information about the device with the UUID received as URL parameter
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -727,7 +1239,11 @@ func (s *Server) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := s.database.DeleteDeviceFromUUID(deviceUUID)
+	if !s.authorizeUUID(w, r, auth.RoleAdmin, deviceUUID) {
+		return
+	}
+
+	err := s.database.DeleteDeviceFromUUID(r.Context(), deviceUUID)
 	if err != nil {
 		fmt.Printf("Error while deleting the device\n")
 		utils.ServerError(w)
@@ -740,7 +1256,7 @@ func (s *Server) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 
 // UpdateDevice is the handler used with PUT /devices/{uuid} endpoint
 // It will update the information about the device with the UUID received as URL parameter
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -755,6 +1271,10 @@ func (s *Server) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeUUID(w, r, auth.RoleAdmin, deviceUUID) {
+		return
+	}
+
 	requestBody, err := ioutil.ReadAll(r.Body)
 
 	if err != nil {
@@ -793,9 +1313,14 @@ func (s *Server) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 
 	device.DeviceUUID = deviceUUID
 
-	err = s.database.UpdateDevice(device)
-	if err != nil {
-		fmt.Printf("Error while updating: %v", err)
+	// moving the device to another group also needs the role in that group
+	if !s.authorize(w, r, auth.RoleAdmin, device) {
+		return
+	}
+
+	err = s.database.UpdateDevice(r.Context(), device)
+	if err != nil {
+		fmt.Printf("Error while updating: %v", err)
 		utils.ServerError(w)
 		return
 	}
@@ -807,7 +1332,7 @@ func (s *Server) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 
 // NewDevice is the handler used with POST /devices endpoint
 // It preforms all the necessary checking and, if everything is correct, will insert a new device to the DB
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) NewDevice(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -850,7 +1375,11 @@ func (s *Server) NewDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err := s.database.DeviceExistWithNameAndIP(device.Name, device.IP)
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{Group: device.Group}) {
+		return
+	}
+
+	exists, err := s.database.DeviceExistWithNameAndIP(r.Context(), device.Name, device.IP)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -865,22 +1394,23 @@ func (s *Server) NewDevice(w http.ResponseWriter, r *http.Request) {
 
 	device.DeviceUUID = uuid.NewString()
 
-	err = s.database.InsertDevice(device)
+	err = s.database.InsertDevice(r.Context(), device)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	fmt.Println("Device inserted successfully")
 
 }
 
 // ReceiveResponse is the handler used with POST /responses/{deviceUUID}/{messageUUID} endpoint
-// It will receive information about a response to the message and from the device received as URL parameters
-// It will return status code 200, 400 or 500 as appropiate
+// It will receive information about a response to the message and from the device received as URL parameters.
+// The body has to be signed with the secret sent in the message, see auth.VerifySignature, so that results cannot be
+// forged or replayed. The results of messages sent before they had a secret are rejected unless ACCEPT_UNSIGNED_RESULTS is true
+// It will return status code 200, 400, 401, 403 or 500 as appropiate
 func (s *Server) ReceiveResponse(w http.ResponseWriter, r *http.Request) {
 	requestBody, err := ioutil.ReadAll(r.Body)
 
@@ -912,6 +1442,10 @@ func (s *Server) ReceiveResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeUUID(w, r, auth.RoleOperator, deviceUUID) {
+		return
+	}
+
 	messageUUID := mux.Vars(r)["messageUUID"]
 
 	if messageUUID == "" {
@@ -942,6 +1476,35 @@ func (s *Server) ReceiveResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	message, err := s.database.GetMessage(r.Context(), deviceUUID, messageUUID)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	if message.MessageUUID == "" {
+		fmt.Printf("Message not found with given UUIDs\n")
+		utils.BadRequest(w)
+		return
+	}
+
+	// messages sent by older backends have no secret to sign their results, which are only accepted if configured
+	if message.ResultSecret == "" && !s.acceptUnsigned {
+		fmt.Printf("Rejected unsigned response to message %v, sent before results were signed\n", messageUUID)
+		utils.Unauthorized(w)
+		return
+	}
+
+	if message.ResultSecret != "" {
+		err = auth.VerifySignature(r.Header.Get(auth.SignatureHeader), message.ResultSecret, requestBody, time.Now(), s.resultTolerance)
+		if err != nil {
+			fmt.Printf("Rejected response to message %v: %v\n", messageUUID, err)
+			utils.Unauthorized(w)
+			return
+		}
+	}
+
 	fmt.Printf("\nReceived response to message %v from device %v with outcome %v\n", messageUUID, deviceUUID, response.Result)
 
 	resultDB := types.ResultDB{
@@ -951,18 +1514,19 @@ func (s *Server) ReceiveResponse(w http.ResponseWriter, r *http.Request) {
 		Timestamp:   response.Timestamp,
 	}
 
-	err = s.database.InsertResult(resultDB)
+	err = s.database.InsertResult(r.Context(), resultDB)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
+		return
 	}
 
 	utils.OKRequest(w)
 }
 
 // DeviceMessages is the handler used with GET /messages/{deviceUUID} endpoint
-// It will receive a deviceUUID and return all its messages information
-// It will return status code 200, 400 or 500 as appropiate
+// It will receive a deviceUUID and return all its messages information, including the analysis of the meshes sent in jobs
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) DeviceMessages(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -985,7 +1549,11 @@ func (s *Server) DeviceMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	messages, err := s.database.GetMessagesFromDevice(deviceUUID)
+	if !s.authorizeUUID(w, r, auth.RoleViewer, deviceUUID) {
+		return
+	}
+
+	messages, err := s.database.GetMessagesFromDevice(r.Context(), deviceUUID)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -1000,7 +1568,6 @@ func (s *Server) DeviceMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(messagesJSON)
 	if err != nil {
@@ -1013,7 +1580,7 @@ func (s *Server) DeviceMessages(w http.ResponseWriter, r *http.Request) {
 
 // MessageResponses is the handler used with GET /responses/{messageUUID} endpoint
 // It will receive a messageUUID and return all its responses information
-// It will return status code 200, 400 or 500 as appropiate
+// It will return status code 200, 400, 403 or 500 as appropiate
 func (s *Server) MessageResponses(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		utils.OKRequest(w)
@@ -1036,6 +1603,10 @@ func (s *Server) MessageResponses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeUUID(w, r, auth.RoleViewer, deviceUUID) {
+		return
+	}
+
 	messageUUID := mux.Vars(r)["messageUUID"]
 
 	if messageUUID == "" {
@@ -1052,7 +1623,7 @@ func (s *Server) MessageResponses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	responses, err := s.database.GetResponsesFromMessage(deviceUUID, messageUUID)
+	responses, err := s.database.GetResponsesFromMessage(r.Context(), deviceUUID, messageUUID)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		utils.ServerError(w)
@@ -1067,7 +1638,6 @@ func (s *Server) MessageResponses(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	_, err = w.Write(responsesJSON)
 	if err != nil {
@@ -1086,10 +1656,13 @@ func (s *Server) TestJobs(w http.ResponseWriter, r *http.Request) {
 		utils.OKRequest(w)
 		return
 	}
+
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
 	file, _ := os.ReadFile("jobs.json")
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	_, err := w.Write(file)
 	if err != nil {
 		fmt.Printf("There was an error writing the information: %v\n", err)
@@ -1103,13 +1676,533 @@ func (s *Server) TestIdentification(w http.ResponseWriter, r *http.Request) {
 		utils.OKRequest(w)
 		return
 	}
+
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
 	file, _ := os.ReadFile("identification.json")
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	_, err := w.Write(file)
 	if err != nil {
 		fmt.Printf("There was an error writing the information: %v\n", err)
 		return
 	}
 }
+
+// RetentionReport is the handler used with GET and OPTIONS /retention/report endpoint
+// It runs a dry run of the retention sweeper and returns the report of the objects and messages that would be deleted
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) RetentionReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		utils.OKRequest(w)
+		return
+	}
+
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	report, err := s.retention.Sweep(r.Context(), time.Now(), true)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(reportJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+}
+
+// MaterialsCRUDOptionsHandler is the handler used with the verb OPTIONS and all endpoints related to materials
+// It will write the necessary headers
+// It will return status code 200
+func (s *Server) MaterialsCRUDOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS, PUT, DELETE")
+}
+
+// GetMaterials is the handler used with GET /materials endpoint
+// It will return all the materials of the catalog in JSON format. If the model query parameter is present,
+// only the materials compatible with that device model are returned
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) GetMaterials(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
+
+	catalog, err := s.database.GetMaterials(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	if model, ok := r.URL.Query()["model"]; ok {
+		compatible := []types.Material{}
+		for _, material := range catalog {
+			if materials.Compatible(material, model[0]) {
+				compatible = append(compatible, material)
+			}
+		}
+		catalog = compatible
+	}
+
+	materialsJSON, err := json.Marshal(catalog)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(materialsJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("\nServed the list of Materials\n")
+}
+
+// GetMaterial is the handler used with GET /materials/{name} endpoint
+// It will return the information about the material with the name received as URL parameter
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) GetMaterial(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAnywhere(w, r, auth.RoleViewer) {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	material, err := s.database.GetMaterial(r.Context(), name)
+	if err != nil {
+		fmt.Printf("Error while getting the material: %v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	if material.Name == "" {
+		fmt.Printf("Material not found with given name\n")
+		utils.BadRequest(w)
+		return
+	}
+
+	materialJSON, err := json.Marshal(material)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(materialJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("\nServed the information of material %v\n", name)
+}
+
+// PutMaterial is the handler used with PUT /materials/{name} endpoint
+// It will add the material with the name received as URL parameter to the catalog, or replace it if it already exists,
+// with the density and compatible models received as JSON body
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) PutMaterial(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		fmt.Println("Invalid request content type")
+		utils.BadRequest(w)
+		return
+	}
+
+	var material types.Material
+	err := json.NewDecoder(r.Body).Decode(&material)
+	if err != nil {
+		fmt.Println("Put Material: Invalid JSON provided as body")
+		utils.BadRequest(w)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if material.Name != "" && material.Name != name {
+		fmt.Println("Put Material: the name in the body does not match the one in the URL")
+		utils.BadRequest(w)
+		return
+	}
+	material.Name = name
+
+	err = materials.Validate(material)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.BadRequest(w)
+		return
+	}
+
+	err = s.database.PutMaterial(r.Context(), material)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	fmt.Printf("Stored material %v\n", name)
+	utils.OKRequest(w)
+}
+
+// DeleteMaterial is the handler used with DELETE /materials/{name} endpoint
+// It will remove the material with the name received as URL parameter from the catalog,
+// so that it cannot be used in new jobs
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	err := s.database.DeleteMaterial(r.Context(), name)
+	if err != nil {
+		fmt.Printf("Error while deleting the material: %v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	fmt.Printf("Deleted material %v\n", name)
+	utils.OKRequest(w)
+}
+
+// APIKeysOptionsHandler is the handler used with the verb OPTIONS and all endpoints related to API keys
+// It will write the necessary headers
+// It will return status code 200
+func (s *Server) APIKeysOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
+}
+
+// GetAPIKeys is the handler used with GET /auth/keys endpoint
+// It will return the information about all the API keys, revoked ones included, in JSON format.
+// The keys themselves and their hashes are never returned
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	keys, err := s.database.GetAPIKeys(r.Context())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(keysJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("\nServed the list of API keys\n")
+}
+
+// CreateAPIKey is the handler used with POST /auth/keys endpoint
+// It will create a new API key with the name received in the JSON body and return its information along with
+// the key itself in JSON format. The key is only returned in this response, as just the hash of its secret is stored
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		fmt.Println("Invalid request content type")
+		utils.BadRequest(w)
+		return
+	}
+
+	var request struct {
+		Name string
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || strings.TrimSpace(request.Name) == "" {
+		fmt.Println("Create API key: Invalid JSON provided as body or missing name")
+		utils.BadRequest(w)
+		return
+	}
+
+	apiKey, key, err := auth.CreateAPIKey(r.Context(), s.database, strings.TrimSpace(request.Name), caller(r))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	keyJSON, err := json.Marshal(struct {
+		types.APIKey
+		Key string
+	}{apiKey, key})
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(keyJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("Created API key %v (%v)\n", apiKey.KeyID, apiKey.Name)
+}
+
+// RevokeAPIKey is the handler used with DELETE /auth/keys/{id} endpoint
+// It will revoke the API key with the ID received as URL parameter, so that it cannot be used anymore.
+// Revoked keys are kept, so that the callers recorded with them can still be identified
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	apiKey, err := s.database.GetAPIKey(r.Context(), id)
+	if err != nil {
+		fmt.Printf("Error while getting the API key: %v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	if apiKey.KeyID == "" {
+		fmt.Printf("API key not found with given ID\n")
+		utils.BadRequest(w)
+		return
+	}
+
+	err = s.database.RevokeAPIKey(r.Context(), id, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	fmt.Printf("Revoked API key %v (%v)\n", apiKey.KeyID, apiKey.Name)
+	utils.OKRequest(w)
+}
+
+// GrantsOptionsHandler is the handler used with the verb OPTIONS and all endpoints related to grants
+// It will write the necessary headers
+// It will return status code 200
+func (s *Server) GrantsOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
+}
+
+// GetGrants is the handler used with GET /auth/grants endpoint
+// It will return all the grants in JSON format. If the subject query parameter is present,
+// only the grants of that identity, such as "api-key:<id>" or "jwt:<sub>", are returned
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) GetGrants(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	var grants []types.Grant
+	var err error
+	if subject, ok := r.URL.Query()["subject"]; ok {
+		grants, err = s.database.GetGrantsOfSubject(r.Context(), subject[0])
+	} else {
+		grants, err = s.database.GetGrants(r.Context())
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	grantsJSON, err := json.Marshal(grants)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(grantsJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("\nServed the list of grants\n")
+}
+
+// CreateGrant is the handler used with POST /auth/grants endpoint
+// It will grant the role received in the JSON body to the subject on the scope, see auth.ValidateGrant,
+// and return the grant in JSON format. API keys have to exist and not be revoked to be granted a role
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) CreateGrant(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		fmt.Println("Invalid request content type")
+		utils.BadRequest(w)
+		return
+	}
+
+	var request types.Grant
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Println("Create grant: Invalid JSON provided as body")
+		utils.BadRequest(w)
+		return
+	}
+
+	err = auth.ValidateGrant(request)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.BadRequest(w)
+		return
+	}
+
+	if strings.HasPrefix(request.Subject, auth.MethodAPIKey+":") {
+		apiKey, err := s.database.GetAPIKey(r.Context(), strings.TrimPrefix(request.Subject, auth.MethodAPIKey+":"))
+		if err != nil {
+			fmt.Printf("Error while getting the API key: %v\n", err)
+			utils.ServerError(w)
+			return
+		}
+
+		if apiKey.KeyID == "" || apiKey.RevokedAt != 0 {
+			fmt.Printf("API key not found with given ID or revoked\n")
+			utils.BadRequest(w)
+			return
+		}
+	}
+
+	grant, err := auth.CreateGrant(r.Context(), s.database, request.Subject, request.Role, request.Scope, caller(r))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	grantJSON, err := json.Marshal(grant)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(grantJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("Granted %v on %v to %v\n", grant.Role, grant.Scope, grant.Subject)
+}
+
+// DeleteGrant is the handler used with DELETE /auth/grants/{id} endpoint
+// It will delete the grant with the ID received as URL parameter
+// It will return status code 200, 403 or 500 as appropiate
+func (s *Server) DeleteGrant(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	err := s.database.DeleteGrant(r.Context(), id)
+	if err != nil {
+		fmt.Printf("Error while deleting the grant: %v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	fmt.Printf("Deleted grant %v\n", id)
+	utils.OKRequest(w)
+}
+
+// AuditEntries is the handler used with GET and OPTIONS /auth/audit endpoint
+// It will return the actions denied to their callers in JSON format, since the timestamp in milliseconds
+// received as the since query parameter, or all of them if it is not present
+// It will return status code 200, 400, 403 or 500 as appropiate
+func (s *Server) AuditEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		utils.OKRequest(w)
+		return
+	}
+
+	if !s.authorize(w, r, auth.RoleAdmin, types.Device{}) {
+		return
+	}
+
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fmt.Println("Invalid since query parameter")
+			utils.BadRequest(w)
+			return
+		}
+	}
+
+	entries, err := s.database.GetAuditEntries(r.Context(), since)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		fmt.Printf("Error while creating the JSON%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(entriesJSON)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		utils.ServerError(w)
+		return
+	}
+	fmt.Printf("\nServed the audit entries\n")
+}
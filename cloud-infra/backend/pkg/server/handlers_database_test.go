@@ -0,0 +1,866 @@
+package server
+
+import (
+	"backend/pkg/auth"
+	"backend/pkg/database"
+	"backend/pkg/materials"
+	"backend/pkg/mocks"
+	objstorage "backend/pkg/obj_storage"
+	"backend/pkg/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+// testDatabases contains the Database implementations the handlers are tested with,
+// and the functions creating a new empty instance of each one
+var testDatabases = []struct {
+	newDatabase func(t *testing.T) database.Database
+	testName    string
+}{
+	{func(t *testing.T) database.Database { return database.NewDatabaseMemory() }, "Memory"},
+	{newSQLTestDatabase, "SQL"},
+}
+
+// newSQLTestDatabase returns an in-memory SQLite database, which is closed when the test finishes
+func newSQLTestDatabase(t *testing.T) database.Database {
+	t.Setenv("SQL_DRIVER", "sqlite")
+	t.Setenv("SQL_DATA_SOURCE", ":memory:")
+
+	db := database.NewDatabaseSQL()
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// forEachDatabase runs test as a subtest with a new instance of every Database implementation,
+// with the materials catalog seeded as the backend does on its first start
+func forEachDatabase(t *testing.T, test func(t *testing.T, db database.Database)) {
+	for i, tt := range testDatabases {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			db := tt.newDatabase(t)
+			if _, err := materials.Seed(context.Background(), db); err != nil {
+				t.Fatal(err)
+			}
+			test(t, db)
+		})
+	}
+}
+
+// newTestServer returns a Server backed by the received database
+// Queue and object storage are mocked and never return an error
+func newTestServer(t *testing.T, db database.Database) *Server {
+	t.Setenv("SERVER_URL", "http://localhost:12345")
+
+	mockCtrl := gomock.NewController(t)
+
+	mockQueue := mocks.NewMockQueue(mockCtrl)
+	mockQueue.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
+	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockObjStorage.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	mockObjStorage.EXPECT().PresignGetURL(gomock.Any(), gomock.Any(), gomock.Any()).Return("", objstorage.ErrPresignNotSupported).AnyTimes()
+
+	server := NewServer(mockQueue, mockObjStorage, db, mux.NewRouter())
+	server.Routes()
+	return server
+}
+
+func doRequest(s *Server, method string, url string, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDevicesCRUD(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		w := doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"devName","Model":"devModel"}`))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("Expected code %v inserting device, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.2","Name":"devName"}`))
+		if w.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected code %v inserting duplicated device, got %v", http.StatusBadRequest, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "GET", "/devices", "", nil)
+		var devices []types.Device
+		err := json.Unmarshal(w.Body.Bytes(), &devices)
+		if err != nil || len(devices) != 1 {
+			t.Fatalf("Expected exactly one device, got %s", w.Body.String())
+		}
+		deviceUUID := devices[0].DeviceUUID
+
+		w = doRequest(server, "PUT", "/devices/"+deviceUUID, "application/json", []byte(`{"IP":"127.0.0.3","Name":"newName"}`))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("Expected code %v updating device, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "GET", "/devices/"+deviceUUID, "", nil)
+		var device types.Device
+		err = json.Unmarshal(w.Body.Bytes(), &device)
+		if err != nil || device.Name != "newName" || device.IP != "127.0.0.3" || device.Model != "" {
+			t.Errorf("Device was not updated correctly, got %s", w.Body.String())
+		}
+
+		w = doRequest(server, "DELETE", "/devices/"+deviceUUID, "", nil)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("Expected code %v deleting device, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "GET", "/devices/"+deviceUUID, "", nil)
+		if w.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected code %v getting deleted device, got %v", http.StatusBadRequest, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestMessagesAndResponses(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		var tc = []struct {
+			url                string
+			contentType        string
+			body               []byte
+			expectedStatusCode int
+			testName           string
+		}{
+			{"/heartbeat", "application/json", []byte(`{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"unknown"}`), http.StatusBadRequest, "Heartbeat to unknown device"},
+			{"/heartbeat", "application/json", []byte(`{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"device"}`), http.StatusOK, "Heartbeat"},
+			{"/upload", "application/json", []byte(`{"DeviceName" : "device", "type":"UPLOAD", "UploadInfo":"Jobs"}`), http.StatusOK, "Upload"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				w := doRequest(server, "POST", tt.url, tt.contentType, tt.body)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`)
+		fw, _ := CustomCreateFormFile(writer, "file", "sample.pdf", "application/pdf")
+		_, _ = fw.Write([]byte("%PDF-1.4"))
+		writer.Close()
+
+		w := doRequest(server, "POST", "/job", writer.FormDataContentType(), body.Bytes())
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("Expected code %v sending job, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "GET", "/devices", "", nil)
+		var devices []types.Device
+		_ = json.Unmarshal(w.Body.Bytes(), &devices)
+		deviceUUID := devices[0].DeviceUUID
+
+		w = doRequest(server, "GET", "/messages/"+deviceUUID, "", nil)
+		var messages []types.MessageDB
+		err := json.Unmarshal(w.Body.Bytes(), &messages)
+		if err != nil || len(messages) != 3 {
+			t.Fatalf("Expected 3 messages, got %s", w.Body.String())
+		}
+
+		messageUUID := messages[0].MessageUUID
+		url := "/responses/" + deviceUUID + "/" + messageUUID
+
+		// results are signed with the secret sent in the message, as the agent does
+		stored, err := server.database.GetMessage(context.Background(), deviceUUID, messageUUID)
+		if err != nil || stored.ResultSecret == "" {
+			t.Fatalf("Expected the message to have a result secret, got %+v and error %v", stored, err)
+		}
+		sendResult := func(body string, secret string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", url, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(auth.SignatureHeader, auth.Sign(secret, time.Now(), []byte(body)))
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		w = sendResult(`{"Result":"FAILURE", "Timestamp": 1650795291931}`, stored.ResultSecret)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("Expected code %v inserting result, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+		sendResult(`{"Result":"SUCCESS", "Timestamp": 1650795291999}`, stored.ResultSecret)
+
+		w = sendResult(`{"Result":"FORGED", "Timestamp": 1650795292000}`, "forged")
+		if w.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected code %v inserting forged result, got %v", http.StatusUnauthorized, w.Result().StatusCode)
+		}
+
+		w = doRequest(server, "GET", url, "", nil)
+		var responses []types.Response
+		err = json.Unmarshal(w.Body.Bytes(), &responses)
+		if err != nil || len(responses) != 2 || responses[1].Result != "SUCCESS" {
+			t.Errorf("Expected 2 responses ending with SUCCESS, got %s", w.Body.String())
+		}
+
+		w = doRequest(server, "GET", "/devices/"+deviceUUID, "", nil)
+		var device types.Device
+		_ = json.Unmarshal(w.Body.Bytes(), &device)
+		if device.LastResult != "SUCCESS" {
+			t.Errorf("Expected device last result SUCCESS, got %v", device.LastResult)
+		}
+
+		w = doRequest(server, "GET", "/messages/"+deviceUUID, "", nil)
+		_ = json.Unmarshal(w.Body.Bytes(), &messages)
+		for _, msg := range messages {
+			if msg.MessageUUID == messageUUID && msg.LastResult != "SUCCESS" {
+				t.Errorf("Expected message last result SUCCESS, got %v", msg.LastResult)
+			}
+		}
+	})
+}
+
+func TestJobFileDeduplication(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("SERVER_URL", "http://localhost:12345")
+
+		mockCtrl := gomock.NewController(t)
+
+		// the agent receives the URL to download the file
+		mockQueue := mocks.NewMockQueue(mockCtrl)
+		mockQueue.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, message string, groupID string) error {
+			var msg types.Message
+			_ = json.Unmarshal([]byte(message), &msg)
+			if msg.DownloadURL != "https://bucket/presigned" {
+				t.Errorf("Expected the presigned URL in the message, got %v", message)
+			}
+			return nil
+		}).Times(2)
+
+		// sha256 of the file content and sanitized file name
+		key := "jobs/e16fa5d9b51928755db85b917f0297babaf22c7a47e97d9212adab56e61ba04e/my_part.pdf"
+
+		// the file is only uploaded by the first job, which creates it, and the second one finds it already stored
+		mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
+		gomock.InOrder(
+			mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any(), key).Return(nil),
+			mockObjStorage.EXPECT().Exists(gomock.Any(), key).Return(true, nil),
+		)
+		mockObjStorage.EXPECT().PresignGetURL(gomock.Any(), key, defaultPresignExpiry).Return("https://bucket/presigned", nil).Times(2)
+
+		server := NewServer(mockQueue, mockObjStorage, db, mux.NewRouter())
+		server.Routes()
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		for i := 0; i < 2; i++ {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`)
+			fw, _ := CustomCreateFormFile(writer, "file", "my part.pdf", "application/pdf")
+			_, _ = fw.Write([]byte("%PDF-1.4"))
+			writer.Close()
+
+			w := doRequest(server, "POST", "/job", writer.FormDataContentType(), body.Bytes())
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("Expected code %v sending job %v, got %v", http.StatusOK, i, w.Result().StatusCode)
+			}
+		}
+
+		// both messages reference the file, so it cannot be deleted
+		began, err := db.BeginFileDeletion(context.Background(), key)
+		if err != nil || began {
+			t.Errorf("Expected the deletion of the referenced file not to begin, got %v and error %v", began, err)
+		}
+	})
+}
+
+func TestJobUploads(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("SERVER_URL", "http://localhost:12345")
+
+		mockCtrl := gomock.NewController(t)
+
+		// small files are uploaded with a single URL and a 1 GiB file in 16 parts of 64 MiB
+		mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
+		mockObjStorage.EXPECT().PresignPutURL(gomock.Any(), gomock.Any(), defaultPresignExpiry).Return("https://bucket/put", nil)
+		mockObjStorage.EXPECT().CreateMultipartUpload(gomock.Any(), gomock.Any(), 16, defaultPresignExpiry).Return(make([]string, 16), nil)
+
+		// the manifest of every upload is stored with what the file is checked against once it is uploaded
+		manifests := map[string]types.StagedUpload{}
+		mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, file io.Reader, name string) error {
+			var manifest types.StagedUpload
+			err := json.NewDecoder(file).Decode(&manifest)
+			manifests[name] = manifest
+			return err
+		}).Times(2)
+
+		server := NewServer(mocks.NewMockQueue(mockCtrl), mockObjStorage, db, mux.NewRouter())
+		server.Routes()
+
+		var tc = []struct {
+			body       string
+			statusCode int
+			url        string
+			partSize   int64
+			parts      int
+			size       int64
+			testName   string
+		}{
+			{`{"filename":"my part.stl","size":1024}`, http.StatusOK, "https://bucket/put", 0, 0, 1024, "Small file"},
+			{`{"filename":"my part.stl","size":1073741824}`, http.StatusOK, "", minPartSize, 16, 1073741824, "Multipart upload"},
+			{`{"filename":"my part.exe","size":1024}`, http.StatusBadRequest, "", 0, 0, 0, "Invalid extension"},
+			{`{"filename":"my part.stl","size":0}`, http.StatusBadRequest, "", 0, 0, 0, "Empty file"},
+			{`{"filename":"my part.stl","size":17179869184}`, http.StatusBadRequest, "", 0, 0, 0, "File too big to be validated"},
+			{`{"filename":"my part.stl"`, http.StatusBadRequest, "", 0, 0, 0, "Invalid JSON"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				w := doRequest(server, "POST", "/job/uploads", "application/json", []byte(tt.body))
+				if w.Result().StatusCode != tt.statusCode {
+					t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Result().StatusCode)
+				}
+				if tt.statusCode != http.StatusOK {
+					return
+				}
+
+				var upload types.JobUpload
+				err := json.Unmarshal(w.Body.Bytes(), &upload)
+				if err != nil || upload.UploadID == "" || upload.URL != tt.url || upload.PartSize != tt.partSize || len(upload.PartURLs) != tt.parts {
+					t.Errorf("Unexpected upload %+v and error %v", upload, err)
+				}
+
+				manifest := manifests["uploads/"+upload.UploadID+".json"]
+				if manifest.Key != "uploads/"+upload.UploadID+"/my_part.stl" || manifest.Size != tt.size || manifest.Parts != tt.parts {
+					t.Errorf("Unexpected manifest %+v", manifest)
+				}
+			})
+		}
+	})
+}
+
+func TestJobWithUpload(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("SERVER_URL", "http://localhost:12345")
+
+		mockCtrl := gomock.NewController(t)
+
+		var sent types.Message
+		mockQueue := mocks.NewMockQueue(mockCtrl)
+		mockQueue.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, message string, groupID string) error {
+			return json.Unmarshal([]byte(message), &sent)
+		})
+
+		objStorage := objstorage.NewObjStorageMemory()
+
+		server := NewServer(mockQueue, objStorage, db, mux.NewRouter())
+		server.Routes()
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		// files in memory cannot be uploaded with presigned URLs
+		w := doRequest(server, "POST", "/job/uploads", "application/json", []byte(`{"filename":"my part.pdf","size":8}`))
+		if w.Result().StatusCode != http.StatusNotImplemented {
+			t.Fatalf("Expected code %v, got %v", http.StatusNotImplemented, w.Result().StatusCode)
+		}
+
+		// uploads are staged as JobUploads and a client would do
+		stage := func(uploadID string, content string, size int64) string {
+			staged := "uploads/" + uploadID + "/my_part.pdf"
+			manifest, _ := json.Marshal(types.StagedUpload{Key: staged, Size: size})
+			_ = objStorage.UploadFile(context.Background(), bytes.NewReader(manifest), "uploads/"+uploadID+".json")
+			if content != "" {
+				_ = objStorage.UploadFile(context.Background(), bytes.NewReader([]byte(content)), staged)
+			}
+			return staged
+		}
+
+		uploadID := "0b1fc3ab-7a8e-4c0a-9d0b-2f4f5e7c9a11"
+		staged := stage(uploadID, "%PDF-1.4", 8)
+		stage("1c2d3e4f-5a6b-4c7d-8e9f-0a1b2c3d4e5f", "", 8)
+		stage("2d3e4f5a-6b7c-4d8e-9f0a-1b2c3d4e5f6a", "%PDF-1.4 and more", 8)
+		stage("3e4f5a6b-7c8d-4e9f-0a1b-2c3d4e5f6a7b", "MZ\x90\x00pdf!", 8)
+
+		var tc = []struct {
+			uploadID   string
+			statusCode int
+			testName   string
+		}{
+			{"not-an-uuid", http.StatusBadRequest, "Invalid upload ID"},
+			{"6a0f3c1e-1d2b-4e5f-8a9b-0c1d2e3f4a5b", http.StatusBadRequest, "Upload not found"},
+			{"1c2d3e4f-5a6b-4c7d-8e9f-0a1b2c3d4e5f", http.StatusBadRequest, "File not uploaded"},
+			{"2d3e4f5a-6b7c-4d8e-9f0a-1b2c3d4e5f6a", http.StatusBadRequest, "Bigger file than expected"},
+			{"3e4f5a6b-7c8d-4e9f-0a1b-2c3d4e5f6a7b", http.StatusBadRequest, "Content is not a PDF"},
+			{uploadID, http.StatusOK, "Uploaded file"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				body := &bytes.Buffer{}
+				writer := multipart.NewWriter(body)
+				_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB", "UploadID":"`+tt.uploadID+`"}`)
+				writer.Close()
+
+				w := doRequest(server, "POST", "/job", writer.FormDataContentType(), body.Bytes())
+				if w.Result().StatusCode != tt.statusCode {
+					t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		// the validated file is stored with its content-addressed key and the staged one is deleted
+		key := "jobs/e16fa5d9b51928755db85b917f0297babaf22c7a47e97d9212adab56e61ba04e/my_part.pdf"
+		if sent.S3Name != key || sent.FileName != "my_part.pdf" || sent.UploadID != "" {
+			t.Errorf("Unexpected message sent %+v", sent)
+		}
+		for name, exists := range map[string]bool{key: true, staged: false, "uploads/" + uploadID + ".json": false} {
+			if ok, _ := objStorage.Exists(context.Background(), name); ok != exists {
+				t.Errorf("Expected %v to exist: %v", name, exists)
+			}
+		}
+	})
+}
+
+func TestJobAnalysis(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		// a tetrahedron with its corners at the origin and 10 mm along every axis
+		tetrahedron := "solid part\n"
+		for _, facet := range [][3]string{{"0 0 0", "0 10 0", "10 0 0"}, {"0 0 0", "10 0 0", "0 0 10"}, {"0 0 0", "0 0 10", "0 10 0"}, {"10 0 0", "0 10 0", "0 0 10"}} {
+			tetrahedron += fmt.Sprintf("facet normal 0 0 0\nouter loop\nvertex %v\nvertex %v\nvertex %v\nendloop\nendfacet\n", facet[0], facet[1], facet[2])
+		}
+		tetrahedron += "endsolid part\n"
+
+		var tc = []struct {
+			material   string
+			content    string
+			statusCode int
+			testName   string
+		}{
+			{"HR PA 12GB", "solid part\nendsolid part\n", http.StatusBadRequest, "Mesh without triangles"},
+			{"Unknown", tetrahedron, http.StatusBadRequest, "Unknown material"},
+			{"HR PA 12GB", tetrahedron, http.StatusOK, "Tetrahedron"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				body := &bytes.Buffer{}
+				writer := multipart.NewWriter(body)
+				_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"`+tt.material+`"}`)
+				fw, _ := CustomCreateFormFile(writer, "file", "part.stl", "model/stl")
+				_, _ = fw.Write([]byte(tt.content))
+				writer.Close()
+
+				w := doRequest(server, "POST", "/job", writer.FormDataContentType(), body.Bytes())
+				if w.Result().StatusCode != tt.statusCode {
+					t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		w := doRequest(server, "GET", "/devices", "", nil)
+		var devices []types.Device
+		_ = json.Unmarshal(w.Body.Bytes(), &devices)
+
+		w = doRequest(server, "GET", "/messages/"+devices[0].DeviceUUID, "", nil)
+		var messages []types.MessageDB
+		err := json.Unmarshal(w.Body.Bytes(), &messages)
+		if err != nil || len(messages) != 1 || messages[0].Analysis == nil {
+			t.Fatalf("Expected a job with its analysis, got %s", w.Body.String())
+		}
+
+		total := messages[0].Analysis.Total
+		volume := 1000.0 / 6
+		if total.Triangles != 4 || !total.Watertight || total.Max != [3]float64{10, 10, 10} ||
+			math.Abs(total.Volume-volume) > 1e-6 || math.Abs(total.Mass-volume/1000*1.30) > 1e-6 {
+			t.Errorf("Unexpected analysis %+v", total)
+		}
+	})
+}
+
+func TestJobBuildVolume(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("SERVER_URL", "http://localhost:12345")
+
+		mockCtrl := gomock.NewController(t)
+
+		mockQueue := mocks.NewMockQueue(mockCtrl)
+		mockQueue.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(3)
+
+		server := NewServer(mockQueue, objstorage.NewObjStorageMemory(), db, mux.NewRouter())
+		server.Routes()
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		// a triangle with the received size in X
+		triangle := func(size int) string {
+			return fmt.Sprintf("solid part\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex %v 0 0\nvertex 0 10 0\nendloop\nendfacet\nendsolid part\n", size)
+		}
+
+		sendJob := func(query string, content string) *httptest.ResponseRecorder {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`)
+			fw, _ := CustomCreateFormFile(writer, "file", "part.stl", "model/stl")
+			_, _ = fw.Write([]byte(content))
+			writer.Close()
+
+			return doRequest(server, "POST", "/job"+query, writer.FormDataContentType(), body.Bytes())
+		}
+
+		// the build volume is not checked until the device uploads its identification
+		w := sendJob("", triangle(500))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("Expected code %v without identification, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		req := httptest.NewRequest("POST", "/uploadIdentification", bytes.NewReader([]byte(`{"Identification": {"PrinterProperties": {"BuildPlatforms": {"BuildPlatform": {
+			"UsablePlatform": {"P1": {"X": 35000, "Y": 33000, "Z": 16920}, "P2": {"X": 415000, "Y": 317000, "Z": 396920}, "Units": "micron"}}}}}}`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Device", "device")
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("Expected code %v uploading the identification, got %v", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var tc = []struct {
+			query      string
+			size       int
+			statusCode int
+			testName   string
+		}{
+			{"", 380, http.StatusOK, "Part as big as the platform"},
+			{"", 381, http.StatusBadRequest, "Part bigger than the platform"},
+			{"?force=true", 381, http.StatusOK, "Forced part bigger than the platform"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				w := sendJob(tt.query, triangle(tt.size))
+				if w.Result().StatusCode != tt.statusCode {
+					t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Result().StatusCode)
+				}
+
+				if tt.statusCode == http.StatusBadRequest {
+					var rejection types.BuildVolumeError
+					err := json.Unmarshal(w.Body.Bytes(), &rejection)
+					if err != nil || rejection.Part != "part.stl" || rejection.PartSize != [3]float64{381, 10, 0} || rejection.PlatformSize[0] != 380 {
+						t.Errorf("Unexpected rejection %s", w.Body.String())
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestMaterials(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device","Model":"HP Jet Fusion 5210"}`))
+
+		var tc = []struct {
+			method     string
+			url        string
+			body       string
+			statusCode int
+			testName   string
+		}{
+			{"PUT", "/materials/HR%20PA%2012", `{"Density":1.01,"Models":["HP Jet Fusion 4200"]}`, http.StatusOK, "Restrict material to other model"},
+			{"PUT", "/materials/HR%20CB%20PA%2012", `{"Name":"HR CB PA 12","Density":1.02,"Models":["hp jet fusion 5210"]}`, http.StatusOK, "New material"},
+			{"PUT", "/materials/HR%20PA%2011", `{"Name":"HR PA 12","Density":1.05,"Models":["*"]}`, http.StatusBadRequest, "Different name in body"},
+			{"PUT", "/materials/HR%20PA%2011", `{"Density":0,"Models":["*"]}`, http.StatusBadRequest, "Missing density"},
+			{"PUT", "/materials/HR%20PA%2011", `{"Density":`, http.StatusBadRequest, "Invalid JSON"},
+			{"DELETE", "/materials/HR%20PP", "", http.StatusOK, "Delete material"},
+			{"GET", "/materials/HR%20PP", "", http.StatusBadRequest, "Deleted material"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				w := doRequest(server, tt.method, tt.url, "application/json", []byte(tt.body))
+				if w.Result().StatusCode != tt.statusCode {
+					t.Errorf("Expected code %v, got %v", tt.statusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		w := doRequest(server, "GET", "/materials/HR%20CB%20PA%2012", "", nil)
+		var material types.Material
+		err := json.Unmarshal(w.Body.Bytes(), &material)
+		if err != nil || material.Name != "HR CB PA 12" || material.Density != 1.02 {
+			t.Errorf("Unexpected material %s", w.Body.String())
+		}
+
+		w = doRequest(server, "GET", "/materials?model=HP%20Jet%20Fusion%205210", "", nil)
+		var catalog []types.Material
+		_ = json.Unmarshal(w.Body.Bytes(), &catalog)
+		names := []string{}
+		for _, material := range catalog {
+			names = append(names, material.Name)
+		}
+		if fmt.Sprint(names) != "[HR CB PA 12 HR PA 11 HR PA 12GB HR TPA]" {
+			t.Errorf("Unexpected materials compatible with the device %v", names)
+		}
+
+		// jobs are only sent with materials of the catalog compatible with the model of the device
+		for i, job := range []struct {
+			material   string
+			statusCode int
+		}{
+			{"HR CB PA 12", http.StatusOK},
+			{"HR PA 12", http.StatusBadRequest},
+			{"HR PP", http.StatusBadRequest},
+		} {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			_ = writer.WriteField("data", `{"type":"JOB", "DeviceName" : "device", "material":"`+job.material+`"}`)
+			fw, _ := CustomCreateFormFile(writer, "file", "sample.pdf", "application/pdf")
+			_, _ = fw.Write([]byte("%PDF-1.4"))
+			writer.Close()
+
+			w := doRequest(server, "POST", "/job", writer.FormDataContentType(), body.Bytes())
+			if w.Result().StatusCode != job.statusCode {
+				t.Errorf("Expected code %v sending job %v with %v, got %v", job.statusCode, i, job.material, w.Result().StatusCode)
+			}
+		}
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("AUTH_DISABLED", "false")
+		t.Setenv("AUTH_JWKS_FILE", "")
+		server := newTestServer(t, db)
+
+		// the first key is created directly in the database, as the backend does with -create-api-key
+		adminKey := createKeyWithGrants(t, server, "admin", auth.RoleAdmin, auth.ScopeAll)
+
+		request := func(method string, url string, key string, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				req.Header.Set(auth.APIKeyHeader, key)
+			}
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		w := request("GET", "/devices", "", "")
+		if w.Code != http.StatusUnauthorized || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatalf("Expected code %v with CORS headers without credentials, got %v and %v", http.StatusUnauthorized, w.Code, w.Header())
+		}
+
+		w = request("OPTIONS", "/devices", "", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected code %v in preflight request without credentials, got %v", http.StatusOK, w.Code)
+		}
+
+		w = request("POST", "/auth/keys", adminKey, `{"Name":""}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected code %v creating key without name, got %v", http.StatusBadRequest, w.Code)
+		}
+
+		w = request("POST", "/auth/keys", adminKey, `{"Name":"frontend"}`)
+		var created struct {
+			KeyID     string
+			CreatedBy string
+			Key       string
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &created) != nil || created.Key == "" {
+			t.Fatalf("Expected code %v and the new key, got %v and %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if !strings.HasPrefix(created.CreatedBy, auth.MethodAPIKey+":") {
+			t.Errorf("Expected the key to be created by the admin key, got %q", created.CreatedBy)
+		}
+
+		w = request("POST", "/devices", created.Key, `{"IP":"127.0.0.1","Name":"device","Model":"devModel"}`)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("Expected code %v inserting device with a key without grants, got %v", http.StatusForbidden, w.Code)
+		}
+
+		w = request("POST", "/auth/grants", adminKey, `{"Subject":"api-key:`+created.KeyID+`","Role":"admin","Scope":"*"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected code %v granting the admin role to the new key, got %v", http.StatusOK, w.Code)
+		}
+
+		w = request("POST", "/devices", created.Key, `{"IP":"127.0.0.1","Name":"device","Model":"devModel"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected code %v inserting device with the new key, got %v", http.StatusOK, w.Code)
+		}
+
+		w = request("POST", "/heartbeat", created.Key, `{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"device"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected code %v sending heartbeat, got %v", http.StatusOK, w.Code)
+		}
+
+		devices, _ := server.database.GetDevices(context.Background())
+		w = request("GET", "/messages/"+devices[0].DeviceUUID, adminKey, "")
+		var messages []types.MessageDB
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &messages) != nil || len(messages) != 1 {
+			t.Fatalf("Expected the heartbeat, got %v and %s", w.Code, w.Body.String())
+		}
+		if messages[0].Caller != auth.MethodAPIKey+":"+created.KeyID {
+			t.Errorf("Expected the heartbeat to be sent by the new key, got %q", messages[0].Caller)
+		}
+
+		w = request("GET", "/auth/keys", adminKey, "")
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Hash") || strings.Contains(w.Body.String(), created.Key) {
+			t.Fatalf("Expected the keys without their hashes, got %v and %s", w.Code, w.Body.String())
+		}
+
+		w = request("DELETE", "/auth/keys/unknown", adminKey, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected code %v revoking unknown key, got %v", http.StatusBadRequest, w.Code)
+		}
+
+		w = request("DELETE", "/auth/keys/"+created.KeyID, adminKey, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected code %v revoking key, got %v", http.StatusOK, w.Code)
+		}
+
+		w = request("GET", "/devices", created.Key, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected code %v with revoked key, got %v", http.StatusUnauthorized, w.Code)
+		}
+	})
+}
+
+// createKeyWithGrants creates an API key with the received name in the database of the server,
+// granting it the role on every received scope, and returns the key
+func createKeyWithGrants(t *testing.T, server *Server, name string, role string, scopes ...string) string {
+	apiKey, key, err := auth.CreateAPIKey(context.Background(), server.database, name, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scope := range scopes {
+		_, err = auth.CreateGrant(context.Background(), server.database, auth.MethodAPIKey+":"+apiKey.KeyID, role, scope, "cli")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return key
+}
+
+func TestAuthorization(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		t.Setenv("AUTH_DISABLED", "false")
+		t.Setenv("AUTH_JWKS_FILE", "")
+		server := newTestServer(t, db)
+		ctx := context.Background()
+
+		adminKey := createKeyWithGrants(t, server, "admin", auth.RoleAdmin, auth.ScopeAll)
+
+		request := func(method string, url string, key string, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(auth.APIKeyHeader, key)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		for _, device := range []string{
+			`{"IP":"127.0.0.1","Name":"production","Model":"devModel","Group":"production"}`,
+			`{"IP":"127.0.0.2","Name":"lab","Model":"devModel","Group":"lab"}`,
+		} {
+			w := request("POST", "/devices", adminKey, device)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected code %v inserting device, got %v", http.StatusOK, w.Code)
+			}
+		}
+
+		uuids := map[string]string{}
+		devices, _ := server.database.GetDevices(ctx)
+		for _, device := range devices {
+			uuids[device.Name] = device.DeviceUUID
+		}
+
+		viewerKey := createKeyWithGrants(t, server, "viewer", auth.RoleViewer, auth.GroupScope("production"))
+		operatorKey := createKeyWithGrants(t, server, "operator", auth.RoleOperator, auth.GroupScope("lab"), auth.DeviceScope(uuids["production"]))
+		labAdminKey := createKeyWithGrants(t, server, "lab admin", auth.RoleAdmin, auth.GroupScope("lab"))
+		noGrantsKey := createKeyWithGrants(t, server, "no grants", auth.RoleAdmin)
+
+		var tc = []struct {
+			method             string
+			url                string
+			key                string
+			body               string
+			expectedStatusCode int
+			testName           string
+		}{
+			{"GET", "/messages/" + uuids["production"], viewerKey, "", http.StatusOK, "Viewer reads messages of its group"},
+			{"GET", "/messages/" + uuids["lab"], viewerKey, "", http.StatusForbidden, "Viewer reads messages of other group"},
+			{"POST", "/heartbeat", viewerKey, `{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"production"}`, http.StatusForbidden, "Viewer sends heartbeat"},
+			{"POST", "/heartbeat", operatorKey, `{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"production"}`, http.StatusOK, "Operator sends heartbeat to its device"},
+			{"POST", "/heartbeat", operatorKey, `{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"lab"}`, http.StatusOK, "Operator sends heartbeat to its group"},
+			{"GET", "/messages/" + uuids["lab"], operatorKey, "", http.StatusOK, "Operator reads messages of its group"},
+			{"DELETE", "/devices/" + uuids["production"], operatorKey, "", http.StatusForbidden, "Operator deletes device"},
+			{"PUT", "/devices/" + uuids["lab"], labAdminKey, `{"IP":"127.0.0.2","Name":"lab","Group":"production"}`, http.StatusForbidden, "Admin moves device to other group"},
+			{"PUT", "/devices/" + uuids["lab"], labAdminKey, `{"IP":"127.0.0.3","Name":"lab","Group":"lab"}`, http.StatusOK, "Admin updates device of its group"},
+			{"PUT", "/materials/HR%20TPA", labAdminKey, `{"Density":1.01}`, http.StatusForbidden, "Admin of a group changes catalog"},
+			{"GET", "/materials", noGrantsKey, "", http.StatusForbidden, "Key without grants reads catalog"},
+			{"GET", "/auth/grants", operatorKey, "", http.StatusForbidden, "Operator reads grants"},
+			{"POST", "/auth/grants", adminKey, `{"Subject":"api-key:unknown","Role":"viewer","Scope":"*"}`, http.StatusBadRequest, "Grant to unknown key"},
+			{"POST", "/auth/grants", adminKey, `{"Subject":"jwt:alice","Role":"owner","Scope":"*"}`, http.StatusBadRequest, "Grant unknown role"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				w := request(tt.method, tt.url, tt.key, tt.body)
+				if w.Code != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Code)
+				}
+			})
+		}
+
+		// the list of devices only contains the ones the caller can read
+		w := request("GET", "/devices", viewerKey, "")
+		var readable []types.Device
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &readable) != nil || len(readable) != 1 || readable[0].Name != "production" {
+			t.Errorf("Expected only the production device, got %v and %s", w.Code, w.Body.String())
+		}
+
+		// every denied action is audited
+		w = request("GET", "/auth/audit", adminKey, "")
+		var entries []types.AuditEntry
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &entries) != nil || len(entries) != 7 {
+			t.Fatalf("Expected 7 audit entries, got %v and %s", w.Code, w.Body.String())
+		}
+		audited := false
+		for _, entry := range entries {
+			audited = audited || entry.Action == "POST /heartbeat" && entry.Role == auth.RoleOperator && entry.DeviceUUID == uuids["production"]
+		}
+		if !audited {
+			t.Errorf("Expected the heartbeat denied to the viewer to be audited, got %+v", entries)
+		}
+
+		w = request("GET", "/auth/audit?since="+fmt.Sprint(entries[6].Timestamp+1), adminKey, "")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Errorf("Expected no audit entries after the last one, got %v and %s", w.Code, w.Body.String())
+		}
+	})
+}
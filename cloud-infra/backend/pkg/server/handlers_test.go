@@ -1,10 +1,12 @@
 package server
 
 import (
+	"backend/pkg/auth"
+	"backend/pkg/database"
 	"backend/pkg/mocks"
 	"backend/pkg/types"
-	"backend/pkg/utils"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -15,149 +17,120 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 )
 
-func TestHeartbeat(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-
-	// Object Storage not used in Heartbeat Handler but we need to pass one to the server struct
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
-
-	mockDatabase := mocks.NewMockDatabase(mockCtrl)
-
-	// The mocked queue will return nil as error when called with any value
-	mockQueue.EXPECT().SendMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	// We assume database never returns an error and always gives a valid IP and UUID back
-	mockDatabase.EXPECT().DeviceIPAndUUIDFromName(gomock.Any()).Return("127.0.0.1", "placeholderUUID", nil).AnyTimes()
-
-	// We assume database insert message never return an error
-	mockDatabase.EXPECT().InsertMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	router := mux.NewRouter()
-
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
-
-	var tc = []struct {
-		body               []byte
-		expectedStatusCode int
-		testName           string
-	}{
-		{nil, http.StatusBadRequest, "Empty request body"},
-		{[]byte(`{"type":"HEARTBEAT"}`), http.StatusBadRequest, "Message is empty"},
-		{[]byte(`{"type":"HEARTBEAT", "message":"placeholder"}`), http.StatusBadRequest, "Device Name is empty"},
-		{[]byte(`{"message":"placeholder", "type":"JOB", "DeviceName":"device"}`), http.StatusBadRequest, "Type is incorrect"},
-		{[]byte(`{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"device"}`), http.StatusOK, "Good request"},
-	}
-
-	for i, tt := range tc {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			req := httptest.NewRequest("POST", "/heartbeat", bytes.NewBuffer(tt.body))
-			if tt.body != nil {
-				req.Header.Set("Content-Type", "application/json")
-			}
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-		})
-	}
+// TestMain disables authentication, which is tested in TestAuthentication, so that the requests of the other tests
+// do not need API keys
+func TestMain(m *testing.M) {
+	os.Setenv("AUTH_DISABLED", "true")
+	os.Exit(m.Run())
+}
 
+func TestHeartbeat(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		var tc = []struct {
+			body               []byte
+			expectedStatusCode int
+			testName           string
+		}{
+			{nil, http.StatusBadRequest, "Empty request body"},
+			{[]byte(`{"type":"HEARTBEAT"}`), http.StatusBadRequest, "Message is empty"},
+			{[]byte(`{"type":"HEARTBEAT", "message":"placeholder"}`), http.StatusBadRequest, "Device Name is empty"},
+			{[]byte(`{"message":"placeholder", "type":"JOB", "DeviceName":"device"}`), http.StatusBadRequest, "Type is incorrect"},
+			{[]byte(`{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"unknown"}`), http.StatusBadRequest, "Unknown device"},
+			{[]byte(`{"message":"placeholder", "type":"HEARTBEAT", "DeviceName":"device"}`), http.StatusOK, "Good request"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/heartbeat", bytes.NewBuffer(tt.body))
+				if tt.body != nil {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+	})
 }
 
 func TestJob(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
-	mockDatabase := mocks.NewMockDatabase(mockCtrl)
-
-	// The mocked queue will return nil as error when called with any value
-	mockQueue.EXPECT().SendMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	// We assume database never returns an error and always gives a valid IP and UUID back
-	mockDatabase.EXPECT().DeviceIPAndUUIDFromName(gomock.Any()).Return("127.0.0.1", "placeholderUUID", nil).AnyTimes()
-
-	// The mocked object storage will return nil as error when called with any values
-	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-
-	// We assume database insert message never return an error
-	mockDatabase.EXPECT().InsertMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	router := mux.NewRouter()
-
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
-
-	var tc = []struct {
-		data               []byte
-		file               string
-		expectedStatusCode int
-		testName           string
-	}{
-		{nil, "", http.StatusBadRequest, "Empty request"}, // empty request
-		{[]byte(`{"type":"HEARTBEAT", "DeviceName" : "device", "material":"HR PA 12GB"}`), "", http.StatusBadRequest, "Wrong type"}, // Wrong type
-		{[]byte(`{"type":"JOB", "DeviceName" : "device"}`), "", http.StatusBadRequest, "Missing material"},
-		{[]byte(`{"type":"JOB", "material" : "HR PA 12GB"}`), "", http.StatusBadRequest, "Missing device name"},                   // Missing field
-		{[]byte(`{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`), "", http.StatusBadRequest, "Missing file"},   // Missing file
-		{[]byte(`{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`), "sample.pdf", http.StatusOK, "Good request"}, // All good
-	}
-
-	for i, tt := range tc {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			body := &bytes.Buffer{}
-			writer := multipart.NewWriter(body)
-
-			if tt.data != nil {
-				fw, _ := writer.CreateFormField("data")
-				_, err := io.Copy(fw, strings.NewReader(string(tt.data)))
-				if err != nil {
-					t.Errorf("Error while copying data in test %v: %v", tt.testName, err)
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		var tc = []struct {
+			data               []byte
+			file               string
+			expectedStatusCode int
+			testName           string
+		}{
+			{nil, "", http.StatusBadRequest, "Empty request"}, // empty request
+			{[]byte(`{"type":"HEARTBEAT", "DeviceName" : "device", "material":"HR PA 12GB"}`), "", http.StatusBadRequest, "Wrong type"}, // Wrong type
+			{[]byte(`{"type":"JOB", "DeviceName" : "device"}`), "", http.StatusBadRequest, "Missing material"},
+			{[]byte(`{"type":"JOB", "material" : "HR PA 12GB"}`), "", http.StatusBadRequest, "Missing device name"},                   // Missing field
+			{[]byte(`{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`), "", http.StatusBadRequest, "Missing file"},   // Missing file
+			{[]byte(`{"type":"JOB", "DeviceName" : "device", "material":"HR PA 12GB"}`), "sample.pdf", http.StatusOK, "Good request"}, // All good
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				body := &bytes.Buffer{}
+				writer := multipart.NewWriter(body)
+
+				if tt.data != nil {
+					fw, _ := writer.CreateFormField("data")
+					_, err := io.Copy(fw, strings.NewReader(string(tt.data)))
+					if err != nil {
+						t.Errorf("Error while copying data in test %v: %v", tt.testName, err)
+					}
 				}
-			}
 
-			if tt.file != "" {
-				var fw io.Writer
-				switch filepath.Ext(tt.file) {
-				case ".pdf":
-					fw, _ = CustomCreateFormFile(writer, "file", tt.file, "application/pdf")
-				default:
-					fw, _ = writer.CreateFormFile("file", tt.file)
-				}
-				file, err := os.Open("../test_files/" + tt.file)
-				if err != nil {
-					t.Errorf("File %s not found in test folder", tt.file)
-				}
-				_, err = io.Copy(fw, file)
-				if err != nil {
-					t.Errorf("Error while copying data in test %v: %v", tt.testName, err)
+				if tt.file != "" {
+					var fw io.Writer
+					switch filepath.Ext(tt.file) {
+					case ".pdf":
+						fw, _ = CustomCreateFormFile(writer, "file", tt.file, "application/pdf")
+					default:
+						fw, _ = writer.CreateFormFile("file", tt.file)
+					}
+					file, err := os.Open("../test_files/" + tt.file)
+					if err != nil {
+						t.Errorf("File %s not found in test folder", tt.file)
+					}
+					_, err = io.Copy(fw, file)
+					if err != nil {
+						t.Errorf("Error while copying data in test %v: %v", tt.testName, err)
+					}
+					file.Close()
 				}
-				file.Close()
-			}
-			writer.Close()
+				writer.Close()
 
-			req := httptest.NewRequest("POST", "/job", bytes.NewBuffer(body.Bytes()))
-			req.Header.Set("Content-Type", writer.FormDataContentType())
+				req := httptest.NewRequest("POST", "/job", bytes.NewBuffer(body.Bytes()))
+				req.Header.Set("Content-Type", writer.FormDataContentType())
 
-			w := httptest.NewRecorder()
+				w := httptest.NewRecorder()
 
-			server.router.ServeHTTP(w, req)
-
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-		})
-	}
+				server.router.ServeHTTP(w, req)
 
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+	})
 }
 
 func CustomCreateFormFile(w *multipart.Writer, fieldName string, fileName string, contentType string) (io.Writer, error) {
@@ -169,55 +142,38 @@ func CustomCreateFormFile(w *multipart.Writer, fieldName string, fileName string
 }
 
 func TestUpload(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-
-	// Object Storage not used in Upload Handler but we need to pass one to the server struct
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
-
-	mockDatabase := mocks.NewMockDatabase(mockCtrl)
-
-	// We assume database never returns an error and always gives a valid IP and UUID back
-	mockDatabase.EXPECT().DeviceIPAndUUIDFromName(gomock.Any()).Return("127.0.0.1", "placeholderUUID", nil).AnyTimes()
-
-	// The mocked queue will return nil as error when called with any value
-	mockQueue.EXPECT().SendMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	// We assume database insert message never return an error
-	mockDatabase.EXPECT().InsertMessage(gomock.Any()).Return(nil).AnyTimes()
-
-	router := mux.NewRouter()
-
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
-
-	var tc = []struct {
-		body               []byte
-		contentType        string
-		expectedStatusCode int
-		testName           string
-	}{
-		{[]byte(`placeholder`), "text/plain", http.StatusBadRequest, "Invalid content type"},
-		{[]byte(`()!!)(""·!!))`), "application/json", http.StatusBadRequest, "Invalid JSON format"},
-		{[]byte(`{"DeviceName" : "device", "type":"JOB", "UploadInfo":"Jobs"}`), "application/json", http.StatusBadRequest, "Invalid Type field"},
-		{[]byte(`{"type":"UPLOAD", "UploadInfo":"Jobs"}`), "application/json", http.StatusBadRequest, "Missing device name field"},
-		{[]byte(`{"DeviceName" : "device", "type":"UPLOAD", "UploadInfo":"placeholder"}`), "application/json", http.StatusBadRequest, "Invalid Upload Info field"},
-		{[]byte(`{"DeviceName" : "device", "type":"UPLOAD", "UploadInfo":"Jobs"}`), "application/json", http.StatusOK, "Good request"},
-	}
-
-	for i, tt := range tc {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			req := httptest.NewRequest("POST", "/upload", bytes.NewBuffer(tt.body))
-			req.Header.Set("Content-Type", tt.contentType)
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-		})
-	}
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+
+		var tc = []struct {
+			body               []byte
+			contentType        string
+			expectedStatusCode int
+			testName           string
+		}{
+			{[]byte(`placeholder`), "text/plain", http.StatusBadRequest, "Invalid content type"},
+			{[]byte(`()!!)(""·!!))`), "application/json", http.StatusBadRequest, "Invalid JSON format"},
+			{[]byte(`{"DeviceName" : "device", "type":"JOB", "UploadInfo":"Jobs"}`), "application/json", http.StatusBadRequest, "Invalid Type field"},
+			{[]byte(`{"type":"UPLOAD", "UploadInfo":"Jobs"}`), "application/json", http.StatusBadRequest, "Missing device name field"},
+			{[]byte(`{"DeviceName" : "device", "type":"UPLOAD", "UploadInfo":"placeholder"}`), "application/json", http.StatusBadRequest, "Invalid Upload Info field"},
+			{[]byte(`{"DeviceName" : "unknown", "type":"UPLOAD", "UploadInfo":"Jobs"}`), "application/json", http.StatusBadRequest, "Unknown device"},
+			{[]byte(`{"DeviceName" : "device", "type":"UPLOAD", "UploadInfo":"Jobs"}`), "application/json", http.StatusOK, "Good request"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/upload", bytes.NewBuffer(tt.body))
+				req.Header.Set("Content-Type", tt.contentType)
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+	})
 }
 
 func TestUploadIdentification(t *testing.T) {
@@ -229,7 +185,7 @@ func TestUploadIdentification(t *testing.T) {
 	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
 
 	// The mocked object storage will return nil as error when called with any values
-	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	router := mux.NewRouter()
 
@@ -273,7 +229,7 @@ func TestUploadJobs(t *testing.T) {
 	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
 
 	// The mocked object storage will return nil as error when called with any values
-	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockObjStorage.EXPECT().UploadFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	router := mux.NewRouter()
 
@@ -338,7 +294,7 @@ func TestAvailableInformation(t *testing.T) {
 	for i, tt := range tc {
 		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
 
-			mockObjStorage.EXPECT().AvailableInformation().Return(validInformation, tt.returnedError).Times(1)
+			mockObjStorage.EXPECT().AvailableInformation(gomock.Any()).Return(validInformation, tt.returnedError).Times(1)
 			req := httptest.NewRequest("GET", "/availableInformation", nil)
 
 			w := httptest.NewRecorder()
@@ -382,7 +338,7 @@ func TestGetInformationFile(t *testing.T) {
 	for i, tt := range tc {
 		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
 			if tt.usesObjStorage {
-				mockObjStorage.EXPECT().GetFile(gomock.Any(), gomock.Any()).Return(tt.GetFileMockReturnedError).Times(1)
+				mockObjStorage.EXPECT().GetFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(tt.GetFileMockReturnedError).Times(1)
 			}
 
 			req := httptest.NewRequest("GET", "/getInformationFile"+tt.requestAdditionalPath, nil)
@@ -397,206 +353,296 @@ func TestGetInformationFile(t *testing.T) {
 }
 
 func TestGetPublicDevices(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		// every case inserts its device, if any, before getting the devices
+		var tc = []struct {
+			device               []byte
+			expectedStatusCode   int
+			expectedResponseBody []byte
+			testName             string
+		}{
+			{nil, 200, []byte(`[]`), "OK no devices"},
+			{[]byte(`{"IP":"127.0.0.1","Name":"deviceFullName","Model":"deviceFullModel"}`), 200, []byte(`[{"Name":"deviceFullName","Model":"deviceFullModel"}]`), "OK with devices"},
+			{[]byte(`{"IP":"127.0.0.2","Name":"deviceNoModelName"}`), 200, []byte(`[{"Name":"deviceFullName","Model":"deviceFullModel"},{"Name":"deviceNoModelName"}]`), "OK with devices without model"},
+		}
+
+		for i, tt := range tc {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				if tt.device != nil {
+					doRequest(server, "POST", "/devices", "application/json", tt.device)
+				}
+				req := httptest.NewRequest("GET", "/getPublicDevices", bytes.NewBuffer(nil))
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+				body, _ := io.ReadAll(w.Result().Body)
+				if string(body) != string(tt.expectedResponseBody) {
+					t.Errorf("Expected response body %v, got %v", string(tt.expectedResponseBody), string(body))
+				}
+			})
+		}
+	})
+}
+
+// TestGetPublicDevicesDatabaseError uses a mocked database, as the implementations cannot be made to fail
+func TestGetPublicDevicesDatabaseError(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-
-	// Object Storage not used in Upload Handler but we need to pass one to the server struct
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
-
 	mockDatabase := mocks.NewMockDatabase(mockCtrl)
+	mockDatabase.EXPECT().GetDevices(gomock.Any()).Return([]types.Device{}, fmt.Errorf("error")).Times(1)
 
-	router := mux.NewRouter()
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
-
-	deviceEmpty := types.Device{}
+	server := newTestServer(t, mockDatabase)
 
-	deviceFull := types.Device{
-		IP:         "placeholder",
-		DeviceUUID: "placeholder",
-		Name:       "deviceFullName",
-		Model:      "deviceFullModel",
-	}
-
-	deviceNoModel := types.Device{
-		IP:         "placeholder",
-		DeviceUUID: "placeholder",
-		Name:       "deviceNoModelName",
+	w := doRequest(server, "GET", "/getPublicDevices", "", nil)
+	if w.Result().StatusCode != http.StatusInternalServerError || w.Body.Len() != 0 {
+		t.Errorf("Expected code %v without body, got %v and %s", http.StatusInternalServerError, w.Result().StatusCode, w.Body.String())
 	}
+}
 
-	// function utils.DevicesToPublicJSON is tested on its own so we assume here that it works fine
+func TestNewDevice(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		var testCasesNoDBinvolved = []struct {
+			body               []byte
+			contentType        string
+			expectedStatusCode int
+			testName           string
+		}{
+			{[]byte(`placeholder`), "text/plain", http.StatusBadRequest, "Invalid content type"},
+			{[]byte(`()!!)(""·!!))`), "application/json", http.StatusBadRequest, "Invalid JSON format"},
+			{[]byte(`{"Name":"devName"}`), "application/json", http.StatusBadRequest, "Missing device IP field"},
+			{[]byte(`{"IP":"127.0.0.1"}`), "application/json", http.StatusBadRequest, "Missing device name field"},
+			{[]byte(`{"IP":"123456789","Name":"devName"}`), "application/json", http.StatusBadRequest, "Invalid IP provided"},
+		}
+
+		for i, tt := range testCasesNoDBinvolved {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/devices", bytes.NewBuffer(tt.body))
+				req.Header.Set("Content-Type", tt.contentType)
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		var testCasesDBinvolved = []struct {
+			body               []byte
+			contentType        string
+			expectedStatusCode int
+			testName           string
+		}{
+			{[]byte(`{"IP":"127.0.0.1","Name":"devName"}`), "application/json", http.StatusOK, "Device inserted correctly"},
+			{[]byte(`{"IP":"127.0.0.1","Name":"devName"}`), "application/json", http.StatusBadRequest, "Device already exists"},
+			{[]byte(`{"IP":"127.0.0.2","Name":"devName"}`), "application/json", http.StatusBadRequest, "Device with same name already exists"},
+			{[]byte(`{"IP":"127.0.0.1","Name":"otherName"}`), "application/json", http.StatusBadRequest, "Device with same IP already exists"},
+		}
+
+		for i, tt := range testCasesDBinvolved {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/devices", bytes.NewBuffer(tt.body))
+				req.Header.Set("Content-Type", tt.contentType)
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		devices, err := db.GetDevices(context.Background())
+		if err != nil || len(devices) != 1 {
+			t.Errorf("Expected only the first device to be inserted, got %+v and error %v", devices, err)
+		}
+	})
+}
 
+func TestNewServerAcceptUnsigned(t *testing.T) {
 	var tc = []struct {
-		returnedDevices      []types.Device
-		databaseError        error
-		expectedStatusCode   int
-		expectedResponseBody []byte
-		testName             string
+		value          string
+		acceptUnsigned bool
+		panics         bool
+		testName       string
 	}{
-		{[]types.Device{}, nil, 200, []byte(utils.DevicesToPublicJSON([]types.Device{})), "OK no devices"},
-		{[]types.Device{deviceEmpty, deviceFull, deviceNoModel}, nil, 200, []byte(utils.DevicesToPublicJSON([]types.Device{deviceEmpty, deviceFull, deviceNoModel})), "OK with devices"},
-		{[]types.Device{}, fmt.Errorf("error"), 500, []byte{}, "Server error"},
+		{"", false, false, "Not set"},
+		{"true", true, false, "Accepting unsigned results"},
+		{"false", false, false, "Rejecting unsigned results"},
+		{"sometimes", false, true, "Invalid value"},
 	}
 
 	for i, tt := range tc {
 		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			mockDatabase.EXPECT().GetDevices().Return(tt.returnedDevices, tt.databaseError).Times(1)
-			req := httptest.NewRequest("GET", "/getPublicDevices", bytes.NewBuffer(nil))
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-			body, _ := io.ReadAll(w.Result().Body)
-			if string(body) != string(tt.expectedResponseBody) {
-				t.Errorf("Expected response body %v, got %v", string(tt.expectedResponseBody), string(body))
-			}
-		})
-	}
-}
+			t.Setenv("SERVER_URL", "http://localhost:12345")
+			t.Setenv("ACCEPT_UNSIGNED_RESULTS", tt.value)
 
-func TestNewDevice(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
-
-	mockDatabase := mocks.NewMockDatabase(mockCtrl)
-
-	router := mux.NewRouter()
-
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
-
-	var testCasesNoDBinvolved = []struct {
-		body               []byte
-		contentType        string
-		expectedStatusCode int
-		testName           string
-	}{
-		{[]byte(`placeholder`), "text/plain", http.StatusBadRequest, "Invalid content type"},
-		{[]byte(`()!!)(""·!!))`), "application/json", http.StatusBadRequest, "Invalid JSON format"},
-		{[]byte(`{"Name":"devName"}`), "application/json", http.StatusBadRequest, "Missing device IP field"},
-		{[]byte(`{"IP":"127.0.0.1"}`), "application/json", http.StatusBadRequest, "Missing device name field"},
-		{[]byte(`{"IP":"123456789","Name":"devName"}`), "application/json", http.StatusBadRequest, "Invalid IP provided"},
-	}
+			defer func() {
+				if panicked := recover() != nil; panicked != tt.panics {
+					t.Errorf("Expected panic: %v", tt.panics)
+				}
+			}()
 
-	for i, tt := range testCasesNoDBinvolved {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			req := httptest.NewRequest("POST", "/devices", bytes.NewBuffer(tt.body))
-			req.Header.Set("Content-Type", tt.contentType)
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+			server := NewServer(nil, nil, nil, mux.NewRouter())
+			if server.acceptUnsigned != tt.acceptUnsigned {
+				t.Errorf("Expected acceptUnsigned %v, got %v", tt.acceptUnsigned, server.acceptUnsigned)
 			}
 		})
 	}
+}
 
-	var testCasesDBinvolved = []struct {
-		body               []byte
-		contentType        string
-		expectedStatusCode int
-		alreadyExists      bool
-		insertError        error
-		testName           string
-	}{
-		{[]byte(`{"IP":"127.0.0.1","Name":"devName"}`), "application/json", http.StatusBadRequest, true, fmt.Errorf("Device already exists"), "Device already exists"},
-		{[]byte(`{"IP":"127.0.0.1","Name":"devName"}`), "application/json", http.StatusOK, false, nil, "Device inserted correctly"},
-	}
-
-	for i, tt := range testCasesDBinvolved {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			mockDatabase.EXPECT().DeviceExistWithNameAndIP(gomock.Any(), gomock.Any()).Return(tt.alreadyExists, nil).Times(1)
-
-			if !tt.alreadyExists {
-				mockDatabase.EXPECT().InsertDevice(gomock.Any()).Return(tt.insertError).Times(1)
+func TestReceiveResponse(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db database.Database) {
+		server := newTestServer(t, db)
+
+		var testCasesNoDBinvolved = []struct {
+			contentType        string
+			deviceUUID         string
+			messageUUID        string
+			body               []byte
+			expectedStatusCode int
+			testName           string
+		}{
+			{"text/plain", "placeholderDeviceUUID", "placeholderMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid content type"},
+			{"application/json", "invalidDeviceUUID", "placeholderMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid device UUID"},
+			{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "invalidMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid message UUID"},
+			{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`()!!)(""·!!))`), http.StatusBadRequest, "Invalid JSON provided as body"},
+			{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS"}`), http.StatusBadRequest, "Missing Timestamp in body"},
+			{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Timestamp": 1650795291931}`), http.StatusBadRequest, "Missing Result in body"},
+			{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS", "Timestamp": "invalidTimestamp"}`), http.StatusBadRequest, "Invalid timestamp in body"},
+		}
+
+		for i, tt := range testCasesNoDBinvolved {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				url := "/responses" + "/" + tt.deviceUUID + "/" + tt.messageUUID
+				req := httptest.NewRequest("POST", url, bytes.NewBuffer(tt.body))
+				req.Header.Set("Content-Type", tt.contentType)
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		doRequest(server, "POST", "/devices", "application/json", []byte(`{"IP":"127.0.0.1","Name":"device"}`))
+		devices, _ := db.GetDevices(context.Background())
+		deviceUUID := devices[0].DeviceUUID
+
+		// messages sent by older backends do not have a secret to sign their results
+		legacyUUID := "222c4951-31ba-4f8c-bca8-b17528810ee9"
+		signedUUID := "333c4951-31ba-4f8c-bca8-b17528810ee9"
+		for _, msg := range []types.MessageDB{
+			{DeviceUUID: deviceUUID, MessageUUID: legacyUUID, Type: "HEARTBEAT", Timestamp: 1650795291000},
+			{DeviceUUID: deviceUUID, MessageUUID: signedUUID, Type: "HEARTBEAT", Timestamp: 1650795291000, ResultSecret: "secret"},
+		} {
+			if err := db.InsertMessage(context.Background(), msg); err != nil {
+				t.Fatal(err)
 			}
-
-			req := httptest.NewRequest("POST", "/devices", bytes.NewBuffer(tt.body))
-			req.Header.Set("Content-Type", tt.contentType)
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+		}
+
+		body := []byte(`{"Result":"SUCCESS", "Timestamp": 1650795291931}`)
+		now := time.Now()
+
+		var testCasesDBinvolved = []struct {
+			messageUUID        string
+			signature          string
+			acceptUnsigned     bool
+			expectedStatusCode int
+			testName           string
+		}{
+			{legacyUUID, "", false, http.StatusUnauthorized, "Message without secret"},
+			{legacyUUID, "", true, http.StatusOK, "All good with message without secret accepting unsigned results"},
+			{"444c4951-31ba-4f8c-bca8-b17528810ee9", "", false, http.StatusBadRequest, "Unknown message"},
+			{signedUUID, auth.Sign("secret", now, body), false, http.StatusOK, "All good with signed result"},
+			{signedUUID, "", false, http.StatusUnauthorized, "Missing signature"},
+			{signedUUID, "", true, http.StatusUnauthorized, "Missing signature accepting unsigned results"},
+			{signedUUID, auth.Sign("other", now, body), false, http.StatusUnauthorized, "Signed with other secret"},
+			{signedUUID, auth.Sign("secret", now, []byte(`{"Result":"FAILURE", "Timestamp": 1650795291931}`)), false, http.StatusUnauthorized, "Signature of other body"},
+			{signedUUID, auth.Sign("secret", now.Add(-time.Hour), body), false, http.StatusUnauthorized, "Replayed result"},
+		}
+
+		for i, tt := range testCasesDBinvolved {
+			t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+				server.acceptUnsigned = tt.acceptUnsigned
+				url := "/responses" + "/" + deviceUUID + "/" + tt.messageUUID
+				req := httptest.NewRequest("POST", url, bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				if tt.signature != "" {
+					req.Header.Set(auth.SignatureHeader, tt.signature)
+				}
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+				if w.Result().StatusCode != tt.expectedStatusCode {
+					t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
+				}
+			})
+		}
+
+		// only the accepted results are stored
+		for _, messageUUID := range []string{legacyUUID, signedUUID} {
+			responses, err := db.GetResponsesFromMessage(context.Background(), deviceUUID, messageUUID)
+			if err != nil || len(responses) != 1 || responses[0].Result != "SUCCESS" {
+				t.Errorf("Expected one result of message %v, got %+v and error %v", messageUUID, responses, err)
 			}
-		})
-	}
+		}
+	})
 }
 
-func TestReceiveResponse(t *testing.T) {
+// TestReceiveResponseDatabaseError uses a mocked database, as the implementations cannot be made to fail
+func TestReceiveResponseDatabaseError(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	mockQueue := mocks.NewMockQueue(mockCtrl)
-
-	mockObjStorage := mocks.NewMockObjStorage(mockCtrl)
+	deviceUUID := "111c4951-31ba-4f8c-bca8-b17528810ee9"
+	messageUUID := "111c4951-31ba-4f8c-bca8-b17528810ee9"
+	body := []byte(`{"Result":"SUCCESS", "Timestamp": 1650795291931}`)
 
 	mockDatabase := mocks.NewMockDatabase(mockCtrl)
+	mockDatabase.EXPECT().GetMessage(gomock.Any(), deviceUUID, messageUUID).Return(types.MessageDB{DeviceUUID: deviceUUID, MessageUUID: messageUUID, ResultSecret: "secret"}, nil).Times(1)
+	mockDatabase.EXPECT().InsertResult(gomock.Any(), gomock.Any()).Return(fmt.Errorf("Server error")).Times(1)
+
+	server := newTestServer(t, mockDatabase)
+
+	req := httptest.NewRequest("POST", "/responses/"+deviceUUID+"/"+messageUUID, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.SignatureHeader, auth.Sign("secret", time.Now(), body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected code %v, got %v", http.StatusInternalServerError, w.Result().StatusCode)
+	}
+}
 
-	router := mux.NewRouter()
+// TestAuthorizeUUIDDatabaseError uses a mocked database, as the implementations cannot be made to fail
+func TestAuthorizeUUIDDatabaseError(t *testing.T) {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("AUTH_JWKS_FILE", "")
 
-	server := NewServer(mockQueue, mockObjStorage, mockDatabase, router)
-	server.Routes()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
 
-	var testCasesNoDBinvolved = []struct {
-		contentType        string
-		deviceUUID         string
-		messageUUID        string
-		body               []byte
-		expectedStatusCode int
-		testName           string
-	}{
-		{"text/plain", "placeholderDeviceUUID", "placeholderMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid content type"},
-		{"application/json", "invalidDeviceUUID", "placeholderMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid device UUID"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "invalidMessageUUID", []byte(`placeholder`), http.StatusBadRequest, "Invalid message UUID"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`()!!)(""·!!))`), http.StatusBadRequest, "Invalid JSON provided as body"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS"}`), http.StatusBadRequest, "Missing Timestamp in body"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Timestamp": 1650795291931}`), http.StatusBadRequest, "Missing Result in body"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS", "Timestamp": "invalidTimestamp"}`), http.StatusBadRequest, "Invalid timestamp in body"},
-	}
+	deviceUUID := "111c4951-31ba-4f8c-bca8-b17528810ee9"
+	identity := auth.Identity{Method: auth.MethodAPIKey, Subject: "key"}
 
-	for i, tt := range testCasesNoDBinvolved {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			url := "/responses" + "/" + tt.deviceUUID + "/" + tt.messageUUID
-			req := httptest.NewRequest("POST", url, bytes.NewBuffer(tt.body))
-			req.Header.Set("Content-Type", tt.contentType)
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-		})
-	}
+	// the group of the device is needed, as the caller only has grants on a group, and the denied action
+	// cannot be audited without knowing it
+	mockDatabase := mocks.NewMockDatabase(mockCtrl)
+	mockDatabase.EXPECT().GetGrantsOfSubject(gomock.Any(), identity.String()).Return([]types.Grant{{Subject: identity.String(), Role: auth.RoleAdmin, Scope: auth.GroupScope("lab")}}, nil)
+	mockDatabase.EXPECT().GetDeviceByUUID(gomock.Any(), deviceUUID).Return(types.Device{}, fmt.Errorf("error"))
+	mockDatabase.EXPECT().InsertAuditEntry(gomock.Any(), gomock.Any()).Times(0)
 
-	var testCasesDBinvolved = []struct {
-		contentType        string
-		deviceUUID         string
-		messageUUID        string
-		body               []byte
-		expectedStatusCode int
-		insertError        error
-		testName           string
-	}{
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS", "Timestamp": 1650795291931}`), http.StatusInternalServerError, fmt.Errorf("Server error"), "Error while inserting result"},
-		{"application/json", "111c4951-31ba-4f8c-bca8-b17528810ee9", "111c4951-31ba-4f8c-bca8-b17528810ee9", []byte(`{"Result":"SUCCESS", "Timestamp": 1650795291931}`), http.StatusOK, nil, "All good"}}
+	server := newTestServer(t, mockDatabase)
 
-	for i, tt := range testCasesDBinvolved {
-		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
-			url := "/responses" + "/" + tt.deviceUUID + "/" + tt.messageUUID
-			mockDatabase.EXPECT().InsertResult(gomock.Any()).Return(tt.insertError).Times(1)
-			req := httptest.NewRequest("POST", url, bytes.NewBuffer(tt.body))
-			req.Header.Set("Content-Type", tt.contentType)
-			w := httptest.NewRecorder()
-			server.router.ServeHTTP(w, req)
-			if w.Result().StatusCode != tt.expectedStatusCode {
-				t.Errorf("Expected code %v, got %v", tt.expectedStatusCode, w.Result().StatusCode)
-			}
-		})
+	req := httptest.NewRequest("GET", "/messages/"+deviceUUID, nil)
+	req = req.WithContext(auth.WithIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	if server.authorizeUUID(w, req, auth.RoleViewer, deviceUUID) || w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the caller not to be allowed with code %v, got %v", http.StatusInternalServerError, w.Code)
 	}
-
 }
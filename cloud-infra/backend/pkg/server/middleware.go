@@ -0,0 +1,42 @@
+package server
+
+import (
+	"backend/pkg/auth"
+	"net/http"
+)
+
+// cors is the middleware adding the CORS headers to every response. The origin of the request is allowed
+// if it is one of the allowed origins, or every origin is allowed with "*"
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		for _, allowed := range s.allowedOrigins {
+			if allowed == "*" {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				break
+			}
+
+			if allowed == origin {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+				break
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isPublic returns whether the received request is handled without authentication.
+// Only the root, used to check that the backend is working, is public
+func isPublic(r *http.Request) bool {
+	return r.URL.Path == "/"
+}
+
+// caller returns the identity of the caller of the received request as stored with the messages,
+// empty if authentication is disabled
+func caller(r *http.Request) string {
+	identity, _ := auth.FromContext(r.Context())
+	return identity.String()
+}
@@ -5,11 +5,15 @@ import (
 	"net/http"
 )
 
-// Routes defines the different endpoints the backend will have and assign the handlers to them
+// Routes defines the different endpoints the backend will have and assign the handlers to them.
+// Every request goes through the CORS middleware and then the authentication one
 func (s *Server) Routes() {
+	s.router.Use(s.cors, s.authenticator.Middleware(isPublic))
+
 	s.router.HandleFunc("/", hello)
 	s.router.HandleFunc("/heartbeat", s.Heartbeat).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/job", s.Job).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/job/uploads", s.JobUploads).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/upload", s.Upload).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/uploadIdentification", s.UploadIdentification).Methods("POST")
 	s.router.HandleFunc("/uploadJobs", s.UploadJobs).Methods("POST")
@@ -29,6 +33,32 @@ func (s *Server) Routes() {
 	s.router.HandleFunc("/devices/{uuid}", s.DeleteDevice).Methods("DELETE")
 	s.router.HandleFunc("/devices/{uuid}", s.UpdateDevice).Methods("PUT")
 
+	// CRUD funtionality for the material catalog
+	s.router.HandleFunc("/materials", s.MaterialsCRUDOptionsHandler).Methods("OPTIONS")
+	s.router.HandleFunc("/materials/{name}", s.MaterialsCRUDOptionsHandler).Methods("OPTIONS")
+
+	s.router.HandleFunc("/materials", s.GetMaterials).Methods("GET")
+	s.router.HandleFunc("/materials/{name}", s.GetMaterial).Methods("GET")
+	s.router.HandleFunc("/materials/{name}", s.PutMaterial).Methods("PUT")
+	s.router.HandleFunc("/materials/{name}", s.DeleteMaterial).Methods("DELETE")
+
+	// API keys management
+	s.router.HandleFunc("/auth/keys", s.APIKeysOptionsHandler).Methods("OPTIONS")
+	s.router.HandleFunc("/auth/keys/{id}", s.APIKeysOptionsHandler).Methods("OPTIONS")
+
+	s.router.HandleFunc("/auth/keys", s.GetAPIKeys).Methods("GET")
+	s.router.HandleFunc("/auth/keys", s.CreateAPIKey).Methods("POST")
+	s.router.HandleFunc("/auth/keys/{id}", s.RevokeAPIKey).Methods("DELETE")
+
+	// roles granted to the callers on the devices, and the actions denied because of them
+	s.router.HandleFunc("/auth/grants", s.GrantsOptionsHandler).Methods("OPTIONS")
+	s.router.HandleFunc("/auth/grants/{id}", s.GrantsOptionsHandler).Methods("OPTIONS")
+
+	s.router.HandleFunc("/auth/grants", s.GetGrants).Methods("GET")
+	s.router.HandleFunc("/auth/grants", s.CreateGrant).Methods("POST")
+	s.router.HandleFunc("/auth/grants/{id}", s.DeleteGrant).Methods("DELETE")
+	s.router.HandleFunc("/auth/audit", s.AuditEntries).Methods("GET", "OPTIONS")
+
 	//Receives responses from the On Premise indicating the result of serving a message to the corresponding device
 	s.router.HandleFunc("/responses/{deviceUUID}/{messageUUID}", s.ReceiveResponse).Methods("POST")
 
@@ -38,13 +68,14 @@ func (s *Server) Routes() {
 	//Returns all messages from the corresponding device
 	s.router.HandleFunc("/messages/{deviceUUID}", s.DeviceMessages).Methods("GET", "OPTIONS")
 
+	//Returns the objects and messages that the retention sweeper would delete now, without deleting them
+	s.router.HandleFunc("/retention/report", s.RetentionReport).Methods("GET", "OPTIONS")
+
 	// this are test handlers used to test UI without making unnecesary calls to AWS services
 	s.router.HandleFunc("/testjobs", s.TestJobs).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/testidentification", s.TestIdentification).Methods("GET", "OPTIONS")
 }
 
 func hello(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	fmt.Fprintf(w, "Working")
 }
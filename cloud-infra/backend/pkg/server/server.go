@@ -1,44 +1,151 @@
 package server
 
 import (
+	"backend/pkg/auth"
 	"backend/pkg/database"
 	objstorage "backend/pkg/obj_storage"
 	"backend/pkg/queue"
-	"log"
+	"backend/pkg/retention"
+	"context"
+	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // Server is the struct used to set up the device API.
-// It contains a queue and object storage implementation, a rotuer and its own public URL
+// It contains a queue and object storage implementation, a rotuer and its own public URL,
+// the time the URLs sent to the On-Premise agent to download job files are valid,
+// the authenticator of the requests and the origins allowed to make cross-origin requests
 type Server struct {
-	queue      queue.Queue
-	objStorage objstorage.ObjStorage
-	database   database.Database
-	router     *mux.Router
-	serverURL  string
+	queue          queue.Queue
+	objStorage     objstorage.ObjStorage
+	database       database.Database
+	router         *mux.Router
+	serverURL      string
+	retention      *retention.Sweeper
+	presignExpiry  time.Duration
+	authenticator  *auth.Authenticator
+	allowedOrigins []string
+	// resultTolerance is how old, or how far in the future, the signature of the results can be
+	resultTolerance time.Duration
+	// acceptUnsigned makes the results of messages without a secret, sent by older backends, be accepted unsigned
+	acceptUnsigned bool
 }
 
+// defaultPresignExpiry is the time presigned URLs are valid if PRESIGN_EXPIRY is not set.
+// It covers the retries of the agent, which cannot download the file once the URL expires
+const defaultPresignExpiry = 24 * time.Hour
+
+// maxPresignExpiry is the longest expiry allowed by S3 for presigned URLs
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// defaultResultTolerance is the tolerance window of the signature of the results if RESULT_SIGNATURE_TOLERANCE is not set.
+// It covers the clock skew between the backend and the agents and the time the request takes
+const defaultResultTolerance = 5 * time.Minute
+
 // NewServer creates and returns the reference to a new Server struct
-// It sets the serverURL field to the corresponding Environment variable value, and panics if it not present
+// It sets the serverURL field to the corresponding Environment variable value, and panics if it not present.
+// The retention policy is read from the environment with retention.PolicyFromEnv, and the expiry of presigned URLs
+// from PRESIGN_EXPIRY, a duration such as "12h". It panics if it is not valid.
+// Requests are authenticated as configured in auth.NewAuthenticator, and the origins allowed to make cross-origin
+// requests are read from CORS_ALLOWED_ORIGINS, a comma-separated list, every origin being allowed if it is not set.
+// The tolerance window of the signature of the results is read from RESULT_SIGNATURE_TOLERANCE, a duration such as "5m",
+// and the results of messages sent by older backends, which cannot be signed, are only accepted if ACCEPT_UNSIGNED_RESULTS is true
 func NewServer(queue queue.Queue, objStorage objstorage.ObjStorage, database database.Database, router *mux.Router) *Server {
 	url, ok := os.LookupEnv("SERVER_URL")
 	if !ok {
 		panic("Environment variable SERVER_URL does not exist")
 	}
 
+	presignExpiry := defaultPresignExpiry
+	if value, ok := os.LookupEnv("PRESIGN_EXPIRY"); ok && value != "" {
+		var err error
+		presignExpiry, err = time.ParseDuration(value)
+		if err != nil || presignExpiry <= 0 || presignExpiry > maxPresignExpiry {
+			panic(fmt.Sprintf("Invalid PRESIGN_EXPIRY value: %v", value))
+		}
+	}
+
+	resultTolerance := defaultResultTolerance
+	if value, ok := os.LookupEnv("RESULT_SIGNATURE_TOLERANCE"); ok && value != "" {
+		var err error
+		resultTolerance, err = time.ParseDuration(value)
+		if err != nil || resultTolerance <= 0 {
+			panic(fmt.Sprintf("Invalid RESULT_SIGNATURE_TOLERANCE value: %v", value))
+		}
+	}
+
+	acceptUnsigned := false
+	if value := os.Getenv("ACCEPT_UNSIGNED_RESULTS"); value != "" {
+		var err error
+		acceptUnsigned, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid ACCEPT_UNSIGNED_RESULTS %q: %v", value, err))
+		}
+	}
+
+	allowedOrigins := []string{"*"}
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok && strings.TrimSpace(value) != "" {
+		allowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				allowedOrigins = append(allowedOrigins, origin)
+			}
+		}
+	}
+
 	s := &Server{
-		router:     router,
-		queue:      queue,
-		objStorage: objStorage,
-		database:   database,
-		serverURL:  url}
+		router:          router,
+		queue:           queue,
+		objStorage:      objStorage,
+		database:        database,
+		serverURL:       url,
+		retention:       retention.NewSweeper(objStorage, database, retention.PolicyFromEnv()),
+		presignExpiry:   presignExpiry,
+		authenticator:   auth.NewAuthenticator(database),
+		allowedOrigins:  allowedOrigins,
+		resultTolerance: resultTolerance,
+		acceptUnsigned:  acceptUnsigned}
 	return s
 }
 
-// ListenAndServe makes the server router listen so that the API endpoints are available
-func (s *Server) ListenAndServe() {
-	log.Fatal(http.ListenAndServe(":12345", s.router))
+// ListenAndServe makes the server router listen so that the API endpoints are available, and runs the retention sweeper
+// and the reload of the JWKS file, until ctx is cancelled. Then it stops accepting requests and waits up to shutdownTimeout for the ones being handled
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) ListenAndServe(ctx context.Context, shutdownTimeout time.Duration) error {
+	httpServer := &http.Server{
+		Addr:    ":12345",
+		Handler: s.router,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	go s.retention.Run(ctx)
+	go s.authenticator.Run(ctx)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("error while serving the API: %w", err)
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down, waiting for requests being handled...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("error while shutting down the server: %w", err)
+	}
+
+	return nil
 }
@@ -11,10 +11,44 @@ type Message struct {
 	IPAddress   string `json:"IPAddress,omitempty"`
 	UploadInfo  string `json:"UploadInfo,omitempty"`
 	UploadURL   string `json:"UploadURL,omitempty"`
+	DownloadURL string `json:"DownloadURL,omitempty"`
 	DeviceName  string `json:"DeviceName"`
 	DeviceUUID  string `json:"DeviceUUID,omitempty"`
 	MessageUUID string `json:"MessageUUID,omitempty"`
 	ResultURL   string `json:"ResultURL,omitempty"`
+	SHA256      string `json:"SHA256,omitempty"`
+	UploadID    string `json:"UploadID,omitempty"`
+	// ResultSecret is the secret used by the On-Premise agent to sign the results of the message
+	ResultSecret string `json:"ResultSecret,omitempty"`
+}
+
+// JobUploadRequest struct represents the file that a client wants to upload directly to the object storage
+// before sending it in a job. Size is the number of bytes of the file
+type JobUploadRequest struct {
+	FileName string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// JobUpload struct represents where the file of a JobUploadRequest has to be uploaded.
+// Small files are uploaded with a single PUT request to URL. Bigger files are split in parts of PartSize bytes,
+// the last one can be smaller, and every part is uploaded with a PUT request to the URL in PartURLs with its index.
+// The URLs are valid until Expires, the number of milliseconds elapsed since January 1, 1970 UTC.
+// Once uploaded, the file is sent in a job including the UploadID in the message
+type JobUpload struct {
+	UploadID string
+	URL      string   `json:",omitempty"`
+	PartSize int64    `json:",omitempty"`
+	PartURLs []string `json:",omitempty"`
+	Expires  int64
+}
+
+// StagedUpload struct represents what the backend expects to find once the file of a JobUpload is uploaded:
+// the name of the file in the object storage, its Size in bytes and the number of Parts of a multipart upload,
+// 0 if it is uploaded with a single request. It is stored next to the file until it is sent in a job
+type StagedUpload struct {
+	Key   string
+	Size  int64
+	Parts int
 }
 
 // Information struct represents the names of the available files with information about the devices
@@ -31,9 +65,53 @@ type Device struct {
 	IP         string `json:"IP"`
 	Name       string `json:"Name"`
 	Model      string `json:"Model,omitempty"`
+	// Group is the group, such as the site, the device belongs to, used to grant access to all its devices at once
+	Group      string `json:"Group,omitempty"`
 	LastResult string `json:"LastResult,omitempty"`
 }
 
+// Material struct represents a material of the catalog, with its Density in grams per cubic centimeter,
+// used to estimate the mass of the parts printed with it, and the Models of the devices compatible with it.
+// The model "*" means that every device is compatible with the material
+type Material struct {
+	Name    string   `json:"Name"`
+	Density float64  `json:"Density"`
+	Models  []string `json:"Models"`
+}
+
+// APIKey struct represents an API key used to authenticate requests to the backend. Only the SHA-256 Hash of its
+// secret is stored, the key itself is returned once when it is created. RevokedAt is 0 while the key is valid
+type APIKey struct {
+	KeyID     string `json:"KeyID"`
+	Name      string `json:"Name"`
+	Hash      string `json:"-"`
+	CreatedBy string `json:"CreatedBy,omitempty"`
+	CreatedAt int64  `json:"CreatedAt"`
+	RevokedAt int64  `json:"RevokedAt,omitempty"`
+}
+
+// Grant struct represents a Role granted to the caller with the Subject identity, such as "api-key:<id>" or "jwt:<sub>",
+// on the devices of its Scope: "*" for every device, "device:<uuid>" for a device or "group:<name>" for the devices of a group
+type Grant struct {
+	GrantID   string `json:"GrantID"`
+	Subject   string `json:"Subject"`
+	Role      string `json:"Role"`
+	Scope     string `json:"Scope"`
+	CreatedBy string `json:"CreatedBy,omitempty"`
+	CreatedAt int64  `json:"CreatedAt"`
+}
+
+// AuditEntry struct represents an action denied to a caller because it did not have the Role required on the device,
+// or on every device if DeviceUUID is empty. Action is the method and path of the request and Timestamp is in milliseconds
+type AuditEntry struct {
+	EntryID    string `json:"EntryID"`
+	Timestamp  int64  `json:"Timestamp"`
+	Caller     string `json:"Caller"`
+	Action     string `json:"Action"`
+	Role       string `json:"Role"`
+	DeviceUUID string `json:"DeviceUUID,omitempty"`
+}
+
 // Response struct represents the information received from the On-Premise server about the outcome of a message
 type Response struct {
 	Result    string `json:"Result"`
@@ -48,10 +126,52 @@ type MessageDB struct {
 	AdditionalInfo string
 	Timestamp      int64
 	LastResult     string
+	// Analysis is the analysis of the meshes of the file sent in jobs, if any
+	Analysis *MeshAnalysis `json:",omitempty"`
+	// Caller is the identity of the API key or token used to send the message, empty if authentication is disabled
+	Caller string `json:",omitempty"`
+	// ResultSecret is the secret sent with the message to sign its results, never sent in JSON responses
+	ResultSecret string `json:"-"`
 	// this field is only used to read info from DynamoDB and not sent in JSON responses
 	Information string `json:"-"`
 }
 
+// MeshAnalysis struct represents the analysis of the meshes of a job file, with a report for every part of the file,
+// such as every object of a 3MF file or every mesh of a ZIP archive, and the Total of all of them.
+// The Mass of the reports is estimated for the Material of the job
+type MeshAnalysis struct {
+	Material string
+	Parts    []MeshReport
+	Total    MeshReport
+}
+
+// MeshReport struct represents the analysis of a mesh. Min and Max are the corners of its bounding box, in millimeters,
+// Volume is in cubic millimeters, SurfaceArea in square millimeters and Mass in grams.
+// A mesh is Manifold if it has no NonManifoldEdges, shared by more than two triangles or by two triangles with
+// inconsistent orientation, and Watertight if it is also closed, without BoundaryEdges used by a single triangle
+type MeshReport struct {
+	Name             string `json:",omitempty"`
+	Triangles        int
+	Min              [3]float64
+	Max              [3]float64
+	Volume           float64
+	SurfaceArea      float64
+	BoundaryEdges    int
+	NonManifoldEdges int
+	Watertight       bool
+	Manifold         bool
+	Mass             float64
+}
+
+// BuildVolumeError struct represents the body of the response to a job rejected because a part does not fit
+// in the usable platform of the device. PartSize and PlatformSize are the sizes in millimeters in every axis
+type BuildVolumeError struct {
+	Error        string
+	Part         string
+	PartSize     [3]float64
+	PlatformSize [3]float64
+}
+
 // ResultDB struct represents the information about a result that is inserted into the DB
 type ResultDB struct {
 	DeviceUUID  string
@@ -59,3 +179,29 @@ type ResultDB struct {
 	Result      string
 	Timestamp   int64
 }
+
+// FileDB struct represents a job file stored in the object storage and the number of messages that reference it.
+// Timestamp is the last time its references changed, so that files are only garbage-collected some time after
+// they stop being used. Deleting is true once the garbage collection of the file has begun, after which
+// it cannot be referenced again until it is deleted
+type FileDB struct {
+	FileKey    string
+	References int64
+	Timestamp  int64
+	Deleting   bool
+}
+
+// FileReferenceDB struct represents the reference of a message to the job file it sends
+type FileReferenceDB struct {
+	FileKey     string
+	MessageUUID string
+	Timestamp   int64
+}
+
+// ObjectInfo struct represents a file stored in the object storage.
+// LastModified is the number of milliseconds elapsed since January 1, 1970 UTC when it was last written
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified int64
+}
@@ -2,70 +2,143 @@ package utils
 
 import (
 	"backend/pkg/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mesh"
 	"net"
 	"net/http"
 	"path/filepath"
 	"strings"
 	"time"
-
-	"github.com/hschendel/stl"
 )
 
 // BadRequest writes needed headers and status code 400 to the received http.ResponseWriter
 func BadRequest(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.WriteHeader(http.StatusBadRequest)
 }
 
+// BadRequestJSON writes needed headers, status code 400 and the received body encoded as JSON,
+// which describes why the request is not valid, to the received http.ResponseWriter
+func BadRequestJSON(w http.ResponseWriter, body interface{}) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		BadRequest(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	BadRequest(w)
+
+	_, err = w.Write(jsonBody)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
 // OKRequest writes needed headers and status code 200 to the received http.ResponseWriter
 func OKRequest(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Unauthorized writes needed headers and status code 401 to the received http.ResponseWriter
+func Unauthorized(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// Forbidden writes needed headers and status code 403 to the received http.ResponseWriter
+func Forbidden(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
 }
 
 // ServerError writes needed headers and status code 500 to the received http.ResponseWriter
 func ServerError(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.WriteHeader(http.StatusInternalServerError)
 }
 
+// NotImplemented writes needed headers and status code 501 to the received http.ResponseWriter
+func NotImplemented(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// ValidateFileName checks whether a file with the provided name can be valid, before its content is available
+// Returns nil if the name has the extension of a .pdf file or a mesh supported by package mesh and an non-nil error otherwise
+func ValidateFileName(FileName string) error {
+	if filepath.Ext(FileName) == ".pdf" || mesh.Supported(FileName) {
+		return nil
+	}
+
+	return errors.New("invalid file name received")
+}
+
 // ValidateFile checks whether the provided file is valid or not
-// Returns nil if file is a valid .pdf or .stl file and an non-nil error otherwise
+// Returns nil if file is a valid .pdf file, or a valid .stl, .3mf, .obj or .zip file of meshes, and an non-nil error otherwise
 func ValidateFile(file io.ReadSeeker, FileName string, MIMEType string) error {
 
-	switch filepath.Ext(FileName) {
-	case ".pdf":
+	if filepath.Ext(FileName) == ".pdf" {
 		if MIMEType == "application/pdf" {
 			return nil
 		}
-	case ".stl":
-		_, err := stl.ReadAll(file)
-		if err != nil {
-			return err
-		}
-
-		// need to set the reader back to the start of the file
-		_, err = file.Seek(0, 0)
-		return err
+	} else if mesh.Supported(FileName) {
+		// the reader is set back to the start of the file once it is read
+		return mesh.Read(file, FileName, func(string, mesh.Triangle) {})
 	}
 
 	return errors.New("invalid file received")
 }
 
-// ValidateMaterial checks that the provided material is one of the valids one
-// Returns nil if valid and a non-nil error otherwise
-func ValidateMaterial(material string) error {
-	switch material {
-	case "HR PA 11", "HR PA 12GB", "HR TPA", "HR PP", "HR PA 12":
-		return nil
-	default:
-		return errors.New("invalid material received")
+// Checksum returns the hex encoded SHA-256 of the provided file, leaving it at its beginning
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func Checksum(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("error while computing the checksum: %w", err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("error while computing the checksum: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// maxFileNameLength is the maximum length of the sanitized file names used in object keys
+const maxFileNameLength = 128
+
+// SanitizeFileName returns the received file name with every character other than letters, digits, '.', '_' and '-'
+// replaced by '_' and no leading dots, so that it can be used in object keys. Long names are shortened keeping their extension
+func SanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	if strings.HasPrefix(sanitized, ".") {
+		sanitized = "_" + strings.TrimLeft(sanitized, ".")
+	}
+
+	if len(sanitized) > maxFileNameLength {
+		ext := filepath.Ext(sanitized)
+		if len(ext) >= maxFileNameLength {
+			ext = ""
+		}
+		sanitized = sanitized[:maxFileNameLength-len(ext)] + ext
+	}
+
+	if sanitized == "" {
+		return "_"
 	}
+	return sanitized
 }
 
 // ValidateIPAddress checks that the provided IP address is valid
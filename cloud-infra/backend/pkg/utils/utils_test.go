@@ -2,10 +2,10 @@ package utils
 
 import (
 	"backend/pkg/types"
-	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -41,25 +41,46 @@ func TestValidateFile(t *testing.T) {
 	}
 }
 
-func TestValidateMaterial(t *testing.T) {
+func TestValidateFileName(t *testing.T) {
 	var tc = []struct {
-		Material string
-		err      error
+		FileName string
+		valid    bool
 	}{
-		{"HR PA 12GB", nil}, // Valid Material
-		{"plastic", errors.New("invalid material received")}, // Invalid Material
-		{"", errors.New("invalid material received")},        // Empty
+		{"part.stl", true},
+		{"manual.pdf", true},
+		{"build.3mf", true},
+		{"parts.zip", true},
+		{"part.exe", false},
+		{"stl", false},
 	}
 
 	for i, tt := range tc {
 		t.Run(fmt.Sprintf("Test %v", i), func(t *testing.T) {
-			err := ValidateMaterial(tt.Material)
-			fmt.Println(err == nil)
-			if err != nil && (tt.err == nil || err.Error() != tt.err.Error()) {
-				t.Fail()
+			err := ValidateFileName(tt.FileName)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected %v to be valid: %v, got error %v", tt.FileName, tt.valid, err)
 			}
-			if err == nil && tt.err != nil {
-				t.Fail()
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	var tc = []struct {
+		name     string
+		expected string
+	}{
+		{"part.stl", "part.stl"},                 // Valid name
+		{"my part (v2).stl", "my_part__v2_.stl"}, // Spaces and symbols
+		{"piñón.pdf", "pi__n.pdf"},               // Non ASCII characters
+		{"../../etc/passwd", "__.._etc_passwd"},  // Path traversal
+		{"", "_"},                                // Empty
+		{strings.Repeat("a", 200) + ".stl", strings.Repeat("a", 124) + ".stl"}, // Too long
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v", i), func(t *testing.T) {
+			if sanitized := SanitizeFileName(tt.name); sanitized != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, sanitized)
 			}
 		})
 	}
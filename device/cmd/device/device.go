@@ -1,22 +1,59 @@
 package main
 
 import (
+	"context"
 	"device/pkg/api"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-func setUpDevice() {
+func setUpDevice(ctx context.Context, shutdownTimeout time.Duration, materials []string, uploadTTL time.Duration) {
 	fmt.Println("Setting up...")
 	router := mux.NewRouter()
-	server := api.NewServer(router)
+	server := api.NewServer(router, materials, uploadTTL)
+	fmt.Printf("Accepting jobs with materials: %v\n", strings.Join(materials, ", "))
 
 	server.Routes()
 	fmt.Println("Running correctly")
-	server.ListenAndServe()
+	err := server.ListenAndServe(ctx, shutdownTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseMaterials returns the materials of a comma-separated list, or the default ones if it is empty
+func parseMaterials(list string) []string {
+	materials := []string{}
+	for _, material := range strings.Split(list, ",") {
+		material = strings.TrimSpace(material)
+		if material != "" {
+			materials = append(materials, material)
+		}
+	}
+
+	if len(materials) == 0 {
+		return api.DefaultMaterials
+	}
+	return materials
 }
 
 func main() {
-	setUpDevice()
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for requests being handled when SIGINT or SIGTERM is received")
+	uploadTTL := flag.Duration("upload-ttl", 24*time.Hour, "Time after which chunked uploads that receive no chunks are discarded, 0 keeps them until they are completed")
+	materials := flag.String("materials", os.Getenv("DEVICE_MATERIALS"), "Comma-separated materials accepted in jobs, DEVICE_MATERIALS can be used instead. Defaults to "+strings.Join(api.DefaultMaterials, ", "))
+
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	setUpDevice(ctx, *shutdownTimeout, parseMaterials(*materials), *uploadTTL)
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"device/pkg/api"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseMaterials(t *testing.T) {
+	var tc = []struct {
+		list      string
+		materials []string
+		testName  string
+	}{
+		{"HR PA 12", []string{"HR PA 12"}, "One material"},
+		{"HR PA 12,HR TPA", []string{"HR PA 12", "HR TPA"}, "Several materials"},
+		{" HR PA 12 , HR TPA ", []string{"HR PA 12", "HR TPA"}, "Materials with spaces"},
+		{"HR PA 12,,HR TPA,", []string{"HR PA 12", "HR TPA"}, "Empty materials"},
+		{"", api.DefaultMaterials, "Empty list"},
+		{" , ", api.DefaultMaterials, "List without materials"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			materials := parseMaterials(tt.list)
+			if !reflect.DeepEqual(materials, tt.materials) {
+				t.Errorf("Expected %q, got %q", tt.materials, materials)
+			}
+		})
+	}
+}
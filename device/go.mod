@@ -4,5 +4,9 @@ go 1.17
 
 require (
 	github.com/gorilla/mux v1.8.0
-	github.com/hschendel/stl v1.0.4
+	mesh v0.0.0
 )
+
+require github.com/hschendel/stl v1.0.4 // indirect
+
+replace mesh => ../mesh
@@ -1,14 +1,17 @@
 package api
 
 import (
+	"crypto/sha256"
 	"device/pkg/types"
 	"device/pkg/utils"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 )
 
 // Jobs is the handler used with GETS /jobs endpoint
@@ -62,8 +65,9 @@ func (s *Server) Identification(w http.ResponseWriter, r *http.Request) {
 // ReceiveJob is the handler used with POST /job endpoint
 // It receives a Job as a MultipartForm request including JSON data in the 'job' field
 // and a file in the 'file field'
-// It will validate the received information and save the received file in the /receivedFiles folder
-// It will return status code 200 or 400 as appropiate
+// It will validate the received information and save the received file in the /receivedFiles folder.
+// If the job includes the SHA-256 of the file, files not matching it are discarded
+// It will return status code 200, 400 or 422 if the checksum does not match as appropiate
 func (s *Server) ReceiveJob(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(64 << 20)
 
@@ -85,7 +89,7 @@ func (s *Server) ReceiveJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.ValidateMaterial(job.Material)
+	err = utils.ValidateMaterial(job.Material, s.materials)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -119,7 +123,8 @@ func (s *Server) ReceiveJob(w http.ResponseWriter, r *http.Request) {
 
 	defer localFile.Close()
 
-	_, err = io.Copy(localFile, file)
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(localFile, hash), file)
 
 	if err != nil {
 		fmt.Printf("Error while saving the file: %v\n", err)
@@ -127,6 +132,13 @@ func (s *Server) ReceiveJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if job.SHA256 != "" && !strings.EqualFold(job.SHA256, hex.EncodeToString(hash.Sum(nil))) {
+		fmt.Printf("Checksum mismatch in file %v, discarding it\n", job.FileName)
+		os.Remove(localFile.Name())
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
 	fmt.Printf("Received new job with file %v and material %v\n", job.FileName, job.Material)
 }
 
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"device/pkg/types"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+// jobForm returns the multipart form of a job with a PDF file, as sent by the On-Premise agent, and its Content-Type
+func jobForm(t *testing.T, job types.JobDevice, content string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	jobJSON, _ := json.Marshal(job)
+	_ = writer.WriteField("job", string(jobJSON))
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, job.FileName))
+	header.Set("Content-Type", "application/pdf")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	return body, writer.FormDataContentType()
+}
+
+func TestReceiveJob(t *testing.T) {
+	// received files are saved in the receivedFiles folder of the working directory
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	_ = os.Mkdir(dir+"/receivedFiles", 0755)
+	_ = os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	s := newUploadsTestServer(t, dir)
+
+	var tc = []struct {
+		checksum   string
+		statusCode int
+		received   bool
+		testName   string
+	}{
+		{checksum(pdfContent), http.StatusOK, true, "Matching checksum"},
+		{strings.ToUpper(checksum(pdfContent)), http.StatusOK, true, "Matching checksum in upper case"},
+		{"", http.StatusOK, true, "Job without checksum"},
+		{checksum("another file"), http.StatusUnprocessableEntity, false, "Checksum mismatch"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			fileName := fmt.Sprintf("job%v.pdf", i)
+			body, contentType := jobForm(t, types.JobDevice{FileName: fileName, Material: "HR PA 12", SHA256: tt.checksum}, pdfContent)
+
+			req := httptest.NewRequest("POST", "/job", body)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Code)
+			}
+
+			received, err := os.ReadFile("receivedFiles/" + fileName)
+			if (err == nil) != tt.received || (tt.received && string(received) != pdfContent) {
+				t.Errorf("Expected the file to be received: %v, got %q and error %v", tt.received, received, err)
+			}
+		})
+	}
+}
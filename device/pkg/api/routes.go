@@ -5,5 +5,9 @@ func (s *Server) Routes() {
 	s.router.HandleFunc("/jobs", s.Jobs).Methods("GET")
 	s.router.HandleFunc("/identification", s.Identification).Methods("GET")
 	s.router.HandleFunc("/job", s.ReceiveJob).Methods("POST")
+	s.router.HandleFunc("/uploads", s.StartUpload).Methods("POST")
+	s.router.HandleFunc("/uploads/{uploadID}", s.UploadStatus).Methods("GET")
+	s.router.HandleFunc("/uploads/{uploadID}", s.UploadChunk).Methods("PUT")
+	s.router.HandleFunc("/uploads/{uploadID}/complete", s.CompleteUpload).Methods("POST")
 	s.router.HandleFunc("/heartbeat", s.Heartbeat).Methods("POST")
 }
@@ -1,26 +1,93 @@
 package api
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// uploadsExpiryInterval is the time between the checks of the chunked uploads that expired
+const uploadsExpiryInterval = 10 * time.Minute
+
 // Server is the struct used to set up the device API
+// It contains the router, the chunked uploads in progress and the materials accepted in jobs
 type Server struct {
-	router *mux.Router
+	router    *mux.Router
+	uploads   *uploadStore
+	materials []string
 }
 
-// NewServer creates and returns the reference to a new Server struct
-func NewServer(router *mux.Router) *Server {
+// DefaultMaterials contains the materials accepted by the device if no others are configured
+var DefaultMaterials = []string{"HR PA 11", "HR PA 12", "HR PA 12GB", "HR PP", "HR TPA"}
+
+// NewServer creates and returns the reference to a new Server struct that accepts jobs with the received materials
+// Chunked uploads left in progress by a previous execution are kept so that they can be resumed,
+// until they are not updated for longer than uploadTTL, if it is not 0
+// It panics if no material is received
+func NewServer(router *mux.Router, materials []string, uploadTTL time.Duration) *Server {
+	if len(materials) == 0 {
+		panic("The device has to accept at least one material")
+	}
+
 	s := &Server{
-		router: router,
+		router:    router,
+		uploads:   newUploadStore(UploadsDir, uploadTTL),
+		materials: materials,
 	}
 	return s
 }
 
-// ListenAndServe makes the server router listen so that the API endpoints are available
-func (s *Server) ListenAndServe() {
-	log.Fatal(http.ListenAndServe(":55555", s.router))
+// ListenAndServe makes the server router listen so that the API endpoints are available until ctx is cancelled.
+// Then it stops accepting requests and waits up to shutdownTimeout for the ones being handled
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (s *Server) ListenAndServe(ctx context.Context, shutdownTimeout time.Duration) error {
+	httpServer := &http.Server{
+		Addr:    ":55555",
+		Handler: s.router,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	go s.expireUploads(ctx)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("error while serving the API: %w", err)
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down, waiting for requests being handled...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("error while shutting down the server: %w", err)
+	}
+
+	return nil
+}
+
+// expireUploads discards the chunked uploads that expired, including the ones left by a previous execution,
+// every uploadsExpiryInterval until ctx is cancelled
+func (s *Server) expireUploads(ctx context.Context) {
+	ticker := time.NewTicker(uploadsExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		s.uploads.expire(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
@@ -0,0 +1,429 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"device/pkg/types"
+	"device/pkg/utils"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// UploadsDir is the directory where chunked uploads are kept until they are completed.
+// Every upload has a <uploadID>.json file with its information and a <uploadID>.part file with the bytes committed so far
+const UploadsDir = "./receivedFiles/.uploads"
+
+// upload represents a chunked upload. Its mutex serializes the requests received for it.
+// updated is the last time the upload was started or received a chunk
+type upload struct {
+	mu      sync.Mutex
+	id      string
+	info    types.UploadDevice
+	offset  int64
+	done    bool
+	updated time.Time
+}
+
+// uploadStore keeps the chunked uploads in progress, which are saved in a directory so that they survive restarts.
+// Uploads not updated for longer than ttl are discarded by expire, unless ttl is 0
+type uploadStore struct {
+	mu      sync.Mutex
+	dir     string
+	ttl     time.Duration
+	uploads map[string]*upload
+}
+
+// newUploadStore creates and returns the reference to a new uploadStore with the uploads saved in the received directory,
+// which is created if it does not exist, that expire after the received ttl
+func newUploadStore(dir string, ttl time.Duration) *uploadStore {
+	store := &uploadStore{
+		dir:     dir,
+		ttl:     ttl,
+		uploads: make(map[string]*upload),
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		fmt.Printf("Error while creating the uploads directory: %v\n", err)
+		return store
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return store
+	}
+
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		u := &upload{id: id}
+		err = json.Unmarshal(data, &u.info)
+		if err != nil {
+			continue
+		}
+
+		// the committed offset is the size of the part file, which is only written by chunk requests
+		info, err := os.Stat(store.partPath(id))
+		if err == nil {
+			u.offset = info.Size()
+			u.updated = info.ModTime()
+		}
+
+		store.uploads[id] = u
+	}
+
+	return store
+}
+
+func (store *uploadStore) partPath(id string) string {
+	return filepath.Join(store.dir, id+".part")
+}
+
+func (store *uploadStore) infoPath(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// start returns the upload in progress with the same key, size and file name as the received one, or a new one otherwise
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func (store *uploadStore) start(info types.UploadDevice) (*upload, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if info.Key != "" {
+		for _, u := range store.uploads {
+			if u.info == info {
+				return u, nil
+			}
+		}
+	}
+
+	idBytes := make([]byte, 16)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating the upload ID: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("error while saving the upload: %w", err)
+	}
+
+	err = os.WriteFile(store.partPath(id), nil, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error while saving the upload: %w", err)
+	}
+
+	err = os.WriteFile(store.infoPath(id), data, 0644)
+	if err != nil {
+		os.Remove(store.partPath(id))
+		return nil, fmt.Errorf("error while saving the upload: %w", err)
+	}
+
+	u := &upload{id: id, info: info, updated: time.Now()}
+	store.uploads[id] = u
+	return u, nil
+}
+
+// expire discards the uploads not updated for longer than the ttl of the store before the received time,
+// and the files of the directory older than it that do not belong to any upload, such as the part file
+// of an upload whose information could not be saved. It does nothing if the ttl is 0
+func (store *uploadStore) expire(now time.Time) {
+	if store.ttl <= 0 {
+		return
+	}
+	before := now.Add(-store.ttl)
+
+	store.mu.Lock()
+	expired := []*upload{}
+	for _, u := range store.uploads {
+		expired = append(expired, u)
+	}
+
+	files, err := os.ReadDir(store.dir)
+	if err != nil {
+		fmt.Printf("Error while reading the uploads directory: %v\n", err)
+	}
+	for _, file := range files {
+		id := strings.TrimSuffix(strings.TrimSuffix(file.Name(), ".json"), ".part")
+		info, err := file.Info()
+		if _, ok := store.uploads[id]; ok || err != nil || info.ModTime().After(before) {
+			continue
+		}
+
+		fmt.Printf("Removing stale upload file %v\n", file.Name())
+		os.Remove(filepath.Join(store.dir, file.Name()))
+	}
+	store.mu.Unlock()
+
+	// the uploads are checked once their requests finish
+	for _, u := range expired {
+		u.mu.Lock()
+		if !u.done && u.updated.Before(before) {
+			fmt.Printf("Upload %v of file %v expired at offset %v of %v\n", u.id, u.info.FileName, u.offset, u.info.Size)
+			store.remove(u)
+		}
+		u.mu.Unlock()
+	}
+}
+
+// get returns the upload with the received ID, or nil if it does not exist
+func (store *uploadStore) get(id string) *upload {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.uploads[id]
+}
+
+// remove discards the received upload, which must be locked
+func (store *uploadStore) remove(u *upload) {
+	store.mu.Lock()
+	delete(store.uploads, u.id)
+	store.mu.Unlock()
+
+	u.done = true
+	os.Remove(store.partPath(u.id))
+	os.Remove(store.infoPath(u.id))
+}
+
+func (u *upload) status() types.UploadStatus {
+	return types.UploadStatus{
+		UploadID: u.id,
+		Offset:   u.offset,
+		Size:     u.info.Size,
+	}
+}
+
+func writeStatus(w http.ResponseWriter, statusCode int, status types.UploadStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		fmt.Printf("Error while writing the upload status: %v\n", err)
+	}
+}
+
+// StartUpload is the handler used with POST /uploads endpoint
+// It receives the information of a job whose file will be sent in chunks and returns the status of its upload.
+// If an upload with the same key, file and size is in progress, it is returned so that it can be resumed
+// It will return status code 200, 400, 500 or 503 if the upload was discarded while it was resumed as appropiate
+func (s *Server) StartUpload(w http.ResponseWriter, r *http.Request) {
+	var info types.UploadDevice
+	err := json.NewDecoder(r.Body).Decode(&info)
+	if err != nil {
+		fmt.Println("Error while reading request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if info.FileName == "" || info.Material == "" || info.Size < 0 || filepath.Base(info.FileName) != info.FileName {
+		fmt.Println("Missing or invalid field")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = utils.ValidateMaterial(info.Material, s.materials)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := s.uploads.start(info)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// the upload in progress can expire or be completed before it is locked, then it has to be started again
+	if u.done {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	u.updated = time.Now()
+
+	fmt.Printf("Upload %v of file %v at offset %v of %v\n", u.id, info.FileName, u.offset, info.Size)
+	writeStatus(w, http.StatusOK, u.status())
+}
+
+// UploadStatus is the handler used with GET /uploads/{uploadID} endpoint
+// It returns the number of bytes of the upload committed so far
+// It will return status code 200 or 404 as appropiate
+func (s *Server) UploadStatus(w http.ResponseWriter, r *http.Request) {
+	u := s.uploads.get(mux.Vars(r)["uploadID"])
+	if u == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	writeStatus(w, http.StatusOK, u.status())
+}
+
+// UploadChunk is the handler used with PUT /uploads/{uploadID}?offset=N endpoint
+// It appends the request body to the upload, which must have exactly N bytes committed, and returns its status.
+// Bytes received before the connection is interrupted are kept, so the upload can be resumed from them
+// It will return status code 200, 400, 404, 409 with the status of the upload if the offset is not the committed one, or 500 as appropiate
+func (s *Server) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	u := s.uploads.get(mux.Vars(r)["uploadID"])
+	if u == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.done {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if offset != u.offset {
+		writeStatus(w, http.StatusConflict, u.status())
+		return
+	}
+
+	part, err := os.OpenFile(s.uploads.partPath(u.id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Printf("Error while opening the upload: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer part.Close()
+
+	// one more byte than remaining is read to detect chunks going beyond the size of the file
+	remaining := u.info.Size - u.offset
+	written, copyErr := io.Copy(part, io.LimitReader(r.Body, remaining+1))
+	if written > remaining {
+		written = remaining
+		copyErr = errors.New("chunk exceeds the size of the file")
+		part.Truncate(u.info.Size)
+	}
+
+	err = part.Sync()
+	if err != nil {
+		fmt.Printf("Error while saving the upload: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	u.offset += written
+	u.updated = time.Now()
+
+	if copyErr != nil {
+		fmt.Printf("Error while receiving chunk of upload %v: %v\n", u.id, copyErr)
+		writeStatus(w, http.StatusBadRequest, u.status())
+		return
+	}
+
+	writeStatus(w, http.StatusOK, u.status())
+}
+
+// CompleteUpload is the handler used with POST /uploads/{uploadID}/complete endpoint
+// It receives the SHA-256 of the file and, if it matches the received bytes, validates the file and saves it in the
+// /receivedFiles folder as a new job. Uploads whose checksum does not match are discarded, so they must be started again
+// It will return status code 200, 400, 404, 409 with the status of the upload if it is not complete, 422 or 500 as appropiate
+func (s *Server) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	u := s.uploads.get(mux.Vars(r)["uploadID"])
+	if u == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var complete types.UploadComplete
+	err := json.NewDecoder(r.Body).Decode(&complete)
+	if err != nil || complete.SHA256 == "" {
+		fmt.Println("Error while reading request body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.done {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if u.offset != u.info.Size {
+		writeStatus(w, http.StatusConflict, u.status())
+		return
+	}
+
+	file, err := os.Open(s.uploads.partPath(u.id))
+	if err != nil {
+		fmt.Printf("Error while opening the upload: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		fmt.Printf("Error while reading the upload: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), complete.SHA256) {
+		fmt.Printf("Checksum mismatch in upload %v, discarding it\n", u.id)
+		s.uploads.remove(u)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = utils.ValidateFile(file, u.info.FileName, u.info.ContentType)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		s.uploads.remove(u)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = os.Rename(s.uploads.partPath(u.id), filepath.Join(filepath.Dir(s.uploads.dir), u.info.FileName))
+	if err != nil {
+		fmt.Printf("Error while saving the file: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s.uploads.remove(u)
+
+	fmt.Printf("Received new job with file %v and material %v\n", u.info.FileName, u.info.Material)
+}
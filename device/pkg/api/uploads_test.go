@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"device/pkg/types"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const pdfContent = "%PDF-1.4 a job that is sent in chunks"
+
+// newUploadsTestServer returns a Server whose uploads are kept in a temporary directory, with their received files
+func newUploadsTestServer(t *testing.T, dir string) *Server {
+	t.Helper()
+
+	s := &Server{
+		router:    mux.NewRouter(),
+		uploads:   newUploadStore(filepath.Join(dir, ".uploads"), time.Hour),
+		materials: DefaultMaterials,
+	}
+	s.Routes()
+	return s
+}
+
+func doUploadRequest(s *Server, method string, url string, body io.Reader) (*httptest.ResponseRecorder, types.UploadStatus) {
+	req := httptest.NewRequest(method, url, body)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	var status types.UploadStatus
+	_ = json.Unmarshal(w.Body.Bytes(), &status)
+	return w, status
+}
+
+func startUpload(t *testing.T, s *Server, key string) types.UploadStatus {
+	t.Helper()
+
+	info, _ := json.Marshal(types.UploadDevice{Key: key, FileName: "part.pdf", Material: "HR PA 12", ContentType: "application/pdf", Size: int64(len(pdfContent))})
+	w, status := doUploadRequest(s, "POST", "/uploads", bytes.NewReader(info))
+	if w.Code != http.StatusOK || status.UploadID == "" {
+		t.Fatalf("Expected the upload to start, got code %v and status %+v", w.Code, status)
+	}
+	return status
+}
+
+func checksum(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+// failingReader returns the error once its data is read, as a connection interrupted in the middle of a chunk
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+func TestUploadChunks(t *testing.T) {
+	s := newUploadsTestServer(t, t.TempDir())
+	status := startUpload(t, s, "message")
+	url := "/uploads/" + status.UploadID
+
+	var tc = []struct {
+		offset     int64
+		body       io.Reader
+		statusCode int
+		committed  int64
+		testName   string
+	}{
+		{5, bytes.NewReader([]byte(pdfContent[5:10])), http.StatusConflict, 0, "Offset not committed yet"},
+		{0, bytes.NewReader([]byte(pdfContent[:10])), http.StatusOK, 10, "First chunk"},
+		{0, bytes.NewReader([]byte(pdfContent[:10])), http.StatusConflict, 10, "Duplicated chunk"},
+		{10, &failingReader{bytes.NewReader([]byte(pdfContent[10:15]))}, http.StatusBadRequest, 15, "Interrupted chunk"},
+		{15, bytes.NewReader([]byte(pdfContent[15:] + "extra")), http.StatusBadRequest, int64(len(pdfContent)), "Chunk bigger than the file"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			w, status := doUploadRequest(s, "PUT", fmt.Sprintf("%s?offset=%d", url, tt.offset), tt.body)
+			if w.Code != tt.statusCode || status.Offset != tt.committed {
+				t.Errorf("Expected code %v and offset %v, got %v and %+v", tt.statusCode, tt.committed, w.Code, status)
+			}
+		})
+	}
+
+	w, _ := doUploadRequest(s, "PUT", "/uploads/unknown?offset=0", bytes.NewReader([]byte(pdfContent)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected code %v sending a chunk of an unknown upload, got %v", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	dir := t.TempDir()
+	s := newUploadsTestServer(t, dir)
+	status := startUpload(t, s, "message")
+
+	doUploadRequest(s, "PUT", "/uploads/"+status.UploadID+"?offset=0", bytes.NewReader([]byte(pdfContent[:12])))
+
+	// after a restart, starting the upload of the same job resumes it from the bytes committed
+	s = newUploadsTestServer(t, dir)
+	resumed := startUpload(t, s, "message")
+	if resumed.UploadID != status.UploadID || resumed.Offset != 12 {
+		t.Fatalf("Expected upload %v to be resumed at offset 12, got %+v", status.UploadID, resumed)
+	}
+
+	other := startUpload(t, s, "other message")
+	if other.UploadID == status.UploadID || other.Offset != 0 {
+		t.Errorf("Expected a new upload for another job, got %+v", other)
+	}
+
+	w, status := doUploadRequest(s, "GET", "/uploads/"+resumed.UploadID, nil)
+	if w.Code != http.StatusOK || status.Offset != 12 || status.Size != int64(len(pdfContent)) {
+		t.Errorf("Unexpected status %+v with code %v", status, w.Code)
+	}
+}
+
+func TestCompleteUpload(t *testing.T) {
+	var tc = []struct {
+		sent       string
+		checksum   string
+		statusCode int
+		received   bool
+		testName   string
+	}{
+		{pdfContent[:12], checksum(pdfContent), http.StatusConflict, false, "Incomplete upload"},
+		{pdfContent, checksum("another file"), http.StatusUnprocessableEntity, false, "Checksum mismatch"},
+		{pdfContent, checksum(pdfContent), http.StatusOK, true, "Matching checksum"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			dir := t.TempDir()
+			s := newUploadsTestServer(t, dir)
+			status := startUpload(t, s, "message")
+			url := "/uploads/" + status.UploadID
+
+			doUploadRequest(s, "PUT", url+"?offset=0", bytes.NewReader([]byte(tt.sent)))
+
+			complete, _ := json.Marshal(types.UploadComplete{SHA256: tt.checksum})
+			w, _ := doUploadRequest(s, "POST", url+"/complete", bytes.NewReader(complete))
+			if w.Code != tt.statusCode {
+				t.Fatalf("Expected code %v, got %v", tt.statusCode, w.Code)
+			}
+
+			received, err := os.ReadFile(filepath.Join(dir, "part.pdf"))
+			if (err == nil) != tt.received || (tt.received && string(received) != pdfContent) {
+				t.Errorf("Expected the file to be received: %v, got %q and error %v", tt.received, received, err)
+			}
+
+			// completed and discarded uploads cannot be resumed
+			w, _ = doUploadRequest(s, "GET", url, nil)
+			if discarded := w.Code == http.StatusNotFound; discarded != (tt.statusCode != http.StatusConflict) {
+				t.Errorf("Unexpected code %v getting the upload", w.Code)
+			}
+		})
+	}
+}
+
+func TestExpireUploads(t *testing.T) {
+	dir := t.TempDir()
+	s := newUploadsTestServer(t, dir)
+	uploadsDir := filepath.Join(dir, ".uploads")
+
+	stale := startUpload(t, s, "stale")
+	active := startUpload(t, s, "active")
+
+	// the part file of an upload whose information was not saved
+	orphan := filepath.Join(uploadsDir, "orphan.part")
+	_ = os.WriteFile(orphan, []byte("data"), 0644)
+
+	now := time.Now().Add(2 * time.Hour)
+	_ = os.Chtimes(orphan, now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	s.uploads.get(stale.UploadID).updated = now.Add(-3 * time.Hour)
+	s.uploads.get(active.UploadID).updated = now.Add(-time.Minute)
+
+	s.uploads.expire(now)
+
+	if s.uploads.get(stale.UploadID) != nil || s.uploads.get(active.UploadID) == nil {
+		t.Errorf("Expected only the stale upload to expire")
+	}
+
+	for name, exists := range map[string]bool{
+		orphan: false,
+		filepath.Join(uploadsDir, stale.UploadID+".part"):  false,
+		filepath.Join(uploadsDir, stale.UploadID+".json"):  false,
+		filepath.Join(uploadsDir, active.UploadID+".part"): true,
+		filepath.Join(uploadsDir, active.UploadID+".json"): true,
+	} {
+		if _, err := os.Stat(name); (err == nil) != exists {
+			t.Errorf("Expected %v to exist: %v", filepath.Base(name), exists)
+		}
+	}
+
+	// a ttl of 0 keeps the uploads until they are completed
+	s.uploads.ttl = 0
+	s.uploads.expire(now.Add(24 * time.Hour))
+	if s.uploads.get(active.UploadID) == nil {
+		t.Errorf("Expected uploads not to expire without ttl")
+	}
+}
@@ -2,7 +2,32 @@ package types
 
 // JobDevice defines the struct that the JSON information received
 // by the POST /job endpoint should receive.
+// SHA256 is the hex encoded checksum of the file, which is verified if present
 type JobDevice struct {
 	FileName string `json:"filename"`
 	Material string `json:"material"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// UploadDevice defines the struct that the JSON information received by the POST /uploads endpoint should receive
+// to start a chunked job upload. Key identifies the job in the agent, so that starting it again resumes the same upload
+type UploadDevice struct {
+	Key         string `json:"key"`
+	FileName    string `json:"filename"`
+	Material    string `json:"material"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// UploadStatus defines the struct returned by the chunked upload endpoints with the number of bytes committed so far
+type UploadStatus struct {
+	UploadID string `json:"uploadID"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+}
+
+// UploadComplete defines the struct that the JSON information received by the POST /uploads/{uploadID}/complete endpoint
+// should receive, with the hex encoded SHA-256 of the whole file
+type UploadComplete struct {
+	SHA256 string `json:"sha256"`
 }
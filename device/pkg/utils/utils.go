@@ -3,39 +3,32 @@ package utils
 import (
 	"errors"
 	"io"
+	"mesh"
 	"path/filepath"
-
-	"github.com/hschendel/stl"
 )
 
-// ValidateMaterial checks that the provided material is one of the valids one
+// ValidateMaterial checks that the provided material is one of the accepted ones
 // Returns nil if valid and a non-nil error otherwise
-func ValidateMaterial(material string) error {
-	switch material {
-	case "HR PA 11", "HR PA 12GB", "HR TPA", "HR PP", "HR PA 12":
-		return nil
-	default:
-		return errors.New("invalid material received")
+func ValidateMaterial(material string, accepted []string) error {
+	for _, valid := range accepted {
+		if material == valid {
+			return nil
+		}
 	}
+	return errors.New("invalid material received")
 }
 
 // ValidateFile checks whether the provided file is valid or not
-// Returns nil if file is a valid .pdf or .stl file and an non-nil error otherwise
+// Returns nil if file is a valid .pdf file, or a valid .stl, .3mf, .obj or .zip file of meshes, and an non-nil error otherwise
 func ValidateFile(file io.ReadSeeker, FileName string, MIMEType string) error {
 
-	switch filepath.Ext(FileName) {
-	case ".pdf":
+	if filepath.Ext(FileName) == ".pdf" {
 		if MIMEType == "application/pdf" {
 			return nil
 		}
-	case ".stl":
-		_, err := stl.ReadAll(file)
-		if err != nil {
-			return err
-		}
-		// need to set the reader back to the start of the file
-		_, err = file.Seek(0, 0)
-		return err
+	} else if mesh.Supported(FileName) {
+		// the reader is set back to the start of the file once it is read
+		return mesh.Read(file, FileName, func(string, mesh.Triangle) {})
 	}
 
 	return errors.New("invalid file received")
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidateMaterial(t *testing.T) {
+	accepted := []string{"HR PA 12", "HR TPA"}
+
+	var tc = []struct {
+		material string
+		accepted []string
+		valid    bool
+		testName string
+	}{
+		{"HR PA 12", accepted, true, "Accepted material"},
+		{"HR TPA", accepted, true, "Last accepted material"},
+		{"HR PP", accepted, false, "Material not accepted"},
+		{"hr pa 12", accepted, false, "Material with different case"},
+		{" HR PA 12", accepted, false, "Material with spaces"},
+		{"", accepted, false, "Empty material"},
+		{"HR PA 12", []string{}, false, "No accepted materials"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			err := ValidateMaterial(tt.material, tt.accepted)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected %q to be valid: %v, got error %v", tt.material, tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+module mesh
+
+go 1.17
+
+require github.com/hschendel/stl v1.0.4
@@ -0,0 +1,155 @@
+package mesh
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hschendel/stl"
+)
+
+// Vec3 is a point or vector in millimeters, the same type used by package stl
+type Vec3 = stl.Vec3
+
+// Triangle is a triangle of a mesh, the same type used by package stl.
+// Its Normal is only set for triangles read from STL files
+type Triangle = stl.Triangle
+
+// VisitFunc is called with every triangle read from a job file and the name of the part it belongs to:
+// the name of the file, of the object in 3MF and OBJ files, or of the entry in ZIP archives
+type VisitFunc func(part string, t Triangle)
+
+// maxArchiveSize is the maximum number of bytes decompressed from a ZIP or 3MF archive,
+// so that small archives cannot exhaust the disk or the memory when they are read
+const maxArchiveSize = 8 << 30
+
+// ErrUnsupported is returned when the format of a file is not supported
+var ErrUnsupported = errors.New("unsupported file format")
+
+// errNoTriangles is returned when a file is valid but it does not contain any triangle
+var errNoTriangles = errors.New("the file does not contain any triangle")
+
+// readers contains the function used to read every supported mesh format, by file extension.
+// ZIP archives are not included, as they can only contain meshes and not other archives
+var readers = map[string]func(io.ReadSeeker, string, VisitFunc) error{
+	".stl": readSTL,
+	".obj": readOBJ,
+	".3mf": read3MF,
+}
+
+// Supported returns whether a file with the received name has the extension of a mesh
+// or a ZIP archive of meshes that can be read
+func Supported(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	_, ok := readers[ext]
+	return ok || ext == ".zip"
+}
+
+// Read reads the meshes of the received file, whose format is given by the extension of its name,
+// calling visit with every triangle, and sets the reader back to the start of the file.
+// It fails if the file is not valid or it does not contain any triangle
+// Returns a non-nil error if there's one during the execution and nil otherwise
+func Read(file io.ReadSeeker, name string, visit VisitFunc) error {
+	triangles := 0
+	count := func(part string, t Triangle) {
+		triangles++
+		visit(part, t)
+	}
+
+	var err error
+	if strings.ToLower(filepath.Ext(name)) == ".zip" {
+		err = readZIP(file, count)
+	} else {
+		err = read(file, name, count)
+	}
+
+	if err == nil && triangles == 0 {
+		err = errNoTriangles
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading %v: %w", name, err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
+
+func read(file io.ReadSeeker, name string, visit VisitFunc) error {
+	reader, ok := readers[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return ErrUnsupported
+	}
+
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return reader(file, name, visit)
+}
+
+// stlWriter implements stl.Writer passing the triangles read to a VisitFunc, so that they are not kept in memory
+type stlWriter struct {
+	part  string
+	visit VisitFunc
+}
+
+func (w *stlWriter) SetName(name string)           {}
+func (w *stlWriter) SetBinaryHeader(header []byte) {}
+func (w *stlWriter) SetASCII(isASCII bool)         {}
+func (w *stlWriter) SetTriangleCount(n uint32)     {}
+
+func (w *stlWriter) AppendTriangle(t Triangle) {
+	w.visit(w.part, t)
+}
+
+// readSTL reads an ASCII or binary STL file
+func readSTL(file io.ReadSeeker, name string, visit VisitFunc) error {
+	return stl.CopyAll(file, &stlWriter{part: name, visit: visit})
+}
+
+// openArchive opens the received file as a ZIP archive
+func openArchive(file io.ReadSeeker) (*zip.Reader, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		readerAt = &seekerReaderAt{file}
+	}
+
+	return zip.NewReader(readerAt, size)
+}
+
+// seekerReaderAt implements io.ReaderAt for readers that can only seek. It is not safe for concurrent use
+type seekerReaderAt struct {
+	io.ReadSeeker
+}
+
+func (r *seekerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	_, err := r.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r, p)
+}
+
+// limitedReader reads an entry of an archive, adding the bytes read to the ones decompressed from the whole archive,
+// and fails once they are more than maxArchiveSize
+type limitedReader struct {
+	reader       io.Reader
+	decompressed *int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	*r.decompressed += int64(n)
+	if *r.decompressed > maxArchiveSize {
+		return n, fmt.Errorf("the archive is bigger than %v bytes once decompressed", int64(maxArchiveSize))
+	}
+	return n, err
+}
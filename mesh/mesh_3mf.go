@@ -0,0 +1,424 @@
+package mesh
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// modelRelationshipType is the type of the relationship that points to the root model of a 3MF package
+	modelRelationshipType = "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+	// defaultModelPath is the usual path of the root model, used if the package has no relationships
+	defaultModelPath = "/3D/3dmodel.model"
+	// maxComponentDepth is the maximum depth of nested components
+	maxComponentDepth = 32
+	// maxObjectInstances and maxInstanceTriangles are the maximum number of objects placed in the build, by the build
+	// items and their components, and of triangles visited in all of them, as every level of components can multiply
+	// the objects placed by the previous ones
+	maxObjectInstances   = 100000
+	maxInstanceTriangles = 100 << 20
+)
+
+// unitScales contains the millimeters of every unit that can be used in 3MF models
+var unitScales = map[string]float64{
+	"micron":     0.001,
+	"millimeter": 1,
+	"centimeter": 10,
+	"inch":       25.4,
+	"foot":       304.8,
+	"meter":      1000,
+}
+
+// matrix is a 3MF transform, a 4x3 matrix "m00 m01 m02 m10 m11 m12 m20 m21 m22 m30 m31 m32"
+// that transforms points represented as row vectors, so its last row is the translation
+type matrix [12]float64
+
+var identity = matrix{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0}
+
+// parseMatrix parses the received transform, which is the identity if it is empty
+func parseMatrix(value string) (matrix, error) {
+	if value == "" {
+		return identity, nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 12 {
+		return identity, fmt.Errorf("invalid transform %q", value)
+	}
+
+	var m matrix
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return identity, fmt.Errorf("invalid transform %q", value)
+		}
+		m[i] = f
+	}
+	return m, nil
+}
+
+// then returns the transform that applies m and then next
+func (m matrix) then(next matrix) matrix {
+	var r matrix
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i*3+j] += m[i*3+k] * next[k*3+j]
+			}
+		}
+	}
+	for j := 0; j < 3; j++ {
+		r[9+j] += next[9+j]
+	}
+	return r
+}
+
+func (m matrix) apply(v Vec3) Vec3 {
+	x, y, z := float64(v[0]), float64(v[1]), float64(v[2])
+	return Vec3{
+		float32(x*m[0] + y*m[3] + z*m[6] + m[9]),
+		float32(x*m[1] + y*m[4] + z*m[7] + m[10]),
+		float32(x*m[2] + y*m[5] + z*m[8] + m[11]),
+	}
+}
+
+// reference is a build item or a component, which places an object, possibly of another model part, with a transform
+type reference struct {
+	path      string
+	objectID  string
+	transform matrix
+}
+
+type object struct {
+	name       string
+	vertices   []Vec3
+	triangles  [][3]int
+	components []reference
+}
+
+// model is a 3MF model part, with its objects by ID and its build items
+type model struct {
+	scale   float64
+	objects map[string]*object
+	items   []reference
+}
+
+// threeMF reads the model parts of a 3MF package, which are parsed once they are referenced
+type threeMF struct {
+	archive      *zip.Reader
+	models       map[string]*model
+	decompressed int64
+	// instances and triangles are the objects placed in the build and their triangles visited so far
+	instances int
+	triangles int64
+	// visiting contains the objects being visited, which cannot be components of themselves
+	visiting map[reference]bool
+}
+
+// read3MF reads a 3MF package: a ZIP archive whose root model contains the objects, with their meshes and
+// components, and the build items, which place the objects to print. The triangles of every build item are
+// transformed to their position in the build, in millimeters, and belong to a part with the name of the object
+func read3MF(file io.ReadSeeker, name string, visit VisitFunc) error {
+	archive, err := openArchive(file)
+	if err != nil {
+		return err
+	}
+
+	pkg := &threeMF{archive: archive, models: make(map[string]*model), visiting: make(map[reference]bool)}
+
+	rootPath, err := pkg.rootModelPath()
+	if err != nil {
+		return err
+	}
+
+	root, err := pkg.model(rootPath)
+	if err != nil {
+		return err
+	}
+
+	if len(root.items) == 0 {
+		return errors.New("the model does not have build items")
+	}
+
+	// the unit of the root model is used by all the model parts
+	toMillimeters := matrix{root.scale, 0, 0, 0, root.scale, 0, 0, 0, root.scale, 0, 0, 0}
+
+	for _, item := range root.items {
+		if item.path == "" {
+			item.path = rootPath
+		}
+
+		err = pkg.visitObject(item, toMillimeters, 0, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open returns a reader of the file with the received path in the package, which counts the bytes decompressed
+func (pkg *threeMF) open(name string) (io.ReadCloser, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, f := range pkg.archive.File {
+		if strings.EqualFold(f.Name, name) {
+			reader, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{&limitedReader{reader: reader, decompressed: &pkg.decompressed}, reader}, nil
+		}
+	}
+	return nil, fmt.Errorf("%v not found in the package", name)
+}
+
+// rootModelPath returns the path of the root model, read from the package relationships
+func (pkg *threeMF) rootModelPath() (string, error) {
+	reader, err := pkg.open("_rels/.rels")
+	if err != nil {
+		return defaultModelPath, nil
+	}
+	defer reader.Close()
+
+	var relationships struct {
+		Relationship []struct {
+			Target string `xml:"Target,attr"`
+			Type   string `xml:"Type,attr"`
+		}
+	}
+
+	err = xml.NewDecoder(reader).Decode(&relationships)
+	if err != nil {
+		return "", fmt.Errorf("invalid package relationships: %w", err)
+	}
+
+	for _, relationship := range relationships.Relationship {
+		if relationship.Type == modelRelationshipType {
+			return relationship.Target, nil
+		}
+	}
+	return "", errors.New("the package does not have a model")
+}
+
+// model returns the model part with the received path, parsing it the first time
+func (pkg *threeMF) model(modelPath string) (*model, error) {
+	if m, ok := pkg.models[modelPath]; ok {
+		return m, nil
+	}
+
+	reader, err := pkg.open(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	m, err := parseModel(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model %v: %w", modelPath, err)
+	}
+
+	pkg.models[modelPath] = m
+	return m, nil
+}
+
+// visitObject visits the triangles of the object and the components of the received reference,
+// applying its transform and then the received one.
+// It fails if the object is one of its own components or if the build places too many objects or triangles
+func (pkg *threeMF) visitObject(ref reference, transform matrix, depth int, visit VisitFunc) error {
+	if depth > maxComponentDepth {
+		return errors.New("too many nested components")
+	}
+
+	m, err := pkg.model(ref.path)
+	if err != nil {
+		return err
+	}
+
+	obj, ok := m.objects[ref.objectID]
+	if !ok {
+		return fmt.Errorf("object %v not found in %v", ref.objectID, ref.path)
+	}
+
+	// objects are identified by their model part and ID, regardless of the transform
+	id := reference{path: ref.path, objectID: ref.objectID}
+	if pkg.visiting[id] {
+		return fmt.Errorf("object %v of %v is a component of itself", ref.objectID, ref.path)
+	}
+
+	pkg.instances++
+	pkg.triangles += int64(len(obj.triangles))
+	if pkg.instances > maxObjectInstances {
+		return fmt.Errorf("the build places more than %v objects", maxObjectInstances)
+	}
+	if pkg.triangles > maxInstanceTriangles {
+		return fmt.Errorf("the build places more than %v triangles", int64(maxInstanceTriangles))
+	}
+
+	pkg.visiting[id] = true
+	defer delete(pkg.visiting, id)
+
+	transform = ref.transform.then(transform)
+
+	for _, t := range obj.triangles {
+		visit(obj.name, Triangle{Vertices: [3]Vec3{
+			transform.apply(obj.vertices[t[0]]),
+			transform.apply(obj.vertices[t[1]]),
+			transform.apply(obj.vertices[t[2]]),
+		}})
+	}
+
+	for _, component := range obj.components {
+		if component.path == "" {
+			component.path = ref.path
+		}
+
+		err = pkg.visitObject(component, transform, depth+1, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseModel parses a 3MF model part, checking that all the triangles reference existing vertices
+func parseModel(reader io.Reader) (*model, error) {
+	m := &model{scale: 1, objects: make(map[string]*object)}
+	decoder := xml.NewDecoder(reader)
+
+	var current *object
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			if end, ok := token.(xml.EndElement); ok && end.Name.Local == "object" {
+				current = nil
+			}
+			continue
+		}
+
+		attrs := attributes(element)
+
+		switch element.Name.Local {
+		case "model":
+			if unit, ok := attrs["unit"]; ok {
+				m.scale, ok = unitScales[unit]
+				if !ok {
+					return nil, fmt.Errorf("unknown unit %q", unit)
+				}
+			}
+		case "object":
+			current = &object{name: attrs["name"]}
+			if current.name == "" {
+				current.name = "object " + attrs["id"]
+			}
+			m.objects[attrs["id"]] = current
+		case "vertex":
+			if current == nil {
+				return nil, errors.New("vertex outside of an object")
+			}
+			vertex, err := parseVertex(attrs)
+			if err != nil {
+				return nil, err
+			}
+			current.vertices = append(current.vertices, vertex)
+		case "triangle":
+			if current == nil {
+				return nil, errors.New("triangle outside of an object")
+			}
+			triangle, err := parseTriangle(attrs)
+			if err != nil {
+				return nil, err
+			}
+			current.triangles = append(current.triangles, triangle)
+		case "component", "item":
+			ref, err := parseReference(attrs)
+			if err != nil {
+				return nil, err
+			}
+			if element.Name.Local == "item" {
+				m.items = append(m.items, ref)
+			} else if current != nil {
+				current.components = append(current.components, ref)
+			}
+		}
+	}
+
+	for id, obj := range m.objects {
+		for _, t := range obj.triangles {
+			for _, v := range t {
+				if v < 0 || v >= len(obj.vertices) {
+					return nil, fmt.Errorf("triangle of object %v references vertex %v, which does not exist", id, v)
+				}
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// attributes returns the attributes of the received element by local name
+func attributes(element xml.StartElement) map[string]string {
+	attrs := make(map[string]string, len(element.Attr))
+	for _, attr := range element.Attr {
+		attrs[attr.Name.Local] = attr.Value
+	}
+	return attrs
+}
+
+func parseVertex(attrs map[string]string) (Vec3, error) {
+	var vertex Vec3
+	for i, name := range []string{"x", "y", "z"} {
+		value, err := strconv.ParseFloat(attrs[name], 32)
+		if err != nil {
+			return vertex, fmt.Errorf("invalid vertex: %w", err)
+		}
+		vertex[i] = float32(value)
+	}
+	return vertex, nil
+}
+
+func parseTriangle(attrs map[string]string) ([3]int, error) {
+	var triangle [3]int
+	for i, name := range []string{"v1", "v2", "v3"} {
+		value, err := strconv.Atoi(attrs[name])
+		if err != nil {
+			return triangle, fmt.Errorf("invalid triangle: %w", err)
+		}
+		triangle[i] = value
+	}
+	return triangle, nil
+}
+
+// parseReference parses a build item or a component. Their path is set if the object is in another model part
+func parseReference(attrs map[string]string) (reference, error) {
+	transform, err := parseMatrix(attrs["transform"])
+	if err != nil {
+		return reference{}, err
+	}
+
+	ref := reference{path: attrs["path"], objectID: attrs["objectid"], transform: transform}
+	if ref.objectID == "" {
+		return reference{}, errors.New("reference without object ID")
+	}
+	if ref.path != "" && !strings.HasPrefix(ref.path, "/") {
+		ref.path = path.Join("/", ref.path)
+	}
+	return ref, nil
+}
@@ -0,0 +1,98 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxOBJLineLength is the length of the longest line accepted in OBJ files
+const maxOBJLineLength = 16 << 20
+
+// readOBJ reads a Wavefront OBJ file. Only the vertices and the faces are used, faces with more than three vertices
+// are split in triangles. Faces can only reference vertices defined before them.
+// The triangles of every object or group belong to a part with its name
+func readOBJ(file io.ReadSeeker, name string, visit VisitFunc) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxOBJLineLength)
+
+	part := name
+	vertices := []Vec3{}
+
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			vertex, err := parseOBJVertex(fields[1:])
+			if err != nil {
+				return fmt.Errorf("invalid vertex in line %v: %w", line, err)
+			}
+			vertices = append(vertices, vertex)
+		case "f":
+			face, err := parseOBJFace(fields[1:], vertices)
+			if err != nil {
+				return fmt.Errorf("invalid face in line %v: %w", line, err)
+			}
+			for i := 1; i+1 < len(face); i++ {
+				visit(part, Triangle{Vertices: [3]Vec3{face[0], face[i], face[i+1]}})
+			}
+		case "o", "g":
+			if len(fields) > 1 {
+				part = strings.Join(fields[1:], " ")
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseOBJVertex parses the coordinates of a vertex, "x y z" followed by an optional weight or color
+func parseOBJVertex(fields []string) (Vec3, error) {
+	var vertex Vec3
+	if len(fields) < 3 {
+		return vertex, fmt.Errorf("expected 3 coordinates, got %v", len(fields))
+	}
+
+	for i := range vertex {
+		value, err := strconv.ParseFloat(fields[i], 32)
+		if err != nil {
+			return vertex, err
+		}
+		vertex[i] = float32(value)
+	}
+
+	return vertex, nil
+}
+
+// parseOBJFace returns the vertices of a face, whose references have the form "v", "v/vt", "v//vn" or "v/vt/vn".
+// Negative references are relative to the last vertex defined
+func parseOBJFace(fields []string, vertices []Vec3) ([]Vec3, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected at least 3 vertices, got %v", len(fields))
+	}
+
+	face := make([]Vec3, 0, len(fields))
+	for _, field := range fields {
+		index, err := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if index < 0 {
+			index += len(vertices) + 1
+		}
+		if index < 1 || index > len(vertices) {
+			return nil, fmt.Errorf("vertex %v is not defined", field)
+		}
+
+		face = append(face, vertices[index-1])
+	}
+
+	return face, nil
+}
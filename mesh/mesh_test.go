@@ -0,0 +1,178 @@
+package mesh
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+const asciiSTL = `solid part
+facet normal 0 0 1
+outer loop
+vertex 0 0 0
+vertex 1 0 0
+vertex 0 1 0
+endloop
+endfacet
+endsolid part
+`
+
+const rels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>`
+
+// model3MF returns a 3MF model in centimeters with a triangle, that is placed twice by an assembly
+// and once more with a translation of 10 cm in X
+func model3MF(triangle string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="centimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+<resources>
+<object id="1" name="bracket" type="model">
+<mesh>
+<vertices><vertex x="0" y="0" z="0"/><vertex x="1" y="0" z="0"/><vertex x="0" y="1" z="0"/></vertices>
+<triangles>` + triangle + `</triangles>
+</mesh>
+</object>
+<object id="2" type="model">
+<components><component objectid="1"/><component objectid="1" transform="1 0 0 0 1 0 0 0 1 0 0 1"/></components>
+</object>
+</resources>
+<build>
+<item objectid="2"/>
+<item objectid="1" transform="1 0 0 0 1 0 0 0 1 10 0 0"/>
+</build>
+</model>`
+}
+
+// nested3MF returns a 3MF model with a triangle and the received number of levels of assemblies,
+// each one placing the previous one twice, and whose first one also places the last one if cyclic is true
+func nested3MF(levels int, cyclic bool) string {
+	objects := `<object id="0" name="triangle" type="model"><mesh>
+<vertices><vertex x="0" y="0" z="0"/><vertex x="1" y="0" z="0"/><vertex x="0" y="1" z="0"/></vertices>
+<triangles><triangle v1="0" v2="1" v3="2"/></triangles>
+</mesh></object>`
+
+	for i := 1; i <= levels; i++ {
+		components := fmt.Sprintf(`<component objectid="%v"/><component objectid="%v"/>`, i-1, i-1)
+		if cyclic && i == 1 {
+			components += fmt.Sprintf(`<component objectid="%v"/>`, levels)
+		}
+		objects += fmt.Sprintf(`<object id="%v" type="model"><components>%v</components></object>`, i, components)
+	}
+
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+<resources>` + objects + `</resources>
+<build><item objectid="` + fmt.Sprint(levels) + `"/></build>
+</model>`
+}
+
+func binarySTL() []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 80))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(1))
+	for _, f := range []float32{0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 2, 0} {
+		_ = binary.Write(&buf, binary.LittleEndian, math.Float32bits(f))
+	}
+	buf.Write([]byte{0, 0})
+	return buf.Bytes()
+}
+
+func zipFiles(files map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		fw, _ := writer.Create(name)
+		_, _ = fw.Write([]byte(content))
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	var tc = []struct {
+		name     string
+		content  []byte
+		parts    map[string]int
+		vertices []Vec3
+		fails    bool
+		testName string
+	}{
+		{"part.stl", []byte(asciiSTL), map[string]int{"part.stl": 1}, []Vec3{{0, 0, 0}}, false, "ASCII STL"},
+		{"part.STL", binarySTL(), map[string]int{"part.STL": 1}, []Vec3{{0, 0, 0}}, false, "Binary STL"},
+		{"part.stl", []byte("solid part\nendsolid part\n"), nil, nil, true, "STL without triangles"},
+		{"part.obj", []byte("# square\no square\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvn 0 0 1\nf 1//1 2//1 3//1 4//1\n"),
+			map[string]int{"square": 2}, []Vec3{{0, 0, 0}, {0, 0, 0}}, false, "OBJ with a quad"},
+		{"part.obj", []byte("v 0 0 0\nv 1 0 0\nv 1 1 0\nf -3/1 -2/2 -1/3\n"), map[string]int{"part.obj": 1}, []Vec3{{0, 0, 0}}, false, "OBJ with relative references"},
+		{"part.obj", []byte("v 0 0 0\nv 1 0 0\nf 1 2 3\n"), nil, nil, true, "OBJ with undefined vertex"},
+		{"part.obj", []byte("v 0 zero 0\n"), nil, nil, true, "OBJ with invalid vertex"},
+		{"part.obj", binarySTL(), nil, nil, true, "Binary file named as OBJ"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels, "3D/3dmodel.model": model3MF(`<triangle v1="0" v2="1" v3="2"/>`)}),
+			map[string]int{"bracket": 3}, []Vec3{{0, 0, 0}, {0, 0, 10}, {100, 0, 0}}, false, "3MF with components and transforms"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels, "3D/3dmodel.model": model3MF(`<triangle v1="0" v2="1" v3="3"/>`)}),
+			nil, nil, true, "3MF with undefined vertex"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels}), nil, nil, true, "3MF without model"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels, "3D/3dmodel.model": nested3MF(3, false)}),
+			map[string]int{"triangle": 8}, nil, false, "3MF placing an assembly several times"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels, "3D/3dmodel.model": nested3MF(3, true)}),
+			nil, nil, true, "3MF with cyclic components"},
+		{"build.3mf", zipFiles(map[string]string{"_rels/.rels": rels, "3D/3dmodel.model": nested3MF(30, false)}),
+			nil, nil, true, "3MF placing too many objects"},
+		{"build.3mf", []byte(asciiSTL), nil, nil, true, "STL named as 3MF"},
+		{"parts.zip", zipFiles(map[string]string{"a.stl": asciiSTL, "b/c.obj": "v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n", "README.txt": "parts"}),
+			map[string]int{"a.stl": 1, "b/c.obj": 1}, nil, false, "ZIP with meshes"},
+		{"parts.zip", zipFiles(map[string]string{"a.stl": asciiSTL, "b.obj": "f 1 2 3\n"}), nil, nil, true, "ZIP with invalid mesh"},
+		{"parts.zip", zipFiles(map[string]string{"README.txt": "parts", "inner.zip": string(zipFiles(map[string]string{"a.stl": asciiSTL}))}),
+			nil, nil, true, "ZIP without meshes"},
+		{"manual.pdf", []byte("%PDF-1.4"), nil, nil, true, "Unsupported format"},
+	}
+
+	for i, tt := range tc {
+		t.Run(fmt.Sprintf("Test %v: %s", i, tt.testName), func(t *testing.T) {
+			parts := map[string]int{}
+			vertices := []Vec3{}
+
+			file := bytes.NewReader(tt.content)
+			err := Read(file, tt.name, func(part string, t Triangle) {
+				parts[part]++
+				vertices = append(vertices, t.Vertices[0])
+			})
+
+			if (err != nil) != tt.fails {
+				t.Fatalf("Expected error: %v, got %v", tt.fails, err)
+			}
+			if tt.fails {
+				return
+			}
+
+			if !reflect.DeepEqual(parts, tt.parts) {
+				t.Errorf("Expected triangles by part %v, got %v", tt.parts, parts)
+			}
+			if tt.vertices != nil && !reflect.DeepEqual(vertices, tt.vertices) {
+				t.Errorf("Expected first vertices %v, got %v", tt.vertices, vertices)
+			}
+			if offset, _ := file.Seek(0, 1); offset != 0 {
+				t.Errorf("Expected the file to be read from the start again, got offset %v", offset)
+			}
+		})
+	}
+
+	err := Read(bytes.NewReader(nil), "manual.pdf", func(string, Triangle) {})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for name, supported := range map[string]bool{"a.stl": true, "a.3MF": true, "a.obj": true, "a.zip": true, "a.pdf": false, "stl": false} {
+		if Supported(name) != supported {
+			t.Errorf("Expected %v to be supported: %v", name, supported)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mesh
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// readZIP reads the meshes of a ZIP archive. Every entry with the extension of a supported mesh format is read,
+// the other entries, such as notes or the metadata added by some archivers, are ignored.
+// The triangles of every entry belong to a part with its name
+func readZIP(file io.ReadSeeker, visit VisitFunc) error {
+	archive, err := openArchive(file)
+	if err != nil {
+		return err
+	}
+
+	var decompressed int64
+	for _, entry := range archive.File {
+		_, ok := readers[strings.ToLower(path.Ext(entry.Name))]
+		if !ok || entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+
+		err = readEntry(entry, &decompressed, visit)
+		if err != nil {
+			return fmt.Errorf("invalid entry %v: %w", entry.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// readEntry decompresses an entry of an archive to a temporary file, as meshes need to be read from seekable files,
+// and reads it
+func readEntry(entry *zip.File, decompressed *int64, visit VisitFunc) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "mesh-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, &limitedReader{reader: reader, decompressed: decompressed})
+	if err != nil {
+		return err
+	}
+
+	return read(tmp, entry.Name, visit)
+}